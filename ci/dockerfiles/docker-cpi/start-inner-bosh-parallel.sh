@@ -17,7 +17,7 @@ deployment_name="bosh-${node_number}"
 BOSH_DEPLOYMENT_PATH="${BOSH_DEPLOYMENT_PATH:-/usr/local/bosh-deployment}"
 BOSH_DIRECTOR_IP="10.245.0.$((10 + node_number))"
 
-inner_bosh_dir="/tmp/inner-bosh/director/${node_number}" # see src/brats/utils/utils.go
+inner_bosh_dir="/tmp/inner-bosh/director/${node_number}" # see src/brats/utils/inner_bosh.go
 mkdir -p "${inner_bosh_dir}"
 
 # shellcheck disable=SC2068
@@ -40,10 +40,10 @@ BOSH_RELEASE="${REPO_ROOT}/src/spec/assets/dummy-release.tgz"
 
 DNS_RELEASE_PATH="$(find "${REPO_PARENT}/bosh-dns-release" -maxdepth 1 -path '*.tgz')"
 
-if [ -d database-metadata ]; then
-  apt-get update
-  apt-get install -y mysql-client postgresql-client
+# Debian installs the postgres binaries outside PATH, one dir per version.
+POSTGRES_BIN_DIR="$(find /usr/lib/postgresql -mindepth 2 -maxdepth 2 -name bin | sort -V | tail -n 1)"
 
+if [ -d database-metadata ]; then
   RDS_MYSQL_EXTERNAL_DB_HOST="$(jq -r .aws_mysql_endpoint database-metadata/metadata | cut -d':' -f1)"
   RDS_POSTGRES_EXTERNAL_DB_HOST="$(jq -r .aws_postgres_endpoint database-metadata/metadata | cut -d':' -f1)"
   GCP_MYSQL_EXTERNAL_DB_HOST="$(jq -r .gcp_mysql_endpoint database-metadata/metadata)"
@@ -77,6 +77,7 @@ brats_env_file="${REPO_PARENT}/brats-env.sh"
 
   echo "export BOSH_RELEASE=\"${BOSH_RELEASE}\""
   echo "export DNS_RELEASE_PATH=\"${DNS_RELEASE_PATH}\""
+  echo "export POSTGRES_BIN_DIR=\"${POSTGRES_BIN_DIR}\""
 
   echo "export RDS_MYSQL_EXTERNAL_DB_HOST=\"${RDS_MYSQL_EXTERNAL_DB_HOST:-}\""
 
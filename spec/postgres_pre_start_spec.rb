@@ -0,0 +1,148 @@
+require 'spec_helper'
+
+RSpec.describe 'postgres job pre-start' do
+  let(:release) { Bosh::Common::Template::Test::ReleaseDir.new(RELEASE_ROOT) }
+  let(:job) { release.job('postgres') }
+  let(:template) { job.template('bin/pre-start') }
+  let(:properties) { { 'postgres' => { 'password' => 'secret' } } }
+
+  let(:tmpdir) { Dir.mktmpdir }
+  let(:bin_dir) { File.join(tmpdir, 'bin') }
+  let(:packages_dir) { File.join(tmpdir, 'packages') }
+  let(:store_dir) { File.join(tmpdir, 'store') }
+  let(:commands_log) { File.join(tmpdir, 'commands.log') }
+  let(:interrupt_marker) { File.join(tmpdir, 'interrupt-upgrade') }
+
+  # The script runs as root against /var/vcap; point it at tmpdir instead and
+  # stand in for the system and postgres commands it calls.
+  let(:pre_start) do
+    path = File.join(tmpdir, 'pre-start')
+    File.write(
+      path,
+      template.render(properties)
+        .gsub('/var/vcap/store', store_dir)
+        .gsub('/var/vcap/packages', packages_dir),
+    )
+    path
+  end
+
+  def fake_command(path, body)
+    FileUtils.mkdir_p(File.dirname(path))
+    File.write(path, "#!/bin/bash\n#{body.gsub('COMMANDS_LOG', commands_log).gsub('INTERRUPT_MARKER', interrupt_marker)}\n")
+    File.chmod(0o755, path)
+  end
+
+  def run_pre_start
+    output = `PATH=#{bin_dir}:$PATH bash #{pre_start} 2>&1`
+    [output, $?.exitstatus]
+  end
+
+  def commands
+    File.readlines(commands_log, chomp: true)
+  end
+
+  before do
+    fake_command(File.join(bin_dir, 'sysctl'), 'true')
+    fake_command(File.join(bin_dir, 'chown'), 'true')
+    fake_command(File.join(bin_dir, 'dpkg-query'), 'echo 2.35-0ubuntu3')
+    # su - vcap -c COMMAND
+    fake_command(File.join(bin_dir, 'su'), 'exec bash -c "$4"')
+
+    fake_command(File.join(packages_dir, 'postgres-15', 'bin', 'initdb'), <<~'BASH')
+      echo "initdb" >> COMMANDS_LOG
+      mkdir -p "$4"
+      touch "$4/postgresql.conf"
+    BASH
+    # pg_upgrade refuses a new cluster it already imported into. When
+    # INTERRUPT_MARKER exists it is interrupted after it started importing.
+    fake_command(File.join(packages_dir, 'postgres-15', 'bin', 'pg_upgrade'), <<~'BASH')
+      for arg in "$@"; do
+        case "${arg}" in
+          --old-datadir=*) old="${arg#*=}" ;;
+          --new-datadir=*) new="${arg#*=}" ;;
+        esac
+      done
+      echo "pg_upgrade" >> COMMANDS_LOG
+      if [[ -f "${new}/imported" ]]; then
+        echo "New cluster database is not empty" >&2
+        exit 1
+      fi
+      touch "${new}/imported"
+      if [[ -f INTERRUPT_MARKER ]]; then
+        rm INTERRUPT_MARKER
+        exit 1
+      fi
+      cp "${old}/data" "${new}/data"
+    BASH
+    fake_command(File.join(packages_dir, 'postgres-15', 'bin', 'postgres'), 'cat > /dev/null')
+    %w[13 15].each do |version|
+      fake_command(File.join(packages_dir, "postgres-#{version}", 'bin', 'pg_ctl'), %(echo "pg_ctl-#{version} $*" >> COMMANDS_LOG))
+    end
+  end
+
+  after do
+    FileUtils.remove_entry(tmpdir)
+  end
+
+  context 'without an older postgres' do
+    it 'initializes postgres 15' do
+      output, status = run_pre_start
+      expect(status).to eq(0), output
+
+      expect(commands).to eq(['initdb'])
+      expect(File).to exist(File.join(store_dir, 'postgres-15', 'postgresql.conf'))
+      expect(File).not_to exist(File.join(store_dir, 'postgres-15', 'fresh'))
+    end
+  end
+
+  context 'with postgres 13 data' do
+    before do
+      FileUtils.mkdir_p(File.join(store_dir, 'postgres-13'))
+      File.write(File.join(store_dir, 'postgres-13', 'data'), 'director data')
+    end
+
+    it 'upgrades it and removes it' do
+      output, status = run_pre_start
+      expect(status).to eq(0), output
+
+      expect(commands).to eq(%w[initdb pg_upgrade])
+      expect(File.read(File.join(store_dir, 'postgres-15', 'data'))).to eq('director data')
+      expect(File).not_to exist(File.join(store_dir, 'postgres-13'))
+      expect(File).not_to exist(File.join(store_dir, 'postgres-15', 'upgrading'))
+      expect(File).not_to exist(File.join(store_dir, 'postgres-15', 'fresh'))
+    end
+
+    context 'when the upgrade is interrupted' do
+      before { FileUtils.touch(interrupt_marker) }
+
+      it 'keeps postgres 13 and marks the upgrade as interrupted' do
+        _, status = run_pre_start
+        expect(status).not_to eq(0)
+
+        expect(File.read(File.join(store_dir, 'postgres-13', 'data'))).to eq('director data')
+        expect(File).to exist(File.join(store_dir, 'postgres-15', 'upgrading'))
+        expect(File).to exist(File.join(store_dir, 'postgres-15', 'fresh'))
+      end
+
+      it 'starts over from postgres 13 when it is retried' do
+        run_pre_start
+
+        output, status = run_pre_start
+        expect(status).to eq(0), output
+        expect(output).to include('previous upgrade from postgres-13 was interrupted, re-initializing postgres-15')
+
+        expect(commands).to eq([
+          'initdb',
+          'pg_upgrade',
+          "pg_ctl-13 stop -D #{store_dir}/postgres-13 -m fast",
+          "pg_ctl-15 stop -D #{store_dir}/postgres-15 -m fast",
+          'initdb',
+          'pg_upgrade',
+        ])
+        expect(File.read(File.join(store_dir, 'postgres-15', 'data'))).to eq('director data')
+        expect(File).not_to exist(File.join(store_dir, 'postgres-13'))
+        expect(File).not_to exist(File.join(store_dir, 'postgres-15', 'upgrading'))
+      end
+    end
+  end
+end
@@ -4,14 +4,13 @@ import (
 	"fmt"
 	"path/filepath"
 	"regexp"
-	"strconv"
 	"strings"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
-	"github.com/onsi/gomega/gbytes"
 	"github.com/onsi/gomega/gexec"
+	"github.com/onsi/gomega/gmeasure"
 
 	"brats/utils"
 )
@@ -33,35 +32,23 @@ func extractAzIpsMap(regex *regexp.Regexp, contents string) map[string][]string
 	return out
 }
 
-func mustGetLatestDnsVersions() []int {
-	session := utils.Bosh("-n", "-d", deploymentName, "ssh",
-		"-c", "sudo cat /var/vcap/instance/dns/records.json",
-	)
-	Eventually(session, time.Minute).Should(gexec.Exit(0))
-
-	trimmedOutput := strings.TrimSpace(string(session.Out.Contents()))
-
-	results := extractDnsVersionsList(trimmedOutput)
-	Expect(len(results)).To(BeNumerically(">", 0))
+func mustGetLatestDnsVersions() []uint64 {
+	records := utils.InstanceRecords(deploymentName)
+	Expect(records).NotTo(BeEmpty())
 
-	return results
+	versions := make([]uint64, 0, len(records))
+	for _, instanceRecords := range records {
+		versions = append(versions, instanceRecords.Version)
+	}
+	return versions
 }
 
-var versionSegmentsPattern = regexp.MustCompile(`"version":(\d+)`)
-
-func extractDnsVersionsList(sshContents string) []int {
-	matches := versionSegmentsPattern.FindAllStringSubmatch(sshContents, -1)
-	Expect(matches).ToNot(BeNil())
-	results := make([]int, len(matches))
-
-	for i, match := range matches {
-		Expect(len(match)).To(Equal(2))
-		value, err := strconv.Atoi(match[1])
-		Expect(err).ToNot(HaveOccurred())
+func mustRunQueryErrand(errandName string) string {
+	run := utils.RunErrand(deploymentName, errandName, utils.ErrandOptions{Timeout: time.Minute})
+	Expect(run.ExitCode).To(Equal(0))
+	Expect(run.Results).To(HaveLen(1))
 
-		results[i] = value
-	}
-	return results
+	return run.Results[0].Stdout
 }
 
 var _ = Describe("BoshDns", func() {
@@ -105,12 +92,8 @@ var _ = Describe("BoshDns", func() {
 			matchExpression := regexp.MustCompile(`provider\S+\s+(z1|z2)\s+(\S+)`)
 			knownProviders := extractAzIpsMap(matchExpression, string(instanceList))
 
-			session = utils.Bosh("-d", deploymentName, "run-errand", "query-all")
-			Eventually(session, time.Minute).Should(gexec.Exit(0))
-
-			Expect(session.Out).To(gbytes.Say("ANSWER: 3"))
-
-			output := string(session.Out.Contents())
+			output := mustRunQueryErrand("query-all")
+			Expect(output).To(ContainSubstring("ANSWER: 3"))
 
 			for _, ips := range knownProviders {
 				for _, ip := range ips {
@@ -132,17 +115,99 @@ var _ = Describe("BoshDns", func() {
 			matchExpression := regexp.MustCompile(`provider\S+\s+(z1)\s+(\S+)`)
 			knownProviders := extractAzIpsMap(matchExpression, string(instanceList))
 
-			session = utils.Bosh("-d", deploymentName, "run-errand", "query-individual-instance")
-			Eventually(session, time.Minute).Should(gexec.Exit(0))
-
-			Expect(session.Out).To(gbytes.Say("ANSWER: 1"))
-
-			output := string(session.Out.Contents())
+			output := mustRunQueryErrand("query-individual-instance")
+			Expect(output).To(ContainSubstring("ANSWER: 1"))
 
 			ip1 := knownProviders["z1"][0]
 			ip2 := knownProviders["z1"][1]
 			Expect(output).To(MatchRegexp(`q-m\d+n\d+s\d\.q-g\d+\.bosh\.\s+\d+\s+IN\s+A\s+(%s|%s)`, ip1, ip2))
 		})
+
+		Context("resolving queries against bosh-dns", func() {
+			var (
+				records  *utils.Records
+				resolver *utils.DNSResolver
+				provider utils.RecordInfo
+			)
+
+			BeforeEach(func() {
+				// bosh ssh reports instances by ID, and there is only one
+				// test-agent.
+				for instance, instanceRecords := range utils.InstanceRecords(deploymentName) {
+					if strings.HasPrefix(instance, "test-agent/") {
+						records = instanceRecords
+					}
+				}
+				Expect(records).NotTo(BeNil())
+
+				infos, err := records.Infos()
+				Expect(err).NotTo(HaveOccurred())
+				provider = utils.RecordInfo{}
+				for _, info := range infos {
+					if info.InstanceGroup == "provider" && info.AZ == "z1" && (provider.ID == "" || info.InstanceIndex < provider.InstanceIndex) {
+						provider = info
+					}
+				}
+				Expect(provider.ID).NotTo(BeEmpty())
+
+				resolver = utils.StartDNSTunnel(deploymentName, "test-agent/0")
+			})
+
+			isProvider := func(info utils.RecordInfo) bool { return info.InstanceGroup == "provider" }
+
+			shortQuery := func(info utils.RecordInfo, filters string) string {
+				query, err := info.ShortQuery(filters)
+				Expect(err).NotTo(HaveOccurred())
+				return query
+			}
+
+			DescribeTable("the query grammar",
+				func(query func(provider utils.RecordInfo) string, answers func(provider, info utils.RecordInfo) bool) {
+					expected, err := records.IPs(func(info utils.RecordInfo) bool { return isProvider(info) && answers(provider, info) })
+					Expect(err).NotTo(HaveOccurred())
+					Expect(expected).NotTo(BeEmpty())
+
+					Expect(resolver.Lookup(query(provider))).To(Equal(expected))
+				},
+				Entry("q-s0 with a long name",
+					func(p utils.RecordInfo) string { return p.LongQuery("s0") },
+					func(_, _ utils.RecordInfo) bool { return true },
+				),
+				Entry("q-s0 with a short name",
+					func(p utils.RecordInfo) string { return shortQuery(p, "s0") },
+					func(_, _ utils.RecordInfo) bool { return true },
+				),
+				Entry("q-a<az> filtering by AZ",
+					func(p utils.RecordInfo) string { return shortQuery(p, "a"+p.AZID+"s0") },
+					func(p, info utils.RecordInfo) bool { return info.AZ == p.AZ },
+				),
+				Entry("q-m<num_id> for a single instance",
+					func(p utils.RecordInfo) string { return shortQuery(p, "m"+p.NumID+"s0") },
+					func(p, info utils.RecordInfo) bool { return info.ID == p.ID },
+				),
+				Entry("q-i<index> for a single instance",
+					func(p utils.RecordInfo) string { return shortQuery(p, fmt.Sprintf("i%ds0", p.InstanceIndex)) },
+					func(p, info utils.RecordInfo) bool { return info.InstanceIndex == p.InstanceIndex },
+				),
+				Entry("q-n<network> filtering by network",
+					func(p utils.RecordInfo) string { return shortQuery(p, "n"+p.NetworkID+"s0") },
+					func(p, info utils.RecordInfo) bool { return info.NetworkID == p.NetworkID },
+				),
+				Entry("q-m<num_id> with q-n<network> and a long name",
+					func(p utils.RecordInfo) string { return p.LongQuery("m" + p.NumID + "n" + p.NetworkID + "s0") },
+					func(p, info utils.RecordInfo) bool { return info.ID == p.ID },
+				),
+				Entry("an instance-specific name",
+					func(p utils.RecordInfo) string { return p.Name() },
+					func(p, info utils.RecordInfo) bool { return info.ID == p.ID },
+				),
+			)
+
+			It("does not resolve a group that does not exist", func() {
+				_, err := resolver.Lookup("q-s0.q-g9999.bosh")
+				Expect(err).To(HaveOccurred())
+			})
+		})
 	})
 
 	Context("When deploying vms across different azs", func() {
@@ -170,11 +235,8 @@ var _ = Describe("BoshDns", func() {
 				matchExpression := regexp.MustCompile(`provider\S+\s+(z1|z2)\s+(\S+)`)
 				knownProviders := extractAzIpsMap(matchExpression, string(instanceList))
 
-				session = utils.Bosh("-d", deploymentName, "run-errand", "query-all")
-				Eventually(session, time.Minute).Should(gexec.Exit(0))
-
-				Expect(session.Out).To(gbytes.Say("ANSWER: 3"))
-				output := string(session.Out.Contents())
+				output := mustRunQueryErrand("query-all")
+				Expect(output).To(ContainSubstring("ANSWER: 3"))
 
 				for _, ips := range knownProviders {
 					for _, ip := range ips {
@@ -187,11 +249,8 @@ var _ = Describe("BoshDns", func() {
 				matchExpression := regexp.MustCompile(`provider\S+\s+(z1)\s+(\S+)`)
 				knownProviders := extractAzIpsMap(matchExpression, string(instanceList))
 
-				session = utils.Bosh("-d", deploymentName, "run-errand", "query-with-az-filter")
-				Eventually(session, time.Minute).Should(gexec.Exit(0))
-
-				Expect(session.Out).To(gbytes.Say("ANSWER: 2"))
-				output := string(session.Out.Contents())
+				output := mustRunQueryErrand("query-with-az-filter")
+				Expect(output).To(ContainSubstring("ANSWER: 2"))
 
 				for _, ips := range knownProviders {
 					for _, ip := range ips {
@@ -203,7 +262,7 @@ var _ = Describe("BoshDns", func() {
 
 		It("can force a new DNS blob to propagate to ALL vms", func() {
 			versionPerInstance := mustGetLatestDnsVersions()
-			previousMax := -1
+			previousMax := uint64(0)
 			for _, version := range versionPerInstance {
 				if previousMax < version {
 					previousMax = version
@@ -226,5 +285,69 @@ var _ = Describe("BoshDns", func() {
 				Expect(version).To(Equal(firstNewVersion))
 			}
 		})
+
+		It("propagates new DNS records to every vm within the SLA", func() {
+			sla := utils.Env().DNSPropagationSLA()
+
+			experiment := gmeasure.NewExperiment("DNS Propagation")
+			AddReportEntry(experiment.Name, experiment)
+
+			// measure makes a change that has to bump the records version.
+			// change returns when the director pushed the new records.
+			measure := func(name string, change func() time.Time) {
+				baseline := utils.LatestDNSVersion(deploymentName)
+				start := change()
+				version, durations := utils.MeasureDNSConvergence(experiment, name, deploymentName, baseline, start, 2*sla)
+				for instance, duration := range durations {
+					Expect(duration).To(BeNumerically("<=", sla), "%s: %s converged after %s", name, instance, duration)
+				}
+				Expect(version).To(BeNumerically(">", baseline), "%s did not bump the records version", name)
+			}
+
+			// taskEnded is when the last task of a bosh CLI invocation ended.
+			// The director pushes the records a deploy or recreate changed at
+			// the end of its task, so that is when propagation starts.
+			taskEnded := func(session *gexec.Session) time.Time {
+				ids := utils.TaskIDsFromOutput(session.Out.Contents())
+				Expect(ids).NotTo(BeEmpty(), "no task reported by %v", session.Command.Args)
+
+				task, err := utils.InnerDirectorClient().Task(ids[len(ids)-1])
+				Expect(err).NotTo(HaveOccurred())
+				ended, ok := task.Ended()
+				Expect(ok).To(BeTrue(), "task %d has not ended", task.ID)
+				return ended
+			}
+
+			By("scaling up the deployment", func() {
+				measure("deploy", func() time.Time {
+					session := utils.Bosh("deploy", "-n", "-d", deploymentName, manifestPath,
+						"-o", utils.AssetPath("ops-scale-dns-provider.yml"),
+						"-v", fmt.Sprintf("dns-release-path=%s", dnsReleasePath),
+						"-v", fmt.Sprintf("stemcell-os=%s", utils.StemcellOS()),
+						"-v", fmt.Sprintf("linked-template-release-path=%s", linkedTemplateReleasePath),
+						"--vars-store", "creds.yml",
+					)
+					Eventually(session, 20*time.Minute).Should(gexec.Exit(0))
+					return taskEnded(session)
+				})
+			})
+
+			By("recreating an instance group", func() {
+				measure("recreate", func() time.Time {
+					session := utils.Bosh("-n", "-d", deploymentName, "recreate", "provider")
+					Eventually(session, 20*time.Minute).Should(gexec.Exit(0))
+					return taskEnded(session)
+				})
+			})
+
+			By("triggering a one-time sync", func() {
+				measure("one-time sync", func() time.Time {
+					// The sync pushes the records as soon as it runs.
+					start := time.Now()
+					utils.InnerDirectorRun("/var/vcap/jobs/director/bin/trigger-one-time-sync-dns")
+					return start
+				})
+			})
+		})
 	})
 })
@@ -19,17 +19,23 @@ var (
 	dnsReleasePath string
 )
 
+var requiredEnvironment = []utils.EnvironmentField{
+	utils.BOSHReleasePath,
+	utils.DNSReleasePath,
+	utils.CandidateStemcellPath,
+}
+
 var _ = SynchronizedBeforeSuite(func() []byte {
-	utils.Bootstrap()
+	utils.Bootstrap(requiredEnvironment...)
 	utils.CreateAndUploadBOSHRelease()
 	utils.StartInnerBosh()
 
 	return []byte{}
 }, func(data []byte) {
-	utils.Bootstrap()
-	boshRelease = utils.AssertEnvExists("BOSH_RELEASE")
-	dnsReleasePath = utils.AssertEnvExists("DNS_RELEASE_PATH")
-	candidateWardenLinuxStemcellPath = utils.AssertEnvExists("CANDIDATE_STEMCELL_TARBALL_PATH")
+	utils.Bootstrap(requiredEnvironment...)
+	boshRelease = utils.Env().Releases.Bosh
+	dnsReleasePath = utils.Env().Releases.DNS
+	candidateWardenLinuxStemcellPath = utils.Env().Stemcells.Candidate
 })
 
 var _ = AfterSuite(func() {
@@ -39,3 +45,9 @@ var _ = AfterSuite(func() {
 var _ = AfterEach(func() {
 	utils.CleanupInnerBoshDeployments()
 })
+
+var _ = ReportAfterEach(func(report SpecReport) {
+	utils.ReportTasksForCurrentSpec()
+	utils.CollectFailureArtifacts(report)
+	utils.ForgetTasksForCurrentSpec()
+})
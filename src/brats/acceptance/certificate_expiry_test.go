@@ -0,0 +1,74 @@
+package acceptance_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.yaml.in/yaml/v3"
+
+	"brats/certs"
+	"brats/utils"
+)
+
+// certificate_expiry.json is served by the director's
+// /director/certificate_expiry endpoint. The request asked for the metrics
+// server's certificate series too, but metrics_collector has none: its
+// gauges cover tasks, resurrection, network IPs and agent and instance
+// health, so the director API is the only certificate expiry report to
+// check.
+var _ = Describe("Director certificate expiry", func() {
+	const validFor = 10 * 24 * time.Hour
+
+	var directorCert *certs.Certificate
+
+	BeforeEach(func() {
+		// Deploying first has creds.yml generate the default_ca the short
+		// lived certificate is signed with.
+		utils.StartInnerBosh()
+
+		ca, err := certs.Parse(
+			[]byte(utils.InnerBoshCredential("/default_ca/certificate")),
+			[]byte(utils.InnerBoshCredential("/default_ca/private_key")),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		directorCert, err = ca.Server(certs.Options{
+			CommonName: utils.InnerDirectorIP(),
+			Hosts:      []string{utils.InnerDirectorIP()},
+			Validity:   certs.ValidFor(validFor),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		vars, err := yaml.Marshal(map[string]any{
+			"director_ssl": map[string]string{
+				"ca":          string(ca.CertPEM()),
+				"certificate": string(directorCert.CertPEM()),
+				"private_key": string(directorCert.KeyPEM()),
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		varsFile := filepath.Join(GinkgoT().TempDir(), "short-lived-director-ssl.yml")
+		Expect(os.WriteFile(varsFile, vars, 0o600)).To(Succeed())
+
+		// Variables given explicitly take precedence over creds.yml, which
+		// keeps the long-lived certificate for the next spec.
+		utils.StartInnerBosh("-l", varsFile)
+	})
+
+	It("reports the expiry of the certificates deployed on the director", func() {
+		deployed := utils.DeployedCertificateExpiries()
+		Expect(deployed).To(HaveKeyWithValue("director.ssl.cert", directorCert.Certificate.NotAfter.UTC().Truncate(time.Second)))
+
+		reported, err := utils.InnerDirectorClient().CertificateExpiries()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(utils.CertificateExpiryMismatches(deployed, reported, time.Now())).To(BeEmpty())
+
+		Expect(reported).To(ContainElement(SatisfyAll(
+			HaveField("Property", "director.ssl.cert"),
+			HaveField("DaysLeft", 9),
+		)))
+	})
+})
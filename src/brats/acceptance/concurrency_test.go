@@ -0,0 +1,163 @@
+package acceptance_test
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+
+	"brats/utils"
+)
+
+func slowDeployArgs(deployment string, instances, preStartSleepSeconds int) []string {
+	return []string{"deploy", "-n", "-d", deployment, utils.AssetPath("slow-manifest.yml"),
+		"-v", fmt.Sprintf("deployment-name=%s", deployment),
+		"-v", fmt.Sprintf("stemcell-os=%s", utils.StemcellOS()),
+		"-v", fmt.Sprintf("instances=%d", instances),
+		"-v", fmt.Sprintf("pre-start-sleep-seconds=%d", preStartSleepSeconds),
+	}
+}
+
+func uploadSlowRelease() {
+	releasePath := utils.AssetPath("slow-release")
+	utils.CreateRelease(releasePath)
+	utils.UploadReleaseDir(releasePath)
+}
+
+func taskIDOf(session *gexec.Session) int {
+	id, found := utils.TaskIDFromOutput(session.Out.Contents())
+	Expect(found).To(BeTrue(), "no task reported in output of %v", session.Command.Args)
+	return id
+}
+
+var _ = Describe("Director task concurrency", func() {
+	const (
+		directorWorkers = 2
+		deployTimeout   = 20 * time.Minute
+	)
+
+	var director *utils.DirectorClient
+
+	BeforeEach(func() {
+		utils.StartInnerBosh(
+			"-o", utils.AssetPath("ops-director-workers.yml"),
+			"-v", fmt.Sprintf("director_workers=%d", directorWorkers),
+		)
+		utils.UploadStemcell(candidateWardenLinuxStemcellPath)
+		uploadSlowRelease()
+
+		director = utils.InnerDirectorClient()
+	})
+
+	It("serializes two deploys of the same deployment on its lock", func() {
+		recorder := utils.RecordTaskTimeline(director, utils.TasksFilter{Verbose: 2, Limit: 20}, time.Second)
+		sessions := utils.StartConcurrently(
+			slowDeployArgs("concurrent-same", 1, 30),
+			slowDeployArgs("concurrent-same", 1, 30),
+		)
+		utils.WaitForAll(sessions, deployTimeout)
+		timeline := recorder.Stop()
+
+		deployTasks := map[string]utils.Task{}
+		succeeded := 0
+		for _, session := range sessions {
+			task, err := director.Task(taskIDOf(session))
+			Expect(err).NotTo(HaveOccurred())
+			deployTasks[strconv.Itoa(task.ID)] = task
+
+			if session.ExitCode() == 0 {
+				succeeded++
+				Expect(task.State).To(Equal(utils.TaskStateDone))
+			} else {
+				Expect(task.State).To(Equal(utils.TaskStateError))
+				Expect(task.Result).To(ContainSubstring("Failed to acquire lock for lock:deployment:concurrent-same"))
+			}
+		}
+		Expect(succeeded).To(BeNumerically(">=", 1))
+
+		holds := timeline.LockHolds("deployment:concurrent-same")
+		Expect(holds).NotTo(BeEmpty())
+		for i, hold := range holds {
+			Expect(deployTasks).To(HaveKey(hold.TaskID))
+			for _, other := range holds[i+1:] {
+				if other.TaskID != hold.TaskID {
+					Expect(hold.Overlaps(other)).To(BeFalse(), "tasks %s and %s held the deployment lock at the same time", hold.TaskID, other.TaskID)
+				}
+			}
+		}
+	})
+
+	It("runs deploys of different deployments in parallel up to the number of workers", func() {
+		var commands [][]string
+		for i := 0; i <= directorWorkers; i++ {
+			commands = append(commands, slowDeployArgs(fmt.Sprintf("concurrent-%d", i), 1, 60))
+		}
+
+		recorder := utils.RecordTaskTimeline(director, utils.TasksFilter{Verbose: 2, Limit: 20}, time.Second)
+		sessions := utils.StartConcurrently(commands...)
+		utils.WaitForAll(sessions, deployTimeout)
+		timeline := recorder.Stop()
+
+		for _, session := range sessions {
+			Expect(session.ExitCode()).To(Equal(0))
+		}
+
+		Expect(timeline.MaxConcurrentLocks("deployment")).To(Equal(directorWorkers))
+		Expect(timeline.MaxConcurrentTasks(utils.TaskStateProcessing)).To(BeNumerically("<=", directorWorkers))
+		Expect(timeline.MaxConcurrentTasks(utils.TaskStateQueued)).To(BeNumerically(">=", 1))
+	})
+
+	It("lets config updates and cloud checks of other deployments run alongside a deploy", func() {
+		session := utils.Bosh(slowDeployArgs("concurrent-other", 1, 0)...)
+		Eventually(session, deployTimeout).Should(gexec.Exit(0))
+
+		cloudConfigName := fmt.Sprintf("concurrency-%d", GinkgoParallelProcess())
+		DeferCleanup(func() {
+			session := utils.Bosh("-n", "delete-config", "--type", "cloud", "--name", cloudConfigName)
+			Eventually(session, time.Minute).Should(gexec.Exit(0))
+		})
+
+		recorder := utils.RecordTaskTimeline(director, utils.TasksFilter{Verbose: 2, Limit: 20}, time.Second)
+		deploy := utils.Bosh(slowDeployArgs("concurrent-busy", 1, 60)...)
+		deployTaskID := utils.WaitForTaskID(deploy, 10*time.Minute)
+		Expect(utils.WaitForTaskLocks(director, deployTaskID, 10*time.Minute)).To(ContainElement(HaveField("Resource", ConsistOf("concurrent-busy"))))
+
+		sessions := utils.StartConcurrently(
+			[]string{"-n", "update-config", "--type", "cloud", "--name", cloudConfigName, utils.AssetPath("cpi-config.yml")},
+			[]string{"-n", "-d", "concurrent-other", "cck", "--auto"},
+			[]string{"-n", "-d", "concurrent-busy", "cck", "--auto"},
+		)
+		utils.WaitForAll(sessions, 5*time.Minute)
+
+		Expect(sessions[0].ExitCode()).To(Equal(0))
+		Expect(sessions[1].ExitCode()).To(Equal(0))
+		Expect(sessions[2].ExitCode()).NotTo(Equal(0))
+
+		busyCck, err := director.Task(taskIDOf(sessions[2]))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(busyCck.Result).To(ContainSubstring("Failed to acquire lock for lock:deployment:concurrent-busy"))
+
+		Eventually(deploy, deployTimeout).Should(gexec.Exit(0))
+		timeline := recorder.Stop()
+
+		for _, hold := range timeline.LockHolds("deployment:concurrent-busy") {
+			Expect(hold.TaskID).To(Equal(strconv.Itoa(deployTaskID)))
+		}
+	})
+
+	It("releases every lock held by a task once it is cancelled", func() {
+		deploy := utils.Bosh(slowDeployArgs("concurrent-cancelled", 1, 300)...)
+		taskID := utils.WaitForTaskID(deploy, 10*time.Minute)
+		utils.WaitForTaskLocks(director, taskID, 10*time.Minute)
+
+		session := utils.Bosh("cancel-task", strconv.Itoa(taskID))
+		Eventually(session, time.Minute).Should(gexec.Exit(0))
+		Eventually(deploy, deployTimeout).Should(gexec.Exit())
+
+		utils.WaitForTaskState(director, taskID, 10*time.Minute, utils.TaskStateCancelled)
+		utils.WaitForTaskLocksReleased(director, taskID, 2*time.Minute)
+	})
+})
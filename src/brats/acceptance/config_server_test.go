@@ -0,0 +1,296 @@
+package acceptance_test
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+
+	"brats/fakes/credhub"
+	"brats/fakes/uaa"
+	"brats/utils"
+)
+
+var _ = Describe("Config server", func() {
+	const (
+		deploymentName = "config-server"
+		directorName   = "docker-inner"
+	)
+
+	var (
+		server             *credhub.Server
+		configServerConfig utils.ConfigServerConfig
+	)
+
+	variableName := func(name string) string {
+		return fmt.Sprintf("/%s/%s/%s", directorName, deploymentName, name)
+	}
+
+	deploy := func(alternativeName string) {
+		session := utils.Bosh("deploy", "-n", "-d", deploymentName, utils.AssetPath("config-server-manifest.yml"),
+			"-v", fmt.Sprintf("deployment-name=%s", deploymentName),
+			"-v", fmt.Sprintf("stemcell-os=%s", utils.StemcellOS()),
+			"-v", fmt.Sprintf("service-alternative-name=%s", alternativeName),
+		)
+		Eventually(session, 15*time.Minute).Should(gexec.Exit(0))
+	}
+
+	consumerMessage := func() string {
+		run := utils.RunErrand(deploymentName, "smoke-errand", utils.ErrandOptions{})
+		Expect(run.ExitCode).To(Equal(0))
+		Expect(run.Results).To(HaveLen(1))
+		return run.Results[0].Stdout
+	}
+
+	deployedVariableIDs := func() map[string]string {
+		session := utils.Bosh("-d", deploymentName, "variables", "--json")
+		Eventually(session, time.Minute).Should(gexec.Exit(0))
+
+		output, err := utils.ParseCLIOutput(session.Out.Contents())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output.Tables).To(HaveLen(1))
+
+		ids := map[string]string{}
+		for _, row := range output.Tables[0].Rows {
+			ids[row["name"]] = row["id"]
+		}
+		return ids
+	}
+
+	deployedVersions := func(name string) map[string]string {
+		var response struct {
+			Deployments []struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			} `json:"deployments"`
+		}
+		Expect(utils.InnerDirectorClient().Get("/deployed_variables/"+url.PathEscape(variableName(name)), nil, &response)).To(Succeed())
+
+		versions := map[string]string{}
+		for _, deployment := range response.Deployments {
+			versions[deployment.Name] = deployment.Version
+		}
+		return versions
+	}
+
+	current := func(name string) credhub.Credential {
+		credential, found := server.Current(variableName(name))
+		Expect(found).To(BeTrue(), "%s was never stored in the config server", variableName(name))
+		return credential
+	}
+
+	// Specs that need the director to fetch config server tokens from a UAA
+	// start one in a BeforeEach; the config server and director start after.
+	var uaaServer *uaa.Server
+
+	BeforeEach(func() {
+		uaaServer = nil
+	})
+
+	JustBeforeEach(func() {
+		config := credhub.Config{
+			Address:      net.JoinHostPort(utils.LocalIPForInnerDirector(), "0"),
+			Hosts:        []string{utils.LocalIPForInnerDirector()},
+			ClientID:     "director_to_credhub",
+			ClientSecret: "brats-config-server-secret",
+		}
+		if uaaServer != nil {
+			config.VerifyToken = func(token string) error {
+				claims, err := uaaServer.Verify(token)
+				if err != nil {
+					return err
+				}
+				if !slices.Contains(claims.Scope, "credhub.write") {
+					return fmt.Errorf("token of %s lacks credhub.write", claims.ClientID)
+				}
+				return nil
+			}
+		}
+
+		var err error
+		server, err = credhub.Start(config)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(server.Close)
+
+		dir := GinkgoT().TempDir()
+		caCertPath := filepath.Join(dir, "config-server-ca.pem")
+		Expect(os.WriteFile(caCertPath, []byte(server.CACert()), 0o644)).To(Succeed())
+
+		configServerConfig = utils.ConfigServerConfig{
+			URL:          server.URL() + "/api/",
+			UAAURL:       server.URL(),
+			CACertPath:   caCertPath,
+			ClientID:     "director_to_credhub",
+			ClientSecret: "brats-config-server-secret",
+		}
+		options := utils.InnerBoshWithConfigServerOptions(configServerConfig)
+		if uaaServer != nil {
+			uaaCACertPath := filepath.Join(dir, "uaa-ca.pem")
+			Expect(os.WriteFile(uaaCACertPath, []byte(uaaServer.CACert()), 0o644)).To(Succeed())
+			verificationKeyPath := filepath.Join(dir, "uaa-verification-key.pem")
+			Expect(os.WriteFile(verificationKeyPath, []byte(uaaServer.VerificationKey()), 0o644)).To(Succeed())
+
+			options = append(options, utils.InnerBoshWithConfigServerUAAOptions(utils.UAAConfig{
+				URL:                 uaaServer.URL(),
+				CACertPath:          uaaCACertPath,
+				VerificationKeyPath: verificationKeyPath,
+			})...)
+		}
+		utils.StartInnerBosh(options...)
+
+		utils.UploadStemcell(candidateWardenLinuxStemcellPath)
+		releasePath := utils.AssetPath("errand-release")
+		utils.CreateRelease(releasePath)
+		utils.UploadReleaseDir(releasePath)
+
+		server.Set(variableName("greeting"), "value", "hello from the config server")
+	})
+
+	It("interpolates set and generated variables into the deployment", func() {
+		deploy("service.brats.internal")
+
+		greeting := current("greeting")
+		password := current("generated-password")
+		tls := current("service-tls")
+
+		message := consumerMessage()
+		Expect(message).To(ContainSubstring("greeting=hello from the config server"))
+		Expect(message).To(ContainSubstring("password=" + password.StringValue()))
+		Expect(message).To(ContainSubstring(strings.TrimSpace(tls.Field("certificate"))))
+
+		ids := deployedVariableIDs()
+		Expect(ids).To(HaveKeyWithValue(variableName("greeting"), greeting.ID))
+		Expect(ids).To(HaveKeyWithValue(variableName("generated-password"), password.ID))
+		Expect(ids).To(HaveKeyWithValue(variableName("service-ca"), current("service-ca").ID))
+		Expect(ids).To(HaveKeyWithValue(variableName("service-tls"), tls.ID))
+
+		Expect(deployedVersions("service-tls")).To(Equal(map[string]string{deploymentName: tls.ID}))
+
+		Expect(server.GenerateRequests()).To(ContainElements(
+			And(HaveField("Name", variableName("generated-password")), HaveField("Mode", credhub.ModeNoOverwrite)),
+			And(HaveField("Name", variableName("service-tls")), HaveField("Mode", credhub.ModeConverge), HaveField("Parameters", HaveKeyWithValue("ca", variableName("service-ca")))),
+		))
+	})
+
+	It("keeps using the deployed variable versions until the next deploy", func() {
+		deploy("service.brats.internal")
+		deployedIDs := deployedVariableIDs()
+
+		server.Set(variableName("greeting"), "value", "hello again")
+
+		Expect(consumerMessage()).To(ContainSubstring("greeting=hello from the config server"))
+		Expect(deployedVariableIDs()).To(Equal(deployedIDs))
+
+		deploy("service.brats.internal")
+
+		Expect(consumerMessage()).To(ContainSubstring("greeting=hello again"))
+
+		redeployedIDs := deployedVariableIDs()
+		Expect(redeployedIDs[variableName("greeting")]).To(Equal(current("greeting").ID))
+		Expect(redeployedIDs[variableName("greeting")]).NotTo(Equal(deployedIDs[variableName("greeting")]))
+		Expect(redeployedIDs[variableName("generated-password")]).To(Equal(deployedIDs[variableName("generated-password")]))
+
+		Expect(deployedVersions("greeting")).To(Equal(map[string]string{deploymentName: current("greeting").ID}))
+
+		Expect(server.Versions(variableName("greeting"))).To(HaveLen(2))
+		Expect(server.Versions(variableName("generated-password"))).To(HaveLen(1))
+	})
+
+	It("regenerates converging certificates when their CA or options change", func() {
+		deploy("service.brats.internal")
+		firstTLS := current("service-tls")
+
+		rotatedCA, err := server.Generate(variableName("service-ca"), "certificate", map[string]any{"is_ca": true, "common_name": "service-ca"}, credhub.ModeOverwrite)
+		Expect(err).NotTo(HaveOccurred())
+
+		deploy("service.brats.internal")
+
+		rotatedTLS := current("service-tls")
+		Expect(rotatedTLS.ID).NotTo(Equal(firstTLS.ID))
+		Expect(rotatedTLS.Field("ca")).To(Equal(rotatedCA.Field("certificate")))
+		Expect(verifyCertificate(rotatedTLS.Field("certificate"), rotatedCA.Field("certificate"))).To(Succeed())
+		Expect(consumerMessage()).To(ContainSubstring(strings.TrimSpace(rotatedTLS.Field("certificate"))))
+
+		deploy("renamed.brats.internal")
+
+		renamedTLS := current("service-tls")
+		Expect(renamedTLS.ID).NotTo(Equal(rotatedTLS.ID))
+		Expect(parseCertificate(renamedTLS.Field("certificate")).DNSNames).To(ConsistOf("renamed.brats.internal"))
+		Expect(deployedVariableIDs()).To(HaveKeyWithValue(variableName("service-tls"), renamedTLS.ID))
+
+		Expect(server.Versions(variableName("service-ca"))).To(HaveLen(2))
+		Expect(server.Versions(variableName("service-tls"))).To(HaveLen(3))
+		Expect(server.Versions(variableName("generated-password"))).To(HaveLen(1))
+	})
+
+	Context("with the director's logs scanned for secrets", func() {
+		secretLeaks := utils.DetectSecretLeaks()
+
+		// Registered after the director starts, so that the scanner reads
+		// the variables from this spec's config server.
+		JustBeforeEach(func() {
+			secretLeaks.UseConfigServer(configServerConfig)
+		})
+
+		// Without the smoke errand, which prints the generated password on
+		// purpose into the task's output.
+		It("keeps the values of set, generated and rotated variables out of the logs", func() {
+			deploy("service.brats.internal")
+
+			server.Set(variableName("greeting"), "value", "hello again from the config server")
+			deploy("service.brats.internal")
+		})
+	})
+
+	Context("when the director gets its config server tokens from a UAA", func() {
+		BeforeEach(func() {
+			var err error
+			uaaServer, err = uaa.Start(uaa.Config{
+				Address: net.JoinHostPort(utils.LocalIPForInnerDirector(), "0"),
+				Hosts:   []string{utils.LocalIPForInnerDirector()},
+				Clients: []uaa.Client{
+					{ID: "director_to_credhub", Secret: "brats-config-server-secret", Scopes: []string{"credhub.read", "credhub.write"}},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(uaaServer.Close)
+		})
+
+		It("authenticates to the config server with a UAA token", func() {
+			deploy("service.brats.internal")
+
+			Expect(consumerMessage()).To(ContainSubstring("greeting=hello from the config server"))
+			Expect(uaaServer.IssuedTokens()).To(ContainElement(And(
+				HaveField("ClientID", "director_to_credhub"),
+				HaveField("Scope", ConsistOf("credhub.read", "credhub.write")),
+			)))
+		})
+	})
+})
+
+func parseCertificate(certPEM string) *x509.Certificate {
+	block, _ := pem.Decode([]byte(certPEM))
+	Expect(block).NotTo(BeNil(), "not a PEM certificate: %q", certPEM)
+
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	Expect(err).NotTo(HaveOccurred())
+	return certificate
+}
+
+func verifyCertificate(certPEM, caPEM string) error {
+	roots := x509.NewCertPool()
+	Expect(roots.AppendCertsFromPEM([]byte(caPEM))).To(BeTrue())
+
+	_, err := parseCertificate(certPEM).Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+	return err
+}
@@ -1,61 +1,121 @@
 package acceptance_test
 
 import (
-	"os/exec"
-	"syscall"
+	"fmt"
+	"strings"
 	"time"
 
-	"github.com/creack/pty"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
-	"github.com/onsi/gomega/gbytes"
 	"github.com/onsi/gomega/gexec"
 
+	"brats/terminal"
 	"brats/utils"
 )
 
 var _ = Describe("director console", func() {
+	var term *terminal.Terminal
+
 	BeforeEach(func() {
 		utils.StartInnerBosh()
 	})
 
-	It("allows a user to launch the director console", func() {
-		ptyF, ttyF, err := pty.Open()
-		Expect(err).ShouldNot(HaveOccurred())
-		defer ptyF.Close() //nolint:errcheck
-
-		consoleCmd := exec.Command(utils.OuterBoshBinaryPath(), "-d", utils.InnerBoshDirectorName(), "ssh", "bosh")
-		consoleCmd.Stdin = ttyF
-		consoleCmd.Stdout = ttyF
-		consoleCmd.Stderr = ttyF
-		consoleCmd.SysProcAttr = &syscall.SysProcAttr{Setctty: true, Setsid: true}
-
-		session, err := gexec.Start(consoleCmd, GinkgoWriter, GinkgoWriter)
-		Expect(err).ShouldNot(HaveOccurred())
-		Expect(ttyF.Close()).To(Succeed())
-
-		Eventually(session.Out, 1*time.Minute).Should(gbytes.Say(`bosh/[0-9a-f\-]{36}:~\$ `))
-
-		_, err = ptyF.Write([]byte("sudo su -\n"))
-		Expect(err).NotTo(HaveOccurred())
+	// loginAsRoot opens a root shell on the director VM that the console
+	// runs without colors or a multi-line editor, whose redrawing would get
+	// in the way of matching its output.
+	loginAsRoot := func() {
+		term = utils.InnerDirectorTerminal()
+		Expect(term.ExpectPrompt(time.Minute)).Error().NotTo(HaveOccurred())
+
+		Expect(term.SendLine("sudo su -")).To(Succeed())
+		Expect(term.SetPrompt(utils.InnerDirectorRootPrompt)).To(Succeed())
+		Expect(term.ExpectPrompt(time.Minute)).Error().NotTo(HaveOccurred())
+
+		Expect(term.SendLine(`printf 'IRB.conf[:USE_COLORIZE] = false\nIRB.conf[:USE_MULTILINE] = false\nIRB.conf[:USE_AUTOCOMPLETE] = false\nIRB.conf[:PROMPT_MODE] = :SIMPLE\n' > ~/.irbrc`)).To(Succeed())
+		Expect(term.ExpectPrompt(time.Minute)).Error().NotTo(HaveOccurred())
+		DeferCleanup(func() {
+			utils.InnerDirectorRun("rm -f /root/.irbrc")
+		})
+	}
+
+	logout := func() {
+		Expect(term.SendLine("exit")).To(Succeed())
+		Expect(term.SetPrompt(utils.InnerDirectorShellPrompt)).To(Succeed())
+		Expect(term.ExpectPrompt(time.Minute)).Error().NotTo(HaveOccurred())
+
+		Expect(term.SendLine("exit")).To(Succeed())
+		Expect(term.Wait(time.Minute)).To(Equal(0))
+	}
 
-		Eventually(session.Out, 1*time.Minute).Should(gbytes.Say(`bosh/[0-9a-f\-]{36}:~\# `))
-
-		_, err = ptyF.Write([]byte("echo 'IRB.conf[:USE_COLORIZE] = false' > ~/.irbrc\n"))
-		Expect(err).NotTo(HaveOccurred())
-
-		_, err = ptyF.Write([]byte("echo 'Bosh::Director::VERSION' | /var/vcap/jobs/director/bin/console\n"))
-		Expect(err).NotTo(HaveOccurred())
-
-		Eventually(session.Out, 1*time.Minute).Should(gbytes.Say(`"0.0.0"`))
+	It("allows a user to launch the director console", func() {
+		loginAsRoot()
 
-		_, err = ptyF.Write([]byte("exit\n"))
-		Expect(err).NotTo(HaveOccurred())
-		Eventually(session.Out, 1*time.Minute).Should(gbytes.Say(`bosh/[0-9a-f\-]{36}:~\$ `))
+		Expect(term.SendLine("echo 'Bosh::Director::VERSION' | /var/vcap/jobs/director/bin/console")).To(Succeed())
+		Expect(term.ExpectPrompt(time.Minute)).To(ContainSubstring(`"0.0.0"`))
 
-		_, err = ptyF.Write([]byte("exit\n"))
-		Expect(err).NotTo(HaveOccurred())
+		logout()
+	})
 
-		Eventually(session, time.Minute).Should(gexec.Exit(0))
+	Context("with a deployment", func() {
+		const deployment = "console-models"
+
+		BeforeEach(func() {
+			utils.UploadStemcell(candidateWardenLinuxStemcellPath)
+			uploadSlowRelease()
+			Eventually(utils.Bosh(slowDeployArgs(deployment, 2, 0)...), 20*time.Minute).Should(gexec.Exit(0))
+		})
+
+		It("queries the director's models in a multi-line session", func() {
+			tasks, err := utils.InnerDirectorClient().Tasks(utils.TasksFilter{Deployment: deployment, Limit: 1})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tasks).To(HaveLen(1))
+
+			loginAsRoot()
+
+			Expect(term.SendLine("/var/vcap/jobs/director/bin/console")).To(Succeed())
+			Expect(term.SetPrompt(`\n>> $`)).To(Succeed())
+			Expect(term.ExpectPrompt(2 * time.Minute)).To(ContainSubstring("Welcome to BOSH Director console"))
+
+			By("listing deployments with their instances", func() {
+				Expect(term.Send(strings.Join([]string{
+					"Deployment.order(:name).each do |deployment|",
+					`  puts "deployment=#{deployment.name} instances=#{deployment.instances.count}"`,
+					"end; nil",
+					"",
+				}, "\n"))).To(Succeed())
+				Expect(term.ExpectPrompt(time.Minute)).To(ContainSubstring(fmt.Sprintf("deployment=%s instances=2\n", deployment)))
+			})
+
+			// Without the multi-line editor IRB only continues a statement
+			// whose line ends in a dot, not one whose next line starts
+			// with it. Each statement gets a prompt of its own, so the
+			// lookup is a single one.
+			By("finding the deployment's latest task", func() {
+				Expect(term.Send(strings.Join([]string{
+					fmt.Sprintf("puts Task.where(deployment_name: %q).", deployment),
+					"  order(Sequel.desc(:id)).",
+					"  first.",
+					`  then { |task| "task=#{task.id} state=#{task.state} description=#{task.description}" }`,
+					"",
+				}, "\n"))).To(Succeed())
+				Expect(term.ExpectPrompt(time.Minute)).To(ContainSubstring(fmt.Sprintf("task=%d state=%s description=%s\n", tasks[0].ID, tasks[0].State, tasks[0].Description)))
+			})
+
+			By("evaluating a multi-line expression", func() {
+				Expect(term.Send(strings.Join([]string{
+					"Instance.where(deployment: Deployment.find(name: '" + deployment + "')).",
+					"  map { |instance| instance.job }.",
+					"  uniq",
+					"",
+				}, "\n"))).To(Succeed())
+				Expect(term.ExpectPrompt(time.Minute)).To(ContainSubstring(`=> ["sleeper"]`))
+			})
+
+			Expect(term.SendLine("exit")).To(Succeed())
+			Expect(term.SetPrompt(utils.InnerDirectorRootPrompt)).To(Succeed())
+			Expect(term.ExpectPrompt(time.Minute)).Error().NotTo(HaveOccurred())
+
+			logout()
+		})
 	})
 })
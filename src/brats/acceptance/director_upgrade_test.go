@@ -0,0 +1,102 @@
+package acceptance_test
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+
+	"brats/fakes/credhub"
+	"brats/utils"
+)
+
+var _ = Describe("Director upgrade", func() {
+	const (
+		variablesDeployment = "upgrade-variables"
+		sleepersDeployment  = "upgrade-sleepers"
+		orphanDeployment    = "upgrade-orphan"
+	)
+
+	var (
+		configServer        *credhub.Server
+		configServerOptions []string
+	)
+
+	BeforeEach(func() {
+		var err error
+		configServer, err = credhub.Start(credhub.Config{
+			Address:      net.JoinHostPort(utils.LocalIPForInnerDirector(), "0"),
+			Hosts:        []string{utils.LocalIPForInnerDirector()},
+			ClientID:     "director_to_credhub",
+			ClientSecret: "brats-config-server-secret",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(configServer.Close)
+
+		caCertPath := filepath.Join(GinkgoT().TempDir(), "config-server-ca.pem")
+		Expect(os.WriteFile(caCertPath, []byte(configServer.CACert()), 0o644)).To(Succeed())
+
+		configServerOptions = utils.InnerBoshWithConfigServerOptions(utils.ConfigServerConfig{
+			URL:          configServer.URL() + "/api/",
+			UAAURL:       configServer.URL(),
+			CACertPath:   caCertPath,
+			ClientID:     "director_to_credhub",
+			ClientSecret: "brats-config-server-secret",
+		})
+	})
+
+	createWorkloads := func() {
+		utils.UploadStemcell(candidateWardenLinuxStemcellPath)
+		uploadSlowRelease()
+		releasePath := utils.AssetPath("errand-release")
+		utils.CreateRelease(releasePath)
+		utils.UploadReleaseDir(releasePath)
+
+		session := utils.Bosh("-n", "update-config", "--type", "brats-upgrade", "--name", "workload",
+			utils.AssetPath("team-cloud-config.yml"), "-v", "team=upgrade")
+		Eventually(session, time.Minute).Should(gexec.Exit(0))
+
+		configServer.Set(fmt.Sprintf("/docker-inner/%s/greeting", variablesDeployment), "value", "hello before the upgrade")
+		session = utils.Bosh("deploy", "-n", "-d", variablesDeployment, utils.AssetPath("config-server-manifest.yml"),
+			"-o", utils.AssetPath("ops-persistent-disk.yml"),
+			"-v", fmt.Sprintf("deployment-name=%s", variablesDeployment),
+			"-v", fmt.Sprintf("stemcell-os=%s", utils.StemcellOS()),
+			"-v", "service-alternative-name=service.brats.internal",
+		)
+		Eventually(session, 15*time.Minute).Should(gexec.Exit(0))
+
+		Eventually(utils.Bosh(slowDeployArgs(sleepersDeployment, 2, 0)...), 15*time.Minute).Should(gexec.Exit(0))
+
+		session = utils.Bosh(append(slowDeployArgs(orphanDeployment, 1, 0), "-o", utils.AssetPath("ops-persistent-disk.yml"))...)
+		Eventually(session, 15*time.Minute).Should(gexec.Exit(0))
+		Eventually(utils.Bosh("-n", "-d", orphanDeployment, "delete-deployment"), 5*time.Minute).Should(gexec.Exit(0))
+	}
+
+	It("upgrades from the last final release without changing any API object", func() {
+		result := utils.UpgradeScenario{
+			Options:   configServerOptions,
+			Workloads: createWorkloads,
+		}.Run()
+
+		Expect(result.CandidateVersion).NotTo(Equal(result.PreviousVersion))
+		Expect(utils.AppliedDirectorMigrations()).To(ContainElements(utils.ExpectedDirectorMigrations()))
+
+		Expect(result.Before.PerDeployment).To(HaveKey(variablesDeployment))
+		Expect(result.Before.PerDeployment).To(HaveKey(sleepersDeployment))
+		Expect(result.Before.PerDeployment[variablesDeployment].Variables).NotTo(BeEmpty())
+		Expect(result.Before.OrphanedDisks).To(ContainElement(HaveKeyWithValue("deployment_name", orphanDeployment)))
+
+		Expect(utils.DiffSnapshots(result.Before, result.After)).To(BeEmpty(), "API objects changed across the upgrade")
+
+		By("running the deployed errand with the variables interpolated before the upgrade")
+		run := utils.RunErrand(variablesDeployment, "smoke-errand", utils.ErrandOptions{})
+		Expect(run.ExitCode).To(Equal(0))
+		Expect(run.Results).To(HaveLen(1))
+		Expect(run.Results[0].Stdout).To(ContainSubstring("greeting=hello before the upgrade"))
+	})
+})
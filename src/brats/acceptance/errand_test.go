@@ -0,0 +1,155 @@
+package acceptance_test
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+
+	"brats/utils"
+)
+
+var _ = Describe("Errands", func() {
+	const errandDeploymentName = "errands"
+
+	deploy := func(standaloneMessage string) {
+		session := utils.Bosh("deploy", "-n", "-d", errandDeploymentName, utils.AssetPath("errands-manifest.yml"),
+			"-v", fmt.Sprintf("deployment-name=%s", errandDeploymentName),
+			"-v", fmt.Sprintf("stemcell-os=%s", utils.StemcellOS()),
+			"-v", fmt.Sprintf("standalone-message=%s", standaloneMessage),
+		)
+		Eventually(session, 15*time.Minute).Should(gexec.Exit(0))
+	}
+
+	BeforeEach(func() {
+		utils.StartInnerBosh()
+		utils.UploadStemcell(candidateWardenLinuxStemcellPath)
+
+		releasePath := utils.AssetPath("errand-release")
+		utils.CreateRelease(releasePath)
+		utils.UploadReleaseDir(releasePath)
+
+		deploy("standalone")
+	})
+
+	It("runs a colocated errand on every instance of the instance group", func() {
+		run := utils.RunErrand(errandDeploymentName, "smoke-errand", utils.ErrandOptions{
+			Instances: []string{"colocated"},
+		})
+		Expect(run.ExitCode).To(Equal(0))
+		Expect(run.Results).To(HaveLen(2))
+
+		for _, result := range run.Results {
+			Expect(result.InstanceGroup()).To(Equal("colocated"))
+			Expect(result.ExitCode).To(Equal(0))
+			Expect(result.Stdout).To(ContainSubstring("stdout: colocated"))
+			Expect(result.Stderr).To(ContainSubstring("stderr: colocated"))
+		}
+	})
+
+	It("runs a colocated errand only on the instances selected with --instance", func() {
+		run := utils.RunErrand(errandDeploymentName, "smoke-errand", utils.ErrandOptions{
+			Instances: []string{"colocated"},
+		})
+		Expect(run.Results).To(HaveLen(2))
+		selected := run.Results[0].Instance
+
+		run = utils.RunErrand(errandDeploymentName, "smoke-errand", utils.ErrandOptions{
+			Instances: []string{selected},
+		})
+		Expect(run.ExitCode).To(Equal(0))
+		Expect(run.Results).To(HaveLen(1))
+		Expect(run.Results[0].Instance).To(Equal(selected))
+	})
+
+	It("runs an errand instance group and deletes its VM afterwards", func() {
+		run := utils.RunErrand(errandDeploymentName, "standalone", utils.ErrandOptions{})
+		Expect(run.ExitCode).To(Equal(0))
+		Expect(run.Results).To(HaveLen(1))
+		Expect(run.Results[0].InstanceGroup()).To(Equal("standalone"))
+		Expect(run.Results[0].Stdout).To(ContainSubstring("stdout: standalone"))
+
+		Expect(errandVMExists(errandDeploymentName, "standalone")).To(BeFalse())
+	})
+
+	It("keeps the errand VM around with --keep-alive", func() {
+		run := utils.RunErrand(errandDeploymentName, "standalone", utils.ErrandOptions{KeepAlive: true})
+		Expect(run.ExitCode).To(Equal(0))
+
+		Expect(errandVMExists(errandDeploymentName, "standalone")).To(BeTrue())
+	})
+
+	It("skips an unchanged errand with --when-changed", func() {
+		run := utils.RunErrand(errandDeploymentName, "standalone", utils.ErrandOptions{WhenChanged: true})
+		Expect(run.ExitCode).To(Equal(0))
+		Expect(run.Ran()).To(BeTrue())
+
+		run = utils.RunErrand(errandDeploymentName, "standalone", utils.ErrandOptions{WhenChanged: true})
+		Expect(run.ExitCode).To(Equal(0))
+		Expect(run.Ran()).To(BeFalse())
+
+		deploy("changed")
+
+		run = utils.RunErrand(errandDeploymentName, "standalone", utils.ErrandOptions{WhenChanged: true})
+		Expect(run.ExitCode).To(Equal(0))
+		Expect(run.Ran()).To(BeTrue())
+		Expect(run.Results[0].Stdout).To(ContainSubstring("stdout: changed"))
+	})
+
+	It("reports the exit code and output of a failing errand", func() {
+		run := utils.RunErrand(errandDeploymentName, "failing", utils.ErrandOptions{})
+		Expect(run.ExitCode).NotTo(Equal(0))
+		Expect(run.Results).To(HaveLen(1))
+		Expect(run.Results[0].ExitCode).To(Equal(3))
+		Expect(run.Results[0].Stdout).To(ContainSubstring("stdout: failing"))
+		Expect(run.Results[0].Stderr).To(ContainSubstring("stderr: failing"))
+	})
+
+	It("runs the errand on every instance group with the job when run by job name", func() {
+		run := utils.RunErrand(errandDeploymentName, "smoke-errand", utils.ErrandOptions{})
+		Expect(run.ExitCode).NotTo(Equal(0))
+
+		exitCodes := map[string]int{}
+		for _, result := range run.Results {
+			exitCodes[result.InstanceGroup()] = result.ExitCode
+		}
+		Expect(exitCodes).To(Equal(map[string]int{
+			"colocated":  0,
+			"standalone": 0,
+			"failing":    3,
+		}))
+		Expect(run.Results).To(HaveLen(4))
+	})
+
+	It("downloads the errand logs with --download-logs", func() {
+		run := utils.RunErrand(errandDeploymentName, "standalone", utils.ErrandOptions{DownloadLogs: true})
+		Expect(run.ExitCode).To(Equal(0))
+		Expect(run.Results).To(HaveLen(1))
+		Expect(run.Results[0].LogsTarball).NotTo(BeEmpty())
+
+		files, err := utils.ReadLogsTarball(run.Results[0].LogsTarball)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(HaveKeyWithValue(HaveSuffix("smoke-errand/errand.log"), ContainSubstring("log: standalone")))
+	})
+})
+
+func errandVMExists(deployment, instanceGroup string) bool {
+	session := utils.Bosh("-n", "-d", deployment, "vms", "--json")
+	Eventually(session, time.Minute).Should(gexec.Exit(0))
+
+	output, err := utils.ParseCLIOutput(session.Out.Contents())
+	Expect(err).NotTo(HaveOccurred())
+
+	for _, table := range output.Tables {
+		for _, row := range table.Rows {
+			if strings.HasPrefix(row["instance"], instanceGroup+"/") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
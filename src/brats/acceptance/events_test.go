@@ -0,0 +1,89 @@
+package acceptance_test
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+
+	"brats/events"
+	"brats/utils"
+)
+
+var _ = Describe("Director events", func() {
+	var (
+		client *events.Client
+		trail  *events.Trail
+	)
+
+	BeforeEach(func() {
+		utils.StartInnerBosh()
+		utils.UploadStemcell(candidateWardenLinuxStemcellPath)
+		uploadSlowRelease()
+
+		client = events.NewClient(utils.InnerDirectorClient())
+
+		var err error
+		trail, err = client.StartTrail()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("records the lifecycle of a deployment", func() {
+		deploy := utils.Bosh(slowDeployArgs("audited", 1, 0)...)
+		Eventually(deploy, 15*time.Minute).Should(gexec.Exit(0))
+		deployTask := strconv.Itoa(taskIDOf(deploy))
+
+		recorded, err := trail.Events(events.Filter{Deployment: "audited"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorded).To(events.HaveEvent(
+			events.Action("create"),
+			events.ObjectType("deployment"),
+			events.ObjectName("audited"),
+			events.Task(deployTask),
+			events.User("admin"),
+			events.WithoutError(),
+		))
+		Expect(recorded).To(events.HaveEvent(
+			events.Action("create"),
+			events.ObjectType("instance"),
+			events.Task(deployTask),
+		))
+
+		byTask, err := client.List(events.Filter{Task: deployTask})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(byTask).NotTo(BeEmpty())
+		Expect(byTask).To(HaveEach(events.MatchEvent(events.Task(deployTask), events.Deployment("audited"))))
+
+		deleteDeployment := utils.Bosh("-n", "-d", "audited", "delete-deployment")
+		Eventually(deleteDeployment, 10*time.Minute).Should(gexec.Exit(0))
+
+		recorded, err = trail.Events(events.Filter{Deployment: "audited", ObjectType: "deployment"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorded).To(events.HaveEvent(
+			events.Action("delete"),
+			events.ObjectName("audited"),
+			events.Task(strconv.Itoa(taskIDOf(deleteDeployment))),
+			events.WithoutError(),
+		))
+	})
+
+	It("records exactly one event per config update", func() {
+		cloudConfigName := fmt.Sprintf("events-%d", GinkgoParallelProcess())
+		DeferCleanup(func() {
+			session := utils.Bosh("-n", "delete-config", "--type", "cloud", "--name", cloudConfigName)
+			Eventually(session, time.Minute).Should(gexec.Exit(0))
+		})
+
+		session := utils.Bosh("-n", "update-config", "--type", "cloud", "--name", cloudConfigName, utils.AssetPath("cpi-config.yml"))
+		Eventually(session, time.Minute).Should(gexec.Exit(0))
+
+		recorded, err := trail.Events(events.Filter{ObjectType: "config/cloud"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorded).To(HaveExactElements(
+			events.MatchEvent(events.Action("create"), events.ObjectName(cloudConfigName), events.User("admin"), events.WithoutError()),
+		))
+	})
+})
@@ -3,13 +3,61 @@ package acceptance_test
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"brats/certs"
+	"brats/db"
+	"brats/fakes/externaldb"
 	"brats/utils"
 )
 
+var _ = Describe("Director external database TLS connections to a local database", func() {
+	const notRunning = "Error: 'bosh/[0-9a-f]{8}-[0-9a-f-]{27} \\(0\\)' is not running after update"
+
+	DescribeTable("DB Connections",
+		func(databaseType string, mutualTLSEnabled bool, tamper func(*externaldb.Server, *utils.ExternalDBConfig)) {
+			server, dbConfig := utils.StartLocalExternalDB(databaseType, mutualTLSEnabled)
+			utils.CreateDB(dbConfig)
+
+			if tamper == nil {
+				DeferCleanup(utils.StopInnerBosh)
+				utils.StartInnerBosh(utils.InnerBoshWithExternalDBOptions(dbConfig)...)
+
+				client, err := db.Connect(dbConfig.DBConfig())
+				Expect(err).NotTo(HaveOccurred())
+				defer client.Close() //nolint:errcheck
+				Expect(client.Tables(dbConfig.DBName)).To(ContainElement("schema_migrations"), "the director did not migrate its database")
+				return
+			}
+
+			tamper(server, dbConfig)
+			DeferCleanup(utils.StopInnerBosh)
+			utils.StartInnerBoshWithExpectation(true, notRunning, utils.InnerBoshWithExternalDBOptions(dbConfig)...)
+		},
+		Entry("allows TLS connections to MYSQL", db.MySQL, false, nil),
+		Entry("allows TLS connections to POSTGRES", db.Postgres, false, nil),
+		Entry("allows mutual TLS connections to MYSQL", db.MySQL, true, nil),
+		Entry("allows mutual TLS connections to POSTGRES", db.Postgres, true, nil),
+		Entry("fails to connect to MYSQL with an incorrect CA", db.MySQL, true, trustWrongCA),
+		Entry("fails to connect to POSTGRES with an incorrect CA", db.Postgres, true, trustWrongCA),
+		Entry("fails to connect to MYSQL requiring a client certificate without one", db.MySQL, true, withoutClientCertificate),
+		Entry("fails to connect to POSTGRES requiring a client certificate without one", db.Postgres, true, withoutClientCertificate),
+	)
+})
+
+func trustWrongCA(server *externaldb.Server, dbConfig *utils.ExternalDBConfig) {
+	dbConfig.CACertPath = server.WrongCACertPath()
+}
+
+func withoutClientCertificate(_ *externaldb.Server, dbConfig *utils.ExternalDBConfig) {
+	dbConfig.ClientCertPath = ""
+	dbConfig.ClientKeyPath = ""
+}
+
+// These need RDS and Cloud SQL instances and their *_EXTERNAL_DB_* secrets.
 var _ = PDescribe("Director external database TLS connections", func() {
 	testDBConnectionOverTLS := func(databaseType string, mutualTLSEnabled bool, useIncorrectCA bool) {
 		tmpCertDir, err := os.MkdirTemp("", fmt.Sprintf("db_tls_%d", GinkgoParallelProcess()))
@@ -21,7 +69,10 @@ var _ = PDescribe("Director external database TLS connections", func() {
 
 		realCACertPath := dbConfig.CACertPath
 		if useIncorrectCA {
-			dbConfig.CACertPath = utils.AssetPath("external_db/invalid_ca_cert.pem")
+			wrongCA, err := certs.NewCA(certs.Options{CommonName: "invalid-ca"})
+			Expect(err).ToNot(HaveOccurred())
+			dbConfig.CACertPath = filepath.Join(tmpCertDir, "invalid_ca_cert.pem")
+			Expect(os.WriteFile(dbConfig.CACertPath, wrongCA.CertPEM(), 0o644)).To(Succeed())
 		}
 
 		startInnerBoshArgs := utils.InnerBoshWithExternalDBOptions(dbConfig)
@@ -15,6 +15,8 @@ import (
 var _ = Describe("logging", func() {
 	var cpiConfigName string
 
+	secretLeaks := utils.DetectSecretLeaks()
+
 	BeforeEach(func() {
 		cpiConfigName = fmt.Sprintf("%s-logging-test-fake-cpi-config-%d", time.Now().Format("2006-01-02"), GinkgoParallelProcess())
 		utils.StartInnerBosh()
@@ -33,12 +35,31 @@ var _ = Describe("logging", func() {
 		Expect(err).NotTo(HaveOccurred())
 		Expect(string(content)).To(ContainSubstring(redactable))
 
+		cpiConfigSecrets, err := utils.ManifestSecrets("the cpi config", content)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cpiConfigSecrets).NotTo(BeEmpty())
+		secretLeaks.Add(cpiConfigSecrets...)
+
+		directorLogs := utils.TailInnerDirectorLogs(utils.DirectorLog, utils.WorkerLogs)
+		cursor := directorLogs.Cursor()
+
 		session := utils.Bosh("-n", "update-config", "--type", "cpi", "--name", cpiConfigName, configPath)
 		Eventually(session, 1*time.Minute).Should(gexec.Exit(0))
 
-		session = utils.OuterBoshQuiet("-d", utils.InnerBoshDirectorName(), "ssh", "bosh", "-c", "sudo cat /var/vcap/sys/log/director/*")
-		Eventually(session, 2*time.Minute).Should(gexec.Exit(0))
-		Expect(string(session.Out.Contents())).To(ContainSubstring(`INSERT INTO "configs" <redacted>`))
-		Expect(string(session.Out.Contents())).NotTo(ContainSubstring(redactable))
+		Eventually(directorLogs.Since(cursor), 2*time.Minute).Should(utils.ContainLogEntry(
+			utils.Component("Director"),
+			utils.Message(`INSERT INTO "configs" <redacted>`),
+		))
+
+		// Not every process of the director job writes log entries the
+		// tail parses, e.g. to stderr, so their files are searched as is.
+		logs := utils.FetchInnerDirectorFiles(utils.DirectorLogDir)
+		Expect(logs).To(HaveKey(utils.DirectorLog))
+		Expect(logs).To(HaveKey(utils.SchedulerLog))
+		Expect(logs).To(HaveKey(utils.SyncDNSLog))
+		Expect(logs).To(HaveKey(utils.DirectorLogDir + "/director.stderr.log"))
+		for path, contents := range logs {
+			Expect(contents).NotTo(ContainSubstring(redactable), "%s logged a credential", path)
+		}
 	})
 })
@@ -3,11 +3,10 @@ package acceptance_test
 import (
 	"fmt"
 	"io"
-	"time"
+	"net/http"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
-	"github.com/onsi/gomega/gexec"
 
 	"brats/utils"
 )
@@ -21,22 +20,25 @@ var _ = Describe("nginx with ngx_http_stub_status_module compiled", func() {
 	})
 
 	It("returns metrics when curling metrics endpoints for nginx, blobstore, and nats", func() {
-		session := utils.OuterBosh("-d", utils.InnerBoshDirectorName(), "ssh", "bosh", "-c", "curl -vk https://127.0.0.1:25555/stats")
-		Eventually(session, time.Minute).Should(gexec.Exit(0))
-		Expect(string(session.Out.Contents())).To(ContainSubstring("HTTP/1.1 200 OK"))
-		Expect(string(session.Out.Contents())).To(ContainSubstring("server accepts handled requests"))
-
-		session = utils.OuterBosh("-d", utils.InnerBoshDirectorName(), "ssh", "bosh", "-c", "curl -vk https://127.0.0.1:25250/stats")
-		Eventually(session, time.Minute).Should(gexec.Exit(0))
-		Expect(string(session.Out.Contents())).To(ContainSubstring("HTTP/1.1 200 OK"))
-		Expect(string(session.Out.Contents())).To(ContainSubstring("server accepts handled requests"))
-
-		session = utils.OuterBosh("-d", utils.InnerBoshDirectorName(), "ssh", "bosh", "-c", "curl -v http://localhost:8222")
-		Eventually(session, time.Minute).Should(gexec.Exit(0))
-		Expect(string(session.Out.Contents())).To(ContainSubstring("HTTP/1.1 200 OK"))
+		directorHTTPClient := utils.InnerDirectorHTTPClient()
+		for _, url := range []string{"https://127.0.0.1:25555/stats", "https://127.0.0.1:25250/stats"} {
+			resp, err := directorHTTPClient.Get(url)
+			Expect(err).NotTo(HaveOccurred())
+			contents, err := io.ReadAll(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Body.Close()).To(Succeed())
+
+			Expect(resp.StatusCode).To(Equal(http.StatusOK), url)
+			Expect(string(contents)).To(ContainSubstring("server accepts handled requests"), url)
+		}
+
+		resp, err := directorHTTPClient.Get("http://127.0.0.1:8222")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
 
 		metricsClient := utils.MetricsServerHTTPClient()
-		resp, err := metricsClient.Get(fmt.Sprintf("https://%s:9091/metrics", utils.InnerDirectorIP()))
+		resp, err = metricsClient.Get(fmt.Sprintf("https://%s:9091/metrics", utils.InnerDirectorIP()))
 		Expect(err).NotTo(HaveOccurred())
 		defer resp.Body.Close() //nolint:errcheck
 
@@ -0,0 +1,80 @@
+package acceptance_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+
+	"brats/utils"
+)
+
+var _ = Describe("NATS authorization sync", func() {
+	const (
+		deployment = "nats-sync"
+		// bosh-nats-sync polls the director every 10 seconds, and then
+		// reloads the NATS server.
+		syncTimeout  = 2 * time.Minute
+		syncInterval = 10 * time.Second
+	)
+
+	var director *utils.DirectorClient
+
+	BeforeEach(func() {
+		utils.StartInnerBosh("-o", utils.AssetPath("ops-enable-nats-monitoring.yml"))
+		utils.UploadStemcell(candidateWardenLinuxStemcellPath)
+		uploadSlowRelease()
+
+		director = utils.InnerDirectorClient()
+	})
+
+	deploy := func(instances int) {
+		Eventually(utils.Bosh(slowDeployArgs(deployment, instances, 0)...), 20*time.Minute).Should(gexec.Exit(0))
+	}
+
+	expectAuthorizationInSync := func() {
+		Eventually(func() []string {
+			vms, err := director.AllVMs()
+			Expect(err).NotTo(HaveOccurred())
+			return utils.NATSAuthorizationMismatches(vms, utils.InnerNATSAuthConfig(), utils.InnerNATSConnections())
+		}, syncTimeout, syncInterval).Should(BeEmpty())
+	}
+
+	It("authorizes exactly the agents of the director's VMs", func() {
+		By("deploying", func() {
+			deploy(2)
+			expectAuthorizationInSync()
+		})
+
+		By("scaling up", func() {
+			deploy(4)
+			expectAuthorizationInSync()
+		})
+
+		By("scaling down", func() {
+			deploy(1)
+			expectAuthorizationInSync()
+		})
+
+		By("deleting the deployment", func() {
+			Eventually(utils.Bosh("-n", "-d", deployment, "delete-deployment"), 10*time.Minute).Should(gexec.Exit(0))
+			expectAuthorizationInSync()
+			Expect(utils.InnerNATSAuthConfig().AgentUsers()).To(BeEmpty())
+		})
+	})
+
+	It("rejects an agent's certificate once its VM is gone", func() {
+		deploy(2)
+		credentials := utils.AgentNATSCredentials(deployment, "sleeper/1")
+		Expect(utils.NATSConnect(credentials)).To(Succeed())
+
+		deploy(1)
+		Eventually(func() error {
+			return utils.NATSConnect(credentials)
+		}, syncTimeout, syncInterval).Should(MatchError(ContainSubstring("Authorization Violation")))
+
+		By("still accepting the remaining agent")
+		Expect(utils.NATSConnect(utils.AgentNATSCredentials(deployment, "sleeper/0"))).To(Succeed())
+	})
+})
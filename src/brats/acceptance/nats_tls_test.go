@@ -0,0 +1,153 @@
+package acceptance_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+
+	"brats/certs"
+	"brats/nats"
+	"brats/utils"
+)
+
+var _ = Describe("NATS mutual TLS", func() {
+	const directorCN = "default.director.bosh-internal"
+
+	var natsCA *certs.Certificate
+
+	BeforeEach(func() {
+		utils.StartInnerBosh()
+
+		var err error
+		natsCA, err = certs.Parse(
+			[]byte(utils.InnerBoshCredential("/nats_ca/certificate")),
+			[]byte(utils.InnerBoshCredential("/nats_ca/private_key")),
+		)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	// credentials verify the server with the NATS CA and authenticate with
+	// client, or with no certificate if it is nil.
+	credentials := func(client *certs.Certificate) utils.NATSCredentials {
+		c := utils.NATSCredentials{CA: string(natsCA.CertPEM())}
+		if client != nil {
+			c.Certificate = string(client.CertPEM())
+			c.PrivateKey = string(client.KeyPEM())
+		}
+		return c
+	}
+
+	// directorSubject issues a certificate for the director's identity, so
+	// that only what else is wrong with it can be the reason to refuse it.
+	directorSubject := func(issuer *certs.Certificate, validity certs.Validity) *certs.Certificate {
+		client, err := issuer.Client(certs.Options{
+			CommonName:   directorCN,
+			Country:      "USA",
+			Organization: "Cloud Foundry",
+			Validity:     validity,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return client
+	}
+
+	It("accepts the director's certificate", func() {
+		Expect(utils.NATSConnect(utils.NATSCredentials{
+			CA:          utils.InnerBoshCredential("/nats_server_tls/ca"),
+			Certificate: utils.InnerBoshCredential("/nats_clients_director_tls/certificate"),
+			PrivateKey:  utils.InnerBoshCredential("/nats_clients_director_tls/private_key"),
+		})).To(Succeed())
+
+		By("and a certificate the NATS CA issued for the director's identity")
+		Expect(utils.NATSConnect(credentials(directorSubject(natsCA, certs.Validity{})))).To(Succeed())
+	})
+
+	It("rejects a connection without a client certificate", func() {
+		err := utils.NATSConnect(credentials(nil))
+		Expect(err).To(HaveOccurred())
+		Expect(nats.IsAuthorizationViolation(err)).To(BeFalse(), "the TLS handshake refuses the client before NATS authorizes it")
+	})
+
+	It("rejects a client certificate from another CA", func() {
+		otherCA, err := certs.NewCA(certs.Options{CommonName: "nats_ca"})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(utils.NATSConnect(credentials(directorSubject(otherCA, certs.Validity{})))).NotTo(Succeed())
+	})
+
+	It("rejects an expired client certificate", func() {
+		Expect(utils.NATSConnect(credentials(directorSubject(natsCA, certs.Expired())))).NotTo(Succeed())
+	})
+
+	It("rejects a client certificate for an identity it does not authorize", func() {
+		client, err := natsCA.Client(certs.Options{
+			CommonName:   "not-an-agent.agent.bosh-internal",
+			Country:      "USA",
+			Organization: "Cloud Foundry",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = utils.NATSConnect(credentials(client))
+		Expect(nats.IsAuthorizationViolation(err)).To(BeTrue(), "expected an authorization violation, got %v", err)
+	})
+
+	Context("with an agent's certificate", func() {
+		const deployment = "nats-tls"
+
+		var (
+			conn       *nats.Conn
+			agentID    string
+			otherAgent string
+		)
+
+		BeforeEach(func() {
+			utils.UploadStemcell(candidateWardenLinuxStemcellPath)
+			uploadSlowRelease()
+			Eventually(utils.Bosh(slowDeployArgs(deployment, 2, 0)...), 20*time.Minute).Should(gexec.Exit(0))
+
+			vms, err := utils.InnerDirectorClient().VMs(deployment)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vms).To(HaveLen(2))
+			for _, vm := range vms {
+				if vm.Index == 0 {
+					agentID = vm.AgentID
+				} else {
+					otherAgent = vm.AgentID
+				}
+			}
+
+			conn, err = utils.ConnectInnerNATS(utils.AgentNATSCredentials(deployment, "sleeper/0"))
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(conn.Close)
+		})
+
+		It("may subscribe to its own subject", func() {
+			_, err := conn.Subscribe("agent." + agentID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conn.Flush()).To(Succeed())
+		})
+
+		DescribeTable("may not subscribe outside its own subject",
+			func(subject func() string) {
+				_, err := conn.Subscribe(subject())
+				Expect(err).NotTo(HaveOccurred())
+
+				err = conn.Flush()
+				Expect(nats.IsPermissionsViolation(err)).To(BeTrue(), "expected a permissions violation, got %v", err)
+			},
+			Entry("another agent's subject", func() string { return "agent." + otherAgent }),
+			Entry("every agent's subject", func() string { return "agent.*" }),
+			Entry("the director's subjects", func() string { return "director.>" }),
+			Entry("the health monitor's subjects", func() string { return "hm.agent.heartbeat.*" }),
+			Entry("every subject", func() string { return ">" }),
+		)
+
+		It("may not publish to another agent as the director would", func() {
+			Expect(conn.Publish("agent."+otherAgent, []byte(`{"method":"ping","arguments":[]}`))).To(Succeed())
+
+			err := conn.Flush()
+			Expect(nats.IsPermissionsViolation(err)).To(BeTrue(), "expected a permissions violation, got %v", err)
+		})
+	})
+})
@@ -1,38 +1,125 @@
 package acceptance_test
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"net"
+	"strconv"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gexec"
 
+	"brats/db"
+	"brats/dbintegrity"
 	"brats/utils"
 )
 
 var _ = Describe("postgres", func() {
 	Context("postgres-15", func() {
-		const upgradeTimeout = 20 * time.Minute
+		const (
+			upgradeTimeout = 20 * time.Minute
+			queryTimeout   = 5 * time.Minute
+		)
 
-		It("Upgrades from 13", func() {
-			postgresDeploymentName := fmt.Sprintf("postgres-13-to-postgres-15-%x", GinkgoT().RandomSeed())
+		dataset := dbintegrity.DefaultDataset()
 
-			postgres13Manifest := utils.AssetPath("postgres-13-manifest.yml")
-			session := utils.OuterBosh("deploy", "-n", postgres13Manifest,
-				"-d", postgresDeploymentName,
+		deploy := func(deploymentName, manifest string) *gexec.Session {
+			session := utils.OuterBosh("deploy", "-n", utils.AssetPath(manifest),
+				"-d", deploymentName,
 				"-v", fmt.Sprintf("stemcell-os=%s", utils.StemcellOS()),
-				"-v", fmt.Sprintf("deployment-name=%s", postgresDeploymentName),
+				"-v", fmt.Sprintf("deployment-name=%s", deploymentName),
 			)
-			Eventually(session, upgradeTimeout).Should(gexec.Exit(0))
+			Eventually(session, upgradeTimeout).Should(gexec.Exit())
+			return session
+		}
 
-			postgres15Manifest := utils.AssetPath("postgres-manifest.yml")
-			session = utils.OuterBosh("deploy", "-n", postgres15Manifest,
-				"-d", postgresDeploymentName,
-				"-v", fmt.Sprintf("stemcell-os=%s", utils.StemcellOS()),
-				"-v", fmt.Sprintf("deployment-name=%s", postgresDeploymentName),
-			)
-			Eventually(session, upgradeTimeout).Should(gexec.Exit(0))
+		ssh := func(deploymentName, command string) *gexec.Session {
+			session := utils.OuterBosh("-d", deploymentName, "ssh", "bosh/0", "-c", command)
+			Eventually(session, 5*time.Minute).Should(gexec.Exit())
+			return session
+		}
+
+		// connect reaches the deployment's database through an ssh tunnel to
+		// its VM, on which postgres only listens on the loopback interface.
+		// The tunnel stays open until the spec ends.
+		connect := func(deploymentName string) *sql.DB {
+			address := utils.StartOuterTunnel(deploymentName, "bosh/0", "127.0.0.1:5432")
+			host, port, err := net.SplitHostPort(address)
+			Expect(err).NotTo(HaveOccurred())
+			portNumber, err := strconv.Atoi(port)
+			Expect(err).NotTo(HaveOccurred())
+
+			conn, err := db.Config{
+				Type:      db.Postgres,
+				Host:      host,
+				Port:      portNumber,
+				User:      "postgres",
+				Password:  "c1oudc0w",
+				Plaintext: true,
+			}.Open("bosh")
+			Expect(err).NotTo(HaveOccurred())
+			return conn
+		}
+
+		report := func(deploymentName string) dbintegrity.Report {
+			ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+			defer cancel()
+
+			conn := connect(deploymentName)
+			defer conn.Close() //nolint:errcheck
+
+			report, err := dbintegrity.ReadReport(ctx, conn)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dataset.Verify(report)).To(Succeed())
+			return report
+		}
+
+		seed := func(deploymentName string) dbintegrity.Report {
+			Expect(deploy(deploymentName, "postgres-13-manifest.yml")).To(gexec.Exit(0))
+
+			By("seeding postgres-13")
+			ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+			defer cancel()
+			conn := connect(deploymentName)
+			Expect(dataset.Seed(ctx, conn)).To(Succeed())
+			Expect(conn.Close()).To(Succeed())
+
+			return report(deploymentName)
+		}
+
+		It("Upgrades from 13", func() {
+			postgresDeploymentName := fmt.Sprintf("postgres-13-to-postgres-15-%x", GinkgoT().RandomSeed())
+			before := seed(postgresDeploymentName)
+
+			Expect(deploy(postgresDeploymentName, "postgres-manifest.yml")).To(gexec.Exit(0))
+
+			By("comparing the data postgres-15 imported")
+			Expect(report(postgresDeploymentName)).To(Equal(before))
+		})
+
+		It("Retries an upgrade from 13 that was interrupted", func() {
+			postgresDeploymentName := fmt.Sprintf("postgres-13-to-postgres-15-retry-%x", GinkgoT().RandomSeed())
+			before := seed(postgresDeploymentName)
+
+			By("killing pg_upgrade as soon as the pre-start runs it")
+			// The VM survives the update, so the watcher is still there when
+			// the postgres-15 pre-start starts importing.
+			session := ssh(postgresDeploymentName, `sudo setsid nohup bash -c 'until pkill -9 -x pg_upgrade; do sleep 0.05; done; touch /tmp/pg_upgrade-interrupted' > /dev/null 2>&1 < /dev/null &`)
+			Expect(session).To(gexec.Exit(0))
+
+			Expect(deploy(postgresDeploymentName, "postgres-manifest.yml")).To(gexec.Exit(1))
+
+			session = ssh(postgresDeploymentName, `sudo pkill -f '[u]ntil pkill -9 -x pg_upgrade'; test -f /tmp/pg_upgrade-interrupted`)
+			Expect(session).To(gexec.Exit(0), "the deploy failed before pg_upgrade ran")
+
+			By("retrying the upgrade")
+			Expect(deploy(postgresDeploymentName, "postgres-manifest.yml")).To(gexec.Exit(0))
+
+			By("comparing the data postgres-15 imported")
+			Expect(report(postgresDeploymentName)).To(Equal(before))
 		})
 	})
 })
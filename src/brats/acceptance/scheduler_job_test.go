@@ -5,7 +5,6 @@ import (
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
-	"github.com/onsi/gomega/gexec"
 
 	"brats/utils"
 )
@@ -16,7 +15,11 @@ var _ = Describe("Scheduled jobs", func() {
 	})
 
 	It("schedules jobs on intervals", func() {
-		session := utils.OuterBosh("-d", utils.InnerBoshDirectorName(), "ssh", "-c", `sudo grep Bosh::Director::Jobs::ScheduledOrphanedVMCleanup.has_work:false /var/vcap/sys/log/director/scheduler.stdout.log`)
-		Eventually(session, 10*time.Minute).Should(gexec.Exit(0))
+		schedulerLog := utils.TailInnerDirectorLogs(utils.SchedulerLog)
+		Eventually(schedulerLog, 10*time.Minute, 5*time.Second).Should(utils.ContainLogEntry(
+			utils.Level("DEBUG"),
+			utils.Component("Scheduler"),
+			utils.Message("Bosh::Director::Jobs::ScheduledOrphanedVMCleanup.has_work:false"),
+		))
 	})
 })
@@ -0,0 +1,125 @@
+package acceptance_test
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+
+	"brats/utils"
+)
+
+var _ = Describe("Task cancellation and worker crash recovery", func() {
+	const (
+		deployment    = "interrupted"
+		deployTimeout = 20 * time.Minute
+	)
+
+	var director *utils.DirectorClient
+
+	startLongDeploy := func() (*gexec.Session, int) {
+		session := utils.Bosh(slowDeployArgs(deployment, 2, 600)...)
+		taskID := utils.WaitForTaskID(session, 10*time.Minute)
+
+		utils.WaitForTaskState(director, taskID, 10*time.Minute, utils.TaskStateProcessing)
+		utils.WaitForTaskLocks(director, taskID, 10*time.Minute)
+
+		return session, taskID
+	}
+
+	expectRetryConverges := func() {
+		session := utils.Bosh(slowDeployArgs(deployment, 2, 0)...)
+		Eventually(session, deployTimeout).Should(gexec.Exit(0))
+
+		session = utils.Bosh("-n", "-d", deployment, "instances", "--json")
+		Eventually(session, time.Minute).Should(gexec.Exit(0))
+
+		output, err := utils.ParseCLIOutput(session.Out.Contents())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output.Tables).To(HaveLen(1))
+		Expect(output.Tables[0].Rows).To(HaveLen(2))
+		for _, row := range output.Tables[0].Rows {
+			Expect(row["process_state"]).To(Equal("running"))
+		}
+	}
+
+	// monitWorkers has monit stop, start or restart every worker.
+	monitWorkers := func(action string) {
+		utils.InnerDirectorRun(fmt.Sprintf(
+			`for worker in $(/var/vcap/bosh/bin/monit summary | grep -o "'worker_[0-9]*'" | tr -d "'"); do /var/vcap/bosh/bin/monit %s "${worker}"; done`,
+			action,
+		))
+	}
+
+	// expectWorkers waits until monit reports every worker in state, e.g.
+	// "running" or "not monitored".
+	expectWorkers := func(state string) {
+		Eventually(func() (int, error) {
+			result, err := utils.InnerDirectorSSHClient().Sudo().Run(fmt.Sprintf(
+				`! /var/vcap/bosh/bin/monit summary | grep "'worker_" | grep -vi %q`, state,
+			))
+			if err != nil {
+				return 0, err
+			}
+			return result.ExitStatus, nil
+		}, 5*time.Minute, 10*time.Second).Should(Equal(0))
+	}
+
+	BeforeEach(func() {
+		utils.StartInnerBosh()
+		utils.UploadStemcell(candidateWardenLinuxStemcellPath)
+		uploadSlowRelease()
+
+		director = utils.InnerDirectorClient()
+	})
+
+	It("cancels a running deploy and releases its locks", func() {
+		deploy, taskID := startLongDeploy()
+
+		session := utils.Bosh("cancel-task", strconv.Itoa(taskID))
+		Eventually(session, time.Minute).Should(gexec.Exit(0))
+
+		task := utils.WaitForTaskState(director, taskID, time.Minute, utils.TaskStateCancelling, utils.TaskStateCancelled)
+		if task.State == utils.TaskStateCancelling {
+			utils.WaitForTaskState(director, taskID, deployTimeout, utils.TaskStateCancelled)
+		}
+		Eventually(deploy, time.Minute).Should(gexec.Exit())
+		Expect(deploy.ExitCode()).NotTo(Equal(0))
+
+		utils.WaitForTaskLocksReleased(director, taskID, 2*time.Minute)
+		expectRetryConverges()
+	})
+
+	// Monit takes a worker down with the job's stop program, which kills
+	// the task's forked process along with it before either records an
+	// outcome: the task stays 'processing', without a result, until the
+	// director finds its checkpoint stale and reports it timed out. Stopping
+	// and restarting only differ in whether the workers come back on their
+	// own.
+	DescribeTable("times out the task when monit takes down the worker running it",
+		func(action, stateAfter string) {
+			deploy, taskID := startLongDeploy()
+
+			By(fmt.Sprintf("having monit %s every worker", action))
+			monitWorkers(action)
+			expectWorkers(stateAfter)
+
+			task := utils.WaitForTaskState(director, taskID, 10*time.Minute, utils.TaskStateTimeout)
+			Expect(task.Result).To(BeEmpty())
+			Eventually(deploy, time.Minute).Should(gexec.Exit())
+			Expect(deploy.ExitCode()).NotTo(Equal(0))
+
+			By("making sure every worker runs again")
+			monitWorkers("start")
+			expectWorkers("running")
+
+			utils.WaitForTaskLocksReleased(director, taskID, 5*time.Minute)
+			expectRetryConverges()
+		},
+		Entry("when it stops them", "stop", "not monitored"),
+		Entry("when it restarts them", "restart", "running"),
+	)
+})
@@ -0,0 +1,233 @@
+package acceptance_test
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+
+	"brats/fakes/uaa"
+	"brats/utils"
+)
+
+var _ = Describe("Team multi-tenancy", Ordered, func() {
+	const (
+		alphaDeployment = "alpha-app"
+		betaDeployment  = "beta-app"
+	)
+
+	// tenant is an identity and what the director lets it see of the
+	// deployments and configs the alpha and beta admins create. A nil list
+	// means the identity may not list that kind of object at all.
+	type tenant struct {
+		client      string
+		scopes      []string
+		deployments []string
+		tasks       []string
+		events      []string
+		configs     []string
+	}
+
+	tenants := []tenant{
+		{
+			client:      "alpha-admin",
+			scopes:      []string{"bosh.teams.alpha.admin"},
+			deployments: []string{alphaDeployment},
+			tasks:       []string{alphaDeployment},
+			events:      []string{alphaDeployment, betaDeployment},
+			configs:     []string{"alpha"},
+		},
+		{
+			client:      "beta-admin",
+			scopes:      []string{"bosh.teams.beta.admin"},
+			deployments: []string{betaDeployment},
+			tasks:       []string{betaDeployment},
+			events:      []string{alphaDeployment, betaDeployment},
+			configs:     []string{"beta"},
+		},
+		{
+			// Team readers can read their team's configs and the event
+			// log, but not list deployments or tasks.
+			client:  "alpha-reader",
+			scopes:  []string{"bosh.teams.alpha.read"},
+			events:  []string{alphaDeployment, betaDeployment},
+			configs: []string{"alpha"},
+		},
+		{
+			client:      "auditor",
+			scopes:      []string{"bosh.read"},
+			deployments: []string{alphaDeployment, betaDeployment},
+			tasks:       []string{alphaDeployment, betaDeployment},
+			events:      []string{alphaDeployment, betaDeployment},
+			configs:     []string{"alpha", "beta"},
+		},
+	}
+
+	var identities map[string]*utils.BoshIdentity
+
+	// column lists the distinct values of a column of the identity's
+	// --json output that are among relevant, ignoring objects other specs
+	// left behind on the director. It returns nil if the director refused
+	// the identity.
+	column := func(identity *utils.BoshIdentity, name string, relevant []string, args ...string) []string {
+		session := identity.Bosh(append(args, "--json")...)
+		Eventually(session, time.Minute).Should(gexec.Exit())
+		if session.ExitCode() != 0 {
+			Expect(string(session.Out.Contents())).To(ContainSubstring("Require one of the scopes"),
+				"%s failed for %s for another reason than missing scopes", strings.Join(args, " "), identity.Client)
+			return nil
+		}
+
+		output, err := utils.ParseCLIOutput(session.Out.Contents())
+		Expect(err).NotTo(HaveOccurred())
+
+		values := []string{}
+		for _, table := range output.Tables {
+			for _, row := range table.Rows {
+				if slices.Contains(relevant, row[name]) && !slices.Contains(values, row[name]) {
+					values = append(values, row[name])
+				}
+			}
+		}
+		return values
+	}
+
+	teamConfig := func(identity *utils.BoshIdentity, configType, team string, vars ...string) {
+		args := []string{"-n", "update-config", "--type", configType, "--name", team,
+			utils.AssetPath(fmt.Sprintf("team-%s-config.yml", configType)),
+			"-v", fmt.Sprintf("team=%s", team),
+		}
+		for _, v := range vars {
+			args = append(args, "-v", v)
+		}
+		Eventually(identity.Bosh(args...), time.Minute).Should(gexec.Exit(0))
+	}
+
+	deployAs := func(identity *utils.BoshIdentity, deployment string, args ...string) *gexec.Session {
+		session := identity.Bosh(append(slowDeployArgs(deployment, 1, 0), args...)...)
+		Eventually(session, 15*time.Minute).Should(gexec.Exit())
+		return session
+	}
+
+	BeforeAll(func() {
+		var clients []uaa.Client
+		for _, t := range tenants {
+			clients = append(clients, uaa.Client{ID: t.client, Secret: t.client + "-secret", Scopes: t.scopes})
+		}
+		startInnerBoshWithFakeUAA(clients...)
+
+		utils.UploadStemcell(candidateWardenLinuxStemcellPath)
+		uploadSlowRelease()
+		releasePath := utils.AssetPath("errand-release")
+		utils.CreateRelease(releasePath)
+		utils.UploadReleaseDir(releasePath)
+
+		identities = map[string]*utils.BoshIdentity{}
+		for _, t := range tenants {
+			identities[t.client] = utils.LogInToInnerBosh(t.client, t.client+"-secret")
+		}
+
+		DeferCleanup(func() {
+			// Not every spec creates every config, so a failing delete is
+			// expected here.
+			for _, team := range []string{"alpha", "beta"} {
+				for _, configType := range []string{"cloud", "runtime"} {
+					Eventually(utils.Bosh("-n", "delete-config", "--type", configType, "--name", team), time.Minute).Should(gexec.Exit())
+				}
+			}
+		})
+	})
+
+	It("shows each identity only what its teams own", func() {
+		teamConfig(identities["alpha-admin"], "cloud", "alpha")
+		teamConfig(identities["beta-admin"], "cloud", "beta")
+
+		Expect(deployAs(identities["alpha-admin"], alphaDeployment)).To(gexec.Exit(0))
+		Expect(deployAs(identities["beta-admin"], betaDeployment)).To(gexec.Exit(0))
+
+		deployments := []string{alphaDeployment, betaDeployment}
+		configs := []string{"alpha", "beta"}
+		for _, t := range tenants {
+			By(fmt.Sprintf("listing objects as %s", t.client))
+			identity := identities[t.client]
+
+			Expect(column(identity, "name", deployments, "deployments")).To(matchVisible(t.deployments), "deployments visible to %s", t.client)
+			Expect(column(identity, "deployment", deployments, "tasks", "--recent=100", "--all")).To(matchVisible(t.tasks), "tasks visible to %s", t.client)
+			Expect(column(identity, "name", configs, "configs")).To(matchVisible(t.configs), "configs visible to %s", t.client)
+
+			// The director does not partition the event log by team: any
+			// identity allowed to read events sees every deployment's.
+			Expect(column(identity, "deployment", deployments, "events")).To(matchVisible(t.events), "events visible to %s", t.client)
+		}
+
+		session := identities["alpha-admin"].Bosh("-d", betaDeployment, "manifest")
+		Eventually(session, time.Minute).Should(gexec.Exit(1))
+		Expect(session.Out).To(gbytes.Say("Require one of the scopes"))
+	})
+
+	It("applies team cloud and runtime configs only to the team's deployments", func() {
+		teamConfig(identities["alpha-admin"], "cloud", "alpha")
+		teamConfig(identities["alpha-admin"], "runtime", "alpha", "errand-version="+releaseVersion("errand"))
+		teamConfig(identities["beta-admin"], "cloud", "beta")
+		teamConfig(identities["beta-admin"], "runtime", "beta", "errand-version="+releaseVersion("errand"))
+
+		withExtension := func(team string) []string {
+			return []string{"-o", utils.AssetPath("ops-vm-extension.yml"), "-v", fmt.Sprintf("vm-extension=%s-extension", team)}
+		}
+
+		Expect(deployAs(identities["alpha-admin"], alphaDeployment, withExtension("alpha")...)).To(gexec.Exit(0))
+
+		session := deployAs(identities["beta-admin"], betaDeployment, withExtension("alpha")...)
+		Expect(session).To(gexec.Exit(1))
+		Expect(session.Out).To(gbytes.Say("alpha-extension"))
+
+		Expect(deployAs(identities["beta-admin"], betaDeployment, withExtension("beta")...)).To(gexec.Exit(0))
+
+		alphaErrands := column(identities["alpha-admin"], "name", []string{"smoke-errand"}, "-d", alphaDeployment, "errands")
+		Expect(alphaErrands).To(ConsistOf("smoke-errand"))
+
+		alphaRun := utils.RunErrand(alphaDeployment, "smoke-errand", utils.ErrandOptions{})
+		Expect(alphaRun.ExitCode).To(Equal(0))
+		Expect(alphaRun.Results).To(HaveLen(1))
+		Expect(alphaRun.Results[0].Stdout).To(ContainSubstring("added by the alpha runtime config"))
+
+		betaRun := utils.RunErrand(betaDeployment, "smoke-errand", utils.ErrandOptions{})
+		Expect(betaRun.ExitCode).To(Equal(0))
+		Expect(betaRun.Results).To(HaveLen(1))
+		Expect(betaRun.Results[0].Stdout).To(ContainSubstring("added by the beta runtime config"))
+		Expect(betaRun.Results[0].Stdout).NotTo(ContainSubstring("alpha"))
+	})
+})
+
+// matchVisible matches what an identity listed against what it should see,
+// where nil means the director should have refused to list anything.
+func matchVisible(expected []string) OmegaMatcher {
+	if expected == nil {
+		return BeNil()
+	}
+	return ConsistOf(expected)
+}
+
+// releaseVersion is the latest uploaded version of a release, as runtime
+// configs need it spelled out.
+func releaseVersion(name string) string {
+	session := utils.Bosh("releases", "--json")
+	Eventually(session, time.Minute).Should(gexec.Exit(0))
+
+	output, err := utils.ParseCLIOutput(session.Out.Contents())
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output.Tables).To(HaveLen(1))
+
+	for _, row := range output.Tables[0].Rows {
+		if row["name"] == name {
+			return strings.TrimRight(row["version"], "*")
+		}
+	}
+	Fail(fmt.Sprintf("release %s is not uploaded", name))
+	return ""
+}
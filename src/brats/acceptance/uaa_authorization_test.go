@@ -0,0 +1,251 @@
+package acceptance_test
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+
+	"brats/fakes/uaa"
+	"brats/utils"
+)
+
+var _ = Describe("UAA authorization", Ordered, func() {
+	const (
+		directorUUIDPlaceholder = "<director-uuid>"
+		clientIDPlaceholder     = "<client-id>"
+	)
+
+	type endpoint struct {
+		method     string
+		path       string
+		body       string
+		startsTask bool
+	}
+
+	// identities are the scope combinations the permission authorizer
+	// distinguishes, keyed by the name the table entries refer to them by.
+	identities := map[string][]string{
+		"admin":             {"bosh.admin"},
+		"director admin":    {"bosh." + directorUUIDPlaceholder + ".admin"},
+		"reader":            {"bosh.read"},
+		"director reader":   {"bosh." + directorUUIDPlaceholder + ".read"},
+		"team admin":        {"bosh.teams.alpha.admin"},
+		"team reader":       {"bosh.teams.alpha.read"},
+		"stemcell uploader": {"bosh.stemcells.upload"},
+		"release uploader":  {"bosh.releases.upload"},
+		"no bosh scopes":    {"openid"},
+	}
+
+	var (
+		uaaServer    *uaa.Server
+		director     *utils.DirectorClient
+		directorUUID string
+	)
+
+	tokenFor := func(options uaa.TokenOptions) string {
+		token, err := uaaServer.Token(options)
+		Expect(err).NotTo(HaveOccurred())
+		return token
+	}
+
+	scopesOf := func(identity string) []string {
+		scopes, found := identities[identity]
+		Expect(found).To(BeTrue(), "unknown identity %q", identity)
+
+		resolved := make([]string, len(scopes))
+		for i, scope := range scopes {
+			resolved[i] = strings.ReplaceAll(scope, directorUUIDPlaceholder, directorUUID)
+		}
+		return resolved
+	}
+
+	call := func(token string, e endpoint) error {
+		client := director.WithAuth(utils.BearerAuth(token))
+
+		var body io.Reader
+		if e.body != "" {
+			body = strings.NewReader(e.body)
+		}
+
+		if e.startsTask {
+			_, err := client.StartTask(e.method, e.path, nil, body)
+			return err
+		}
+		return client.Do(e.method, e.path, nil, body, nil)
+	}
+
+	expectUnauthorized := func(err error, bodySubstring string) {
+		var directorErr *utils.DirectorError
+		Expect(errors.As(err, &directorErr)).To(BeTrue(), "expected a director error, got %v", err)
+		Expect(directorErr.StatusCode).To(Equal(http.StatusUnauthorized))
+		Expect(directorErr.Body).To(ContainSubstring(bodySubstring))
+	}
+
+	BeforeAll(func() {
+		uaaServer = startInnerBoshWithFakeUAA()
+
+		director = utils.InnerDirectorClient().WithAuth(nil)
+
+		var info struct {
+			UUID               string `json:"uuid"`
+			UserAuthentication struct {
+				Type string `json:"type"`
+			} `json:"user_authentication"`
+		}
+		Expect(director.Get("/info", nil, &info)).To(Succeed())
+		Expect(info.UserAuthentication.Type).To(Equal("uaa"))
+		directorUUID = info.UUID
+	})
+
+	It("lets the CLI, health monitor and nats-sync authenticate through the UAA", func() {
+		session := utils.Bosh("deployments")
+		Eventually(session, time.Minute).Should(gexec.Exit(0))
+
+		Eventually(func() []uaa.Claims {
+			return uaaServer.IssuedTokens()
+		}, 2*time.Minute, 5*time.Second).Should(ContainElements(
+			HaveField("ClientID", "admin"),
+			HaveField("ClientID", "hm"),
+			HaveField("ClientID", "nats"),
+		))
+	})
+
+	DescribeTable("grants each endpoint to exactly the scopes the permission authorizer allows",
+		func(e endpoint, allowed ...string) {
+			for identity := range identities {
+				clientID := "brats-" + strings.ReplaceAll(identity, " ", "-")
+				token := tokenFor(uaa.TokenOptions{ClientID: clientID, Scopes: scopesOf(identity)})
+
+				// Identities are tried in random order, so each one writes
+				// its own objects rather than one owned by another team.
+				request := e
+				request.body = strings.ReplaceAll(e.body, clientIDPlaceholder, clientID)
+				err := call(token, request)
+
+				if slices.Contains(allowed, identity) {
+					Expect(err).NotTo(HaveOccurred(), "%s %s as %s", e.method, e.path, identity)
+				} else {
+					expectUnauthorized(err, "Require one of the scopes")
+				}
+			}
+		},
+		Entry("listing deployments", endpoint{method: "GET", path: "/deployments"},
+			"admin", "director admin", "reader", "director reader", "team admin"),
+		Entry("listing releases", endpoint{method: "GET", path: "/releases"},
+			"admin", "director admin", "reader", "director reader", "team admin"),
+		Entry("listing stemcells", endpoint{method: "GET", path: "/stemcells"},
+			"admin", "director admin", "reader", "director reader", "team admin"),
+		Entry("listing tasks", endpoint{method: "GET", path: "/tasks"},
+			"admin", "director admin", "reader", "director reader", "team admin"),
+		Entry("listing events", endpoint{method: "GET", path: "/events"},
+			"admin", "director admin", "reader", "director reader", "team admin", "team reader"),
+		Entry("listing configs", endpoint{method: "GET", path: "/configs"},
+			"admin", "director admin", "reader", "director reader", "team admin", "team reader"),
+		Entry("listing locks", endpoint{method: "GET", path: "/locks"},
+			"admin", "director admin", "reader", "director reader"),
+		Entry("reading the cloud config", endpoint{method: "GET", path: "/cloud_configs"},
+			"admin", "director admin", "reader", "director reader"),
+		Entry("reading certificate expiry", endpoint{method: "GET", path: "/director/certificate_expiry"},
+			"admin", "director admin", "reader", "director reader"),
+		Entry("uploading a stemcell from a URL", endpoint{
+			method: "POST", path: "/stemcells", startsTask: true,
+			body: `{"location": "https://127.0.0.1:1/stemcell.tgz"}`,
+		}, "admin", "director admin", "stemcell uploader"),
+		Entry("uploading a release from a URL", endpoint{
+			method: "POST", path: "/releases", startsTask: true,
+			body: `{"location": "https://127.0.0.1:1/release.tgz"}`,
+		}, "admin", "director admin", "release uploader"),
+		Entry("updating a config", endpoint{
+			method: "POST", path: "/configs",
+			body: `{"type": "runtime", "name": "<client-id>", "content": "--- {}"}`,
+		}, "admin", "director admin", "team admin"),
+		Entry("recording an event", endpoint{
+			method: "POST", path: "/events",
+			body: `{"action": "authorize", "object_type": "brats", "object_name": "scope-matrix"}`,
+		}, "admin", "director admin"),
+	)
+
+	It("rejects tokens the director must not accept", func() {
+		expired := tokenFor(uaa.TokenOptions{ClientID: "brats-expired", Scopes: []string{"bosh.admin"}, Lifetime: -time.Minute})
+		expectUnauthorized(call(expired, endpoint{method: "GET", path: "/deployments"}), "")
+
+		refresh := tokenFor(uaa.TokenOptions{ClientID: "brats-refresh", Scopes: []string{"bosh.admin"}, Refresh: true})
+		expectUnauthorized(call(refresh, endpoint{method: "GET", path: "/deployments"}), "")
+
+		other, err := uaa.Start(uaa.Config{Address: "127.0.0.1:0", Hosts: []string{"127.0.0.1"}})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(other.Close)
+		foreign, err := other.Token(uaa.TokenOptions{ClientID: "brats-foreign", Scopes: []string{"bosh.admin"}})
+		Expect(err).NotTo(HaveOccurred())
+		expectUnauthorized(call(foreign, endpoint{method: "GET", path: "/deployments"}), "")
+	})
+
+	AfterAll(func() {
+		admin := director.WithAuth(utils.BearerAuth(tokenFor(uaa.TokenOptions{ClientID: "brats-cleanup", Scopes: []string{"bosh.admin"}})))
+
+		var configs []struct {
+			Name string `json:"name"`
+		}
+		Expect(admin.Get("/configs", url.Values{"type": {"runtime"}, "latest": {"true"}}, &configs)).To(Succeed())
+		for _, config := range configs {
+			if strings.HasPrefix(config.Name, "brats-") {
+				Expect(admin.Do("DELETE", "/configs", url.Values{"type": {"runtime"}, "name": {config.Name}}, nil, nil)).To(Succeed())
+			}
+		}
+	})
+})
+
+// startInnerBoshWithFakeUAA redeploys the inner director with UAA user
+// management backed by a fake UAA, which lives until the enclosing container
+// ends. The fake trusts the admin client the inner bosh script logs in as,
+// and the health monitor and nats-sync clients, along with clients.
+//
+// The fake signs its certificate with the director's default_ca, so the
+// director is deployed first to have creds.yml generate it.
+func startInnerBoshWithFakeUAA(clients ...uaa.Client) *uaa.Server {
+	utils.StartInnerBosh()
+
+	hostIP := utils.LocalIPForInnerDirector()
+	hmSecret, natsSecret := "brats-hm-secret", "brats-nats-secret"
+
+	server, err := uaa.Start(uaa.Config{
+		Address:       net.JoinHostPort(hostIP, "0"),
+		Hosts:         []string{hostIP},
+		CACertificate: utils.InnerBoshCredential("/default_ca/certificate"),
+		CAPrivateKey:  utils.InnerBoshCredential("/default_ca/private_key"),
+		Clients: append([]uaa.Client{
+			{ID: "admin", Secret: utils.InnerBoshCredential("/admin_password"), Scopes: []string{"bosh.admin"}},
+			{ID: "hm", Secret: hmSecret, Scopes: []string{"bosh.admin"}},
+			{ID: "nats", Secret: natsSecret, Scopes: []string{"bosh.admin"}},
+		}, clients...),
+	})
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(server.Close)
+
+	dir := GinkgoT().TempDir()
+	caCertPath := filepath.Join(dir, "uaa-ca.pem")
+	Expect(os.WriteFile(caCertPath, []byte(server.CACert()), 0o644)).To(Succeed())
+	verificationKeyPath := filepath.Join(dir, "uaa-verification-key.pem")
+	Expect(os.WriteFile(verificationKeyPath, []byte(server.VerificationKey()), 0o644)).To(Succeed())
+
+	utils.StartInnerBosh(utils.InnerBoshWithUAAOptions(utils.UAAConfig{
+		URL:                 server.URL(),
+		CACertPath:          caCertPath,
+		VerificationKeyPath: verificationKeyPath,
+		HMClientSecret:      hmSecret,
+		NATSClientSecret:    natsSecret,
+	})...)
+
+	return server
+}
@@ -0,0 +1,317 @@
+// Package certs issues certificates for TLS fixtures in process: CAs,
+// intermediates and server and client leaves, with RSA or ECDSA keys and
+// any validity window, so that no keys need to be checked in.
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type KeyType int
+
+const (
+	RSA KeyType = iota
+	ECDSA
+)
+
+const defaultRSABits = 2048
+
+// Validity is when a certificate is valid.
+type Validity struct {
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// ValidFor is valid from a minute ago, to allow for clock skew, until d from
+// now.
+func ValidFor(d time.Duration) Validity {
+	now := time.Now()
+	return Validity{NotBefore: now.Add(-time.Minute), NotAfter: now.Add(d)}
+}
+
+// Expired was valid for a day until an hour ago.
+func Expired() Validity {
+	now := time.Now()
+	return Validity{NotBefore: now.Add(-25 * time.Hour), NotAfter: now.Add(-time.Hour)}
+}
+
+// NotYetValid becomes valid in an hour.
+func NotYetValid() Validity {
+	now := time.Now()
+	return Validity{NotBefore: now.Add(time.Hour), NotAfter: now.Add(25 * time.Hour)}
+}
+
+type Options struct {
+	CommonName         string
+	Country            string
+	Organization       string
+	OrganizationalUnit string
+	// Hosts are the subject alternative names: IPs and DNS names.
+	Hosts []string
+
+	KeyType KeyType
+	// RSABits is the RSA key size, 2048 by default.
+	RSABits int
+
+	// Validity defaults to ValidFor(24 * time.Hour).
+	Validity Validity
+
+	// KeyUsage is added to the usages the kind of certificate needs.
+	KeyUsage x509.KeyUsage
+	// ExtKeyUsage replaces the extended usages the kind of certificate
+	// defaults to.
+	ExtKeyUsage []x509.ExtKeyUsage
+}
+
+// Certificate is an issued certificate with its private key.
+type Certificate struct {
+	Certificate *x509.Certificate
+	Key         crypto.Signer
+	// Issuer is nil for self-signed certificates.
+	Issuer *Certificate
+}
+
+// NewCA issues a self-signed root CA.
+func NewCA(options Options) (*Certificate, error) {
+	return issue(options, nil, true, nil)
+}
+
+// SelfSigned issues a self-signed leaf certificate.
+func SelfSigned(options Options) (*Certificate, error) {
+	return issue(options, nil, false, nil)
+}
+
+// Intermediate issues a CA signed by c.
+func (c *Certificate) Intermediate(options Options) (*Certificate, error) {
+	return issue(options, c, true, nil)
+}
+
+// Server issues a leaf for server authentication signed by c.
+func (c *Certificate) Server(options Options) (*Certificate, error) {
+	return issue(options, c, false, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth})
+}
+
+// Client issues a leaf for client authentication signed by c.
+func (c *Certificate) Client(options Options) (*Certificate, error) {
+	return issue(options, c, false, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth})
+}
+
+// Leaf issues a leaf signed by c with only the usages in options.
+func (c *Certificate) Leaf(options Options) (*Certificate, error) {
+	return issue(options, c, false, nil)
+}
+
+func issue(options Options, issuer *Certificate, isCA bool, extKeyUsage []x509.ExtKeyUsage) (*Certificate, error) {
+	if issuer != nil && !issuer.Certificate.IsCA {
+		return nil, fmt.Errorf("%q is not a CA", issuer.Certificate.Subject.CommonName)
+	}
+
+	key, err := generateKey(options)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	validity := options.Validity
+	if validity == (Validity{}) {
+		validity = ValidFor(24 * time.Hour)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: options.CommonName},
+		NotBefore:             validity.NotBefore,
+		NotAfter:              validity.NotAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | options.KeyUsage,
+		ExtKeyUsage:           extKeyUsage,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if options.Country != "" {
+		template.Subject.Country = []string{options.Country}
+	}
+	if options.Organization != "" {
+		template.Subject.Organization = []string{options.Organization}
+	}
+	if options.OrganizationalUnit != "" {
+		template.Subject.OrganizationalUnit = []string{options.OrganizationalUnit}
+	}
+	if options.ExtKeyUsage != nil {
+		template.ExtKeyUsage = options.ExtKeyUsage
+	}
+	if isCA {
+		template.KeyUsage |= x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	} else if options.KeyType == RSA {
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	for _, host := range options.Hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	parent, signer := template, key
+	if issuer != nil {
+		parent, signer = issuer.Certificate, issuer.Key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), signer)
+	if err != nil {
+		return nil, err
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Certificate{Certificate: certificate, Key: key, Issuer: issuer}, nil
+}
+
+func generateKey(options Options) (crypto.Signer, error) {
+	switch options.KeyType {
+	case RSA:
+		bits := options.RSABits
+		if bits == 0 {
+			bits = defaultRSABits
+		}
+		return rsa.GenerateKey(rand.Reader, bits)
+	case ECDSA:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return nil, fmt.Errorf("unknown key type %d", options.KeyType)
+	}
+}
+
+// Parse reads a certificate and its PKCS #1, SEC 1 or PKCS #8 encoded key,
+// e.g. a CA from a director's creds.yml to issue certificates the director
+// trusts.
+func Parse(certPEM, keyPEM []byte) (*Certificate, error) {
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, errors.New("certificate and private key must be PEM encoded")
+	}
+
+	certificate, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	var key any
+	switch keyBlock.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(keyBlock.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("private key cannot sign certificates")
+	}
+	return &Certificate{Certificate: certificate, Key: signer}, nil
+}
+
+// CertPEM is the certificate alone.
+func (c *Certificate) CertPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Certificate.Raw})
+}
+
+// ChainPEM is the certificate followed by the intermediates that issued
+// it, without the root, as servers present it.
+func (c *Certificate) ChainPEM() []byte {
+	var chain []byte
+	for _, cert := range c.chain() {
+		chain = append(chain, cert.CertPEM()...)
+	}
+	return chain
+}
+
+func (c *Certificate) chain() []*Certificate {
+	chain := []*Certificate{c}
+	for cert := c.Issuer; cert != nil && cert.Issuer != nil; cert = cert.Issuer {
+		chain = append(chain, cert)
+	}
+	return chain
+}
+
+// KeyPEM is the private key, PKCS #1 encoded for RSA and SEC 1 for ECDSA.
+// Marshalling only fails for key types neither NewCA nor Parse return.
+func (c *Certificate) KeyPEM() []byte {
+	switch key := c.Key.(type) {
+	case *rsa.PrivateKey:
+		return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	case *ecdsa.PrivateKey:
+		der, _ := x509.MarshalECPrivateKey(key) //nolint:errcheck
+		return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	default:
+		der, _ := x509.MarshalPKCS8PrivateKey(key) //nolint:errcheck
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	}
+}
+
+// TLSCertificate presents the certificate with its chain.
+func (c *Certificate) TLSCertificate() tls.Certificate {
+	certificate := tls.Certificate{PrivateKey: c.Key, Leaf: c.Certificate}
+	for _, cert := range c.chain() {
+		certificate.Certificate = append(certificate.Certificate, cert.Certificate.Raw)
+	}
+	return certificate
+}
+
+// Pool trusts the certificate, for using a CA as a root.
+func (c *Certificate) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(c.Certificate)
+	return pool
+}
+
+// Files are where Write put a certificate.
+type Files struct {
+	// CertPath holds ChainPEM.
+	CertPath string
+	KeyPath  string
+}
+
+// Write writes the certificate chain to <name>.pem and the key to
+// <name>.key in dir, readable only by the owner as servers require of
+// keys.
+func (c *Certificate) Write(dir, name string) (Files, error) {
+	files := Files{
+		CertPath: filepath.Join(dir, name+".pem"),
+		KeyPath:  filepath.Join(dir, name+".key"),
+	}
+	if err := os.WriteFile(files.CertPath, c.ChainPEM(), 0o644); err != nil {
+		return Files{}, err
+	}
+	if err := os.WriteFile(files.KeyPath, c.KeyPEM(), 0o600); err != nil {
+		return Files{}, err
+	}
+	return files, nil
+}
@@ -0,0 +1,154 @@
+package certs_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"brats/certs"
+)
+
+var _ = Describe("certs", func() {
+	var ca *certs.Certificate
+
+	BeforeEach(func() {
+		var err error
+		ca, err = certs.NewCA(certs.Options{CommonName: "test-ca"})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	verify := func(leaf *certs.Certificate, roots *certs.Certificate, options x509.VerifyOptions) error {
+		options.Roots = roots.Pool()
+		options.Intermediates = x509.NewCertPool()
+		for _, cert := range leaf.TLSCertificate().Certificate[1:] {
+			parsed, err := x509.ParseCertificate(cert)
+			Expect(err).NotTo(HaveOccurred())
+			options.Intermediates.AddCert(parsed)
+		}
+		_, err := leaf.Certificate.Verify(options)
+		return err
+	}
+
+	It("issues server certificates for the given hosts", func() {
+		server, err := ca.Server(certs.Options{CommonName: "server", Hosts: []string{"10.0.0.1", "db.internal"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(server.Certificate.IPAddresses).To(HaveLen(1))
+		Expect(server.Certificate.IPAddresses[0].Equal(net.ParseIP("10.0.0.1"))).To(BeTrue())
+		Expect(server.Certificate.DNSNames).To(ConsistOf("db.internal"))
+		Expect(server.Certificate.ExtKeyUsage).To(ConsistOf(x509.ExtKeyUsageServerAuth))
+		Expect(server.Certificate.IsCA).To(BeFalse())
+
+		Expect(verify(server, ca, x509.VerifyOptions{DNSName: "db.internal"})).To(Succeed())
+		Expect(verify(server, ca, x509.VerifyOptions{DNSName: "10.0.0.1"})).To(Succeed())
+		Expect(verify(server, ca, x509.VerifyOptions{DNSName: "other.internal"})).NotTo(Succeed())
+	})
+
+	It("issues client certificates", func() {
+		client, err := ca.Client(certs.Options{CommonName: "director"})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(client.Certificate.ExtKeyUsage).To(ConsistOf(x509.ExtKeyUsageClientAuth))
+		Expect(verify(client, ca, x509.VerifyOptions{KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})).To(Succeed())
+		Expect(verify(client, ca, x509.VerifyOptions{})).NotTo(Succeed(), "client certificates must not authenticate servers")
+	})
+
+	It("chains leaves through intermediates", func() {
+		intermediate, err := ca.Intermediate(certs.Options{CommonName: "intermediate"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(intermediate.Certificate.IsCA).To(BeTrue())
+
+		server, err := intermediate.Server(certs.Options{CommonName: "server", Hosts: []string{"server"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(server.TLSCertificate().Certificate).To(HaveLen(2))
+		Expect(verify(server, ca, x509.VerifyOptions{DNSName: "server"})).To(Succeed())
+
+		otherCA, err := certs.NewCA(certs.Options{CommonName: "other-ca"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(verify(server, otherCA, x509.VerifyOptions{DNSName: "server"})).To(MatchError(ContainSubstring("unknown authority")))
+	})
+
+	It("refuses to issue from a leaf", func() {
+		leaf, err := ca.Server(certs.Options{CommonName: "leaf"})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = leaf.Server(certs.Options{CommonName: "server"})
+		Expect(err).To(MatchError(`"leaf" is not a CA`))
+	})
+
+	DescribeTable("key types",
+		func(keyType certs.KeyType, keyMatcher OmegaMatcher, pemType string) {
+			server, err := ca.Server(certs.Options{CommonName: "server", KeyType: keyType})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(server.Key).To(keyMatcher)
+			Expect(string(server.KeyPEM())).To(HavePrefix("-----BEGIN " + pemType + "-----"))
+
+			_, err = tls.X509KeyPair(server.ChainPEM(), server.KeyPEM())
+			Expect(err).NotTo(HaveOccurred())
+
+			parsed, err := certs.Parse(server.CertPEM(), server.KeyPEM())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parsed.Certificate.Equal(server.Certificate)).To(BeTrue())
+		},
+		Entry("RSA", certs.RSA, BeAssignableToTypeOf(&rsa.PrivateKey{}), "RSA PRIVATE KEY"),
+		Entry("ECDSA", certs.ECDSA, BeAssignableToTypeOf(&ecdsa.PrivateKey{}), "EC PRIVATE KEY"),
+	)
+
+	It("uses the requested RSA key size", func() {
+		server, err := ca.Server(certs.Options{CommonName: "server", RSABits: 3072})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(server.Key.(*rsa.PrivateKey).N.BitLen()).To(Equal(3072))
+	})
+
+	DescribeTable("validity windows",
+		func(validity certs.Validity, expectedError string) {
+			server, err := ca.Server(certs.Options{CommonName: "server", Hosts: []string{"server"}, Validity: validity})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = verify(server, ca, x509.VerifyOptions{DNSName: "server"})
+			if expectedError == "" {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError(ContainSubstring(expectedError)))
+			}
+		},
+		Entry("valid by default", certs.Validity{}, ""),
+		Entry("valid for a while", certs.ValidFor(time.Hour), ""),
+		Entry("expired", certs.Expired(), "expired"),
+		Entry("not yet valid", certs.NotYetValid(), "not yet valid"),
+	)
+
+	It("reads CAs issued elsewhere to issue more certificates", func() {
+		parsed, err := certs.Parse(ca.CertPEM(), ca.KeyPEM())
+		Expect(err).NotTo(HaveOccurred())
+
+		server, err := parsed.Server(certs.Options{CommonName: "server", Hosts: []string{"server"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(verify(server, ca, x509.VerifyOptions{DNSName: "server"})).To(Succeed())
+	})
+
+	It("writes the chain and a private key file", func() {
+		intermediate, err := ca.Intermediate(certs.Options{CommonName: "intermediate"})
+		Expect(err).NotTo(HaveOccurred())
+		server, err := intermediate.Server(certs.Options{CommonName: "server"})
+		Expect(err).NotTo(HaveOccurred())
+
+		files, err := server.Write(GinkgoT().TempDir(), "server")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(os.ReadFile(files.CertPath)).To(Equal(append(server.CertPEM(), intermediate.CertPEM()...)))
+		Expect(os.ReadFile(files.KeyPath)).To(Equal(server.KeyPEM()))
+
+		info, err := os.Stat(files.KeyPath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0o600)))
+	})
+})
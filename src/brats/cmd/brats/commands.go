@@ -0,0 +1,293 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+
+	"brats/sshclient"
+	"brats/utils"
+)
+
+const (
+	innerDirectorLogRoot = "/var/vcap/sys/log"
+
+	// innerDirectorAliasPrefix is how the scripts alias inner director N,
+	// e.g. "docker-inner-director-2".
+	innerDirectorAliasPrefix = "docker-inner-director-"
+	// maxInnerDirectors is as many inner directors as fit in the
+	// 10.245.0.0/24 network after the outer director's addresses.
+	maxInnerDirectors = 244
+)
+
+var commands = []struct {
+	name, usage, summary string
+}{
+	{"up", "[-n N] [--ops FILE]... [--skip-upload]", "deploy an inner director, with ops files for its manifest"},
+	{"down", "[-n N]", "delete an inner director and its deployments"},
+	{"status", "", "list the inner directors with their state, IP and manifest fingerprint"},
+	{"env", "[-n N]", "print the exports that target an inner director with the bosh CLI"},
+	{"ssh", "[-n N] [COMMAND...]", "ssh to an inner director's VM as the jumpbox user"},
+	{"logs", "[-n N] [-o FILE] [JOB...]", "download the logs of an inner director's jobs as a tarball"},
+	{"run", "[--focus REGEXP] [--procs N] [--suite DIR] [--skip-cleanup]", "run a brats suite, process N against inner director N"},
+}
+
+// invocation is a parsed command line.
+type invocation struct {
+	command string
+	// director is the number of the inner director, that of the Ginkgo
+	// process that uses it.
+	director int
+
+	opsFiles   []string
+	skipUpload bool
+
+	output string
+
+	focus       string
+	procs       int
+	suite       string
+	skipCleanup bool
+
+	args []string
+}
+
+// repeatedFlag collects the values of a flag given several times.
+type repeatedFlag []string
+
+func (f *repeatedFlag) String() string { return strings.Join(*f, ",") }
+
+func (f *repeatedFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: brats COMMAND [OPTIONS]")
+	fmt.Fprintln(w)
+	for _, command := range commands {
+		fmt.Fprintf(w, "  %s\n      %s\n", strings.TrimSpace(command.name+" "+command.usage), command.summary)
+	}
+}
+
+// parseArgs parses a command line; flag errors and help go to stderr.
+func parseArgs(args []string, stderr io.Writer) (invocation, error) {
+	if len(args) == 0 {
+		usage(stderr)
+		return invocation{}, errors.New("no command given")
+	}
+	if args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		usage(stderr)
+		return invocation{}, flag.ErrHelp
+	}
+
+	inv := invocation{command: args[0]}
+	flags := flag.NewFlagSet("brats "+inv.command, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	switch inv.command {
+	case "up":
+		flags.Var((*repeatedFlag)(&inv.opsFiles), "ops", "ops file to apply to the director's manifest, may be repeated")
+		flags.BoolVar(&inv.skipUpload, "skip-upload", false, "do not upload the director release, e.g. when it was already")
+	case "logs":
+		flags.StringVar(&inv.output, "o", "", "file to write the tarball to, - for standard output (default bosh-N-logs.tgz)")
+	case "run":
+		flags.StringVar(&inv.focus, "focus", "", "run only the specs that match")
+		flags.IntVar(&inv.procs, "procs", 1, "number of parallel processes, and so of inner directors")
+		flags.StringVar(&inv.suite, "suite", "acceptance", "suite to run, relative to src/brats")
+		flags.BoolVar(&inv.skipCleanup, "skip-cleanup", false, "keep the inner directors and their deployments when the suite ends")
+	case "down", "status", "env", "ssh":
+	default:
+		usage(stderr)
+		return invocation{}, fmt.Errorf("unknown command %q", inv.command)
+	}
+	switch inv.command {
+	case "up", "down", "env", "ssh", "logs":
+		flags.IntVar(&inv.director, "n", 1, "number of the inner director")
+	}
+
+	if err := flags.Parse(args[1:]); err != nil {
+		return invocation{}, err
+	}
+	inv.args = flags.Args()
+
+	switch {
+	case flags.Lookup("n") != nil && inv.director < 1:
+		return invocation{}, fmt.Errorf("-n must be at least 1, got %d", inv.director)
+	case inv.command == "run" && inv.procs < 1:
+		return invocation{}, fmt.Errorf("--procs must be at least 1, got %d", inv.procs)
+	case len(inv.args) > 0 && inv.command != "ssh" && inv.command != "logs":
+		return invocation{}, fmt.Errorf("unexpected arguments %q", inv.args)
+	}
+	return inv, nil
+}
+
+// execute runs a command line and returns the exit status.
+func execute(args []string, p provisioner, stdout, stderr io.Writer) int {
+	inv, err := parseArgs(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	if err := inv.run(p, stdout); err != nil {
+		// ssh and the suites already reported why they failed.
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode()
+		}
+		fmt.Fprintf(stderr, "brats %s: %s\n", inv.command, err)
+		return 1
+	}
+	return 0
+}
+
+func (inv invocation) run(p provisioner, stdout io.Writer) error {
+	director := p.Director(inv.director)
+
+	// The scripts and the suites take BOSH_ENVIRONMENT for the outer
+	// director, which `brats env` points at an inner one.
+	switch inv.command {
+	case "up", "down", "run":
+		if number, ok := innerDirectorTarget(os.Getenv("BOSH_ENVIRONMENT")); ok {
+			return fmt.Errorf("BOSH_ENVIRONMENT targets inner director %d, run brats %s where it targets the outer director", number, inv.command)
+		}
+	}
+
+	switch inv.command {
+	case "up":
+		var args []string
+		for _, opsFile := range inv.opsFiles {
+			args = append(args, "-o", opsFile)
+		}
+		return p.Up(director, !inv.skipUpload, args)
+
+	case "down":
+		return p.Down(director)
+
+	case "status":
+		statuses, err := directorStatuses(p)
+		if err != nil {
+			return err
+		}
+		return writeStatuses(stdout, statuses)
+
+	case "env":
+		if err := requireDeployed(director); err != nil {
+			return err
+		}
+		vars, err := p.Env(director)
+		if err != nil {
+			return err
+		}
+		for _, v := range vars {
+			fmt.Fprintf(stdout, "export %s=%s\n", v.name, sshclient.Quote(v.value))
+		}
+		return nil
+
+	case "ssh":
+		if err := requireDeployed(director); err != nil {
+			return err
+		}
+		return p.SSH(director, inv.args)
+
+	case "logs":
+		if err := requireDeployed(director); err != nil {
+			return err
+		}
+		return inv.logs(p, director, stdout)
+
+	case "run":
+		return p.Run(inv.ginkgoArgs(), inv.skipCleanup)
+	}
+	return fmt.Errorf("unknown command %q", inv.command)
+}
+
+func (inv invocation) logs(p provisioner, director utils.InnerBosh, stdout io.Writer) error {
+	dirs := utils.InnerDirectorLogDirs
+	if len(inv.args) > 0 {
+		dirs = make([]string, len(inv.args))
+		for i, job := range inv.args {
+			dirs[i] = path.Join(innerDirectorLogRoot, job)
+		}
+	}
+
+	if inv.output == "-" {
+		return p.Logs(director, dirs, stdout)
+	}
+
+	output := inv.output
+	if output == "" {
+		output = director.DeploymentName() + "-logs.tgz"
+	}
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	if err := p.Logs(director, dirs, file); err != nil {
+		file.Close() //nolint:errcheck
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "wrote the logs of %s to %s\n", strings.Join(dirs, ", "), output)
+	return nil
+}
+
+// ginkgoArgs runs the suite verbosely. Its process N deploys inner
+// director N, which takes little time when the director is up already.
+func (inv invocation) ginkgoArgs() []string {
+	args := []string{"-v"}
+	if inv.focus != "" {
+		args = append(args, "--focus", inv.focus)
+	}
+	if inv.procs > 1 {
+		args = append(args, "--procs", strconv.Itoa(inv.procs))
+	}
+	return append(args, inv.suite)
+}
+
+// innerDirectorTarget tells which inner director environment, a bosh CLI
+// environment, is: its IP, URL or alias.
+func innerDirectorTarget(environment string) (int, bool) {
+	if number, found := strings.CutPrefix(environment, innerDirectorAliasPrefix); found {
+		n, err := strconv.Atoi(number)
+		return n, err == nil
+	}
+
+	host := environment
+	if u, err := url.Parse(environment); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	} else if h, _, err := net.SplitHostPort(environment); err == nil {
+		host = h
+	}
+	for number := 1; number <= maxInnerDirectors; number++ {
+		if host == utils.NewInnerBosh(number).IP() {
+			return number, true
+		}
+	}
+	return 0, false
+}
+
+func requireDeployed(director utils.InnerBosh) error {
+	deployed, err := director.Deployed()
+	if err != nil {
+		return err
+	}
+	if !deployed {
+		return fmt.Errorf("inner director %d is not deployed, see `brats status`", director.Number)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("commands", func() {
+	Describe("parseArgs", func() {
+		parse := func(args ...string) (invocation, error) {
+			return parseArgs(args, io.Discard)
+		}
+
+		It("defaults to the first inner director", func() {
+			inv, err := parse("env")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(inv).To(Equal(invocation{command: "env", director: 1, args: []string{}}))
+		})
+
+		It("parses repeated ops files", func() {
+			inv, err := parse("up", "-n", "3", "--ops", "a.yml", "--ops=b.yml", "--skip-upload")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(inv.director).To(Equal(3))
+			Expect(inv.opsFiles).To(Equal([]string{"a.yml", "b.yml"}))
+			Expect(inv.skipUpload).To(BeTrue())
+		})
+
+		It("passes what follows the flags of ssh to the remote command", func() {
+			inv, err := parse("ssh", "-n", "2", "sudo", "monit", "summary", "-v")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(inv.director).To(Equal(2))
+			Expect(inv.args).To(Equal([]string{"sudo", "monit", "summary", "-v"}))
+		})
+
+		It("parses the suite to run", func() {
+			inv, err := parse("run", "--focus", "console", "--procs", "2", "--skip-cleanup")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(inv.ginkgoArgs()).To(Equal([]string{"-v", "--focus", "console", "--procs", "2", "acceptance"}))
+			Expect(inv.skipCleanup).To(BeTrue())
+
+			inv, err = parse("run", "--suite", "performance")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(inv.ginkgoArgs()).To(Equal([]string{"-v", "performance"}))
+		})
+
+		DescribeTable("rejects invalid command lines",
+			func(expected string, args ...string) {
+				_, err := parse(args...)
+				Expect(err).To(MatchError(ContainSubstring(expected)))
+			},
+			Entry("no command", "no command given"),
+			Entry("an unknown command", `unknown command "destroy"`, "destroy"),
+			Entry("an unknown flag", "flag provided but not defined: -ops", "down", "--ops", "a.yml"),
+			Entry("a director that does not exist", "-n must be at least 1, got 0", "up", "-n", "0"),
+			Entry("too few processes", "--procs must be at least 1, got 0", "run", "--procs", "0"),
+			Entry("arguments of a command without any", `unexpected arguments ["2"]`, "status", "2"),
+		)
+
+		It("prints the commands for help", func() {
+			stderr := &bytes.Buffer{}
+			_, err := parseArgs([]string{"help"}, stderr)
+			Expect(err).To(MatchError(flag.ErrHelp))
+			Expect(stderr.String()).To(ContainSubstring("up [-n N] [--ops FILE]... [--skip-upload]\n"))
+			Expect(stderr.String()).To(ContainSubstring("run [--focus REGEXP]"))
+		})
+	})
+
+	Describe("execute", func() {
+		var (
+			provisioner    *fakeProvisioner
+			stdout, stderr *bytes.Buffer
+		)
+
+		BeforeEach(func() {
+			provisioner = newFakeProvisioner(GinkgoT().TempDir())
+			stdout = &bytes.Buffer{}
+			stderr = &bytes.Buffer{}
+			GinkgoT().Setenv("BOSH_ENVIRONMENT", "10.245.0.3")
+		})
+
+		execute := func(args ...string) int {
+			return execute(args, provisioner, stdout, stderr)
+		}
+
+		It("deploys a director with ops files", func() {
+			Expect(execute("up", "-n", "2", "--ops", "a.yml", "--ops", "b.yml")).To(Equal(0))
+			Expect(provisioner.ups).To(Equal([]fakeUp{{director: 2, uploadReleases: true, args: []string{"-o", "a.yml", "-o", "b.yml"}}}))
+		})
+
+		It("deletes a director", func() {
+			Expect(execute("down", "-n", "2")).To(Equal(0))
+			Expect(provisioner.downs).To(Equal([]int{2}))
+		})
+
+		It("prints exports that the shell can evaluate", func() {
+			provisioner.deploy(1, "name: bosh", true)
+
+			Expect(execute("env")).To(Equal(0))
+			Expect(stdout.String()).To(Equal("export BOSH_ENVIRONMENT='10.245.0.11'\nexport BOSH_CLIENT_SECRET='it'\\''s secret'\n"))
+		})
+
+		DescribeTable("refuses to deploy, delete or test when targeting an inner director",
+			func(environment string, args ...string) {
+				GinkgoT().Setenv("BOSH_ENVIRONMENT", environment)
+
+				Expect(execute(args...)).To(Equal(1))
+				Expect(stderr.String()).To(Equal(fmt.Sprintf("brats %s: BOSH_ENVIRONMENT targets inner director 2, run brats %[1]s where it targets the outer director\n", args[0])))
+				Expect(provisioner.ups).To(BeEmpty())
+				Expect(provisioner.downs).To(BeEmpty())
+				Expect(provisioner.runs).To(BeEmpty())
+			},
+			Entry("up by IP", "10.245.0.12", "up"),
+			Entry("down by URL", "https://10.245.0.12:25555", "down"),
+			Entry("run by alias", "docker-inner-director-2", "run"),
+		)
+
+		It("refuses directors that were not deployed", func() {
+			provisioner.deploy(2, "name: bosh", false)
+
+			Expect(execute("ssh", "-n", "2")).To(Equal(1))
+			Expect(stderr.String()).To(Equal("brats ssh: inner director 2 is not deployed, see `brats status`\n"))
+			Expect(provisioner.ssh).To(BeEmpty())
+		})
+
+		It("writes the logs of the given jobs", func() {
+			provisioner.deploy(1, "name: bosh", true)
+			output := filepath.Join(GinkgoT().TempDir(), "logs.tgz")
+
+			Expect(execute("logs", "-o", output, "director", "nats")).To(Equal(0))
+			Expect(provisioner.logs).To(Equal([][]string{{"/var/vcap/sys/log/director", "/var/vcap/sys/log/nats"}}))
+			Expect(os.ReadFile(output)).To(Equal([]byte("tarball")))
+			Expect(stdout.String()).To(ContainSubstring("to " + output))
+		})
+
+		It("runs the suite", func() {
+			Expect(execute("run", "--focus", "console")).To(Equal(0))
+			Expect(provisioner.runs).To(Equal([]fakeRun{{args: []string{"-v", "--focus", "console", "acceptance"}}}))
+		})
+
+		It("exits 2 on usage errors", func() {
+			Expect(execute("destroy")).To(Equal(2))
+			Expect(stderr.String()).To(HaveSuffix("unknown command \"destroy\"\n"))
+		})
+	})
+})
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	. "github.com/onsi/gomega"
+
+	"brats/utils"
+)
+
+// fakeProvisioner keeps its inner directors in a directory of the test's,
+// and records what it was asked to do.
+type fakeProvisioner struct {
+	root string
+	// versions are the versions of the directors that answer, by number.
+	versions map[int]string
+
+	ups   []fakeUp
+	downs []int
+	ssh   [][]string
+	logs  [][]string
+	runs  []fakeRun
+}
+
+type fakeUp struct {
+	director       int
+	uploadReleases bool
+	args           []string
+}
+
+type fakeRun struct {
+	args        []string
+	skipCleanup bool
+}
+
+func newFakeProvisioner(root string) *fakeProvisioner {
+	return &fakeProvisioner{root: root, versions: map[int]string{}}
+}
+
+// deploy writes the files the scripts write for a director. A director
+// that was not deployed has a manifest only.
+func (p *fakeProvisioner) deploy(number int, manifest string, deployed bool) {
+	director := p.Director(number)
+	Expect(os.MkdirAll(director.Dir, 0755)).To(Succeed())
+	Expect(os.WriteFile(director.ManifestPath(), []byte(manifest), 0644)).To(Succeed())
+	if deployed {
+		Expect(os.WriteFile(director.BoshPath(), []byte("#!/bin/bash\n"), 0755)).To(Succeed())
+	}
+}
+
+func (p *fakeProvisioner) Director(number int) utils.InnerBosh {
+	return utils.InnerBosh{Number: number, Dir: filepath.Join(p.root, strconv.Itoa(number))}
+}
+
+func (p *fakeProvisioner) Directors() ([]utils.InnerBosh, error) {
+	return utils.ListInnerBoshes(p.root)
+}
+
+func (p *fakeProvisioner) Version(director utils.InnerBosh) (string, error) {
+	version, ok := p.versions[director.Number]
+	if !ok {
+		return "", errors.New("connection refused")
+	}
+	return version, nil
+}
+
+func (p *fakeProvisioner) Up(director utils.InnerBosh, uploadReleases bool, args []string) error {
+	p.ups = append(p.ups, fakeUp{director: director.Number, uploadReleases: uploadReleases, args: args})
+	return nil
+}
+
+func (p *fakeProvisioner) Down(director utils.InnerBosh) error {
+	p.downs = append(p.downs, director.Number)
+	return nil
+}
+
+func (p *fakeProvisioner) Env(director utils.InnerBosh) ([]envVar, error) {
+	return []envVar{
+		{"BOSH_ENVIRONMENT", director.IP()},
+		{"BOSH_CLIENT_SECRET", "it's secret"},
+	}, nil
+}
+
+func (p *fakeProvisioner) SSH(director utils.InnerBosh, command []string) error {
+	p.ssh = append(p.ssh, command)
+	return nil
+}
+
+func (p *fakeProvisioner) Logs(director utils.InnerBosh, dirs []string, w io.Writer) error {
+	p.logs = append(p.logs, dirs)
+	_, err := w.Write([]byte("tarball"))
+	return err
+}
+
+func (p *fakeProvisioner) Run(ginkgoArgs []string, skipCleanup bool) error {
+	p.runs = append(p.runs, fakeRun{args: ginkgoArgs, skipCleanup: skipCleanup})
+	return nil
+}
@@ -0,0 +1,48 @@
+// Command brats manages the inner directors the brats suites run against
+// outside Ginkgo, e.g. to keep one up between runs or to debug a spec
+// against the director it failed on.
+//
+//	brats up -n 2 --ops ops.yml   deploy inner director 2 with an ops file
+//	brats status                  list the inner directors
+//	eval "$(brats env -n 2)"      target inner director 2 with the bosh CLI
+//	brats run --focus console     run the acceptance specs on director 1
+//
+// up, down and run deploy to the outer director, so they refuse to run in
+// a shell whose BOSH_ENVIRONMENT brats env pointed at an inner one.
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	repoRoot, err := findRepoRoot()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	provisioner := newInnerBoshProvisioner(repoRoot, os.Stdout, os.Stderr)
+	os.Exit(execute(os.Args[1:], provisioner, os.Stdout, os.Stderr))
+}
+
+// findRepoRoot finds the bosh repository from the working directory, for
+// the scripts that deploy inner directors and for the suites.
+func findRepoRoot() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, innerBoshScriptsDir)); err == nil {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("run brats from within the bosh repository, no %s found", innerBoshScriptsDir)
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"brats/utils"
+)
+
+const (
+	innerBoshScriptsDir = "ci/dockerfiles/docker-cpi"
+	reachableTimeout    = 5 * time.Second
+)
+
+// provisioner does what the commands need done to the inner directors, so
+// that they can be tested without any.
+type provisioner interface {
+	Director(number int) utils.InnerBosh
+	Directors() ([]utils.InnerBosh, error)
+	// Version asks a director for its version, and fails when it cannot.
+	Version(director utils.InnerBosh) (string, error)
+
+	// Up deploys a director; args go to `bosh int` of its manifest.
+	Up(director utils.InnerBosh, uploadReleases bool, args []string) error
+	Down(director utils.InnerBosh) error
+
+	Env(director utils.InnerBosh) ([]envVar, error)
+	SSH(director utils.InnerBosh, command []string) error
+	Logs(director utils.InnerBosh, dirs []string, w io.Writer) error
+
+	// Run runs the ginkgo CLI in src/brats.
+	Run(ginkgoArgs []string, skipCleanup bool) error
+}
+
+type envVar struct {
+	name, value string
+}
+
+// innerBoshProvisioner runs the scripts of the repository at repoRoot, as
+// the suites do.
+type innerBoshProvisioner struct {
+	repoRoot       string
+	stdout, stderr io.Writer
+}
+
+func newInnerBoshProvisioner(repoRoot string, stdout, stderr io.Writer) *innerBoshProvisioner {
+	return &innerBoshProvisioner{repoRoot: repoRoot, stdout: stdout, stderr: stderr}
+}
+
+func (p *innerBoshProvisioner) Director(number int) utils.InnerBosh {
+	return utils.NewInnerBosh(number)
+}
+
+func (p *innerBoshProvisioner) Directors() ([]utils.InnerBosh, error) {
+	return utils.ListInnerBoshes(utils.InnerBoshRoot)
+}
+
+func (p *innerBoshProvisioner) Version(director utils.InnerBosh) (string, error) {
+	// The director client waits a minute; one that is gone should not hold
+	// up the status of the others that long.
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(director.IP(), "25555"), reachableTimeout)
+	if err != nil {
+		return "", err
+	}
+	conn.Close() //nolint:errcheck
+
+	caCert, err := os.ReadFile(director.CACertPath())
+	if err != nil {
+		return "", err
+	}
+	client, err := utils.NewDirectorClient(director.URL(), caCert, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var info struct {
+		Version string `json:"version"`
+	}
+	if err := client.Get("/info", nil, &info); err != nil {
+		return "", err
+	}
+	return info.Version, nil
+}
+
+func (p *innerBoshProvisioner) Up(director utils.InnerBosh, uploadReleases bool, args []string) error {
+	env, err := utils.ExportEnvironment()
+	if err != nil {
+		return err
+	}
+
+	if uploadReleases {
+		if err := p.runScript(director.UploadReleasesCommand(p.repoRoot, env.Releases.BoshDirector)); err != nil {
+			return err
+		}
+	}
+	if err := p.runScript(director.StartCommand(p.repoRoot, args...)); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(p.stdout, "inner director %d is up at %s, target it with: eval \"$(brats env -n %d)\"\n",
+		director.Number, director.IP(), director.Number)
+	return nil
+}
+
+func (p *innerBoshProvisioner) Down(director utils.InnerBosh) error {
+	if _, err := utils.ExportEnvironment(); err != nil {
+		return err
+	}
+	return p.runScript(director.StopCommand(p.repoRoot))
+}
+
+func (p *innerBoshProvisioner) runScript(cmd *exec.Cmd) error {
+	cmd.Stdout = p.stdout
+	cmd.Stderr = p.stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w", filepath.Base(cmd.Path), err)
+	}
+	return nil
+}
+
+// Env exports what the bosh CLI wrapper the scripts write does. It only
+// needs the director's files and a bosh CLI to read its creds.yml with,
+// not the outer director.
+func (p *innerBoshProvisioner) Env(director utils.InnerBosh) ([]envVar, error) {
+	env, err := utils.LoadEnvironment()
+	if err != nil {
+		return nil, err
+	}
+	if err := env.Validate("paths.bosh_binary"); err != nil {
+		return nil, err
+	}
+	director.BoshBinary = env.Paths.BoshBinary
+
+	password, err := director.Credential("/admin_password")
+	if err != nil {
+		return nil, err
+	}
+	return []envVar{
+		{"BOSH_ENVIRONMENT", director.IP()},
+		{"BOSH_DIRECTOR_IP", director.IP()},
+		{"BOSH_CA_CERT", director.CACertPath()},
+		{"BOSH_CLIENT", "admin"},
+		{"BOSH_CLIENT_SECRET", password},
+	}, nil
+}
+
+// SSH runs the ssh CLI, for a terminal; the director's host key changes
+// every time it is deployed, so it is not checked.
+func (p *innerBoshProvisioner) SSH(director utils.InnerBosh, command []string) error {
+	args := []string{
+		"-i", director.JumpboxPrivateKeyPath(),
+		"-o", "StrictHostKeyChecking=no",
+		"-o", "UserKnownHostsFile=/dev/null",
+		"-o", "LogLevel=ERROR",
+		"jumpbox@" + director.IP(),
+	}
+	cmd := exec.Command("ssh", append(args, command...)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = p.stdout
+	cmd.Stderr = p.stderr
+	return cmd.Run()
+}
+
+func (p *innerBoshProvisioner) Logs(director utils.InnerBosh, dirs []string, w io.Writer) error {
+	client, err := director.SSHClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close() //nolint:errcheck
+
+	result, err := client.Sudo().Run(utils.InnerDirectorTarballCommand(dirs...))
+	if err != nil {
+		return err
+	}
+	if result.ExitStatus != 0 {
+		return fmt.Errorf("archiving the logs failed:\n%s", result.Stderr)
+	}
+	_, err = w.Write(result.Stdout)
+	return err
+}
+
+func (p *innerBoshProvisioner) Run(ginkgoArgs []string, skipCleanup bool) error {
+	cmd := exec.Command("go", append([]string{"run", "github.com/onsi/ginkgo/v2/ginkgo"}, ginkgoArgs...)...)
+	cmd.Dir = filepath.Join(p.repoRoot, "src", "brats")
+	cmd.Env = os.Environ()
+	if skipCleanup {
+		cmd.Env = append(cmd.Env, "BRATS_SKIP_CLEANUP=true")
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = p.stdout
+	cmd.Stderr = p.stderr
+	return cmd.Run()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"brats/utils"
+)
+
+// The states of an inner director.
+const (
+	// stateNotDeployed is a director whose deploy is running or failed.
+	stateNotDeployed = "not deployed"
+	stateRunning     = "running"
+	stateUnreachable = "unreachable"
+)
+
+type directorStatus struct {
+	Director utils.InnerBosh
+	State    string
+	// Fingerprint is empty when the director has no manifest yet.
+	Fingerprint string
+	Version     string
+	// Problem is why the director is unreachable.
+	Problem string
+}
+
+// directorStatuses asks every inner director that was deployed for its
+// version.
+func directorStatuses(p provisioner) ([]directorStatus, error) {
+	directors, err := p.Directors()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]directorStatus, len(directors))
+	for i, director := range directors {
+		status := directorStatus{Director: director}
+		// A director whose deploy has not written its manifest yet has no
+		// fingerprint.
+		status.Fingerprint, _ = director.Fingerprint()
+
+		deployed, err := director.Deployed()
+		switch {
+		case err != nil:
+			return nil, err
+		case !deployed:
+			status.State = stateNotDeployed
+		default:
+			status.Version, err = p.Version(director)
+			if err != nil {
+				status.State = stateUnreachable
+				status.Problem = err.Error()
+			} else {
+				status.State = stateRunning
+			}
+		}
+		statuses[i] = status
+	}
+	return statuses, nil
+}
+
+func writeStatuses(w io.Writer, statuses []directorStatus) error {
+	if len(statuses) == 0 {
+		_, err := fmt.Fprintf(w, "no inner directors under %s\n", utils.InnerBoshRoot)
+		return err
+	}
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "N\tDEPLOYMENT\tSTATE\tIP\tFINGERPRINT\tVERSION")
+	for _, status := range statuses {
+		fmt.Fprintf(table, "%d\t%s\t%s\t%s\t%s\t%s\n",
+			status.Director.Number,
+			status.Director.DeploymentName(),
+			status.State,
+			status.Director.IP(),
+			orDash(status.Fingerprint),
+			orDash(status.Version),
+		)
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+
+	for _, status := range statuses {
+		if status.Problem != "" {
+			fmt.Fprintf(w, "%s: %s\n", status.Director.DeploymentName(), status.Problem)
+		}
+	}
+	return nil
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("status", func() {
+	var provisioner *fakeProvisioner
+
+	BeforeEach(func() {
+		provisioner = newFakeProvisioner(GinkgoT().TempDir())
+	})
+
+	It("tells running, unreachable and undeployed directors apart", func() {
+		provisioner.deploy(1, "name: bosh-1", true)
+		provisioner.deploy(2, "name: bosh-2", true)
+		provisioner.deploy(10, "name: bosh-1", false)
+		provisioner.versions[1] = "282.0.0 (00000000)"
+
+		statuses, err := directorStatuses(provisioner)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statuses).To(HaveLen(3))
+
+		Expect(statuses[0]).To(And(
+			HaveField("Director.Number", 1),
+			HaveField("State", stateRunning),
+			HaveField("Version", "282.0.0 (00000000)"),
+		))
+		Expect(statuses[1]).To(And(
+			HaveField("Director.Number", 2),
+			HaveField("State", stateUnreachable),
+			HaveField("Problem", "connection refused"),
+		))
+		Expect(statuses[2]).To(And(
+			HaveField("Director.Number", 10),
+			HaveField("State", stateNotDeployed),
+			HaveField("Version", ""),
+		))
+
+		By("fingerprinting the manifests")
+		Expect(statuses[0].Fingerprint).To(HaveLen(12))
+		Expect(statuses[2].Fingerprint).To(Equal(statuses[0].Fingerprint))
+		Expect(statuses[1].Fingerprint).NotTo(Equal(statuses[0].Fingerprint))
+	})
+
+	It("prints a table, followed by why directors are unreachable", func() {
+		provisioner.deploy(1, "name: bosh-1", true)
+		provisioner.deploy(2, "name: bosh-2", true)
+		provisioner.versions[1] = "282.0.0"
+
+		statuses, err := directorStatuses(provisioner)
+		Expect(err).NotTo(HaveOccurred())
+		output := &bytes.Buffer{}
+		Expect(writeStatuses(output, statuses)).To(Succeed())
+
+		Expect(output.String()).To(MatchRegexp(`^N  DEPLOYMENT  STATE        IP           FINGERPRINT   VERSION
+1  bosh-1      running      10\.245\.0\.11  [0-9a-f]{12}  282\.0\.0
+2  bosh-2      unreachable  10\.245\.0\.12  [0-9a-f]{12}  -
+bosh-2: connection refused
+$`))
+	})
+
+	It("says when there are no directors", func() {
+		output := &bytes.Buffer{}
+		Expect(writeStatuses(output, nil)).To(Succeed())
+		Expect(output.String()).To(Equal("no inner directors under /tmp/inner-bosh/director\n"))
+	})
+
+	It("leaves out what is not a director", func() {
+		provisioner.deploy(1, "name: bosh-1", false)
+		Expect(os.Mkdir(filepath.Join(provisioner.root, "logs"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(provisioner.root, "2"), nil, 0644)).To(Succeed())
+
+		statuses, err := directorStatuses(provisioner)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statuses).To(ConsistOf(HaveField("Director.Number", 1)))
+	})
+})
@@ -0,0 +1,53 @@
+// Command fake-credhub runs the brats CredHub stand-in on its own, e.g. to
+// point a locally deployed director or the credhub CLI at it.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"brats/fakes/credhub"
+)
+
+func main() {
+	address := flag.String("listen", "127.0.0.1:8844", "address to listen on")
+	hosts := flag.String("hosts", "127.0.0.1", "comma-separated IPs and names for the server certificate")
+	clientID := flag.String("client-id", "director_to_credhub", "UAA client allowed to fetch tokens")
+	clientSecret := flag.String("client-secret", "", "secret of the UAA client")
+	caCertPath := flag.String("ca-cert", "", "path to write the server CA certificate to")
+	flag.Parse()
+
+	if *clientSecret == "" {
+		log.Fatal("-client-secret is required")
+	}
+
+	server, err := credhub.Start(credhub.Config{
+		Address:      *address,
+		Hosts:        strings.Split(*hosts, ","),
+		ClientID:     *clientID,
+		ClientSecret: *clientSecret,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer server.Close() //nolint:errcheck
+
+	if *caCertPath != "" {
+		if err := os.WriteFile(*caCertPath, []byte(server.CACert()), 0o644); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		fmt.Print(server.CACert())
+	}
+
+	fmt.Printf("config server listening on %s/api/ (UAA %s)\n", server.URL(), server.URL())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+}
@@ -0,0 +1,195 @@
+// Package db reaches the external databases the inner director is deployed
+// against, over TLS and mutual TLS, to create, drop and inspect the
+// director's database. It also reaches databases that only listen on a VM's
+// loopback interface, through an ssh tunnel.
+package db
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+const (
+	MySQL    = "mysql"
+	Postgres = "postgres"
+
+	connectTimeout = 30 * time.Second
+)
+
+// Verification is how much of the server's certificate is checked.
+type Verification int
+
+const (
+	// VerifyFull checks the certificate chain and that the certificate
+	// names the host, like sslmode=verify-full.
+	VerifyFull Verification = iota
+	// VerifyCA only checks the certificate chain, like sslmode=verify-ca.
+	// Cloud SQL servers present certificates that do not name the address
+	// they are reached at.
+	VerifyCA
+)
+
+var ErrIncompleteClientCertificate = errors.New("client certificate and key must be given together")
+
+type Config struct {
+	// Type is MySQL or Postgres.
+	Type string
+	Host string
+	// Port defaults to the database type's standard port.
+	Port     int
+	User     string
+	Password string
+
+	// Plaintext connects without TLS, for a server reached through an ssh
+	// tunnel, which encrypts the connection instead. CACertPath and the
+	// client certificate are ignored.
+	Plaintext bool
+
+	CACertPath string
+	// ClientCertPath and ClientKeyPath enable mutual TLS.
+	ClientCertPath string
+	ClientKeyPath  string
+	Verification   Verification
+}
+
+func (c Config) port() int {
+	switch {
+	case c.Port != 0:
+		return c.Port
+	case c.Type == MySQL:
+		return 3306
+	default:
+		return 5432
+	}
+}
+
+// TLSConfig trusts only the CA at CACertPath and presents the client
+// certificate, if any.
+func (c Config) TLSConfig() (*tls.Config, error) {
+	caCert, err := os.ReadFile(c.CACertPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading database CA: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("no certificates in database CA %s", c.CACertPath)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    roots,
+		ServerName: c.Host,
+	}
+
+	if c.ClientCertPath != "" || c.ClientKeyPath != "" {
+		if c.ClientCertPath == "" || c.ClientKeyPath == "" {
+			return nil, ErrIncompleteClientCertificate
+		}
+		certificate, err := tls.LoadX509KeyPair(c.ClientCertPath, c.ClientKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("loading database client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	if c.Verification == VerifyCA {
+		// crypto/tls can only skip the hostname check together with the
+		// chain, so the chain is checked here instead.
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyChain(rawCerts, roots)
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+func verifyChain(rawCerts [][]byte, roots *x509.CertPool) error {
+	if len(rawCerts) == 0 {
+		return errors.New("database server presented no certificate")
+	}
+
+	intermediates := x509.NewCertPool()
+	var leaf *x509.Certificate
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("parsing database server certificate: %w", err)
+		}
+		if i == 0 {
+			leaf = cert
+		} else {
+			intermediates.AddCert(cert)
+		}
+	}
+
+	_, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+	return err
+}
+
+// Open connects to database, or to the server's default database if it is
+// empty. The connection is only made on first use.
+func (c Config) Open(database string) (*sql.DB, error) {
+	var tlsConfig *tls.Config
+	if !c.Plaintext {
+		var err error
+		tlsConfig, err = c.TLSConfig()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch c.Type {
+	case MySQL:
+		config := mysql.NewConfig()
+		config.Net = "tcp"
+		config.Addr = net.JoinHostPort(c.Host, strconv.Itoa(c.port()))
+		config.User = c.User
+		config.Passwd = c.Password
+		config.DBName = database
+		config.TLS = tlsConfig
+		config.Timeout = connectTimeout
+
+		connector, err := mysql.NewConnector(config)
+		if err != nil {
+			return nil, err
+		}
+		return sql.OpenDB(connector), nil
+
+	case Postgres:
+		if database == "" {
+			database = "postgres"
+		}
+
+		// Parsing an explicit sslmode keeps PGSSLMODE and the like from
+		// adding fallback connections without TLS.
+		config, err := pgx.ParseConfig("sslmode=disable")
+		if err != nil {
+			return nil, err
+		}
+		config.Host = c.Host
+		config.Port = uint16(c.port())
+		config.User = c.User
+		config.Password = c.Password
+		config.Database = database
+		config.TLSConfig = tlsConfig
+		config.Fallbacks = nil
+		config.ConnectTimeout = connectTimeout
+
+		return stdlib.OpenDB(*config), nil
+
+	default:
+		return nil, fmt.Errorf("unknown database type %q", c.Type)
+	}
+}
@@ -0,0 +1,183 @@
+package db_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"brats/certs"
+	"brats/db"
+)
+
+// testCA issues certificates for the handshakes and the local postgres.
+type testCA struct {
+	*certs.Certificate
+}
+
+func newTestCA() testCA {
+	ca, err := certs.NewCA(certs.Options{CommonName: "brats-db-test-ca", KeyType: certs.ECDSA})
+	Expect(err).NotTo(HaveOccurred())
+	return testCA{ca}
+}
+
+// issue returns PEM encoded certificate and key for hosts, usable by servers
+// and clients alike.
+func (ca testCA) issue(hosts ...string) ([]byte, []byte) {
+	leaf, err := ca.Leaf(certs.Options{
+		CommonName:  hosts[0],
+		Hosts:       hosts,
+		KeyType:     certs.ECDSA,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	})
+	Expect(err).NotTo(HaveOccurred())
+	return leaf.CertPEM(), leaf.KeyPEM()
+}
+
+func (ca testCA) pem() []byte {
+	return ca.CertPEM()
+}
+
+func writeFile(dir, name string, contents []byte) string {
+	path := filepath.Join(dir, name)
+	Expect(os.WriteFile(path, contents, 0o600)).To(Succeed())
+	return path
+}
+
+var _ = Describe("Config", func() {
+	var (
+		dir    string
+		ca     testCA
+		config db.Config
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		ca = newTestCA()
+
+		config = db.Config{
+			Type:       db.Postgres,
+			Host:       "127.0.0.1",
+			CACertPath: writeFile(dir, "ca.pem", ca.pem()),
+		}
+	})
+
+	// handshake connects a client with config's TLS settings to a server
+	// presenting a certificate for serverHosts, and returns the client's
+	// error and the certificates the server saw.
+	handshake := func(serverHosts ...string) (error, []*x509.Certificate) {
+		certPEM, keyPEM := ca.issue(serverHosts...)
+		serverCert, err := tls.X509KeyPair(certPEM, keyPEM)
+		Expect(err).NotTo(HaveOccurred())
+
+		clientConfig, err := config.TLSConfig()
+		Expect(err).NotTo(HaveOccurred())
+
+		listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			ClientAuth:   tls.RequestClientCert,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer listener.Close() //nolint:errcheck
+
+		serverDone := make(chan []*x509.Certificate, 1)
+		go func() {
+			defer GinkgoRecover()
+			conn, err := listener.Accept()
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close() //nolint:errcheck
+
+			server := conn.(*tls.Conn)
+			server.Handshake() //nolint:errcheck
+			serverDone <- server.ConnectionState().PeerCertificates
+		}()
+
+		conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", listener.Addr().String(), clientConfig)
+		if err == nil {
+			conn.Close() //nolint:errcheck
+		}
+		return err, <-serverDone
+	}
+
+	Context("with full verification", func() {
+		It("accepts a server certificate for the host", func() {
+			err, _ := handshake("127.0.0.1")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("rejects a server certificate for another host", func() {
+			err, _ := handshake("db.example.com")
+			Expect(err).To(MatchError(ContainSubstring("127.0.0.1")))
+		})
+
+		It("rejects a server certificate from another CA", func() {
+			config.CACertPath = writeFile(dir, "other-ca.pem", newTestCA().pem())
+			err, _ := handshake("127.0.0.1")
+			Expect(err).To(MatchError(ContainSubstring("unknown authority")))
+		})
+	})
+
+	Context("with CA verification only", func() {
+		BeforeEach(func() {
+			config.Verification = db.VerifyCA
+		})
+
+		It("accepts a server certificate for another host", func() {
+			err, _ := handshake("db.example.com")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("still rejects a server certificate from another CA", func() {
+			config.CACertPath = writeFile(dir, "other-ca.pem", newTestCA().pem())
+			err, _ := handshake("db.example.com")
+			Expect(err).To(MatchError(ContainSubstring("unknown authority")))
+		})
+	})
+
+	Context("with a client certificate", func() {
+		BeforeEach(func() {
+			certPEM, keyPEM := ca.issue("director")
+			config.ClientCertPath = writeFile(dir, "client.pem", certPEM)
+			config.ClientKeyPath = writeFile(dir, "client.key", keyPEM)
+		})
+
+		It("presents it to the server", func() {
+			err, peerCertificates := handshake("127.0.0.1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(peerCertificates).To(HaveLen(1))
+			Expect(peerCertificates[0].Subject.CommonName).To(Equal("director"))
+		})
+
+		It("requires both the certificate and the key", func() {
+			config.ClientKeyPath = ""
+			_, err := config.TLSConfig()
+			Expect(err).To(MatchError(db.ErrIncompleteClientCertificate))
+		})
+	})
+
+	It("fails when the CA file holds no certificate", func() {
+		config.CACertPath = writeFile(dir, "empty.pem", []byte("not a certificate"))
+		_, err := config.TLSConfig()
+		Expect(err).To(MatchError(ContainSubstring("no certificates")))
+	})
+
+	It("needs no CA to connect without TLS", func() {
+		config.Plaintext = true
+		config.CACertPath = filepath.Join(dir, "missing.pem")
+
+		conn, err := config.Open("bosh")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conn.Close()).To(Succeed())
+	})
+
+	It("fails for unknown database types", func() {
+		config.Type = "sqlite"
+		_, err := config.Open("")
+		Expect(err).To(MatchError(ContainSubstring(`unknown database type "sqlite"`)))
+	})
+})
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const queryTimeout = 2 * time.Minute
+
+// Client runs administrative queries against a database server.
+type Client struct {
+	config Config
+	db     *sql.DB
+}
+
+// Connect opens a connection to the server's default database, failing if
+// the server cannot be reached or its certificate is not trusted.
+func Connect(config Config) (*Client, error) {
+	db, err := config.Open("")
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close() //nolint:errcheck
+		return nil, fmt.Errorf("connecting to %s at %s: %w", config.Type, config.Host, err)
+	}
+
+	return &Client{config: config, db: db}, nil
+}
+
+func (c *Client) Close() error {
+	return c.db.Close()
+}
+
+// CreateDatabase creates the database, failing if it exists.
+func (c *Client) CreateDatabase(name string) error {
+	return c.exec("CREATE DATABASE " + c.quote(name))
+}
+
+// DropDatabase drops the database if it exists.
+func (c *Client) DropDatabase(name string) error {
+	return c.exec("DROP DATABASE IF EXISTS " + c.quote(name))
+}
+
+func (c *Client) DatabaseExists(name string) (bool, error) {
+	query := "SELECT count(*) FROM pg_database WHERE datname = $1"
+	if c.config.Type == MySQL {
+		query = "SELECT count(*) FROM information_schema.schemata WHERE schema_name = ?"
+	}
+
+	var count int
+	if err := scanRow(c.db, query, []any{name}, &count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Tables lists the tables in the database, e.g. to see whether the director
+// migrated it.
+func (c *Client) Tables(database string) ([]string, error) {
+	db := c.db
+	query := "SELECT table_name FROM information_schema.tables WHERE table_schema = ? ORDER BY table_name"
+	args := []any{database}
+
+	if c.config.Type == Postgres {
+		// Postgres only shows the tables of the database a connection is
+		// for.
+		var err error
+		db, err = c.config.Open(database)
+		if err != nil {
+			return nil, err
+		}
+		defer db.Close() //nolint:errcheck
+
+		query = "SELECT table_name FROM information_schema.tables WHERE table_schema = 'public' ORDER BY table_name"
+		args = nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("listing tables in %s: %w", database, err)
+	}
+	defer rows.Close() //nolint:errcheck
+
+	tables := []string{}
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
+
+// Cipher is the TLS cipher of the client's connection, or "" if it is not
+// encrypted.
+func (c *Client) Cipher() (string, error) {
+	var cipher sql.NullString
+	if c.config.Type == MySQL {
+		var name string
+		err := scanRow(c.db, "SHOW SESSION STATUS LIKE 'Ssl_cipher'", nil, &name, &cipher)
+		return cipher.String, err
+	}
+
+	err := scanRow(c.db, "SELECT cipher FROM pg_stat_ssl WHERE pid = pg_backend_pid()", nil, &cipher)
+	return cipher.String, err
+}
+
+func (c *Client) exec(statement string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	if _, err := c.db.ExecContext(ctx, statement); err != nil {
+		return fmt.Errorf("running %q: %w", statement, err)
+	}
+	return nil
+}
+
+// scanRow runs a query that returns one row and scans it into dest.
+func scanRow(db *sql.DB, query string, args []any, dest ...any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	if err := db.QueryRowContext(ctx, query, args...).Scan(dest...); err != nil {
+		return fmt.Errorf("running %q: %w", query, err)
+	}
+	return nil
+}
+
+func (c *Client) quote(identifier string) string {
+	if c.config.Type == MySQL {
+		return "`" + strings.ReplaceAll(identifier, "`", "``") + "`"
+	}
+	return `"` + strings.ReplaceAll(identifier, `"`, `""`) + `"`
+}
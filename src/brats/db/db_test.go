@@ -0,0 +1,164 @@
+package db_test
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+
+	"brats/db"
+)
+
+// These specs run against a postgres the suite starts, with the binaries
+// from POSTGRES_BIN_DIR or the PATH.
+var _ = Describe("Client", Ordered, func() {
+	const password = "brats-db-test"
+
+	var (
+		dir    string
+		ca     testCA
+		config db.Config
+	)
+
+	postgresBinary := func(name string) string {
+		if binDir := os.Getenv("POSTGRES_BIN_DIR"); binDir != "" {
+			return filepath.Join(binDir, name)
+		}
+		path, err := exec.LookPath(name)
+		if err != nil {
+			Skip(fmt.Sprintf("%s is not installed; set POSTGRES_BIN_DIR to run the postgres specs", name))
+		}
+		return path
+	}
+
+	BeforeAll(func() {
+		initdb := postgresBinary("initdb")
+		postgres := postgresBinary("postgres")
+		if os.Geteuid() == 0 {
+			Skip("postgres refuses to run as root")
+		}
+
+		dir = GinkgoT().TempDir()
+		dataDir := filepath.Join(dir, "data")
+		ca = newTestCA()
+
+		session, err := gexec.Start(exec.Command(initdb,
+			"-D", dataDir,
+			"-U", "postgres",
+			"--auth=scram-sha-256",
+			"--pwfile="+writeFile(dir, "password", []byte(password)),
+		), GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(session, time.Minute).Should(gexec.Exit(0))
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		port := listener.Addr().(*net.TCPAddr).Port
+		Expect(listener.Close()).To(Succeed())
+
+		certPEM, keyPEM := ca.issue("127.0.0.1")
+		// The mtls role may only connect with a client certificate.
+		hba := "hostssl all mtls 127.0.0.1/32 scram-sha-256 clientcert=verify-ca\n" +
+			"hostssl all all 127.0.0.1/32 scram-sha-256\n"
+		Expect(os.WriteFile(filepath.Join(dataDir, "pg_hba.conf"), []byte(hba), 0o600)).To(Succeed())
+
+		session, err = gexec.Start(exec.Command(postgres,
+			"-D", dataDir,
+			"-c", "listen_addresses=127.0.0.1",
+			"-c", fmt.Sprintf("port=%d", port),
+			"-c", "unix_socket_directories="+dir,
+			"-c", "ssl=on",
+			"-c", "ssl_cert_file="+writeFile(dir, "server.pem", certPEM),
+			"-c", "ssl_key_file="+writeFile(dir, "server.key", keyPEM),
+			"-c", "ssl_ca_file="+writeFile(dir, "ca.pem", ca.pem()),
+		), GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() {
+			session.Interrupt()
+			Eventually(session, time.Minute).Should(gexec.Exit())
+		})
+		Eventually(session.Err, time.Minute).Should(gbytes.Say("ready to accept connections"))
+
+		config = db.Config{
+			Type:       db.Postgres,
+			Host:       "127.0.0.1",
+			Port:       port,
+			User:       "postgres",
+			Password:   password,
+			CACertPath: filepath.Join(dir, "ca.pem"),
+		}
+	})
+
+	connect := func(config db.Config) *db.Client {
+		client, err := db.Connect(config)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(client.Close)
+		return client
+	}
+
+	It("creates, inspects and drops databases", func() {
+		client := connect(config)
+
+		Expect(client.DropDatabase("brats_db_test")).To(Succeed())
+		Expect(client.CreateDatabase("brats_db_test")).To(Succeed())
+		Expect(client.DatabaseExists("brats_db_test")).To(BeTrue())
+		Expect(client.CreateDatabase("brats_db_test")).To(MatchError(ContainSubstring("already exists")))
+
+		conn, err := config.Open("brats_db_test")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = conn.Exec("CREATE TABLE deployments (id serial PRIMARY KEY)")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conn.Close()).To(Succeed())
+		Expect(client.Tables("brats_db_test")).To(Equal([]string{"deployments"}))
+
+		Expect(client.DropDatabase("brats_db_test")).To(Succeed())
+		Expect(client.DatabaseExists("brats_db_test")).To(BeFalse())
+		Expect(client.DropDatabase("brats_db_test")).To(Succeed())
+	})
+
+	It("connects over TLS", func() {
+		Expect(connect(config).Cipher()).NotTo(BeEmpty())
+	})
+
+	It("presents a client certificate", func() {
+		conn, err := config.Open("")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = conn.Exec(fmt.Sprintf("CREATE ROLE mtls LOGIN PASSWORD '%s'", password))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conn.Close()).To(Succeed())
+
+		config := config
+		config.User = "mtls"
+		_, err = db.Connect(config)
+		Expect(err).To(MatchError(ContainSubstring("certificate")))
+
+		certPEM, keyPEM := ca.issue("mtls")
+		config.ClientCertPath = writeFile(dir, "client.pem", certPEM)
+		config.ClientKeyPath = writeFile(dir, "client.key", keyPEM)
+		Expect(connect(config).Cipher()).NotTo(BeEmpty())
+	})
+
+	It("refuses a server it cannot verify", func() {
+		config := config
+		config.CACertPath = writeFile(dir, "other-ca.pem", newTestCA().pem())
+
+		_, err := db.Connect(config)
+		Expect(err).To(MatchError(ContainSubstring("unknown authority")))
+	})
+
+	It("quotes database names", func() {
+		client := connect(config)
+		name := `brats "quoted"; db`
+
+		Expect(client.CreateDatabase(name)).To(Succeed())
+		DeferCleanup(client.DropDatabase, name)
+		Expect(client.DatabaseExists(name)).To(BeTrue())
+	})
+})
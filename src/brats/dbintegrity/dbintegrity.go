@@ -0,0 +1,309 @@
+// Package dbintegrity seeds a postgres database with director-like data and
+// reports row counts, checksums, sequence values and large objects, so that
+// a database can be compared before and after a major version upgrade.
+//
+// The databases it checks only listen on their VM's loopback interface; the
+// specs reach them through an ssh tunnel with brats/db.
+package dbintegrity
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Schema holds everything SeedSQL creates, apart from the large objects
+// themselves.
+const Schema = "brats_integrity"
+
+// Tables are the seeded tables, in the order they reference each other.
+var Tables = []string{"deployments", "tasks", "events", "blobs"}
+
+// Sequences are the seeded sequences, including the ones backing the
+// tables' serial ids.
+var Sequences = []string{"deployments_id_seq", "tasks_id_seq", "events_id_seq", "agent_ids"}
+
+// NonASCII is text in several scripts, stored in every text and jsonb column
+// so that an encoding or collation change shows up in the checksums.
+const NonASCII = "Grüße ✓ 部署 デプロイ развёртывание עברית 🚀"
+
+// Dataset is how much data SeedSQL creates.
+type Dataset struct {
+	Deployments int
+	// TasksPerDeployment and EventsPerTask multiply: every deployment gets
+	// its tasks and every task its events.
+	TasksPerDeployment int
+	EventsPerTask      int
+	// LargeObjects are stored with lo_from_bytea, referenced from blobs.
+	LargeObjects int
+	// AgentIDs is how many times the agent_ids sequence is advanced.
+	AgentIDs int
+}
+
+// DefaultDataset is large enough that pg_upgrade copies more than one page
+// of every table, and small enough to seed in seconds.
+func DefaultDataset() Dataset {
+	return Dataset{
+		Deployments:        20,
+		TasksPerDeployment: 50,
+		EventsPerTask:      5,
+		LargeObjects:       10,
+		AgentIDs:           137,
+	}
+}
+
+// SeedSQL creates the schema and fills it with d, deterministically.
+func (d Dataset) SeedSQL() string {
+	return fmt.Sprintf(`
+SET client_encoding = 'UTF8';
+BEGIN;
+CREATE SCHEMA %[1]s;
+CREATE TABLE %[1]s.deployments (
+  id serial PRIMARY KEY,
+  name text NOT NULL UNIQUE,
+  manifest text NOT NULL,
+  created_at timestamptz NOT NULL
+);
+CREATE TABLE %[1]s.tasks (
+  id bigserial PRIMARY KEY,
+  deployment_id integer NOT NULL REFERENCES %[1]s.deployments (id),
+  state text NOT NULL,
+  description text NOT NULL,
+  result bytea,
+  started_at timestamptz NOT NULL
+);
+CREATE TABLE %[1]s.events (
+  id bigserial PRIMARY KEY,
+  task_id bigint NOT NULL REFERENCES %[1]s.tasks (id),
+  action text NOT NULL,
+  context jsonb NOT NULL,
+  created_at timestamptz NOT NULL
+);
+CREATE TABLE %[1]s.blobs (
+  id serial PRIMARY KEY,
+  loid oid NOT NULL
+);
+CREATE SEQUENCE %[1]s.agent_ids START WITH 1000 INCREMENT BY 7;
+
+INSERT INTO %[1]s.deployments (name, manifest, created_at)
+SELECT 'deployment-' || d,
+       'name: deployment-' || d || E'\ndescription: ' || %[2]s,
+       timestamptz '2024-01-01 00:00:00+00' + d * interval '1 hour'
+FROM generate_series(1, %[3]d) AS d;
+
+INSERT INTO %[1]s.tasks (deployment_id, state, description, result, started_at)
+SELECT d.id,
+       (ARRAY['done', 'error', 'cancelled'])[1 + t %% 3],
+       'create deployment ' || d.name || ' ' || %[2]s,
+       convert_to(repeat('result-' || t || ' ', t), 'UTF8'),
+       d.created_at + t * interval '1 second'
+FROM %[1]s.deployments AS d, generate_series(1, %[4]d) AS t
+ORDER BY d.id, t;
+
+INSERT INTO %[1]s.events (task_id, action, context, created_at)
+SELECT t.id,
+       (ARRAY['create', 'update', 'delete', 'start', 'stop'])[1 + e %% 5],
+       jsonb_build_object('event', e, 'task', t.id, 'note', %[2]s, 'tags', jsonb_build_array(t.state, e)),
+       t.started_at + e * interval '1 millisecond'
+FROM %[1]s.tasks AS t, generate_series(1, %[5]d) AS e
+ORDER BY t.id, e;
+
+INSERT INTO %[1]s.blobs (loid)
+SELECT lo_from_bytea(0, convert_to(repeat('blob-' || b || ' ' || %[2]s || ' ', 100 * b), 'UTF8'))
+FROM generate_series(1, %[6]d) AS b
+ORDER BY b;
+
+SELECT count(nextval('%[1]s.agent_ids')) FROM generate_series(1, %[7]d);
+COMMIT;
+`, Schema, quote(NonASCII), d.Deployments, d.TasksPerDeployment, d.EventsPerTask, d.LargeObjects, d.AgentIDs)
+}
+
+// Seed runs SeedSQL against db.
+func (d Dataset) Seed(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, d.SeedSQL())
+	return err
+}
+
+// ReportQuery selects a ReportRow per table, sequence and large object.
+func ReportQuery() string {
+	var queries []string
+	for _, table := range Tables {
+		queries = append(queries, fmt.Sprintf(
+			`SELECT 'table', '%[2]s', count(*)::text, md5(coalesce(string_agg(t::text, E'\n' ORDER BY t.id), '')) FROM %[1]s.%[2]s AS t`,
+			Schema, table,
+		))
+	}
+	for _, sequence := range Sequences {
+		queries = append(queries, fmt.Sprintf(
+			`SELECT 'sequence', '%[2]s', last_value::text, is_called::text FROM %[1]s.%[2]s`,
+			Schema, sequence,
+		))
+	}
+	queries = append(queries, fmt.Sprintf(
+		`SELECT 'large_object', loid::text, length(lo_get(loid))::text, md5(lo_get(loid)) FROM %s.blobs`,
+		Schema,
+	))
+	return strings.Join(queries, "\nUNION ALL\n")
+}
+
+// ReportRow is a row ReportQuery selects. Checksum is is_called for
+// sequences.
+type ReportRow struct {
+	Kind, Name, Value, Checksum string
+}
+
+// ReadReport runs ReportQuery against db.
+func ReadReport(ctx context.Context, db *sql.DB) (Report, error) {
+	// The session settings have to apply to the report's query, so both
+	// run on one connection.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return Report{}, err
+	}
+	defer conn.Close() //nolint:errcheck
+
+	// Timestamps render in the session's time zone, which the server's
+	// configuration may change across an upgrade.
+	if _, err := conn.ExecContext(ctx, "SET TimeZone = 'UTC'"); err != nil {
+		return Report{}, err
+	}
+
+	rows, err := conn.QueryContext(ctx, ReportQuery())
+	if err != nil {
+		return Report{}, err
+	}
+	defer rows.Close() //nolint:errcheck
+
+	var reportRows []ReportRow
+	for rows.Next() {
+		var row ReportRow
+		if err := rows.Scan(&row.Kind, &row.Name, &row.Value, &row.Checksum); err != nil {
+			return Report{}, err
+		}
+		reportRows = append(reportRows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return Report{}, err
+	}
+
+	return NewReport(reportRows)
+}
+
+// Report is what ReportQuery selected.
+type Report struct {
+	Tables map[string]TableReport
+	// Sequences are each sequence's last_value.
+	Sequences map[string]int64
+	// LargeObjects are each large object's checksum, by oid.
+	LargeObjects map[uint32]TableReport
+}
+
+// TableReport is the size and checksum of a table or a large object. The
+// checksum covers the text form of every row, in id order.
+type TableReport struct {
+	Rows     int64
+	Checksum string
+}
+
+// NewReport collects the rows ReportQuery selected.
+func NewReport(rows []ReportRow) (Report, error) {
+	report := Report{
+		Tables:       map[string]TableReport{},
+		Sequences:    map[string]int64{},
+		LargeObjects: map[uint32]TableReport{},
+	}
+
+	for _, row := range rows {
+		number, err := strconv.ParseInt(row.Value, 10, 64)
+		if err != nil {
+			return Report{}, fmt.Errorf("parsing %s %s: %w", row.Kind, row.Name, err)
+		}
+
+		switch row.Kind {
+		case "table":
+			report.Tables[row.Name] = TableReport{Rows: number, Checksum: row.Checksum}
+		case "sequence":
+			report.Sequences[row.Name] = number
+		case "large_object":
+			oid, err := strconv.ParseUint(row.Name, 10, 32)
+			if err != nil {
+				return Report{}, fmt.Errorf("parsing large object oid %s: %w", row.Name, err)
+			}
+			report.LargeObjects[uint32(oid)] = TableReport{Rows: number, Checksum: row.Checksum}
+		default:
+			return Report{}, fmt.Errorf("unknown report row kind %q", row.Kind)
+		}
+	}
+
+	var missing []string
+	for _, table := range Tables {
+		if _, found := report.Tables[table]; !found {
+			missing = append(missing, "table "+table)
+		}
+	}
+	for _, sequence := range Sequences {
+		if _, found := report.Sequences[sequence]; !found {
+			missing = append(missing, "sequence "+sequence)
+		}
+	}
+	if len(missing) > 0 {
+		return Report{}, fmt.Errorf("report is missing %s", strings.Join(missing, ", "))
+	}
+
+	return report, nil
+}
+
+// Verify checks that report holds exactly what seeding d created, as far as
+// counts and sequence values go; checksums can only be compared against
+// another report.
+func (d Dataset) Verify(report Report) error {
+	tasks := d.Deployments * d.TasksPerDeployment
+	events := tasks * d.EventsPerTask
+
+	expectedRows := map[string]int{
+		"deployments": d.Deployments,
+		"tasks":       tasks,
+		"events":      events,
+		"blobs":       d.LargeObjects,
+	}
+	expectedSequences := map[string]int{
+		"deployments_id_seq": d.Deployments,
+		"tasks_id_seq":       tasks,
+		"events_id_seq":      events,
+		"agent_ids":          1000 + 7*(d.AgentIDs-1),
+	}
+
+	var problems []string
+	for _, table := range Tables {
+		if rows := report.Tables[table].Rows; rows != int64(expectedRows[table]) {
+			problems = append(problems, fmt.Sprintf("table %s has %d rows, expected %d", table, rows, expectedRows[table]))
+		}
+	}
+	for _, sequence := range Sequences {
+		if value := report.Sequences[sequence]; value != int64(expectedSequences[sequence]) {
+			problems = append(problems, fmt.Sprintf("sequence %s is at %d, expected %d", sequence, value, expectedSequences[sequence]))
+		}
+	}
+	if len(report.LargeObjects) != d.LargeObjects {
+		problems = append(problems, fmt.Sprintf("%d large objects, expected %d", len(report.LargeObjects), d.LargeObjects))
+	}
+	for oid, object := range report.LargeObjects {
+		if object.Rows == 0 {
+			problems = append(problems, fmt.Sprintf("large object %d is empty", oid))
+		}
+	}
+
+	if len(problems) > 0 {
+		slices.Sort(problems)
+		return fmt.Errorf("dataset does not match: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// quote renders s as a SQL string literal.
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,13 @@
+package dbintegrity_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestDBIntegrity(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "DB Integrity Suite")
+}
@@ -0,0 +1,113 @@
+package dbintegrity_test
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"brats/dbintegrity"
+)
+
+var _ = Describe("dbintegrity", func() {
+	dataset := dbintegrity.Dataset{
+		Deployments:        2,
+		TasksPerDeployment: 3,
+		EventsPerTask:      4,
+		LargeObjects:       2,
+		AgentIDs:           5,
+	}
+
+	// rows are what ReportQuery selects for dataset.
+	rows := func() []dbintegrity.ReportRow {
+		return []dbintegrity.ReportRow{
+			{"table", "deployments", "2", "0cc175b9c0f1b6a831c399e269772661"},
+			{"table", "tasks", "6", "92eb5ffee6ae2fec3ad71c777531578f"},
+			{"table", "events", "24", "4a8a08f09d37b73795649038408b5f33"},
+			{"table", "blobs", "2", "8277e0910d750195b448797616e091ad"},
+			{"sequence", "deployments_id_seq", "2", "true"},
+			{"sequence", "tasks_id_seq", "6", "true"},
+			{"sequence", "events_id_seq", "24", "true"},
+			{"sequence", "agent_ids", "1028", "true"},
+			{"large_object", "16390", "540", "e1671797c52e15f763380b45e841ec32"},
+			{"large_object", "16391", "1080", "b026324c6904b2a9cb4b88d6d61c81d1"},
+		}
+	}
+
+	Describe("NewReport", func() {
+		It("collects every table, sequence and large object", func() {
+			report, err := dbintegrity.NewReport(rows())
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(report.Tables).To(HaveLen(4))
+			Expect(report.Tables).To(HaveKeyWithValue("events", dbintegrity.TableReport{Rows: 24, Checksum: "4a8a08f09d37b73795649038408b5f33"}))
+			Expect(report.Sequences).To(HaveKeyWithValue("agent_ids", int64(1028)))
+			Expect(report.LargeObjects).To(HaveKeyWithValue(uint32(16391), dbintegrity.TableReport{Rows: 1080, Checksum: "b026324c6904b2a9cb4b88d6d61c81d1"}))
+		})
+
+		It("fails when a table or sequence is missing", func() {
+			var truncated []dbintegrity.ReportRow
+			for _, row := range rows() {
+				if row.Name != "tasks" && row.Name != "agent_ids" {
+					truncated = append(truncated, row)
+				}
+			}
+
+			_, err := dbintegrity.NewReport(truncated)
+			Expect(err).To(MatchError("report is missing table tasks, sequence agent_ids"))
+		})
+
+		It("fails on a value that is not a number", func() {
+			_, err := dbintegrity.NewReport([]dbintegrity.ReportRow{{"table", "tasks", "many", ""}})
+			Expect(err).To(MatchError(ContainSubstring("parsing table tasks")))
+		})
+	})
+
+	Describe("Verify", func() {
+		It("accepts a report of exactly the seeded dataset", func() {
+			report, err := dbintegrity.NewReport(rows())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dataset.Verify(report)).To(Succeed())
+		})
+
+		It("reports every count and sequence that differs", func() {
+			report, err := dbintegrity.NewReport(rows())
+			Expect(err).NotTo(HaveOccurred())
+
+			report.Tables["events"] = dbintegrity.TableReport{Rows: 23}
+			report.Sequences["tasks_id_seq"] = 1
+			delete(report.LargeObjects, 16390)
+
+			err = dataset.Verify(report)
+			Expect(err).To(MatchError(ContainSubstring("table events has 23 rows, expected 24")))
+			Expect(err).To(MatchError(ContainSubstring("sequence tasks_id_seq is at 1, expected 6")))
+			Expect(err).To(MatchError(ContainSubstring("1 large objects, expected 2")))
+		})
+	})
+
+	Describe("SeedSQL", func() {
+		It("sizes every table from the dataset", func() {
+			sql := dataset.SeedSQL()
+			Expect(sql).To(ContainSubstring("generate_series(1, 2) AS d"))
+			Expect(sql).To(ContainSubstring("generate_series(1, 3) AS t"))
+			Expect(sql).To(ContainSubstring("generate_series(1, 4) AS e"))
+			Expect(sql).To(ContainSubstring("generate_series(1, 2) AS b"))
+			Expect(sql).To(ContainSubstring("generate_series(1, 5)"))
+			Expect(sql).To(ContainSubstring(dbintegrity.NonASCII))
+			Expect(sql).NotTo(ContainSubstring("%!"))
+		})
+	})
+
+	Describe("ReportQuery", func() {
+		It("selects a row for every table and sequence", func() {
+			query := dbintegrity.ReportQuery()
+			for _, table := range dbintegrity.Tables {
+				Expect(query).To(ContainSubstring(fmt.Sprintf("'table', '%s'", table)))
+			}
+			for _, sequence := range dbintegrity.Sequences {
+				Expect(query).To(ContainSubstring(fmt.Sprintf("'sequence', '%s'", sequence)))
+			}
+			Expect(query).NotTo(ContainSubstring(";"))
+		})
+	})
+})
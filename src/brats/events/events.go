@@ -0,0 +1,168 @@
+// Package events reads the director's audit trail from its /events endpoint.
+package events
+
+import (
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"brats/utils"
+)
+
+// PageSize is the number of events the director returns per request.
+const PageSize = 200
+
+type Event struct {
+	ID         string         `json:"id"`
+	ParentID   string         `json:"parent_id"`
+	Timestamp  int64          `json:"timestamp"`
+	User       string         `json:"user"`
+	Action     string         `json:"action"`
+	ObjectType string         `json:"object_type"`
+	ObjectName string         `json:"object_name"`
+	Error      string         `json:"error"`
+	Task       string         `json:"task"`
+	Deployment string         `json:"deployment"`
+	Instance   string         `json:"instance"`
+	Context    map[string]any `json:"context"`
+}
+
+func (e Event) NumericID() int {
+	id, _ := strconv.Atoi(e.ID) //nolint:errcheck
+	return id
+}
+
+func (e Event) Time() time.Time {
+	return time.Unix(e.Timestamp, 0)
+}
+
+type Filter struct {
+	BeforeID   int
+	BeforeTime time.Time
+	AfterTime  time.Time
+	Task       string
+	Deployment string
+	Instance   string
+	User       string
+	Action     string
+	ObjectType string
+	ObjectName string
+}
+
+func (f Filter) query() url.Values {
+	query := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+
+	if f.BeforeID > 0 {
+		query.Set("before_id", strconv.Itoa(f.BeforeID))
+	}
+	if !f.BeforeTime.IsZero() {
+		query.Set("before_time", strconv.FormatInt(f.BeforeTime.Unix(), 10))
+	}
+	if !f.AfterTime.IsZero() {
+		query.Set("after_time", strconv.FormatInt(f.AfterTime.Unix(), 10))
+	}
+	set("task", f.Task)
+	set("deployment", f.Deployment)
+	set("instance", f.Instance)
+	set("user", f.User)
+	set("action", f.Action)
+	set("object_type", f.ObjectType)
+	set("object_name", f.ObjectName)
+
+	return query
+}
+
+type Client struct {
+	director *utils.DirectorClient
+}
+
+func NewClient(director *utils.DirectorClient) *Client {
+	return &Client{director: director}
+}
+
+// Page returns a single page of events matching the filter, newest first.
+func (c *Client) Page(filter Filter) ([]Event, error) {
+	var events []Event
+	err := c.director.Get("/events", filter.query(), &events)
+	return events, err
+}
+
+// List returns every event matching the filter, newest first, following
+// before_id until the director runs out of events.
+func (c *Client) List(filter Filter) ([]Event, error) {
+	return c.list(filter, 0)
+}
+
+// Since returns the events matching the filter that were recorded after the
+// event with the given ID, oldest first.
+func (c *Client) Since(afterID int, filter Filter) ([]Event, error) {
+	events, err := c.list(filter, afterID)
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Reverse(events)
+	return events, nil
+}
+
+// LatestID is the ID of the newest event, or 0 if there is none yet.
+func (c *Client) LatestID() (int, error) {
+	events, err := c.Page(Filter{})
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+
+	return events[0].NumericID(), nil
+}
+
+func (c *Client) list(filter Filter, afterID int) ([]Event, error) {
+	var all []Event
+
+	for {
+		page, err := c.Page(filter)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, event := range page {
+			if event.NumericID() <= afterID {
+				return all, nil
+			}
+			all = append(all, event)
+		}
+
+		if len(page) < PageSize {
+			return all, nil
+		}
+
+		filter.BeforeID = page[len(page)-1].NumericID()
+	}
+}
+
+// Trail marks a point in the audit trail, so a spec can look at only the
+// events its own operations produced.
+type Trail struct {
+	client *Client
+	mark   int
+}
+
+func (c *Client) StartTrail() (*Trail, error) {
+	mark, err := c.LatestID()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Trail{client: c, mark: mark}, nil
+}
+
+// Events returns the events recorded since the trail was started, oldest
+// first.
+func (t *Trail) Events(filter Filter) ([]Event, error) {
+	return t.client.Since(t.mark, filter)
+}
@@ -0,0 +1,128 @@
+package events_test
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"brats/events"
+	"brats/utils"
+)
+
+var _ = Describe("Client", func() {
+	var (
+		server  *httptest.Server
+		queries []url.Values
+		stored  []events.Event
+		client  *events.Client
+	)
+
+	BeforeEach(func() {
+		queries = nil
+		stored = nil
+		for id := 450; id >= 1; id-- {
+			stored = append(stored, events.Event{ID: strconv.Itoa(id), Action: "update", ObjectType: "deployment", Deployment: "fake"})
+		}
+
+		server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.URL.Path).To(Equal("/events"))
+			queries = append(queries, r.URL.Query())
+
+			beforeID := len(stored) + 1
+			if value := r.URL.Query().Get("before_id"); value != "" {
+				beforeID, _ = strconv.Atoi(value) //nolint:errcheck
+			}
+
+			page := []events.Event{}
+			for _, event := range stored {
+				if event.NumericID() < beforeID && len(page) < events.PageSize {
+					page = append(page, event)
+				}
+			}
+
+			Expect(json.NewEncoder(w).Encode(page)).To(Succeed())
+		}))
+		DeferCleanup(server.Close)
+
+		caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+		director, err := utils.NewDirectorClient(server.URL, caCert, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		client = events.NewClient(director)
+	})
+
+	It("passes the filter to the director", func() {
+		_, err := client.Page(events.Filter{
+			BeforeID:   10,
+			AfterTime:  time.Unix(1700000000, 0),
+			Task:       "12",
+			Deployment: "fake",
+			Instance:   "group/id",
+			User:       "admin",
+			Action:     "create",
+			ObjectType: "deployment",
+			ObjectName: "fake",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(queries).To(Equal([]url.Values{{
+			"before_id":   {"10"},
+			"after_time":  {"1700000000"},
+			"task":        {"12"},
+			"deployment":  {"fake"},
+			"instance":    {"group/id"},
+			"user":        {"admin"},
+			"action":      {"create"},
+			"object_type": {"deployment"},
+			"object_name": {"fake"},
+		}}))
+	})
+
+	It("pages through every event with before_id", func() {
+		all, err := client.List(events.Filter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(all).To(HaveLen(450))
+		Expect(all[0].ID).To(Equal("450"))
+		Expect(all[449].ID).To(Equal("1"))
+
+		Expect(queries).To(HaveLen(3))
+		Expect(queries[1].Get("before_id")).To(Equal("251"))
+		Expect(queries[2].Get("before_id")).To(Equal("51"))
+	})
+
+	It("returns the events after a given ID, oldest first", func() {
+		since, err := client.Since(440, events.Filter{})
+		Expect(err).NotTo(HaveOccurred())
+
+		var ids []string
+		for _, event := range since {
+			ids = append(ids, event.ID)
+		}
+		Expect(ids).To(Equal([]string{"441", "442", "443", "444", "445", "446", "447", "448", "449", "450"}))
+		Expect(queries).To(HaveLen(1))
+	})
+
+	It("returns the events recorded since a trail was started", func() {
+		trail, err := client.StartTrail()
+		Expect(err).NotTo(HaveOccurred())
+
+		stored = append([]events.Event{
+			{ID: "452", Action: "delete", ObjectType: "deployment"},
+			{ID: "451", Action: "create", ObjectType: "deployment"},
+		}, stored...)
+
+		recorded, err := trail.Events(events.Filter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorded).To(HaveExactElements(
+			events.MatchEvent(events.Action("create")),
+			events.MatchEvent(events.Action("delete")),
+		))
+	})
+})
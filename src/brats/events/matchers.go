@@ -0,0 +1,115 @@
+package events
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/onsi/gomega"
+	"github.com/onsi/gomega/format"
+	"github.com/onsi/gomega/types"
+)
+
+// Attribute is a single expectation on an event, e.g. Action("create").
+type Attribute struct {
+	description string
+	matches     func(Event) bool
+}
+
+func equal(field, expected string, get func(Event) string) Attribute {
+	return Attribute{
+		description: fmt.Sprintf("%s=%q", field, expected),
+		matches:     func(e Event) bool { return get(e) == expected },
+	}
+}
+
+func Action(action string) Attribute {
+	return equal("action", action, func(e Event) string { return e.Action })
+}
+
+func ObjectType(objectType string) Attribute {
+	return equal("object_type", objectType, func(e Event) string { return e.ObjectType })
+}
+
+func ObjectName(objectName string) Attribute {
+	return equal("object_name", objectName, func(e Event) string { return e.ObjectName })
+}
+
+func Deployment(deployment string) Attribute {
+	return equal("deployment", deployment, func(e Event) string { return e.Deployment })
+}
+
+func Instance(instance string) Attribute {
+	return equal("instance", instance, func(e Event) string { return e.Instance })
+}
+
+func Task(task string) Attribute {
+	return equal("task", task, func(e Event) string { return e.Task })
+}
+
+func User(user string) Attribute {
+	return equal("user", user, func(e Event) string { return e.User })
+}
+
+func ParentID(parentID string) Attribute {
+	return equal("parent_id", parentID, func(e Event) string { return e.ParentID })
+}
+
+func ErrorContaining(substring string) Attribute {
+	return Attribute{
+		description: fmt.Sprintf("error containing %q", substring),
+		matches:     func(e Event) bool { return e.Error != "" && strings.Contains(e.Error, substring) },
+	}
+}
+
+func WithoutError() Attribute {
+	return Attribute{
+		description: "no error",
+		matches:     func(e Event) bool { return e.Error == "" },
+	}
+}
+
+// MatchEvent succeeds for an Event that has every given attribute.
+func MatchEvent(attributes ...Attribute) types.GomegaMatcher {
+	return &eventMatcher{attributes: attributes}
+}
+
+// HaveEvent succeeds for a slice of events containing at least one event
+// that has every given attribute.
+func HaveEvent(attributes ...Attribute) types.GomegaMatcher {
+	return gomega.ContainElement(MatchEvent(attributes...))
+}
+
+type eventMatcher struct {
+	attributes []Attribute
+}
+
+func (m *eventMatcher) Match(actual any) (bool, error) {
+	event, ok := actual.(Event)
+	if !ok {
+		return false, fmt.Errorf("MatchEvent expects an events.Event, got:\n%s", format.Object(actual, 1))
+	}
+
+	for _, attribute := range m.attributes {
+		if !attribute.matches(event) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func (m *eventMatcher) FailureMessage(actual any) string {
+	return format.Message(actual, "to be an event with", m.GomegaString())
+}
+
+func (m *eventMatcher) NegatedFailureMessage(actual any) string {
+	return format.Message(actual, "not to be an event with", m.GomegaString())
+}
+
+func (m *eventMatcher) GomegaString() string {
+	descriptions := make([]string, len(m.attributes))
+	for i, attribute := range m.attributes {
+		descriptions[i] = attribute.description
+	}
+	return strings.Join(descriptions, ", ")
+}
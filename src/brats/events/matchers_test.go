@@ -0,0 +1,52 @@
+package events_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"brats/events"
+)
+
+var _ = Describe("Matchers", func() {
+	var trail []events.Event
+
+	BeforeEach(func() {
+		trail = []events.Event{
+			{ID: "1", User: "admin", Action: "create", ObjectType: "deployment", ObjectName: "x", Deployment: "x", Task: "5"},
+			{ID: "2", ParentID: "1", User: "admin", Action: "create", ObjectType: "instance", ObjectName: "group/id", Deployment: "x", Instance: "group/id", Task: "5"},
+			{ID: "3", ParentID: "1", User: "admin", Action: "create", ObjectType: "deployment", ObjectName: "x", Deployment: "x", Task: "5", Error: "Failed to acquire lock"},
+		}
+	})
+
+	It("matches an event with every attribute", func() {
+		Expect(trail[0]).To(events.MatchEvent(events.Action("create"), events.ObjectType("deployment"), events.Deployment("x"), events.User("admin"), events.Task("5"), events.WithoutError()))
+		Expect(trail[1]).To(events.MatchEvent(events.ObjectName("group/id"), events.Instance("group/id"), events.ParentID("1")))
+		Expect(trail[2]).To(events.MatchEvent(events.ErrorContaining("lock")))
+	})
+
+	It("does not match an event missing an attribute", func() {
+		Expect(trail[0]).NotTo(events.MatchEvent(events.Action("create"), events.ObjectType("instance")))
+		Expect(trail[0]).NotTo(events.MatchEvent(events.ErrorContaining("lock")))
+		Expect(trail[2]).NotTo(events.MatchEvent(events.WithoutError()))
+	})
+
+	It("finds an event in a trail", func() {
+		Expect(trail).To(events.HaveEvent(events.Action("create"), events.ObjectType("deployment"), events.Deployment("x")))
+		Expect(trail).To(events.HaveEvent(events.ObjectType("instance"), events.Instance("group/id")))
+		Expect(trail).NotTo(events.HaveEvent(events.Action("delete")))
+	})
+
+	It("describes the expected attributes on failure", func() {
+		matcher := events.MatchEvent(events.Action("delete"), events.ObjectType("deployment"))
+
+		success, err := matcher.Match(trail[0])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(success).To(BeFalse())
+		Expect(matcher.FailureMessage(trail[0])).To(ContainSubstring(`action="delete", object_type="deployment"`))
+	})
+
+	It("errors for anything but an event", func() {
+		_, err := events.MatchEvent(events.Action("create")).Match("not an event")
+		Expect(err).To(HaveOccurred())
+	})
+})
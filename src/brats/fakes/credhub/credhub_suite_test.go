@@ -0,0 +1,13 @@
+package credhub_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestCredhub(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Fake CredHub Suite")
+}
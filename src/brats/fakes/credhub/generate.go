@@ -0,0 +1,232 @@
+package credhub
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"brats/certs"
+)
+
+const (
+	defaultPasswordLength = 30
+	defaultKeyLength      = 2048
+	defaultDurationDays   = 365
+)
+
+var extendedKeyUsages = map[string]x509.ExtKeyUsage{
+	"server_auth":      x509.ExtKeyUsageServerAuth,
+	"client_auth":      x509.ExtKeyUsageClientAuth,
+	"code_signing":     x509.ExtKeyUsageCodeSigning,
+	"email_protection": x509.ExtKeyUsageEmailProtection,
+	"timestamping":     x509.ExtKeyUsageTimeStamping,
+}
+
+var keyUsages = map[string]x509.KeyUsage{
+	"digital_signature": x509.KeyUsageDigitalSignature,
+	"non_repudiation":   x509.KeyUsageContentCommitment,
+	"key_encipherment":  x509.KeyUsageKeyEncipherment,
+	"data_encipherment": x509.KeyUsageDataEncipherment,
+	"key_agreement":     x509.KeyUsageKeyAgreement,
+	"key_cert_sign":     x509.KeyUsageCertSign,
+	"crl_sign":          x509.KeyUsageCRLSign,
+	"encipher_only":     x509.KeyUsageEncipherOnly,
+	"decipher_only":     x509.KeyUsageDecipherOnly,
+}
+
+func stringParameter(parameters map[string]any, name string) string {
+	value, _ := parameters[name].(string) //nolint:errcheck
+	return value
+}
+
+func boolParameter(parameters map[string]any, name string) bool {
+	value, _ := parameters[name].(bool) //nolint:errcheck
+	return value
+}
+
+func intParameter(parameters map[string]any, name string, defaultValue int) int {
+	switch value := parameters[name].(type) {
+	case float64:
+		return int(value)
+	case int:
+		return value
+	default:
+		return defaultValue
+	}
+}
+
+func stringsParameter(parameters map[string]any, name string) []string {
+	var values []string
+	switch value := parameters[name].(type) {
+	case []any:
+		for _, element := range value {
+			if s, ok := element.(string); ok {
+				values = append(values, s)
+			}
+		}
+	case []string:
+		values = value
+	}
+	return values
+}
+
+func generatePassword(parameters map[string]any) (string, error) {
+	var charset string
+	if !boolParameter(parameters, "exclude_upper") {
+		charset += "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	}
+	if !boolParameter(parameters, "exclude_lower") {
+		charset += "abcdefghijklmnopqrstuvwxyz"
+	}
+	if !boolParameter(parameters, "exclude_number") {
+		charset += "0123456789"
+	}
+	if boolParameter(parameters, "include_special") {
+		charset += "!\"#$%&'()*,-./:;<=>?@[\\]^_`{|}~"
+	}
+	if charset == "" {
+		return "", BadRequestError("The combination of parameters in the request is not allowed. Please validate your input and retry your request.")
+	}
+
+	length := intParameter(parameters, "length", defaultPasswordLength)
+	password := make([]byte, length)
+	for i := range password {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
+		if err != nil {
+			return "", err
+		}
+		password[i] = charset[n.Int64()]
+	}
+
+	return string(password), nil
+}
+
+func generateRSA(parameters map[string]any) (map[string]any, error) {
+	key, err := rsa.GenerateKey(rand.Reader, intParameter(parameters, "key_length", defaultKeyLength))
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{
+		"public_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})),
+		"private_key": encodePrivateKey(key),
+	}, nil
+}
+
+func generateSSH(parameters map[string]any) (map[string]any, error) {
+	key, err := rsa.GenerateKey(rand.Reader, intParameter(parameters, "key_length", defaultKeyLength))
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := ssh.NewPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	authorizedKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey)))
+	if comment := stringParameter(parameters, "ssh_comment"); comment != "" {
+		authorizedKey += " " + comment
+	}
+
+	return map[string]any{
+		"public_key":             authorizedKey,
+		"private_key":            encodePrivateKey(key),
+		"public_key_fingerprint": strings.TrimPrefix(ssh.FingerprintSHA256(publicKey), "SHA256:"),
+	}, nil
+}
+
+type certificateAuthority struct {
+	*certs.Certificate
+	pem string
+}
+
+func parseCertificateAuthority(ca Credential) (*certificateAuthority, error) {
+	certificate, err := certs.Parse([]byte(ca.Field("certificate")), []byte(ca.Field("private_key")))
+	if err != nil || !certificate.Certificate.IsCA {
+		return nil, BadRequestError(fmt.Sprintf("The provided CA '%s' is not a certificate authority.", ca.Name))
+	}
+
+	return &certificateAuthority{Certificate: certificate, pem: ca.Field("certificate")}, nil
+}
+
+// generateCertificate issues a certificate signed by ca, or a self-signed one
+// if ca is nil.
+func generateCertificate(parameters map[string]any, ca *certificateAuthority) (map[string]any, error) {
+	isCA := boolParameter(parameters, "is_ca")
+	if ca == nil && !isCA && !boolParameter(parameters, "self_sign") {
+		return nil, BadRequestError("The combination of parameters in the request is not allowed. Please validate your input and retry your request.")
+	}
+
+	options := certs.Options{
+		CommonName:         stringParameter(parameters, "common_name"),
+		Organization:       stringParameter(parameters, "organization"),
+		OrganizationalUnit: stringParameter(parameters, "organization_unit"),
+		Hosts:              stringsParameter(parameters, "alternative_names"),
+		RSABits:            intParameter(parameters, "key_length", defaultKeyLength),
+		Validity:           certs.ValidFor(time.Duration(intParameter(parameters, "duration", defaultDurationDays)) * 24 * time.Hour),
+	}
+	if options.CommonName == "" && len(options.Hosts) == 0 {
+		return nil, BadRequestError("You must provide a common name or an alternative name to generate a certificate.")
+	}
+
+	for _, usage := range stringsParameter(parameters, "extended_key_usage") {
+		extKeyUsage, found := extendedKeyUsages[usage]
+		if !found {
+			return nil, BadRequestError(fmt.Sprintf("The provided extended key usage '%s' is not supported.", usage))
+		}
+		options.ExtKeyUsage = append(options.ExtKeyUsage, extKeyUsage)
+	}
+	for _, usage := range stringsParameter(parameters, "key_usage") {
+		keyUsage, found := keyUsages[usage]
+		if !found {
+			return nil, BadRequestError(fmt.Sprintf("The provided key usage '%s' is not supported.", usage))
+		}
+		options.KeyUsage |= keyUsage
+	}
+
+	var (
+		certificate *certs.Certificate
+		err         error
+	)
+	switch {
+	case ca != nil && isCA:
+		certificate, err = ca.Intermediate(options)
+	case ca != nil:
+		certificate, err = ca.Leaf(options)
+	case isCA:
+		certificate, err = certs.NewCA(options)
+	default:
+		certificate, err = certs.SelfSigned(options)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	caPEM := string(certificate.CertPEM())
+	if ca != nil {
+		caPEM = ca.pem
+	}
+
+	return map[string]any{
+		"ca":          caPEM,
+		"certificate": string(certificate.CertPEM()),
+		"private_key": string(certificate.KeyPEM()),
+	}, nil
+}
+
+func encodePrivateKey(key *rsa.PrivateKey) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+}
@@ -0,0 +1,351 @@
+// Package credhub is an in-memory stand-in for the CredHub data API, so the
+// inner director can be deployed with a config server without deploying
+// CredHub and UAA next to it.
+//
+// It serves the subset of the API the director's config_server client uses
+// (get by name or ID, generate with overwrite, no-overwrite and converge
+// modes) plus set and delete, and issues its own client-credentials tokens
+// from /oauth/token so it can also be used as the config server's UAA.
+package credhub
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"brats/certs"
+	"brats/fakes/internal/wire"
+)
+
+type Config struct {
+	// Address is the host:port to listen on, e.g. "0.0.0.0:0".
+	Address string
+	// Hosts are the IPs and DNS names the server certificate is issued for.
+	// The first one is used in URL.
+	Hosts []string
+
+	ClientID     string
+	ClientSecret string
+
+	// VerifyToken replaces the server's own token check, e.g. to accept the
+	// tokens of a fake UAA instead.
+	VerifyToken func(token string) error
+}
+
+// GenerateRequest is a generate call as the server received it.
+type GenerateRequest struct {
+	Name       string         `json:"name"`
+	Type       string         `json:"type"`
+	Parameters map[string]any `json:"parameters"`
+	Mode       string         `json:"mode"`
+	Overwrite  bool           `json:"overwrite"`
+}
+
+type setRequest struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value any    `json:"value"`
+}
+
+type Server struct {
+	mu        sync.Mutex
+	store     *store
+	generated []GenerateRequest
+
+	url         string
+	caCert      string
+	tokens      *tokenIssuer
+	verifyToken func(token string) error
+	listener    net.Listener
+	server      *http.Server
+}
+
+// Start listens on config.Address and serves the API over TLS with a
+// certificate signed by a freshly generated CA, see CACert.
+func Start(config Config) (*Server, error) {
+	if len(config.Hosts) == 0 {
+		return nil, errors.New("at least one host is required for the server certificate")
+	}
+
+	s := &Server{store: newStore()}
+
+	ca, err := certs.NewCA(certs.Options{CommonName: "fake-credhub-ca"})
+	if err != nil {
+		return nil, err
+	}
+	s.caCert = string(ca.CertPEM())
+
+	leaf, err := ca.Server(certs.Options{CommonName: config.Hosts[0], Hosts: config.Hosts})
+	if err != nil {
+		return nil, err
+	}
+
+	s.listener, err = tls.Listen("tcp", config.Address, &tls.Config{
+		Certificates: []tls.Certificate{leaf.TLSCertificate()},
+		MinVersion:   tls.VersionTLS12,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	port := s.listener.Addr().(*net.TCPAddr).Port
+	s.url = fmt.Sprintf("https://%s", net.JoinHostPort(config.Hosts[0], strconv.Itoa(port)))
+	s.tokens = newTokenIssuer(config.ClientID, config.ClientSecret, s.url+"/oauth/token")
+	s.verifyToken = config.VerifyToken
+	if s.verifyToken == nil {
+		s.verifyToken = s.tokens.verify
+	}
+
+	s.server = &http.Server{Handler: s.handler()} //nolint:gosec
+	go s.server.Serve(s.listener)                 //nolint:errcheck
+
+	return s, nil
+}
+
+// URL is the base URL of the server. The director's config_server.url is
+// URL()+"/api/", its config_server.uaa.url is URL().
+func (s *Server) URL() string {
+	return s.url
+}
+
+// CACert is the PEM-encoded CA the server certificate is signed by.
+func (s *Server) CACert() string {
+	return s.caCert
+}
+
+func (s *Server) Close() error {
+	return s.server.Close()
+}
+
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /oauth/token", s.issueToken)
+	mux.HandleFunc("GET /info", s.info)
+	mux.HandleFunc("GET /api/v1/data", s.authenticated(s.getByName))
+	mux.HandleFunc("GET /api/v1/data/{id}", s.authenticated(s.getByID))
+	mux.HandleFunc("POST /api/v1/data", s.authenticated(s.generate))
+	mux.HandleFunc("PUT /api/v1/data", s.authenticated(s.set))
+	mux.HandleFunc("DELETE /api/v1/data", s.authenticated(s.delete))
+	return mux
+}
+
+// Set stores a new version of a credential, like `credhub set`.
+func (s *Server) Set(name, credentialType string, value any) Credential {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.store.set(name, credentialType, value)
+}
+
+// Generate generates a credential the way a POST to /api/v1/data would.
+func (s *Server) Generate(name, credentialType string, parameters map[string]any, mode string) (Credential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.store.generate(name, credentialType, parameters, mode)
+}
+
+// Current returns the latest version of a credential.
+func (s *Server) Current(name string) (Credential, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.store.current(name)
+}
+
+// Versions returns every version of a credential, newest first.
+func (s *Server) Versions(name string) []Credential {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.store.history(name)
+}
+
+// GenerateRequests returns the generate calls received so far, oldest first.
+func (s *Server) GenerateRequests() []GenerateRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]GenerateRequest(nil), s.generated...)
+}
+
+func (s *Server) authenticated(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !found || !strings.EqualFold(scheme, "bearer") {
+			wire.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+				"error":             "invalid_token",
+				"error_description": "Full authentication is required to access this resource",
+			})
+			return
+		}
+
+		if err := s.verifyToken(token); err != nil {
+			wire.WriteJSON(w, http.StatusUnauthorized, map[string]string{
+				"error":             "invalid_token",
+				"error_description": err.Error(),
+			})
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+func (s *Server) issueToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		wire.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request", "error_description": err.Error()})
+		return
+	}
+	if grantType := r.PostForm.Get("grant_type"); grantType != "client_credentials" {
+		wire.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type", "error_description": fmt.Sprintf("Unsupported grant type: %s", grantType)})
+		return
+	}
+
+	clientID, clientSecret, found := r.BasicAuth()
+	if !found {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	token, err := s.tokens.issue(clientID, clientSecret)
+	if err != nil {
+		wire.WriteJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized", "error_description": "Bad credentials"})
+		return
+	}
+
+	wire.WriteJSON(w, http.StatusOK, map[string]any{
+		"access_token": token,
+		"token_type":   "bearer",
+		"expires_in":   int(tokenLifetime.Seconds()) - 1,
+		"scope":        strings.Join(tokenScopes, " "),
+		"jti":          wire.NewID(),
+	})
+}
+
+func (s *Server) info(w http.ResponseWriter, r *http.Request) {
+	wire.WriteJSON(w, http.StatusOK, map[string]any{
+		"app":         map[string]string{"name": "CredHub"},
+		"auth-server": map[string]string{"url": s.url},
+	})
+}
+
+func (s *Server) getByName(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		writeError(w, BadRequestError("The query parameter name is required for this request."))
+		return
+	}
+
+	versions := s.Versions(name)
+	if len(versions) == 0 {
+		writeError(w, NotFoundError{})
+		return
+	}
+
+	if r.URL.Query().Get("current") == "true" {
+		versions = versions[:1]
+	} else if value := r.URL.Query().Get("versions"); value != "" {
+		count, err := strconv.Atoi(value)
+		if err != nil || count < 1 {
+			writeError(w, BadRequestError("The number of versions must be a positive integer."))
+			return
+		}
+		versions = versions[:min(count, len(versions))]
+	}
+
+	wire.WriteJSON(w, http.StatusOK, map[string]any{"data": versions})
+}
+
+func (s *Server) getByID(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	credential, found := s.store.byID[r.PathValue("id")]
+	s.mu.Unlock()
+
+	if !found {
+		writeError(w, NotFoundError{})
+		return
+	}
+
+	wire.WriteJSON(w, http.StatusOK, credential)
+}
+
+func (s *Server) generate(w http.ResponseWriter, r *http.Request) {
+	var request GenerateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, BadRequestError("The request could not be fulfilled because the request path or body did not meet expectation. Please check the documentation for required formatting and retry your request."))
+		return
+	}
+	if request.Name == "" {
+		writeError(w, BadRequestError("A credential name must be provided. Please validate your input and retry your request."))
+		return
+	}
+
+	mode := request.Mode
+	if mode == "" && request.Overwrite {
+		mode = ModeOverwrite
+	}
+
+	s.mu.Lock()
+	s.generated = append(s.generated, request)
+	credential, err := s.store.generate(request.Name, request.Type, request.Parameters, mode)
+	s.mu.Unlock()
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	wire.WriteJSON(w, http.StatusOK, credential)
+}
+
+func (s *Server) set(w http.ResponseWriter, r *http.Request) {
+	var request setRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, BadRequestError("The request could not be fulfilled because the request path or body did not meet expectation. Please check the documentation for required formatting and retry your request."))
+		return
+	}
+	if request.Name == "" || request.Type == "" || request.Value == nil {
+		writeError(w, BadRequestError("A credential name, type and value must be provided. Please validate your input and retry your request."))
+		return
+	}
+
+	wire.WriteJSON(w, http.StatusOK, s.Set(request.Name, request.Type, request.Value))
+}
+
+func (s *Server) delete(w http.ResponseWriter, r *http.Request) {
+	name := normalizeName(r.URL.Query().Get("name"))
+
+	s.mu.Lock()
+	versions, found := s.store.versions[name]
+	for _, version := range versions {
+		delete(s.store.byID, version.ID)
+	}
+	delete(s.store.versions, name)
+	s.mu.Unlock()
+
+	if !found {
+		writeError(w, NotFoundError{})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var badRequest BadRequestError
+	switch {
+	case errors.As(err, &NotFoundError{}):
+		status = http.StatusNotFound
+	case errors.As(err, &badRequest):
+		status = http.StatusBadRequest
+	}
+
+	wire.WriteJSON(w, status, map[string]string{"error": err.Error()})
+}
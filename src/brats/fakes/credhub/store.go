@@ -0,0 +1,197 @@
+package credhub
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"brats/fakes/internal/wire"
+)
+
+const (
+	ModeOverwrite   = "overwrite"
+	ModeNoOverwrite = "no-overwrite"
+	ModeConverge    = "converge"
+)
+
+// Credential is a single version of a credential, as returned by the data
+// API.
+type Credential struct {
+	ID               string `json:"id"`
+	Name             string `json:"name"`
+	Type             string `json:"type"`
+	Value            any    `json:"value"`
+	VersionCreatedAt string `json:"version_created_at"`
+
+	// parameters is what the version was generated with, nil if it was set.
+	parameters map[string]any
+	// caID is the version of the CA a generated certificate was signed by.
+	caID string
+}
+
+// StringValue is the value of a password or value credential.
+func (c Credential) StringValue() string {
+	value, _ := c.Value.(string) //nolint:errcheck
+	return value
+}
+
+// Field is a single field of a structured value, e.g. "certificate" or
+// "private_key".
+func (c Credential) Field(name string) string {
+	value, _ := c.Value.(map[string]any) //nolint:errcheck
+	field, _ := value[name].(string)     //nolint:errcheck
+	return field
+}
+
+// NotFoundError is returned for a name or ID the store has no credential for.
+type NotFoundError struct{}
+
+func (NotFoundError) Error() string {
+	return "The request could not be completed because the credential does not exist or you do not have sufficient authorization."
+}
+
+// BadRequestError is returned for a request CredHub would reject with a 400.
+type BadRequestError string
+
+func (e BadRequestError) Error() string {
+	return string(e)
+}
+
+type store struct {
+	versions map[string][]Credential
+	byID     map[string]Credential
+	now      func() time.Time
+}
+
+func newStore() *store {
+	return &store{
+		versions: map[string][]Credential{},
+		byID:     map[string]Credential{},
+		now:      time.Now,
+	}
+}
+
+func normalizeName(name string) string {
+	if strings.HasPrefix(name, "/") {
+		return name
+	}
+	return "/" + name
+}
+
+func (s *store) current(name string) (Credential, bool) {
+	versions := s.versions[normalizeName(name)]
+	if len(versions) == 0 {
+		return Credential{}, false
+	}
+	return versions[len(versions)-1], true
+}
+
+// history returns the versions of a credential, newest first.
+func (s *store) history(name string) []Credential {
+	versions := s.versions[normalizeName(name)]
+
+	history := make([]Credential, len(versions))
+	for i, version := range versions {
+		history[len(versions)-1-i] = version
+	}
+	return history
+}
+
+func (s *store) add(credential Credential) Credential {
+	credential.Name = normalizeName(credential.Name)
+	credential.ID = wire.NewID()
+	credential.VersionCreatedAt = s.now().UTC().Format(time.RFC3339)
+
+	s.versions[credential.Name] = append(s.versions[credential.Name], credential)
+	s.byID[credential.ID] = credential
+	return credential
+}
+
+func (s *store) set(name, credentialType string, value any) Credential {
+	return s.add(Credential{Name: name, Type: credentialType, Value: value})
+}
+
+func (s *store) generate(name, credentialType string, parameters map[string]any, mode string) (Credential, error) {
+	if parameters == nil {
+		parameters = map[string]any{}
+	}
+
+	existing, found := s.current(name)
+	if found {
+		switch mode {
+		case ModeNoOverwrite, "":
+			return existing, nil
+		case ModeConverge:
+			if !s.needsRegeneration(existing, credentialType, parameters) {
+				return existing, nil
+			}
+		case ModeOverwrite:
+		default:
+			return Credential{}, BadRequestError(fmt.Sprintf("The mode '%s' is not supported.", mode))
+		}
+	}
+
+	value, caID, err := s.generateValue(credentialType, parameters)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	return s.add(Credential{Name: name, Type: credentialType, Value: value, parameters: parameters, caID: caID}), nil
+}
+
+// needsRegeneration follows CredHub's converge mode: a credential is
+// regenerated when it was generated with other parameters, was set rather than
+// generated, or is a certificate whose CA has a newer version.
+func (s *store) needsRegeneration(existing Credential, credentialType string, parameters map[string]any) bool {
+	if existing.Type != credentialType || existing.parameters == nil {
+		return true
+	}
+	if !reflect.DeepEqual(existing.parameters, parameters) {
+		return true
+	}
+	if existing.caID != "" {
+		ca, found := s.current(stringParameter(parameters, "ca"))
+		return !found || ca.ID != existing.caID
+	}
+	return false
+}
+
+func (s *store) generateValue(credentialType string, parameters map[string]any) (any, string, error) {
+	switch credentialType {
+	case "password":
+		value, err := generatePassword(parameters)
+		return value, "", err
+	case "certificate":
+		return s.generateCertificate(parameters)
+	case "rsa":
+		value, err := generateRSA(parameters)
+		return value, "", err
+	case "ssh":
+		value, err := generateSSH(parameters)
+		return value, "", err
+	default:
+		return nil, "", BadRequestError("The request does not include a valid type. Valid values for generate include 'password', 'certificate', 'ssh' and 'rsa'.")
+	}
+}
+
+func (s *store) generateCertificate(parameters map[string]any) (any, string, error) {
+	caName := stringParameter(parameters, "ca")
+	if caName == "" {
+		value, err := generateCertificate(parameters, nil)
+		return value, "", err
+	}
+
+	ca, found := s.current(caName)
+	if !found {
+		return nil, "", NotFoundError{}
+	}
+
+	signer, err := parseCertificateAuthority(ca)
+	if err != nil {
+		return nil, "", err
+	}
+
+	value, err := generateCertificate(parameters, signer)
+	return value, ca.ID, err
+}
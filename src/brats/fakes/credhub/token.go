@@ -0,0 +1,68 @@
+package credhub
+
+import (
+	"crypto/rand"
+	"errors"
+	"time"
+
+	"brats/fakes/internal/wire"
+)
+
+const tokenLifetime = time.Hour
+
+var tokenScopes = []string{"credhub.read", "credhub.write"}
+
+type tokenClaims struct {
+	JTI       string   `json:"jti"`
+	Issuer    string   `json:"iss"`
+	ClientID  string   `json:"client_id"`
+	Scope     []string `json:"scope"`
+	IssuedAt  int64    `json:"iat"`
+	ExpiresAt int64    `json:"exp"`
+}
+
+// tokenIssuer stands in for the UAA the director fetches config server
+// tokens from. It issues HS256 JWTs for a single client; the director does not
+// verify them unless it is given a public key.
+type tokenIssuer struct {
+	clientID     string
+	clientSecret string
+	issuer       string
+	key          wire.HS256
+	now          func() time.Time
+}
+
+func newTokenIssuer(clientID, clientSecret, issuer string) *tokenIssuer {
+	key := make([]byte, 32)
+	rand.Read(key) //nolint:errcheck
+
+	return &tokenIssuer{clientID: clientID, clientSecret: clientSecret, issuer: issuer, key: key, now: time.Now}
+}
+
+func (t *tokenIssuer) issue(clientID, clientSecret string) (string, error) {
+	if clientID != t.clientID || clientSecret != t.clientSecret {
+		return "", errors.New("bad credentials")
+	}
+
+	now := t.now()
+	return wire.SignJWT(t.key, tokenClaims{
+		JTI:       wire.NewID(),
+		Issuer:    t.issuer,
+		ClientID:  clientID,
+		Scope:     tokenScopes,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(tokenLifetime).Unix(),
+	})
+}
+
+func (t *tokenIssuer) verify(token string) error {
+	var claims tokenClaims
+	if err := wire.VerifyJWT(t.key, token, &claims); err != nil {
+		return err
+	}
+	if t.now().Unix() >= claims.ExpiresAt {
+		return errors.New("token expired")
+	}
+
+	return nil
+}
@@ -0,0 +1,13 @@
+package externaldb_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestExternalDB(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "External DB Suite")
+}
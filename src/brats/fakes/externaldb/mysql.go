@@ -0,0 +1,68 @@
+package externaldb
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func (s *Server) initMySQL() ([]string, error) {
+	dataDir := filepath.Join(s.dir, "data")
+
+	err := s.run("mysqld", "--no-defaults", "--initialize-insecure", "--datadir="+dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{"mysqld",
+		"--no-defaults",
+		"--datadir=" + dataDir,
+		"--bind-address=" + s.config.Host,
+		fmt.Sprintf("--port=%d", s.port),
+		"--socket=" + s.socketPath(),
+		"--pid-file=" + filepath.Join(s.dir, "mysqld.pid"),
+		"--mysqlx=OFF",
+		"--require-secure-transport=ON",
+		"--ssl-ca=" + s.certs.caCert,
+		"--ssl-cert=" + s.certs.serverCert,
+		"--ssl-key=" + s.certs.serverKey,
+	}, nil
+}
+
+func (s *Server) socketPath() string {
+	return filepath.Join(s.dir, "mysqld.sock")
+}
+
+// bootstrapMySQL creates User through the socket, as the root user the
+// data directory was initialized with has no password and may only connect
+// locally.
+func (s *Server) bootstrapMySQL() error {
+	config := mysql.NewConfig()
+	config.Net = "unix"
+	config.Addr = s.socketPath()
+	config.User = "root"
+
+	connector, err := mysql.NewConnector(config)
+	if err != nil {
+		return err
+	}
+	conn := sql.OpenDB(connector)
+	defer conn.Close() //nolint:errcheck
+
+	require := ""
+	if s.config.MutualTLS {
+		require = " REQUIRE X509"
+	}
+
+	for _, statement := range []string{
+		fmt.Sprintf("CREATE USER IF NOT EXISTS '%s'@'%%' IDENTIFIED BY '%s'%s", User, s.password, require),
+		fmt.Sprintf("GRANT ALL PRIVILEGES ON *.* TO '%s'@'%%' WITH GRANT OPTION", User),
+	} {
+		if _, err := conn.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
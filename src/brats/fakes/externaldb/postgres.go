@@ -0,0 +1,45 @@
+package externaldb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func (s *Server) initPostgres() ([]string, error) {
+	dataDir := filepath.Join(s.dir, "data")
+	passwordFile := filepath.Join(s.dir, "password")
+	if err := os.WriteFile(passwordFile, []byte(s.password), 0o600); err != nil {
+		return nil, err
+	}
+
+	err := s.run("initdb",
+		"--pgdata="+dataDir,
+		"--username="+User,
+		"--pwfile="+passwordFile,
+		"--auth=scram-sha-256",
+		"--encoding=UTF8",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	hba := "hostssl all all 0.0.0.0/0 scram-sha-256\n"
+	if s.config.MutualTLS {
+		hba = "hostssl all all 0.0.0.0/0 scram-sha-256 clientcert=verify-ca\n"
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, "pg_hba.conf"), []byte(hba), 0o600); err != nil {
+		return nil, err
+	}
+
+	return []string{"postgres",
+		"-D", dataDir,
+		"-c", "listen_addresses=" + s.config.Host,
+		"-c", fmt.Sprintf("port=%d", s.port),
+		"-c", "unix_socket_directories=" + s.dir,
+		"-c", "ssl=on",
+		"-c", "ssl_cert_file=" + s.certs.serverCert,
+		"-c", "ssl_key_file=" + s.certs.serverKey,
+		"-c", "ssl_ca_file=" + s.certs.caCert,
+	}, nil
+}
@@ -0,0 +1,295 @@
+// Package externaldb starts a local postgres or mysql server as a stand-in
+// for the cloud databases the director can be deployed against, so that the
+// external database TLS specs run without RDS or Cloud SQL instances.
+//
+// The server only accepts TLS connections, with a certificate for the
+// address it listens on signed by a freshly generated CA. It also issues a
+// client certificate for mutual TLS and a CA that signed nothing, for specs
+// that expect the director to refuse the server.
+package externaldb
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"brats/db"
+)
+
+const (
+	// User is the server's superuser, which connects with Password.
+	User = "brats"
+
+	startTimeout = 2 * time.Minute
+)
+
+type Config struct {
+	// Type is db.Postgres or db.MySQL.
+	Type string
+	// Host is the IP to listen on, which the server certificate is issued
+	// for.
+	Host string
+	// BinDir holds initdb and postgres, or mysqld. They are looked up in
+	// the PATH if it is empty.
+	BinDir string
+	// MutualTLS makes the server refuse clients without a certificate
+	// signed by the CA.
+	MutualTLS bool
+	// RunAs is the user the server runs as when Start is called as root,
+	// which both servers refuse to run as. It defaults to "nobody".
+	RunAs string
+}
+
+type Server struct {
+	config   Config
+	dir      string
+	port     int
+	password string
+	certs    certificateFiles
+
+	log    *os.File
+	cmd    *exec.Cmd
+	exited chan error
+}
+
+// Start initializes a data directory in a new temporary directory, starts
+// the server on a free port and waits until it accepts connections.
+func Start(config Config) (*Server, error) {
+	if config.Type != db.Postgres && config.Type != db.MySQL {
+		return nil, fmt.Errorf("unknown database type %q", config.Type)
+	}
+	if config.Host == "" {
+		return nil, errors.New("a host to listen on is required")
+	}
+
+	dir, err := os.MkdirTemp("", "external-db-")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{config: config, dir: dir}
+
+	if err := s.start(); err != nil {
+		s.Close() //nolint:errcheck
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Server) start() error {
+	var err error
+	if s.log, err = os.Create(s.LogPath()); err != nil {
+		return err
+	}
+	if s.port, err = freePort(s.config.Host); err != nil {
+		return err
+	}
+	if s.password, err = randomPassword(); err != nil {
+		return err
+	}
+	if s.certs, err = writeCertificates(s.dir, s.config.Host, User); err != nil {
+		return err
+	}
+
+	var command []string
+	switch s.config.Type {
+	case db.Postgres:
+		command, err = s.initPostgres()
+	case db.MySQL:
+		command, err = s.initMySQL()
+	}
+	if err != nil {
+		return err
+	}
+
+	if s.cmd, err = s.command(command...); err != nil {
+		return err
+	}
+	if err := s.cmd.Start(); err != nil {
+		return err
+	}
+	s.exited = make(chan error, 1)
+	go func() { s.exited <- s.cmd.Wait() }()
+
+	if s.config.Type == db.MySQL {
+		if err := s.waitFor(s.bootstrapMySQL); err != nil {
+			return err
+		}
+	}
+	return s.waitFor(func() error {
+		client, err := db.Connect(s.DBConfig())
+		if err != nil {
+			return err
+		}
+		return client.Close()
+	})
+}
+
+// waitFor retries ready until it succeeds, the server exits or it times out.
+func (s *Server) waitFor(ready func() error) error {
+	deadline := time.Now().Add(startTimeout)
+	for {
+		err := ready()
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case exitErr := <-s.exited:
+			s.exited <- exitErr
+			return fmt.Errorf("%s exited (%v), see %s", s.config.Type, exitErr, s.LogPath())
+		case <-time.After(500 * time.Millisecond):
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s did not start within %s, see %s: %w", s.config.Type, startTimeout, s.LogPath(), err)
+		}
+	}
+}
+
+// Close stops the server and removes its data and certificates.
+func (s *Server) Close() error {
+	if s.cmd != nil && s.cmd.Process != nil {
+		s.cmd.Process.Signal(syscall.SIGTERM) //nolint:errcheck
+		select {
+		case <-s.exited:
+		case <-time.After(time.Minute):
+			s.cmd.Process.Kill() //nolint:errcheck
+			<-s.exited
+		}
+	}
+	if s.log != nil {
+		s.log.Close() //nolint:errcheck
+	}
+	return os.RemoveAll(s.dir)
+}
+
+func (s *Server) Host() string     { return s.config.Host }
+func (s *Server) Port() int        { return s.port }
+func (s *Server) Password() string { return s.password }
+
+// LogPath is where the server logs, for debugging specs it fails.
+func (s *Server) LogPath() string { return filepath.Join(s.dir, "server.log") }
+
+func (s *Server) CACertPath() string     { return s.certs.caCert }
+func (s *Server) ClientCertPath() string { return s.certs.clientCert }
+func (s *Server) ClientKeyPath() string  { return s.certs.clientKey }
+
+// WrongCACertPath is a CA that signed neither the server's certificate nor
+// the client's.
+func (s *Server) WrongCACertPath() string { return s.certs.wrongCACert }
+
+// DBConfig connects to the server as User, with the client certificate if
+// the server requires one.
+func (s *Server) DBConfig() db.Config {
+	config := db.Config{
+		Type:         s.config.Type,
+		Host:         s.config.Host,
+		Port:         s.port,
+		User:         User,
+		Password:     s.password,
+		CACertPath:   s.certs.caCert,
+		Verification: db.VerifyFull,
+	}
+	if s.config.MutualTLS {
+		config.ClientCertPath = s.certs.clientCert
+		config.ClientKeyPath = s.certs.clientKey
+	}
+	return config
+}
+
+func (s *Server) binary(name string) (string, error) {
+	if s.config.BinDir != "" {
+		return filepath.Join(s.config.BinDir, name), nil
+	}
+	return exec.LookPath(name)
+}
+
+// command runs a server binary, as RunAs if the suite runs as root, with
+// its output in the server log.
+func (s *Server) command(args ...string) (*exec.Cmd, error) {
+	binary, err := s.binary(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(binary, args[1:]...)
+	cmd.Stdout = s.log
+	cmd.Stderr = s.log
+
+	if os.Geteuid() == 0 {
+		uid, gid, err := s.runAs()
+		if err != nil {
+			return nil, err
+		}
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: uid, Gid: gid}}
+	}
+
+	return cmd, nil
+}
+
+// run runs a server binary to completion.
+func (s *Server) run(args ...string) error {
+	cmd, err := s.command(args...)
+	if err != nil {
+		return err
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running %s: %w, see %s", args[0], err, s.LogPath())
+	}
+	return nil
+}
+
+// runAs resolves RunAs and hands the temporary directory over to it.
+func (s *Server) runAs() (uint32, uint32, error) {
+	name := s.config.RunAs
+	if name == "" {
+		name = "nobody"
+	}
+
+	account, err := user.Lookup(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	uid, err := strconv.ParseUint(account.Uid, 10, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	gid, err := strconv.ParseUint(account.Gid, 10, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = filepath.Walk(s.dir, func(path string, _ os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, int(uid), int(gid))
+	})
+	return uint32(uid), uint32(gid), err
+}
+
+func freePort(host string) (int, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close() //nolint:errcheck
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+func randomPassword() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
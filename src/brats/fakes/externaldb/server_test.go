@@ -0,0 +1,77 @@
+package externaldb_test
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"brats/db"
+	"brats/fakes/externaldb"
+)
+
+var _ = Describe("Server", func() {
+	It("refuses unknown database types", func() {
+		_, err := externaldb.Start(externaldb.Config{Type: "sqlite", Host: "127.0.0.1"})
+		Expect(err).To(MatchError(`unknown database type "sqlite"`))
+	})
+
+	// These start real servers with the binaries from POSTGRES_BIN_DIR and
+	// MYSQL_BIN_DIR, or the PATH.
+	DescribeTable("serving over TLS",
+		func(databaseType, binDirEnv, binary string) {
+			binDir := os.Getenv(binDirEnv)
+			if binDir == "" {
+				if _, err := exec.LookPath(binary); err != nil {
+					Skip(fmt.Sprintf("%s is not installed; set %s to run this spec", binary, binDirEnv))
+				}
+			}
+
+			start := func(mutualTLS bool) *externaldb.Server {
+				server, err := externaldb.Start(externaldb.Config{
+					Type:      databaseType,
+					Host:      "127.0.0.1",
+					BinDir:    binDir,
+					MutualTLS: mutualTLS,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				DeferCleanup(server.Close)
+				return server
+			}
+
+			connect := func(config db.Config) error {
+				client, err := db.Connect(config)
+				if err != nil {
+					return err
+				}
+				defer client.Close() //nolint:errcheck
+
+				cipher, err := client.Cipher()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(cipher).NotTo(BeEmpty())
+				return nil
+			}
+
+			By("accepting clients that trust its CA")
+			server := start(false)
+			Expect(connect(server.DBConfig())).To(Succeed())
+
+			config := server.DBConfig()
+			config.CACertPath = server.WrongCACertPath()
+			Expect(connect(config)).To(MatchError(ContainSubstring("unknown authority")))
+
+			By("requiring a client certificate with mutual TLS")
+			server = start(true)
+			Expect(connect(server.DBConfig())).To(Succeed())
+
+			config = server.DBConfig()
+			config.ClientCertPath = ""
+			config.ClientKeyPath = ""
+			Expect(connect(config)).NotTo(Succeed())
+		},
+		Entry("postgres", db.Postgres, "POSTGRES_BIN_DIR", "initdb"),
+		Entry("mysql", db.MySQL, "MYSQL_BIN_DIR", "mysqld"),
+	)
+})
@@ -0,0 +1,62 @@
+package externaldb
+
+import (
+	"os"
+	"path/filepath"
+
+	"brats/certs"
+)
+
+// certificateFiles are the PEM files Start writes: the server's
+// certificate and the client certificate for mutual TLS, both signed by
+// the CA, and a CA that signed neither.
+type certificateFiles struct {
+	caCert, wrongCACert   string
+	serverCert, serverKey string
+	clientCert, clientKey string
+}
+
+func writeCertificates(dir, host, clientName string) (certificateFiles, error) {
+	ca, err := certs.NewCA(certs.Options{CommonName: "external-db-ca"})
+	if err != nil {
+		return certificateFiles{}, err
+	}
+	wrongCA, err := certs.NewCA(certs.Options{CommonName: "external-db-wrong-ca"})
+	if err != nil {
+		return certificateFiles{}, err
+	}
+
+	server, err := ca.Server(certs.Options{CommonName: host, Hosts: []string{host}})
+	if err != nil {
+		return certificateFiles{}, err
+	}
+	client, err := ca.Client(certs.Options{CommonName: clientName})
+	if err != nil {
+		return certificateFiles{}, err
+	}
+
+	serverFiles, err := server.Write(dir, "server")
+	if err != nil {
+		return certificateFiles{}, err
+	}
+	clientFiles, err := client.Write(dir, "client")
+	if err != nil {
+		return certificateFiles{}, err
+	}
+	files := certificateFiles{
+		caCert:      filepath.Join(dir, "ca.pem"),
+		wrongCACert: filepath.Join(dir, "wrong-ca.pem"),
+		serverCert:  serverFiles.CertPath,
+		serverKey:   serverFiles.KeyPath,
+		clientCert:  clientFiles.CertPath,
+		clientKey:   clientFiles.KeyPath,
+	}
+
+	if err := os.WriteFile(files.caCert, ca.CertPEM(), 0o644); err != nil {
+		return certificateFiles{}, err
+	}
+	if err := os.WriteFile(files.wrongCACert, wrongCA.CertPEM(), 0o644); err != nil {
+		return certificateFiles{}, err
+	}
+	return files, nil
+}
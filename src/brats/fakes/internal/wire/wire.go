@@ -0,0 +1,137 @@
+// Package wire has what the fake servers send over the wire alike: signed
+// JWTs, JSON responses and IDs.
+package wire
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Signer signs JWTs with one algorithm and key.
+type Signer interface {
+	// Header is the JWT header, e.g. {"alg": "HS256", "typ": "JWT"}.
+	Header() map[string]string
+	Sign(signingInput []byte) ([]byte, error)
+	Verify(signingInput, signature []byte) error
+}
+
+// HS256 signs with an HMAC key.
+type HS256 []byte
+
+func (k HS256) Header() map[string]string {
+	return map[string]string{"alg": "HS256", "typ": "JWT"}
+}
+
+func (k HS256) Sign(signingInput []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, k)
+	mac.Write(signingInput)
+	return mac.Sum(nil), nil
+}
+
+func (k HS256) Verify(signingInput, signature []byte) error {
+	expected, err := k.Sign(signingInput)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(signature, expected) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// RS256 signs with an RSA key, whose public half clients verify with.
+type RS256 struct {
+	Key   *rsa.PrivateKey
+	KeyID string
+}
+
+func (k RS256) Header() map[string]string {
+	return map[string]string{"alg": "RS256", "kid": k.KeyID, "typ": "JWT"}
+}
+
+func (k RS256) Sign(signingInput []byte) ([]byte, error) {
+	digest := sha256.Sum256(signingInput)
+	return rsa.SignPKCS1v15(rand.Reader, k.Key, crypto.SHA256, digest[:])
+}
+
+func (k RS256) Verify(signingInput, signature []byte) error {
+	digest := sha256.Sum256(signingInput)
+	if err := rsa.VerifyPKCS1v15(&k.Key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// SignJWT encodes claims as a JWT signed by signer.
+func SignJWT(signer Signer, claims any) (string, error) {
+	header, err := json.Marshal(signer.Header())
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encodeSegment(header) + "." + encodeSegment(payload)
+	signature, err := signer.Sign([]byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + encodeSegment(signature), nil
+}
+
+// VerifyJWT checks token was signed by signer and decodes its claims. It
+// leaves checking them, e.g. for expiry, to the caller.
+func VerifyJWT(signer Signer, token string, claims any) error {
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return errors.New("malformed token")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(segments[2])
+	if err != nil {
+		return fmt.Errorf("malformed signature: %w", err)
+	}
+	if err := signer.Verify([]byte(segments[0]+"."+segments[1]), signature); err != nil {
+		return err
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(segments[1])
+	if err != nil {
+		return fmt.Errorf("malformed claims: %w", err)
+	}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return fmt.Errorf("malformed claims: %w", err)
+	}
+	return nil
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// WriteJSON answers with body as JSON, the way UAA and CredHub do.
+func WriteJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body) //nolint:errcheck
+}
+
+// NewID returns a random version 4 UUID.
+func NewID() string {
+	b := make([]byte, 16)
+	rand.Read(b) //nolint:errcheck
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,13 @@
+package wire_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestWire(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Fake Wire Suite")
+}
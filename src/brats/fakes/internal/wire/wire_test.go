@@ -0,0 +1,56 @@
+package wire_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"brats/fakes/internal/wire"
+)
+
+var _ = Describe("wire", func() {
+	type claims struct {
+		Subject string `json:"sub"`
+	}
+
+	DescribeTable("signs and verifies JWTs",
+		func(signer wire.Signer, otherSigner wire.Signer) {
+			token, err := wire.SignJWT(signer, claims{Subject: "director"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strings.Split(token, ".")).To(HaveLen(3))
+
+			var verified claims
+			Expect(wire.VerifyJWT(signer, token, &verified)).To(Succeed())
+			Expect(verified.Subject).To(Equal("director"))
+
+			Expect(wire.VerifyJWT(otherSigner, token, &verified)).To(MatchError("invalid signature"))
+			Expect(wire.VerifyJWT(signer, "not-a-token", &verified)).To(MatchError("malformed token"))
+		},
+		Entry("HS256", wire.HS256("key"), wire.HS256("other key")),
+		Entry("RS256", wire.RS256{Key: mustGenerateKey(), KeyID: "key-1"}, wire.RS256{Key: mustGenerateKey(), KeyID: "key-1"}),
+	)
+
+	It("answers with JSON", func() {
+		recorder := httptest.NewRecorder()
+		wire.WriteJSON(recorder, 201, map[string]string{"id": "1"})
+
+		Expect(recorder.Code).To(Equal(201))
+		Expect(recorder.Header().Get("Content-Type")).To(Equal("application/json;charset=UTF-8"))
+		Expect(recorder.Body.String()).To(MatchJSON(`{"id": "1"}`))
+	})
+
+	It("makes version 4 UUIDs", func() {
+		Expect(wire.NewID()).To(MatchRegexp(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`))
+		Expect(wire.NewID()).NotTo(Equal(wire.NewID()))
+	})
+})
+
+func mustGenerateKey() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	Expect(err).NotTo(HaveOccurred())
+	return key
+}
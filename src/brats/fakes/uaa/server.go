@@ -0,0 +1,249 @@
+// Package uaa is a stand-in for the UAA token issuer, so the inner director
+// can run with UAA user management and specs can call it with tokens carrying
+// any combination of scopes.
+//
+// It signs RS256 JWTs with a key generated at start, serves that key from
+// /token_keys, and grants client-credentials tokens to registered clients.
+package uaa
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"brats/fakes/internal/wire"
+)
+
+// Client is a UAA client allowed to use the client-credentials grant. Its
+// scopes are the authorities the issued tokens carry.
+type Client struct {
+	ID     string
+	Secret string
+	Scopes []string
+}
+
+type Config struct {
+	// Address is the host:port to listen on, e.g. "0.0.0.0:0".
+	Address string
+	// Hosts are the IPs and DNS names the server certificate is issued for.
+	// The first one is used in URL.
+	Hosts []string
+
+	// CACertificate and CAPrivateKey sign the server certificate, e.g. the
+	// inner director's default_ca so the bosh CLI trusts the fake along with
+	// the director. A CA is generated when they are empty.
+	CACertificate string
+	CAPrivateKey  string
+
+	Clients []Client
+}
+
+type Server struct {
+	mu      sync.Mutex
+	clients map[string]Client
+	issued  []Claims
+
+	url        string
+	caCert     string
+	signingKey *rsa.PrivateKey
+	now        func() time.Time
+	server     *http.Server
+}
+
+func Start(config Config) (*Server, error) {
+	if len(config.Hosts) == 0 {
+		return nil, errors.New("at least one host is required for the server certificate")
+	}
+
+	signingKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	certificate, caCert, err := serverCertificate(config.Hosts, config.CACertificate, config.CAPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := tls.Listen("tcp", config.Address, &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		clients:    map[string]Client{},
+		caCert:     caCert,
+		signingKey: signingKey,
+		now:        time.Now,
+	}
+	for _, client := range config.Clients {
+		s.clients[client.ID] = client
+	}
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	s.url = fmt.Sprintf("https://%s", net.JoinHostPort(config.Hosts[0], strconv.Itoa(port)))
+
+	s.server = &http.Server{Handler: s.handler()} //nolint:gosec
+	go s.server.Serve(listener)                   //nolint:errcheck
+
+	return s, nil
+}
+
+func (s *Server) URL() string {
+	return s.url
+}
+
+// CACert is the PEM-encoded CA the server certificate is signed by.
+func (s *Server) CACert() string {
+	return s.caCert
+}
+
+// VerificationKey is the PEM-encoded public key tokens are signed with, as
+// the director's user_management.uaa.public_key expects it.
+func (s *Server) VerificationKey() string {
+	der, err := x509.MarshalPKIXPublicKey(&s.signingKey.PublicKey)
+	if err != nil {
+		panic(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func (s *Server) Close() error {
+	return s.server.Close()
+}
+
+// AddClient registers a client, or replaces the one with the same ID.
+func (s *Server) AddClient(client Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.clients[client.ID] = client
+}
+
+// Token issues a signed access token without going through /oauth/token.
+func (s *Server) Token(options TokenOptions) (string, error) {
+	return s.sign(s.claims(options))
+}
+
+// IssuedTokens returns the claims of the tokens granted through
+// /oauth/token, oldest first.
+func (s *Server) IssuedTokens() []Claims {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Claims(nil), s.issued...)
+}
+
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /oauth/token", s.issueToken)
+	mux.HandleFunc("GET /token_keys", s.tokenKeys)
+	mux.HandleFunc("GET /token_key", s.tokenKey)
+	mux.HandleFunc("GET /info", s.info)
+	mux.HandleFunc("GET /login", s.info)
+	return mux
+}
+
+func (s *Server) issueToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		wire.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request", "error_description": err.Error()})
+		return
+	}
+	if grantType := r.PostForm.Get("grant_type"); grantType != "client_credentials" {
+		wire.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type", "error_description": fmt.Sprintf("Unsupported grant type: %s", grantType)})
+		return
+	}
+
+	clientID, clientSecret, found := r.BasicAuth()
+	if !found {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	s.mu.Lock()
+	client, found := s.clients[clientID]
+	s.mu.Unlock()
+	if !found || client.Secret != clientSecret {
+		wire.WriteJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized", "error_description": "Bad credentials"})
+		return
+	}
+
+	scopes := client.Scopes
+	if requested := r.PostForm.Get("scope"); requested != "" {
+		scopes = nil
+		for _, scope := range strings.Fields(requested) {
+			if !slices.Contains(client.Scopes, scope) {
+				wire.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_scope", "error_description": fmt.Sprintf("Invalid scope: %s", scope)})
+				return
+			}
+			scopes = append(scopes, scope)
+		}
+	}
+
+	claims := s.claims(TokenOptions{ClientID: client.ID, Scopes: scopes})
+	token, err := s.sign(claims)
+	if err != nil {
+		wire.WriteJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error", "error_description": err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	s.issued = append(s.issued, claims)
+	s.mu.Unlock()
+
+	wire.WriteJSON(w, http.StatusOK, map[string]any{
+		"access_token": token,
+		"token_type":   "bearer",
+		"expires_in":   claims.ExpiresAt - claims.IssuedAt - 1,
+		"scope":        strings.Join(scopes, " "),
+		"jti":          claims.JTI,
+	})
+}
+
+func (s *Server) tokenKey(w http.ResponseWriter, r *http.Request) {
+	wire.WriteJSON(w, http.StatusOK, s.jsonWebKey())
+}
+
+func (s *Server) tokenKeys(w http.ResponseWriter, r *http.Request) {
+	wire.WriteJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{s.jsonWebKey()}})
+}
+
+func (s *Server) jsonWebKey() map[string]string {
+	publicKey := s.signingKey.PublicKey
+	return map[string]string{
+		"kty":   "RSA",
+		"alg":   "RS256",
+		"use":   "sig",
+		"kid":   keyID,
+		"value": s.VerificationKey(),
+		"n":     base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+		"e":     base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+	}
+}
+
+func (s *Server) info(w http.ResponseWriter, r *http.Request) {
+	wire.WriteJSON(w, http.StatusOK, map[string]any{
+		"app":       map[string]string{"version": "fake"},
+		"zone_name": "uaa",
+		"links":     map[string]string{"uaa": s.url, "login": s.url},
+		"prompts": map[string][]string{
+			"username": {"text", "Email"},
+			"password": {"password", "Password"},
+		},
+	})
+}
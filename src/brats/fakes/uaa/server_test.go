@@ -0,0 +1,209 @@
+package uaa_test
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"brats/certs"
+	"brats/fakes/uaa"
+)
+
+var _ = Describe("Server", func() {
+	var (
+		server *uaa.Server
+		client *http.Client
+	)
+
+	fetchToken := func(form url.Values, clientID, clientSecret string) (int, map[string]any) {
+		req, err := http.NewRequest("POST", server.URL()+"/oauth/token", strings.NewReader(form.Encode()))
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(clientID, clientSecret)
+
+		resp, err := client.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close() //nolint:errcheck
+
+		Expect(resp.Header.Get("Content-Type")).To(HavePrefix("application/json"))
+		var decoded map[string]any
+		Expect(json.NewDecoder(resp.Body).Decode(&decoded)).To(Succeed())
+		return resp.StatusCode, decoded
+	}
+
+	claimsOf := func(token string) map[string]any {
+		segments := strings.Split(token, ".")
+		Expect(segments).To(HaveLen(3))
+
+		payload, err := base64.RawURLEncoding.DecodeString(segments[1])
+		Expect(err).NotTo(HaveOccurred())
+
+		var claims map[string]any
+		Expect(json.Unmarshal(payload, &claims)).To(Succeed())
+		return claims
+	}
+
+	BeforeEach(func() {
+		var err error
+		server, err = uaa.Start(uaa.Config{
+			Address: "127.0.0.1:0",
+			Hosts:   []string{"127.0.0.1"},
+			Clients: []uaa.Client{
+				{ID: "reader", Secret: "reader-secret", Scopes: []string{"bosh.read", "bosh.teams.alpha.read"}},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(server.Close)
+
+		pool := x509.NewCertPool()
+		Expect(pool.AppendCertsFromPEM([]byte(server.CACert()))).To(BeTrue())
+		client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	})
+
+	Describe("client credentials grant", func() {
+		It("issues a token with the client's scopes", func() {
+			status, body := fetchToken(url.Values{"grant_type": {"client_credentials"}}, "reader", "reader-secret")
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(body).To(HaveKeyWithValue("token_type", "bearer"))
+			Expect(body).To(HaveKeyWithValue("scope", "bosh.read bosh.teams.alpha.read"))
+
+			claims := claimsOf(body["access_token"].(string))
+			Expect(claims).To(HaveKeyWithValue("client_id", "reader"))
+			Expect(claims).To(HaveKeyWithValue("scope", ConsistOf("bosh.read", "bosh.teams.alpha.read")))
+			Expect(claims["jti"]).NotTo(HaveSuffix("-r"))
+
+			Expect(server.IssuedTokens()).To(HaveExactElements(HaveField("ClientID", "reader")))
+		})
+
+		It("narrows the scopes to the requested ones", func() {
+			status, body := fetchToken(url.Values{"grant_type": {"client_credentials"}, "scope": {"bosh.read"}}, "reader", "reader-secret")
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(claimsOf(body["access_token"].(string))).To(HaveKeyWithValue("scope", ConsistOf("bosh.read")))
+
+			status, body = fetchToken(url.Values{"grant_type": {"client_credentials"}, "scope": {"bosh.admin"}}, "reader", "reader-secret")
+			Expect(status).To(Equal(http.StatusBadRequest))
+			Expect(body).To(HaveKeyWithValue("error", "invalid_scope"))
+		})
+
+		It("rejects unknown clients and wrong secrets", func() {
+			status, _ := fetchToken(url.Values{"grant_type": {"client_credentials"}}, "reader", "wrong-secret")
+			Expect(status).To(Equal(http.StatusUnauthorized))
+
+			status, _ = fetchToken(url.Values{"grant_type": {"client_credentials"}}, "unknown", "reader-secret")
+			Expect(status).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("grants tokens to clients added later", func() {
+			server.AddClient(uaa.Client{ID: "uploader", Secret: "uploader-secret", Scopes: []string{"bosh.stemcells.upload"}})
+
+			status, body := fetchToken(url.Values{"grant_type": {"client_credentials"}}, "uploader", "uploader-secret")
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(body).To(HaveKeyWithValue("scope", "bosh.stemcells.upload"))
+		})
+
+		It("supports no other grant types", func() {
+			status, body := fetchToken(url.Values{"grant_type": {"password"}}, "reader", "reader-secret")
+			Expect(status).To(Equal(http.StatusBadRequest))
+			Expect(body).To(HaveKeyWithValue("error", "unsupported_grant_type"))
+		})
+	})
+
+	Describe("token keys", func() {
+		It("serves the key tokens are signed with", func() {
+			resp, err := client.Get(server.URL() + "/token_keys")
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close() //nolint:errcheck
+
+			var keys struct {
+				Keys []map[string]string `json:"keys"`
+			}
+			Expect(json.NewDecoder(resp.Body).Decode(&keys)).To(Succeed())
+			Expect(keys.Keys).To(HaveLen(1))
+			Expect(keys.Keys[0]).To(HaveKeyWithValue("alg", "RS256"))
+			Expect(keys.Keys[0]).To(HaveKeyWithValue("value", server.VerificationKey()))
+
+			block, _ := pem.Decode([]byte(keys.Keys[0]["value"]))
+			Expect(block).NotTo(BeNil())
+			publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+			Expect(err).NotTo(HaveOccurred())
+
+			token, err := server.Token(uaa.TokenOptions{ClientID: "fake", Scopes: []string{"bosh.admin"}})
+			Expect(err).NotTo(HaveOccurred())
+
+			segments := strings.Split(token, ".")
+			signature, err := base64.RawURLEncoding.DecodeString(segments[2])
+			Expect(err).NotTo(HaveOccurred())
+			digest := sha256.Sum256([]byte(segments[0] + "." + segments[1]))
+			Expect(rsa.VerifyPKCS1v15(publicKey.(*rsa.PublicKey), crypto.SHA256, digest[:], signature)).To(Succeed())
+		})
+	})
+
+	Describe("Token and Verify", func() {
+		It("issues user and client tokens with arbitrary scopes", func() {
+			token, err := server.Token(uaa.TokenOptions{ClientID: "bosh_cli", UserName: "alice", Scopes: []string{"bosh.teams.alpha.admin"}})
+			Expect(err).NotTo(HaveOccurred())
+
+			claims, err := server.Verify(token)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(claims.UserName).To(Equal("alice"))
+			Expect(claims.GrantType).To(Equal("password"))
+			Expect(claims.Scope).To(ConsistOf("bosh.teams.alpha.admin"))
+			Expect(claims.Audience).To(ContainElements("bosh_cli", "bosh"))
+		})
+
+		It("marks refresh tokens the way UAA does", func() {
+			token, err := server.Token(uaa.TokenOptions{ClientID: "fake", Refresh: true})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(claimsOf(token)["jti"]).To(HaveSuffix("-r"))
+		})
+
+		It("rejects expired tokens and tokens from other servers", func() {
+			expired, err := server.Token(uaa.TokenOptions{ClientID: "fake", Lifetime: -time.Minute})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = server.Verify(expired)
+			Expect(err).To(MatchError(ContainSubstring("expired")))
+
+			other, err := uaa.Start(uaa.Config{Address: "127.0.0.1:0", Hosts: []string{"127.0.0.1"}})
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(other.Close)
+
+			foreign, err := other.Token(uaa.TokenOptions{ClientID: "fake"})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = server.Verify(foreign)
+			Expect(err).To(MatchError(ContainSubstring("invalid signature")))
+		})
+	})
+
+	It("signs its server certificate with a given CA", func() {
+		caCert, caKey := generateCA()
+		signed, err := uaa.Start(uaa.Config{Address: "127.0.0.1:0", Hosts: []string{"127.0.0.1"}, CACertificate: caCert, CAPrivateKey: caKey})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(signed.Close)
+		Expect(signed.CACert()).To(Equal(caCert))
+
+		pool := x509.NewCertPool()
+		Expect(pool.AppendCertsFromPEM([]byte(caCert))).To(BeTrue())
+		resp, err := (&http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}).Get(signed.URL() + "/info")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	})
+})
+
+func generateCA() (string, string) {
+	ca, err := certs.NewCA(certs.Options{CommonName: "fake-director-ca"})
+	Expect(err).NotTo(HaveOccurred())
+	return string(ca.CertPEM()), string(ca.KeyPEM())
+}
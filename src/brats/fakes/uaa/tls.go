@@ -0,0 +1,31 @@
+package uaa
+
+import (
+	"crypto/tls"
+
+	"brats/certs"
+)
+
+// serverCertificate issues a certificate for hosts signed by the given CA, or
+// by a generated one if caCertPEM is empty. It returns the CA in PEM form.
+func serverCertificate(hosts []string, caCertPEM, caKeyPEM string) (tls.Certificate, string, error) {
+	var (
+		ca  *certs.Certificate
+		err error
+	)
+	if caCertPEM == "" {
+		ca, err = certs.NewCA(certs.Options{CommonName: "fake-uaa-ca"})
+	} else {
+		ca, err = certs.Parse([]byte(caCertPEM), []byte(caKeyPEM))
+	}
+	if err != nil {
+		return tls.Certificate{}, "", err
+	}
+
+	server, err := ca.Server(certs.Options{CommonName: hosts[0], Hosts: hosts})
+	if err != nil {
+		return tls.Certificate{}, "", err
+	}
+
+	return server.TLSCertificate(), string(ca.CertPEM()), nil
+}
@@ -0,0 +1,108 @@
+package uaa
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"brats/fakes/internal/wire"
+)
+
+const (
+	keyID                = "key-1"
+	defaultTokenLifetime = time.Hour
+)
+
+// Claims are the fields of a UAA access token the director and health
+// monitor look at.
+type Claims struct {
+	JTI       string   `json:"jti"`
+	Subject   string   `json:"sub"`
+	Scope     []string `json:"scope"`
+	ClientID  string   `json:"client_id"`
+	CID       string   `json:"cid"`
+	GrantType string   `json:"grant_type"`
+	UserName  string   `json:"user_name,omitempty"`
+	IssuedAt  int64    `json:"iat"`
+	ExpiresAt int64    `json:"exp"`
+	Issuer    string   `json:"iss"`
+	ZoneID    string   `json:"zid"`
+	Audience  []string `json:"aud"`
+}
+
+type TokenOptions struct {
+	ClientID string
+	// UserName makes the token a user token rather than a client token.
+	UserName string
+	Scopes   []string
+	// Lifetime defaults to an hour. A negative lifetime issues an expired
+	// token.
+	Lifetime time.Duration
+	// Refresh issues a refresh token, which the director must not accept as
+	// an access token.
+	Refresh bool
+}
+
+func (s *Server) claims(options TokenOptions) Claims {
+	lifetime := options.Lifetime
+	if lifetime == 0 {
+		lifetime = defaultTokenLifetime
+	}
+
+	jti := strings.ReplaceAll(wire.NewID(), "-", "")
+	if options.Refresh {
+		jti += "-r"
+	}
+
+	grantType := "client_credentials"
+	subject := options.ClientID
+	if options.UserName != "" {
+		grantType = "password"
+		subject = options.UserName
+	}
+
+	audience := []string{options.ClientID}
+	for _, scope := range options.Scopes {
+		if resource, _, found := strings.Cut(scope, "."); found && resource != options.ClientID {
+			audience = append(audience, resource)
+		}
+	}
+
+	now := s.now()
+	return Claims{
+		JTI:       jti,
+		Subject:   subject,
+		Scope:     append([]string{}, options.Scopes...),
+		ClientID:  options.ClientID,
+		CID:       options.ClientID,
+		GrantType: grantType,
+		UserName:  options.UserName,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(lifetime).Unix(),
+		Issuer:    s.url + "/oauth/token",
+		ZoneID:    "uaa",
+		Audience:  audience,
+	}
+}
+
+func (s *Server) sign(claims Claims) (string, error) {
+	return wire.SignJWT(s.signer(), claims)
+}
+
+func (s *Server) signer() wire.RS256 {
+	return wire.RS256{Key: s.signingKey, KeyID: keyID}
+}
+
+// Verify checks a token was signed by this server and has not expired, and
+// returns its claims.
+func (s *Server) Verify(token string) (Claims, error) {
+	var claims Claims
+	if err := wire.VerifyJWT(s.signer(), token, &claims); err != nil {
+		return Claims{}, err
+	}
+	if s.now().Unix() >= claims.ExpiresAt {
+		return Claims{}, errors.New("token expired")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,306 @@
+// Package nats is a minimal client for the NATS protocol, enough to check
+// how the director's NATS server authenticates and authorizes clients. It
+// reads from the connection only while a call waits for the server, so the
+// server's replies to a call are seen by that call.
+package nats
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultTimeout = 30 * time.Second
+
+// Options configure how Connect talks to the server.
+type Options struct {
+	// TLSConfig upgrades the connection after the server's INFO. Without
+	// it, Connect fails against a server that requires TLS.
+	TLSConfig *tls.Config
+	// Name is the client name the server reports in /connz.
+	Name string
+	// Timeout bounds every call, 30 seconds by default.
+	Timeout time.Duration
+}
+
+// Info is the INFO the server greets clients with.
+type Info struct {
+	ServerID     string `json:"server_id"`
+	Version      string `json:"version"`
+	Host         string `json:"host"`
+	Port         int    `json:"port"`
+	AuthRequired bool   `json:"auth_required"`
+	TLSRequired  bool   `json:"tls_required"`
+	TLSVerify    bool   `json:"tls_verify"`
+	MaxPayload   int64  `json:"max_payload"`
+}
+
+// Msg is a message delivered to a subscription.
+type Msg struct {
+	Subject string
+	SID     int
+	Reply   string
+	Data    []byte
+}
+
+// ServerError is an -ERR the server sent, e.g. "Authorization Violation".
+type ServerError struct {
+	Message string
+}
+
+func (e *ServerError) Error() string {
+	return "nats: " + e.Message
+}
+
+// IsAuthorizationViolation is whether err is the server refusing the
+// client's identity.
+func IsAuthorizationViolation(err error) bool {
+	var serverErr *ServerError
+	return errors.As(err, &serverErr) && serverErr.Message == "Authorization Violation"
+}
+
+// IsPermissionsViolation is whether err is the server refusing to let the
+// client publish or subscribe to a subject.
+func IsPermissionsViolation(err error) bool {
+	var serverErr *ServerError
+	return errors.As(err, &serverErr) && strings.HasPrefix(serverErr.Message, "Permissions Violation")
+}
+
+type Conn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	info    Info
+	timeout time.Duration
+	nextSID int
+	pending []Msg
+}
+
+// Connect reads the server's INFO, upgrades to TLS if configured to, and
+// sends CONNECT. It returns once the server answers a PING, so a client the
+// server does not authorize fails here.
+func Connect(address string, options Options) (*Conn, error) {
+	timeout := options.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &Conn{conn: conn, reader: bufio.NewReader(conn), timeout: timeout}
+
+	if err := c.handshake(options); err != nil {
+		c.conn.Close() //nolint:errcheck
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Conn) handshake(options Options) error {
+	if err := c.conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return err
+	}
+
+	line, err := c.readLine()
+	if err != nil {
+		return fmt.Errorf("reading INFO: %w", err)
+	}
+	op, args := splitOp(line)
+	if op != "INFO" {
+		return fmt.Errorf("expected INFO, got %q", line)
+	}
+	if err := json.Unmarshal([]byte(args), &c.info); err != nil {
+		return fmt.Errorf("parsing INFO: %w", err)
+	}
+
+	if options.TLSConfig != nil {
+		tlsConn := tls.Client(c.conn, options.TLSConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			return fmt.Errorf("TLS handshake: %w", err)
+		}
+		c.conn = tlsConn
+		c.reader = bufio.NewReader(tlsConn)
+	} else if c.info.TLSRequired {
+		return errors.New("the server requires TLS")
+	}
+
+	connect, err := json.Marshal(map[string]any{
+		"verbose":      false,
+		"pedantic":     false,
+		"tls_required": options.TLSConfig != nil,
+		"name":         options.Name,
+		"lang":         "go",
+		"version":      "brats",
+		"protocol":     1,
+	})
+	if err != nil {
+		return err
+	}
+	if err := c.write("CONNECT " + string(connect)); err != nil {
+		return err
+	}
+	return c.Flush()
+}
+
+// Info is the INFO the server sent when the client connected.
+func (c *Conn) Info() Info {
+	return c.info
+}
+
+// Publish sends a message. The server only rejects it asynchronously, so
+// Flush to see whether it was allowed.
+func (c *Conn) Publish(subject string, data []byte) error {
+	return c.write(fmt.Sprintf("PUB %s %d\r\n%s", subject, len(data), data))
+}
+
+// Subscribe subscribes to a subject and returns the subscription's ID. As
+// with Publish, Flush to see whether it was allowed.
+func (c *Conn) Subscribe(subject string) (int, error) {
+	c.nextSID++
+	return c.nextSID, c.write(fmt.Sprintf("SUB %s %d", subject, c.nextSID))
+}
+
+// Flush sends a PING and waits for the server's PONG, returning the first
+// error the server sent before it. The server goes on after most errors, so
+// Flush reads on to the PONG, leaving nothing of this round trip for the
+// next call; after an error that closes the connection, such as an
+// Authorization Violation, it returns that error rather than the closed
+// connection's. Messages that arrive meanwhile are kept for NextMsg.
+func (c *Conn) Flush() error {
+	if err := c.write("PING"); err != nil {
+		return err
+	}
+
+	var first error
+	for {
+		msg, op, err := c.read()
+		var serverErr *ServerError
+		switch {
+		case errors.As(err, &serverErr):
+			if first == nil {
+				first = serverErr
+			}
+			continue
+		case err != nil && first != nil:
+			return first
+		case err != nil:
+			return err
+		}
+
+		if msg != nil {
+			c.pending = append(c.pending, *msg)
+		}
+		if op == "PONG" {
+			return first
+		}
+	}
+}
+
+// NextMsg returns the next message delivered to any subscription.
+func (c *Conn) NextMsg() (Msg, error) {
+	for len(c.pending) == 0 {
+		msg, _, err := c.read()
+		if err != nil {
+			return Msg{}, err
+		}
+		if msg != nil {
+			c.pending = append(c.pending, *msg)
+		}
+	}
+
+	msg := c.pending[0]
+	c.pending = c.pending[1:]
+	return msg, nil
+}
+
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// read reads one operation from the server, answering its PINGs.
+func (c *Conn) read() (*Msg, string, error) {
+	if err := c.conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return nil, "", err
+	}
+
+	line, err := c.readLine()
+	if err != nil {
+		return nil, "", err
+	}
+
+	op, args := splitOp(line)
+	switch op {
+	case "PING":
+		return nil, op, c.write("PONG")
+	case "PONG", "+OK", "INFO":
+		return nil, op, nil
+	case "-ERR":
+		return nil, op, &ServerError{Message: strings.Trim(args, "'")}
+	case "MSG":
+		msg, err := c.readMsg(args)
+		return msg, op, err
+	default:
+		return nil, op, fmt.Errorf("unexpected %q from the server", line)
+	}
+}
+
+// readMsg reads the payload of "MSG <subject> <sid> [reply-to] <#bytes>".
+func (c *Conn) readMsg(args string) (*Msg, error) {
+	fields := strings.Fields(args)
+	if len(fields) != 3 && len(fields) != 4 {
+		return nil, fmt.Errorf("malformed MSG %q", args)
+	}
+
+	sid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed MSG %q: %w", args, err)
+	}
+	size, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed MSG %q: %w", args, err)
+	}
+
+	msg := &Msg{Subject: fields[0], SID: sid, Data: make([]byte, size+2)}
+	if len(fields) == 4 {
+		msg.Reply = fields[2]
+	}
+	if _, err := io.ReadFull(c.reader, msg.Data); err != nil {
+		return nil, err
+	}
+	if string(msg.Data[size:]) != "\r\n" {
+		return nil, fmt.Errorf("MSG payload of %d bytes is not terminated by CRLF", size)
+	}
+	msg.Data = msg.Data[:size]
+	return msg, nil
+}
+
+func (c *Conn) readLine() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (c *Conn) write(op string) error {
+	if err := c.conn.SetWriteDeadline(time.Now().Add(c.timeout)); err != nil {
+		return err
+	}
+	_, err := c.conn.Write([]byte(op + "\r\n"))
+	return err
+}
+
+// splitOp splits a protocol line into its operation, upper-cased as the
+// protocol allows either case, and its arguments.
+func splitOp(line string) (string, string) {
+	op, args, _ := strings.Cut(line, " ")
+	return strings.ToUpper(op), strings.TrimSpace(args)
+}
@@ -0,0 +1,13 @@
+package nats_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestNATS(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "NATS Suite")
+}
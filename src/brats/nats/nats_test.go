@@ -0,0 +1,347 @@
+package nats_test
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"brats/certs"
+	"brats/nats"
+)
+
+// fakeServer speaks enough of the NATS protocol to exercise the client: it
+// authorizes clients by the common name of their certificate and refuses
+// subjects in denied.
+type fakeServer struct {
+	tlsConfig  *tls.Config
+	authorized func(cn string) bool
+	denied     map[string]bool
+	// pingFirst makes the server PING the client before answering its
+	// first PING.
+	pingFirst bool
+	// afterConnect is written to the client verbatim once it has
+	// connected.
+	afterConnect string
+
+	mutex sync.Mutex
+	lines []string
+}
+
+func (s *fakeServer) start() string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(listener.Close)
+
+	go func() {
+		defer GinkgoRecover()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+// received is every line clients sent, in order.
+func (s *fakeServer) received() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string{}, s.lines...)
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close() //nolint:errcheck
+
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"fake\",\"version\":\"2.10.0\",\"tls_required\":%t,\"tls_verify\":%t,\"max_payload\":1048576}\r\n", //nolint:errcheck
+		s.tlsConfig != nil, s.tlsConfig != nil)
+
+	cn := ""
+	if s.tlsConfig != nil {
+		tlsConn := tls.Server(conn, s.tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			return
+		}
+		cn = tlsConn.ConnectionState().PeerCertificates[0].Subject.CommonName
+		conn = tlsConn
+	}
+
+	reader := bufio.NewReader(conn)
+	subscriptions := map[string]string{}
+	pinged, connected := false, false
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		s.mutex.Lock()
+		s.lines = append(s.lines, line)
+		s.mutex.Unlock()
+
+		op, args, _ := strings.Cut(line, " ")
+		fields := strings.Fields(args)
+		switch op {
+		case "CONNECT":
+			if s.authorized != nil && !s.authorized(cn) {
+				fmt.Fprint(conn, "-ERR 'Authorization Violation'\r\n") //nolint:errcheck
+				return
+			}
+		case "PING":
+			if s.pingFirst && !pinged {
+				pinged = true
+				fmt.Fprint(conn, "PING\r\n") //nolint:errcheck
+			}
+			fmt.Fprint(conn, "PONG\r\n") //nolint:errcheck
+			if !connected {
+				connected = true
+				fmt.Fprint(conn, s.afterConnect) //nolint:errcheck
+			}
+		case "SUB":
+			if s.denied[fields[0]] {
+				fmt.Fprintf(conn, "-ERR 'Permissions Violation for Subscription to \"%s\"'\r\n", fields[0]) //nolint:errcheck
+				continue
+			}
+			subscriptions[fields[0]] = fields[1]
+		case "PUB":
+			size, _ := strconv.Atoi(fields[len(fields)-1]) //nolint:errcheck
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return
+			}
+			if s.denied[fields[0]] {
+				fmt.Fprintf(conn, "-ERR 'Permissions Violation for Publish to \"%s\"'\r\n", fields[0]) //nolint:errcheck
+				continue
+			}
+			if sid, found := subscriptions[fields[0]]; found {
+				fmt.Fprintf(conn, "MSG %s %s %d\r\n%s", fields[0], sid, size, payload) //nolint:errcheck
+			}
+		}
+	}
+}
+
+var _ = Describe("Conn", func() {
+	var server *fakeServer
+
+	BeforeEach(func() {
+		server = &fakeServer{denied: map[string]bool{}}
+	})
+
+	connect := func(address string, options nats.Options) *nats.Conn {
+		options.Timeout = 5 * time.Second
+		conn, err := nats.Connect(address, options)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(conn.Close)
+		return conn
+	}
+
+	It("reads the server's INFO and connects", func() {
+		conn := connect(server.start(), nats.Options{Name: "brats"})
+
+		Expect(conn.Info().ServerID).To(Equal("fake"))
+		Expect(conn.Info().MaxPayload).To(Equal(int64(1048576)))
+		Expect(server.received()).To(HaveLen(2))
+		Expect(server.received()[0]).To(HavePrefix("CONNECT {"))
+		Expect(server.received()[0]).To(ContainSubstring(`"name":"brats"`))
+		Expect(server.received()[0]).To(ContainSubstring(`"verbose":false`))
+		Expect(server.received()[1]).To(Equal("PING"))
+	})
+
+	It("frames messages by their length", func() {
+		conn := connect(server.start(), nats.Options{})
+
+		sid, err := conn.Subscribe("agent.123")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conn.Publish("agent.123", []byte("line one\r\nline two"))).To(Succeed())
+		Expect(conn.Publish("agent.456", []byte("not subscribed"))).To(Succeed())
+		Expect(conn.Publish("agent.123", []byte{})).To(Succeed())
+		Expect(conn.Flush()).To(Succeed())
+
+		Expect(conn.NextMsg()).To(Equal(nats.Msg{Subject: "agent.123", SID: sid, Data: []byte("line one\r\nline two")}))
+		Expect(conn.NextMsg()).To(Equal(nats.Msg{Subject: "agent.123", SID: sid, Data: []byte{}}))
+		Expect(server.received()).To(ContainElements(
+			fmt.Sprintf("SUB agent.123 %d", sid),
+			"PUB agent.123 18",
+			"PUB agent.123 0",
+		))
+	})
+
+	It("numbers subscriptions", func() {
+		conn := connect(server.start(), nats.Options{})
+
+		first, err := conn.Subscribe("agent.1")
+		Expect(err).NotTo(HaveOccurred())
+		second, err := conn.Subscribe("agent.2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(second).To(Equal(first + 1))
+	})
+
+	It("answers the server's PINGs", func() {
+		server.pingFirst = true
+		connect(server.start(), nats.Options{})
+
+		Eventually(server.received).Should(ContainElement("PONG"))
+	})
+
+	It("reports a refused subscription without closing the connection", func() {
+		server.denied["agent.other"] = true
+		conn := connect(server.start(), nats.Options{})
+
+		_, err := conn.Subscribe("agent.other")
+		Expect(err).NotTo(HaveOccurred())
+		err = conn.Flush()
+		Expect(err).To(MatchError(`nats: Permissions Violation for Subscription to "agent.other"`))
+		Expect(nats.IsPermissionsViolation(err)).To(BeTrue())
+		Expect(nats.IsAuthorizationViolation(err)).To(BeFalse())
+
+		Expect(conn.Flush()).To(Succeed())
+	})
+
+	It("reads on to the PONG and returns the first error", func() {
+		server.denied["agent.other"] = true
+		server.denied["agent.another"] = true
+		conn := connect(server.start(), nats.Options{})
+
+		sid, err := conn.Subscribe("agent.123")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = conn.Subscribe("agent.other")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = conn.Subscribe("agent.another")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conn.Publish("agent.123", []byte("after the errors"))).To(Succeed())
+
+		Expect(conn.Flush()).To(MatchError(`nats: Permissions Violation for Subscription to "agent.other"`))
+		Expect(conn.NextMsg()).To(Equal(nats.Msg{Subject: "agent.123", SID: sid, Data: []byte("after the errors")}))
+		Expect(conn.Flush()).To(Succeed())
+	})
+
+	It("reports a refused publish", func() {
+		server.denied["agent.other"] = true
+		conn := connect(server.start(), nats.Options{})
+
+		Expect(conn.Publish("agent.other", []byte("{}"))).To(Succeed())
+		Expect(nats.IsPermissionsViolation(conn.Flush())).To(BeTrue())
+	})
+
+	DescribeTable("fails on malformed messages",
+		func(afterConnect, message string) {
+			server.afterConnect = afterConnect
+			conn := connect(server.start(), nats.Options{})
+
+			_, err := conn.NextMsg()
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("too few arguments", "MSG agent.1 3\r\n", "malformed MSG"),
+		Entry("a subscription ID that is not a number", "MSG agent.1 one 3\r\nabc\r\n", "malformed MSG"),
+		Entry("a payload longer than its size", "MSG agent.1 1 2\r\nabc\r\n", "not terminated by CRLF"),
+		Entry("an unknown operation", "HELLO\r\n", `unexpected "HELLO"`),
+	)
+
+	It("refuses to connect in plain text to a server that requires TLS", func() {
+		server.tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+
+		_, err := nats.Connect(server.start(), nats.Options{Timeout: 5 * time.Second})
+		Expect(err).To(MatchError("the server requires TLS"))
+	})
+
+	Context("over mutual TLS", func() {
+		var (
+			ca         *certs.Certificate
+			address    string
+			clientTLS  func(client *certs.Certificate) *tls.Config
+			clientCert func(cn string, validity certs.Validity) *certs.Certificate
+		)
+
+		BeforeEach(func() {
+			var err error
+			ca, err = certs.NewCA(certs.Options{CommonName: "nats-ca"})
+			Expect(err).NotTo(HaveOccurred())
+			serverCert, err := ca.Server(certs.Options{CommonName: "default.nats.bosh-internal", Hosts: []string{"127.0.0.1"}})
+			Expect(err).NotTo(HaveOccurred())
+
+			server.tlsConfig = &tls.Config{
+				Certificates: []tls.Certificate{serverCert.TLSCertificate()},
+				ClientCAs:    ca.Pool(),
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+				MinVersion:   tls.VersionTLS12,
+			}
+			server.authorized = func(cn string) bool { return cn == "default.director.bosh-internal" }
+			address = server.start()
+
+			clientTLS = func(client *certs.Certificate) *tls.Config {
+				config := &tls.Config{RootCAs: ca.Pool(), ServerName: "127.0.0.1", MinVersion: tls.VersionTLS12}
+				if client != nil {
+					config.Certificates = []tls.Certificate{client.TLSCertificate()}
+				}
+				return config
+			}
+			clientCert = func(cn string, validity certs.Validity) *certs.Certificate {
+				client, err := ca.Client(certs.Options{CommonName: cn, Validity: validity})
+				Expect(err).NotTo(HaveOccurred())
+				return client
+			}
+		})
+
+		It("connects with an authorized certificate", func() {
+			conn := connect(address, nats.Options{TLSConfig: clientTLS(clientCert("default.director.bosh-internal", certs.Validity{}))})
+
+			Expect(conn.Info().TLSRequired).To(BeTrue())
+			Expect(server.received()[0]).To(ContainSubstring(`"tls_required":true`))
+			Expect(conn.Flush()).To(Succeed())
+		})
+
+		It("is refused a certificate the server does not authorize", func() {
+			_, err := nats.Connect(address, nats.Options{
+				TLSConfig: clientTLS(clientCert("someone-else.agent.bosh-internal", certs.Validity{})),
+				Timeout:   5 * time.Second,
+			})
+			Expect(err).To(MatchError("nats: Authorization Violation"))
+			Expect(nats.IsAuthorizationViolation(err)).To(BeTrue())
+		})
+
+		It("is refused without a client certificate", func() {
+			_, err := nats.Connect(address, nats.Options{TLSConfig: clientTLS(nil), Timeout: 5 * time.Second})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("is refused an expired client certificate", func() {
+			_, err := nats.Connect(address, nats.Options{
+				TLSConfig: clientTLS(clientCert("default.director.bosh-internal", certs.Expired())),
+				Timeout:   5 * time.Second,
+			})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("is refused a client certificate from another CA", func() {
+			otherCA, err := certs.NewCA(certs.Options{CommonName: "other-ca"})
+			Expect(err).NotTo(HaveOccurred())
+			client, err := otherCA.Client(certs.Options{CommonName: "default.director.bosh-internal"})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = nats.Connect(address, nats.Options{TLSConfig: clientTLS(client), Timeout: 5 * time.Second})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("does not trust a server from another CA", func() {
+			otherCA, err := certs.NewCA(certs.Options{CommonName: "other-ca"})
+			Expect(err).NotTo(HaveOccurred())
+			config := clientTLS(clientCert("default.director.bosh-internal", certs.Validity{}))
+			config.RootCAs = otherCA.Pool()
+
+			_, err = nats.Connect(address, nats.Options{TLSConfig: config, Timeout: 5 * time.Second})
+			Expect(err).To(MatchError(ContainSubstring("TLS handshake")))
+		})
+	})
+})
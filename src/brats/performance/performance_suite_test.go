@@ -16,16 +16,22 @@ func TestPerformance(t *testing.T) {
 	RunSpecs(t, "Performance Suite")
 }
 
+var requiredEnvironment = []utils.EnvironmentField{
+	utils.BOSHDirectorTarballPath,
+	utils.CandidateStemcellPath,
+	utils.CFDeploymentPath,
+}
+
 var _ = SynchronizedBeforeSuite(func() {
-	utils.Bootstrap()
-	utils.OuterBosh("upload-release", utils.AssertEnvExists("BOSH_DIRECTOR_TARBALL_PATH"))
-	directorReleasePath := utils.AssertEnvExists("BOSH_DIRECTOR_RELEASE_PATH")
+	utils.Bootstrap(requiredEnvironment...)
+	utils.OuterBosh("upload-release", utils.Env().Releases.BoshDirectorTarball)
+	directorReleasePath := utils.Env().Releases.BoshDirector
 	session := utils.OuterBosh("create-release", "--dir", directorReleasePath)
 	Eventually(session, 1*time.Minute).Should(gexec.Exit())
 	session = utils.OuterBosh("upload-release", "--dir", directorReleasePath, "--rebase")
 	Eventually(session, 1*time.Minute).Should(gexec.Exit())
 }, func() {
-	utils.Bootstrap()
+	utils.Bootstrap(requiredEnvironment...)
 })
 
 var _ = AfterSuite(func() {
@@ -35,3 +41,9 @@ var _ = AfterSuite(func() {
 var _ = AfterEach(func() {
 	utils.CleanupInnerBoshDeployments()
 })
+
+var _ = ReportAfterEach(func(report SpecReport) {
+	utils.ReportTasksForCurrentSpec()
+	utils.CollectFailureArtifacts(report)
+	utils.ForgetTasksForCurrentSpec()
+})
@@ -25,8 +25,8 @@ var _ = Describe("Template Rendering", Serial, func() {
 			fmt.Sprintf("-o %s", utils.BoshDeploymentAssetPath("uaa.yml")),
 			fmt.Sprintf("-o %s", utils.BoshDeploymentAssetPath("credhub.yml")),
 		)
-		utils.UploadStemcell(utils.AssertEnvExists("CANDIDATE_STEMCELL_TARBALL_PATH"))
-		cfDeploymentPath = utils.AssertEnvExists("CF_DEPLOYMENT_RELEASE_PATH")
+		utils.UploadStemcell(utils.Env().Stemcells.Candidate)
+		cfDeploymentPath = utils.Env().Releases.CFDeployment
 	})
 
 	It("deploys", func() {
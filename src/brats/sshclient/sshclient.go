@@ -0,0 +1,329 @@
+// Package sshclient runs commands on, copies files to and from, and
+// forwards ports to a VM over a single SSH connection, without going through
+// the bosh CLI.
+package sshclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const defaultTimeout = 30 * time.Second
+
+// Config is where and as whom Dial connects.
+type Config struct {
+	// Address is the host and port of the SSH server, port 22 if it has
+	// none.
+	Address    string
+	User       string
+	PrivateKey []byte
+	// HostKeyCallback verifies the server. Without it any host key is
+	// accepted, which suits VMs that are recreated with a new one.
+	HostKeyCallback ssh.HostKeyCallback
+	// Timeout bounds connecting, 30 seconds by default.
+	Timeout time.Duration
+}
+
+// Result is how a command ended.
+type Result struct {
+	Stdout     []byte
+	Stderr     []byte
+	ExitStatus int
+}
+
+// ExitError is returned when a command that has to succeed does not.
+type ExitError struct {
+	Command    string
+	ExitStatus int
+	Stderr     string
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("%q exited with status %d: %s", e.Command, e.ExitStatus, strings.TrimSpace(e.Stderr))
+}
+
+// Client is a connection to an SSH server. It is safe for concurrent use:
+// every command runs in a session of its own.
+type Client struct {
+	conn *ssh.Client
+	sudo bool
+}
+
+// Dial connects and authenticates with the private key.
+func Dial(config Config) (*Client, error) {
+	signer, err := ssh.ParsePrivateKey(config.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("parsing private key: %w", err)
+	}
+
+	address := config.Address
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "22")
+	}
+	hostKeyCallback := config.HostKeyCallback
+	if hostKeyCallback == nil {
+		hostKeyCallback = ssh.InsecureIgnoreHostKey() //nolint:gosec
+	}
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+
+	conn, err := ssh.Dial("tcp", address, &ssh.ClientConfig{
+		User:            config.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         timeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn}, nil
+}
+
+// Sudo returns a client on the same connection that runs commands, and
+// reads and writes files, as root through passwordless sudo.
+func (c *Client) Sudo() *Client {
+	return &Client{conn: c.conn, sudo: true}
+}
+
+// Alive is whether the server still answers on the connection within
+// timeout. A connection to a VM that is gone may never fail on its own.
+func (c *Client) Alive(timeout time.Duration) bool {
+	answered := make(chan error, 1)
+	go func() {
+		_, _, err := c.conn.SendRequest("keepalive@openssh.com", true, nil)
+		answered <- err
+	}()
+
+	select {
+	case err := <-answered:
+		return err == nil
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Close closes the connection, for every client that shares it.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Run runs command in the user's shell. A command that exits non-zero is
+// not an error; its status is in the result.
+func (c *Client) Run(command string) (*Result, error) {
+	return c.RunWithInput(command, nil)
+}
+
+// RunWithInput runs command with stdin as its standard input.
+func (c *Client) RunWithInput(command string, stdin io.Reader) (*Result, error) {
+	session, err := c.conn.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close() //nolint:errcheck
+
+	var stdout, stderr bytes.Buffer
+	session.Stdin = stdin
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+
+	result := &Result{}
+	err = session.Run(c.command(command))
+
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		result.ExitStatus = exitErr.ExitStatus()
+	} else if err != nil {
+		return nil, fmt.Errorf("running %q: %w", command, err)
+	}
+	result.Stdout, result.Stderr = stdout.Bytes(), stderr.Bytes()
+	return result, nil
+}
+
+// Process is a command started with Start.
+type Process struct {
+	session *ssh.Session
+}
+
+// Start runs command without waiting for it, writing what it prints to
+// stdout and stderr as it arrives, e.g. to follow a log with tail -F.
+func (c *Client) Start(command string, stdout, stderr io.Writer) (*Process, error) {
+	session, err := c.conn.NewSession()
+	if err != nil {
+		return nil, err
+	}
+
+	session.Stdout = stdout
+	session.Stderr = stderr
+	if err := session.Start(c.command(command)); err != nil {
+		session.Close() //nolint:errcheck
+		return nil, fmt.Errorf("starting %q: %w", command, err)
+	}
+	return &Process{session: session}, nil
+}
+
+// Close asks the command to terminate and closes its session. A command
+// that ignores the signal ends once it next writes.
+func (p *Process) Close() error {
+	p.session.Signal(ssh.SIGTERM) //nolint:errcheck
+	if err := p.session.Close(); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+func (c *Client) command(command string) string {
+	if c.sudo {
+		return "sudo -n sh -c " + Quote(command)
+	}
+	return command
+}
+
+func (c *Client) mustRun(command string, stdin io.Reader) ([]byte, error) {
+	result, err := c.RunWithInput(command, stdin)
+	if err != nil {
+		return nil, err
+	}
+	if result.ExitStatus != 0 {
+		return nil, &ExitError{Command: command, ExitStatus: result.ExitStatus, Stderr: string(result.Stderr)}
+	}
+	return result.Stdout, nil
+}
+
+// Get reads a file.
+func (c *Client) Get(path string) ([]byte, error) {
+	return c.mustRun("cat -- "+Quote(path), nil)
+}
+
+// Put writes a file, replacing it if it exists, and sets its mode.
+func (c *Client) Put(path string, contents []byte, mode os.FileMode) error {
+	_, err := c.mustRun(fmt.Sprintf("cat > %[1]s && chmod %04o %[1]s", Quote(path), mode.Perm()), bytes.NewReader(contents))
+	return err
+}
+
+// DialContext opens a connection to address as seen from the server, e.g.
+// a service that only listens on its loopback interface. It fits
+// http.Transport.
+func (c *Client) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return c.conn.DialContext(ctx, network, address)
+}
+
+// Forward listens on a local port and forwards every connection to it to
+// remoteAddress as seen from the server.
+func (c *Client) Forward(remoteAddress string) (*Forward, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Forward{client: c, remoteAddress: remoteAddress, listener: listener, conns: map[net.Conn]struct{}{}}
+	f.wg.Add(1)
+	go f.accept()
+	return f, nil
+}
+
+// Forward is a local port forwarded to the server.
+type Forward struct {
+	client        *Client
+	remoteAddress string
+	listener      net.Listener
+
+	mutex sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+// Address is the local host and port that is forwarded.
+func (f *Forward) Address() string {
+	return f.listener.Addr().String()
+}
+
+func (f *Forward) accept() {
+	defer f.wg.Done()
+	for {
+		local, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		f.wg.Add(1)
+		go f.forward(local)
+	}
+}
+
+func (f *Forward) forward(local net.Conn) {
+	defer f.wg.Done()
+	defer local.Close() //nolint:errcheck
+
+	remote, err := f.client.DialContext(context.Background(), "tcp", f.remoteAddress)
+	if err != nil {
+		return
+	}
+	defer remote.Close() //nolint:errcheck
+
+	if !f.track(local, remote) {
+		return
+	}
+	defer f.untrack(local, remote)
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, local) //nolint:errcheck
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(local, remote) //nolint:errcheck
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+func (f *Forward) track(conns ...net.Conn) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.conns == nil {
+		return false
+	}
+	for _, conn := range conns {
+		f.conns[conn] = struct{}{}
+	}
+	return true
+}
+
+func (f *Forward) untrack(conns ...net.Conn) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for _, conn := range conns {
+		delete(f.conns, conn)
+	}
+}
+
+// Close stops listening and closes the connections that are forwarded.
+func (f *Forward) Close() error {
+	err := f.listener.Close()
+
+	f.mutex.Lock()
+	for conn := range f.conns {
+		conn.Close() //nolint:errcheck
+	}
+	f.conns = nil
+	f.mutex.Unlock()
+
+	f.wg.Wait()
+	return err
+}
+
+// Quote quotes s as a single word for the shell.
+func Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
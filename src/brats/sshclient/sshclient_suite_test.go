@@ -0,0 +1,13 @@
+package sshclient_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestSSHClient(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "SSH Client Suite")
+}
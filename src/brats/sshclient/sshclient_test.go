@@ -0,0 +1,378 @@
+package sshclient_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"golang.org/x/crypto/ssh"
+
+	"brats/sshclient"
+)
+
+// fakeServer runs the commands it is sent with the local shell, and
+// forwards connections from the local host.
+type fakeServer struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+	path     string
+
+	mutex       sync.Mutex
+	commands    []string
+	connections int
+}
+
+func generateKey() (ssh.Signer, []byte) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	signer, err := ssh.NewSignerFromKey(key)
+	Expect(err).NotTo(HaveOccurred())
+	block, err := ssh.MarshalPrivateKey(key, "")
+	Expect(err).NotTo(HaveOccurred())
+	return signer, pem.EncodeToMemory(block)
+}
+
+func startFakeServer(user string, authorized ssh.PublicKey, path string) *fakeServer {
+	hostKey, _ := generateKey()
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == user && string(key.Marshal()) == string(authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unauthorized")
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+
+	s := &fakeServer{listener: listener, config: config, path: path}
+	go s.serve()
+	return s
+}
+
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeServer) handle(conn net.Conn) {
+	_, channels, requests, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	s.mutex.Lock()
+	s.connections++
+	s.mutex.Unlock()
+
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		switch newChannel.ChannelType() {
+		case "session":
+			go s.session(newChannel)
+		case "direct-tcpip":
+			go s.directTCPIP(newChannel)
+		default:
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported") //nolint:errcheck
+		}
+	}
+}
+
+func (s *fakeServer) session(newChannel ssh.NewChannel) {
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close() //nolint:errcheck
+
+	for request := range requests {
+		if request.Type != "exec" {
+			request.Reply(false, nil) //nolint:errcheck
+			continue
+		}
+		var payload struct{ Command string }
+		if err := ssh.Unmarshal(request.Payload, &payload); err != nil {
+			request.Reply(false, nil) //nolint:errcheck
+			return
+		}
+		request.Reply(true, nil) //nolint:errcheck
+
+		s.mutex.Lock()
+		s.commands = append(s.commands, payload.Command)
+		s.mutex.Unlock()
+
+		cmd := exec.Command("sh", "-c", payload.Command)
+		cmd.Env = []string{"PATH=" + s.path}
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = channel, channel, channel.Stderr()
+		status := 0
+		var exitErr *exec.ExitError
+		if err := cmd.Run(); errors.As(err, &exitErr) {
+			status = exitErr.ExitCode()
+		}
+		channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(status)})) //nolint:errcheck
+		return
+	}
+}
+
+func (s *fakeServer) directTCPIP(newChannel ssh.NewChannel) {
+	var target struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error()) //nolint:errcheck
+		return
+	}
+	remote, err := net.Dial("tcp", net.JoinHostPort(target.Host, fmt.Sprint(target.Port)))
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error()) //nolint:errcheck
+		return
+	}
+	defer remote.Close() //nolint:errcheck
+
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close() //nolint:errcheck
+	go ssh.DiscardRequests(requests)
+
+	go io.Copy(remote, channel) //nolint:errcheck
+	io.Copy(channel, remote)    //nolint:errcheck
+}
+
+func (s *fakeServer) Commands() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string{}, s.commands...)
+}
+
+func (s *fakeServer) Connections() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.connections
+}
+
+var _ = Describe("Client", func() {
+	var (
+		server     *fakeServer
+		client     *sshclient.Client
+		privateKey []byte
+		dir        string
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+
+		// sudo runs the command as is, as the tests already run as whoever
+		// they need to be.
+		bin := filepath.Join(dir, "bin")
+		Expect(os.Mkdir(bin, 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(bin, "sudo"), []byte("#!/bin/sh\n[ \"$1\" = -n ] && shift\nexec \"$@\"\n"), 0755)).To(Succeed())
+
+		var signer ssh.Signer
+		signer, privateKey = generateKey()
+		server = startFakeServer("jumpbox", signer.PublicKey(), bin+":/usr/bin:/bin")
+		DeferCleanup(server.listener.Close)
+
+		var err error
+		client, err = sshclient.Dial(sshclient.Config{Address: server.listener.Addr().String(), User: "jumpbox", PrivateKey: privateKey})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(client.Close)
+	})
+
+	It("refuses to connect with a key the server does not authorize", func() {
+		_, otherKey := generateKey()
+		_, err := sshclient.Dial(sshclient.Config{Address: server.listener.Addr().String(), User: "jumpbox", PrivateKey: otherKey})
+		Expect(err).To(MatchError(ContainSubstring("unable to authenticate")))
+
+		_, err = sshclient.Dial(sshclient.Config{Address: server.listener.Addr().String(), User: "vcap", PrivateKey: privateKey})
+		Expect(err).To(HaveOccurred())
+
+		_, err = sshclient.Dial(sshclient.Config{Address: server.listener.Addr().String(), User: "jumpbox", PrivateKey: []byte("not a key")})
+		Expect(err).To(MatchError(ContainSubstring("parsing private key")))
+	})
+
+	Describe("Run", func() {
+		It("returns stdout, stderr and the exit status separately", func() {
+			result, err := client.Run("echo out; echo err >&2; exit 3")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(result.Stdout)).To(Equal("out\n"))
+			Expect(string(result.Stderr)).To(Equal("err\n"))
+			Expect(result.ExitStatus).To(Equal(3))
+		})
+
+		It("passes input to the command", func() {
+			result, err := client.RunWithInput("tr a-z A-Z", strings.NewReader("shout"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(result.Stdout)).To(Equal("SHOUT"))
+			Expect(result.ExitStatus).To(BeZero())
+		})
+
+		It("runs commands as root through sudo", func() {
+			result, err := client.Sudo().Run("echo 'as root'")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(result.Stdout)).To(Equal("as root\n"))
+			Expect(server.Commands()).To(Equal([]string{`sudo -n sh -c 'echo '\''as root'\'''`}))
+		})
+
+		It("runs concurrent commands over a single connection", func() {
+			var wg sync.WaitGroup
+			for i := range 10 {
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+					result, err := client.Run(fmt.Sprintf("echo %d", i))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(result.Stdout)).To(Equal(fmt.Sprintf("%d\n", i)))
+				}()
+			}
+			wg.Wait()
+
+			Expect(server.Connections()).To(Equal(1))
+			Expect(server.Commands()).To(HaveLen(10))
+		})
+	})
+
+	Describe("Start", func() {
+		It("streams what the command prints until it is closed", func() {
+			path := filepath.Join(dir, "log")
+			Expect(os.WriteFile(path, []byte("first\n"), 0644)).To(Succeed())
+
+			output := gbytes.NewBuffer()
+			process, err := client.Sudo().Start("exec tail -n +1 -f "+sshclient.Quote(path), output, io.Discard)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(output).Should(gbytes.Say("first\n"))
+
+			file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = file.WriteString("second\n")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(file.Close()).To(Succeed())
+			Eventually(output).Should(gbytes.Say("second\n"))
+
+			Expect(process.Close()).To(Succeed())
+		})
+	})
+
+	Describe("Get and Put", func() {
+		It("writes a file with its mode and reads it back", func() {
+			path := filepath.Join(dir, "it's a file.txt")
+			Expect(client.Put(path, []byte("contents\n"), 0640)).To(Succeed())
+
+			info, err := os.Stat(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0640)))
+
+			Expect(client.Get(path)).To(Equal([]byte("contents\n")))
+		})
+
+		It("replaces a file", func() {
+			path := filepath.Join(dir, "file")
+			Expect(client.Put(path, []byte("a long first version"), 0600)).To(Succeed())
+			Expect(client.Sudo().Put(path, []byte("second"), 0644)).To(Succeed())
+
+			Expect(client.Sudo().Get(path)).To(Equal([]byte("second")))
+		})
+
+		It("fails with the command's error", func() {
+			_, err := client.Get(filepath.Join(dir, "missing"))
+			var exitErr *sshclient.ExitError
+			Expect(errors.As(err, &exitErr)).To(BeTrue())
+			Expect(exitErr.ExitStatus).NotTo(BeZero())
+			Expect(exitErr.Stderr).To(ContainSubstring("No such file"))
+
+			Expect(client.Put(filepath.Join(dir, "missing", "file"), nil, 0644)).NotTo(Succeed())
+		})
+	})
+
+	Describe("Forward", func() {
+		var backend *httptest.Server
+
+		BeforeEach(func() {
+			backend = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, "served %s", r.URL.Path)
+			}))
+			DeferCleanup(backend.Close)
+		})
+
+		It("forwards connections to an address as seen from the server", func() {
+			forward, err := client.Forward(backend.Listener.Addr().String())
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(forward.Close)
+			Expect(forward.Address()).To(HavePrefix("127.0.0.1:"))
+
+			for _, path := range []string{"/stats", "/again"} {
+				// A new connection for each request.
+				response, err := (&http.Client{Transport: &http.Transport{DisableKeepAlives: true}}).Get("http://" + forward.Address() + path)
+				Expect(err).NotTo(HaveOccurred())
+				body, err := io.ReadAll(response.Body)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(response.Body.Close()).To(Succeed())
+				Expect(string(body)).To(Equal("served " + path))
+			}
+			Expect(server.Connections()).To(Equal(1))
+		})
+
+		It("stops listening once closed", func() {
+			forward, err := client.Forward(backend.Listener.Addr().String())
+			Expect(err).NotTo(HaveOccurred())
+
+			conn, err := net.Dial("tcp", forward.Address())
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close() //nolint:errcheck
+
+			Expect(forward.Close()).To(Succeed())
+			_, err = net.Dial("tcp", forward.Address())
+			Expect(err).To(HaveOccurred())
+			_, err = conn.Read(make([]byte, 1))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("dials through the server", func() {
+			transport := &http.Transport{DialContext: client.DialContext}
+			response, err := (&http.Client{Transport: transport}).Get(backend.URL + "/dialed")
+			Expect(err).NotTo(HaveOccurred())
+			defer response.Body.Close() //nolint:errcheck
+			Expect(io.ReadAll(response.Body)).To(Equal([]byte("served /dialed")))
+		})
+	})
+
+	It("knows whether the connection is alive", func() {
+		other, err := sshclient.Dial(sshclient.Config{Address: server.listener.Addr().String(), User: "jumpbox", PrivateKey: privateKey})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(other.Alive(time.Second)).To(BeTrue())
+		Expect(other.Close()).To(Succeed())
+		Expect(other.Alive(time.Second)).To(BeFalse())
+	})
+
+	It("quotes words for the shell", func() {
+		Expect(sshclient.Quote("plain")).To(Equal("'plain'"))
+		Expect(sshclient.Quote("it's")).To(Equal(`'it'\''s'`))
+	})
+})
@@ -0,0 +1,245 @@
+// Package terminal drives interactive programs through a pseudo-terminal,
+// expect-style: send input, then wait for output that matches a pattern.
+package terminal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+)
+
+// recentOutput is how much of the output errors quote.
+const recentOutput = 512
+
+// ErrClosed is returned when the output ends before it matches.
+var ErrClosed = errors.New("terminal output ended")
+
+// TimeoutError is returned when the output does not match in time.
+type TimeoutError struct {
+	Pattern string
+	Timeout time.Duration
+	// Output is the output since the last match, at most its last 512
+	// bytes.
+	Output string
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("terminal output did not match %q within %s, got:\n%s", e.Pattern, e.Timeout, e.Output)
+}
+
+// Terminal is a command running with a pseudo-terminal as its controlling
+// terminal. Output is matched in order: each match consumes the output up
+// to and including it.
+type Terminal struct {
+	cmd  *exec.Cmd
+	ptmx *os.File
+	log  io.Writer
+
+	mutex      sync.Mutex
+	transcript bytes.Buffer
+	cursor     int
+	changed    chan struct{}
+	readErr    error
+	prompt     *regexp.Regexp
+
+	exited  chan struct{}
+	waitErr error
+}
+
+// Start starts cmd on a new pseudo-terminal. Output is also copied to log,
+// if it is not nil.
+func Start(cmd *exec.Cmd, log io.Writer) (*Terminal, error) {
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer tty.Close() //nolint:errcheck
+
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = tty, tty, tty
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setctty: true, Setsid: true}
+	if err := cmd.Start(); err != nil {
+		ptmx.Close() //nolint:errcheck
+		return nil, err
+	}
+
+	t := &Terminal{
+		cmd:     cmd,
+		ptmx:    ptmx,
+		log:     log,
+		changed: make(chan struct{}),
+		exited:  make(chan struct{}),
+	}
+	go t.read()
+	go func() {
+		t.waitErr = cmd.Wait()
+		close(t.exited)
+	}()
+	return t, nil
+}
+
+func (t *Terminal) read() {
+	buffer := make([]byte, 4096)
+	for {
+		n, err := t.ptmx.Read(buffer)
+
+		t.mutex.Lock()
+		if n > 0 {
+			t.transcript.Write(buffer[:n])
+			if t.log != nil {
+				t.log.Write(buffer[:n]) //nolint:errcheck
+			}
+		}
+		if err != nil {
+			// Reading the terminal fails with EIO once the command and its
+			// children closed it.
+			t.readErr = err
+		}
+		close(t.changed)
+		t.changed = make(chan struct{})
+		t.mutex.Unlock()
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Send types input as is.
+func (t *Terminal) Send(input string) error {
+	_, err := t.ptmx.Write([]byte(input))
+	return err
+}
+
+// SendLine types a line and presses enter.
+func (t *Terminal) SendLine(line string) error {
+	return t.Send(line + "\n")
+}
+
+// Expect waits for the output after the last match to match pattern, and
+// returns the match and its submatches.
+func (t *Terminal) Expect(pattern string, timeout time.Duration) ([]string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	match, _, err := t.expect(re, timeout)
+	return match, err
+}
+
+// SetPrompt sets the pattern of the prompt ExpectPrompt waits for. Anchor
+// it with "$" to only match a prompt that waits for input.
+func (t *Terminal) SetPrompt(pattern string) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.prompt = re
+	return nil
+}
+
+// ExpectPrompt waits for the prompt and returns the output before it, e.g.
+// what the previous command printed, with the terminal's line endings
+// turned into "\n".
+func (t *Terminal) ExpectPrompt(timeout time.Duration) (string, error) {
+	t.mutex.Lock()
+	prompt := t.prompt
+	t.mutex.Unlock()
+	if prompt == nil {
+		return "", errors.New("the terminal has no prompt set")
+	}
+
+	_, before, err := t.expect(prompt, timeout)
+	return strings.ReplaceAll(before, "\r\n", "\n"), err
+}
+
+func (t *Terminal) expect(re *regexp.Regexp, timeout time.Duration) ([]string, string, error) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		t.mutex.Lock()
+		output := t.transcript.Bytes()[t.cursor:]
+		if location := re.FindSubmatchIndex(output); location != nil {
+			match := make([]string, len(location)/2)
+			for i := range match {
+				if location[2*i] >= 0 {
+					match[i] = string(output[location[2*i]:location[2*i+1]])
+				}
+			}
+			before := string(output[:location[0]])
+			t.cursor += location[1]
+			t.mutex.Unlock()
+			return match, before, nil
+		}
+		changed, readErr := t.changed, t.readErr
+		recent := lastBytes(output, recentOutput)
+		t.mutex.Unlock()
+
+		if readErr != nil {
+			return nil, "", fmt.Errorf("%w before matching %q, got:\n%s", ErrClosed, re, recent)
+		}
+
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return nil, "", &TimeoutError{Pattern: re.String(), Timeout: timeout, Output: recent}
+		}
+	}
+}
+
+func lastBytes(output []byte, n int) string {
+	if len(output) > n {
+		output = output[len(output)-n:]
+	}
+	return string(output)
+}
+
+// Transcript is everything the command printed, including the echo of
+// what was sent.
+func (t *Terminal) Transcript() string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.transcript.String()
+}
+
+// Wait waits for the command to exit and returns its exit code.
+func (t *Terminal) Wait(timeout time.Duration) (int, error) {
+	select {
+	case <-t.exited:
+	case <-time.After(timeout):
+		return 0, fmt.Errorf("%s did not exit within %s", t.cmd.Path, timeout)
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(t.waitErr, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	if t.waitErr != nil {
+		return 0, t.waitErr
+	}
+	return 0, nil
+}
+
+// Close kills the command if it is still running and closes the terminal.
+func (t *Terminal) Close() error {
+	select {
+	case <-t.exited:
+	default:
+		t.cmd.Process.Kill() //nolint:errcheck
+		<-t.exited
+	}
+	return t.ptmx.Close()
+}
@@ -0,0 +1,125 @@
+package terminal_test
+
+import (
+	"errors"
+	"os/exec"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+
+	"brats/terminal"
+)
+
+var _ = Describe("Terminal", func() {
+	const (
+		prompt  = `brats\$ $`
+		timeout = 10 * time.Second
+	)
+
+	var (
+		term *terminal.Terminal
+		log  *gbytes.Buffer
+	)
+
+	BeforeEach(func() {
+		shell := exec.Command("sh")
+		shell.Env = []string{"PS1=brats$ ", "PATH=/usr/bin:/bin", "TERM=dumb"}
+		log = gbytes.NewBuffer()
+
+		var err error
+		term, err = terminal.Start(shell, log)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(term.Close)
+
+		Expect(term.SetPrompt(prompt)).To(Succeed())
+		Expect(term.ExpectPrompt(timeout)).To(BeEmpty())
+	})
+
+	It("gives the command a terminal", func() {
+		Expect(term.SendLine("test -t 0 && test -t 1 && echo is-a-tty")).To(Succeed())
+		Expect(term.ExpectPrompt(timeout)).To(ContainSubstring("is-a-tty\n"))
+	})
+
+	It("returns the match and its submatches", func() {
+		Expect(term.SendLine("echo answer=$((6 * 7))")).To(Succeed())
+		Expect(term.Expect(`answer=(\d+)\r\n`, timeout)).To(Equal([]string{"answer=42\r\n", "42"}))
+	})
+
+	It("only matches output after the last match", func() {
+		Expect(term.SendLine("echo first; echo second")).To(Succeed())
+		Expect(term.Expect(`\r\nfirst`, timeout)).To(HaveLen(1))
+		Expect(term.Expect(`\r\nsecond`, timeout)).To(HaveLen(1))
+
+		_, err := term.Expect(`\r\nfirst`, 100*time.Millisecond)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("returns what a command printed before the next prompt", func() {
+		Expect(term.SendLine("printf 'one\\ntwo\\n'")).To(Succeed())
+		Expect(term.ExpectPrompt(timeout)).To(Equal("printf 'one\\ntwo\\n'\none\ntwo\n"))
+	})
+
+	It("drives multi-line input", func() {
+		Expect(term.SendLine("for i in 1 2 3; do")).To(Succeed())
+		Expect(term.Expect(`> $`, timeout)).To(HaveLen(1))
+		Expect(term.SendLine("  echo line-$i")).To(Succeed())
+		Expect(term.Expect(`> $`, timeout)).To(HaveLen(1))
+		Expect(term.SendLine("done")).To(Succeed())
+
+		Expect(term.ExpectPrompt(timeout)).To(ContainSubstring("line-1\nline-2\nline-3\n"))
+	})
+
+	It("times out with the output it got", func() {
+		Expect(term.SendLine("echo something else")).To(Succeed())
+
+		_, err := term.Expect(`never printed`, 500*time.Millisecond)
+		var timeoutErr *terminal.TimeoutError
+		Expect(errors.As(err, &timeoutErr)).To(BeTrue())
+		Expect(timeoutErr.Pattern).To(Equal("never printed"))
+		Expect(timeoutErr.Output).To(ContainSubstring("something else"))
+		Expect(err).To(MatchError(ContainSubstring(`did not match "never printed" within 500ms`)))
+	})
+
+	It("fails once the output ends without matching", func() {
+		Expect(term.SendLine("echo bye; exit 3")).To(Succeed())
+
+		_, err := term.Expect(`never printed`, timeout)
+		Expect(err).To(MatchError(terminal.ErrClosed))
+		Expect(err).To(MatchError(ContainSubstring("bye")))
+
+		Expect(term.Wait(timeout)).To(Equal(3))
+	})
+
+	It("waits for a command that is still running", func() {
+		_, err := term.Wait(100 * time.Millisecond)
+		Expect(err).To(MatchError(ContainSubstring("did not exit")))
+
+		Expect(term.SendLine("exit")).To(Succeed())
+		Expect(term.Wait(timeout)).To(Equal(0))
+	})
+
+	It("keeps a transcript and copies output to the log", func() {
+		Expect(term.SendLine("echo recorded")).To(Succeed())
+		Expect(term.ExpectPrompt(timeout)).To(ContainSubstring("recorded"))
+
+		Expect(term.Transcript()).To(MatchRegexp(`^brats\$ echo recorded\r\nrecorded\r\nbrats\$ $`))
+		Expect(log).To(gbytes.Say(`recorded\r\nrecorded`))
+	})
+
+	It("fails on an invalid pattern", func() {
+		_, err := term.Expect(`(`, timeout)
+		Expect(err).To(HaveOccurred())
+		Expect(term.SetPrompt(`(`)).NotTo(Succeed())
+	})
+
+	It("needs a prompt to expect one", func() {
+		unprompted, err := terminal.Start(exec.Command("sh"), nil)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(unprompted.Close)
+
+		_, err = unprompted.ExpectPrompt(timeout)
+		Expect(err).To(MatchError("the terminal has no prompt set"))
+	})
+})
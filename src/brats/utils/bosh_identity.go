@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:staticcheck
+	. "github.com/onsi/gomega"    //nolint:staticcheck
+	"github.com/onsi/gomega/gexec"
+)
+
+// boshSessionEnv are the variables the bosh CLI reads its target and
+// credentials from, which an identity must not inherit from the environment
+// the specs run in.
+var boshSessionEnv = []string{
+	"BOSH_CONFIG",
+	"BOSH_ENVIRONMENT",
+	"BOSH_CA_CERT",
+	"BOSH_CLIENT",
+	"BOSH_CLIENT_SECRET",
+	"BOSH_DEPLOYMENT",
+}
+
+// BoshIdentity runs the bosh CLI against the inner director as a UAA client
+// other than the admin the inner bosh script uses. Each identity keeps its
+// own BOSH_CONFIG, so no session state is shared between identities.
+type BoshIdentity struct {
+	Client     string
+	secret     string
+	configPath string
+}
+
+// LogInToInnerBosh logs the CLI in to the inner director as client, in a
+// BOSH_CONFIG removed when the spec ends.
+func LogInToInnerBosh(client, clientSecret string) *BoshIdentity {
+	identity := &BoshIdentity{
+		Client:     client,
+		secret:     clientSecret,
+		configPath: filepath.Join(GinkgoT().TempDir(), "config"),
+	}
+
+	session := identity.Bosh("log-in")
+	Eventually(session, time.Minute).Should(gexec.Exit(0))
+
+	return identity
+}
+
+func (i *BoshIdentity) Bosh(args ...string) *gexec.Session {
+	By(fmt.Sprintf("Bosh as %s '%s'", i.Client, strings.Join(args, " ")))
+
+	cmd := exec.Command(outerBoshBinaryPath, args...)
+	cmd.Env = append(environWithout(boshSessionEnv),
+		"BOSH_CONFIG="+i.configPath,
+		"BOSH_ENVIRONMENT="+innerDirectorIP,
+		"BOSH_CA_CERT="+filepath.Join(innerBoshPath, "ca.crt"),
+		"BOSH_CLIENT="+i.Client,
+		"BOSH_CLIENT_SECRET="+i.secret,
+	)
+
+	session, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+	Expect(err).ToNot(HaveOccurred())
+
+	return session
+}
+
+// ConfigPath is the identity's BOSH_CONFIG file.
+func (i *BoshIdentity) ConfigPath() string {
+	return i.configPath
+}
+
+func environWithout(names []string) []string {
+	var env []string
+	for _, variable := range os.Environ() {
+		name, _, _ := strings.Cut(variable, "=")
+		if !slices.Contains(names, name) {
+			env = append(env, variable)
+		}
+	}
+	return env
+}
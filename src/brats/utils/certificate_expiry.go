@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	. "github.com/onsi/gomega" //nolint:staticcheck
+)
+
+const directorJobConfigDir = "/var/vcap/jobs/director/config"
+
+// directorCertificateFiles are where the director job renders the
+// certificates certificate_expiry.json.erb reports on, by property. The
+// blobstore CA is only rendered into director.yml.
+var directorCertificateFiles = map[string]string{
+	"director.ssl.cert":                  directorJobConfigDir + "/ssl/director.pem",
+	"director.config_server.ca_cert":     directorJobConfigDir + "/config_server_ca.cert",
+	"director.config_server.uaa.ca_cert": directorJobConfigDir + "/uaa_server_ca.cert",
+	"nats.tls.ca":                        directorJobConfigDir + "/nats_server_ca.pem",
+	"nats.tls.client_ca.certificate":     directorJobConfigDir + "/nats_client_ca_certificate.pem",
+	"nats.tls.director.certificate":      directorJobConfigDir + "/nats_client_certificate.pem",
+	"director.db.tls.cert.ca":            directorJobConfigDir + "/db/ca.pem",
+	"director.db.tls.cert.certificate":   directorJobConfigDir + "/db/client_certificate.pem",
+}
+
+const directorConfigFile = directorJobConfigDir + "/director.yml"
+
+// CertificateExpiry is an entry of the director's
+// /director/certificate_expiry, which serves certificate_expiry.json.
+type CertificateExpiry struct {
+	Property string    `json:"certificate_path"`
+	Expiry   time.Time `json:"expiry"`
+	DaysLeft int       `json:"days_left"`
+}
+
+func (c *DirectorClient) CertificateExpiries() ([]CertificateExpiry, error) {
+	var expiries []CertificateExpiry
+	err := c.Get("/director/certificate_expiry", nil, &expiries)
+	return expiries, err
+}
+
+// PEMExpiry is when the first certificate in a PEM bundle expires, to the
+// second as certificate_expiry.json has it. Like the template, it reports
+// no expiry for a property without a certificate.
+func PEMExpiry(contents []byte) (time.Time, bool, error) {
+	for {
+		var block *pem.Block
+		block, contents = pem.Decode(contents)
+		if block == nil {
+			return time.Time{}, false, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		return certificate.NotAfter.UTC().Truncate(time.Second), true, nil
+	}
+}
+
+// DaysLeft is the number of whole days until notAfter, as the director
+// computes it.
+func DaysLeft(notAfter, now time.Time) int {
+	return int(math.Floor(notAfter.Sub(now).Hours() / 24))
+}
+
+// DirectorCertificateExpiries reads the expiries of the certificates in the
+// director job's config files, keyed by property, from the files
+// FetchInnerDirectorFiles returned.
+func DirectorCertificateExpiries(files map[string]string) (map[string]time.Time, error) {
+	pems := map[string]string{}
+	for property, path := range directorCertificateFiles {
+		pems[property] = files[path]
+	}
+
+	if contents, found := files[directorConfigFile]; found {
+		var config struct {
+			Blobstore struct {
+				Options struct {
+					TLS struct {
+						Cert struct {
+							CA string `json:"ca"`
+						} `json:"cert"`
+					} `json:"tls"`
+				} `json:"options"`
+			} `json:"blobstore"`
+		}
+		if err := json.Unmarshal([]byte(contents), &config); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", directorConfigFile, err)
+		}
+		pems["blobstore.tls.cert.ca"] = config.Blobstore.Options.TLS.Cert.CA
+	}
+
+	expiries := map[string]time.Time{}
+	for property, contents := range pems {
+		expiry, found, err := PEMExpiry([]byte(contents))
+		if err != nil {
+			return nil, fmt.Errorf("reading the certificate for %s: %w", property, err)
+		}
+		if found {
+			expiries[property] = expiry
+		}
+	}
+	return expiries, nil
+}
+
+// DeployedCertificateExpiries reads the certificates deployed on the inner
+// director VM.
+func DeployedCertificateExpiries() map[string]time.Time {
+	paths := []string{directorConfigFile}
+	for _, path := range directorCertificateFiles {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	expiries, err := DirectorCertificateExpiries(FetchInnerDirectorFiles(paths...))
+	Expect(err).NotTo(HaveOccurred())
+	return expiries
+}
+
+// CertificateExpiryMismatches describes how the expiries the director
+// reported differ from the deployed ones. The director reports days left as
+// of shortly before now, so they may be one more than at now.
+func CertificateExpiryMismatches(deployed map[string]time.Time, reported []CertificateExpiry, now time.Time) []string {
+	var mismatches []string
+	seen := map[string]bool{}
+	for _, expiry := range reported {
+		seen[expiry.Property] = true
+
+		notAfter, found := deployed[expiry.Property]
+		if !found {
+			mismatches = append(mismatches, fmt.Sprintf("%s is reported to expire at %s but has no certificate deployed", expiry.Property, expiry.Expiry.Format(time.RFC3339)))
+			continue
+		}
+		if !expiry.Expiry.Equal(notAfter) {
+			mismatches = append(mismatches, fmt.Sprintf("%s is reported to expire at %s but expires at %s", expiry.Property, expiry.Expiry.Format(time.RFC3339), notAfter.Format(time.RFC3339)))
+		}
+		if daysLeft := DaysLeft(notAfter, now); expiry.DaysLeft != daysLeft && expiry.DaysLeft != daysLeft+1 {
+			mismatches = append(mismatches, fmt.Sprintf("%s is reported to have %d days left but has %d", expiry.Property, expiry.DaysLeft, daysLeft))
+		}
+	}
+
+	for property, notAfter := range deployed {
+		if !seen[property] {
+			mismatches = append(mismatches, fmt.Sprintf("%s expires at %s but is not reported", property, notAfter.Format(time.RFC3339)))
+		}
+	}
+
+	sort.Strings(mismatches)
+	return mismatches
+}
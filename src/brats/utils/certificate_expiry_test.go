@@ -0,0 +1,144 @@
+package utils_test
+
+import (
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"brats/certs"
+	"brats/utils"
+)
+
+var _ = Describe("certificate expiry", func() {
+	var ca *certs.Certificate
+
+	BeforeEach(func() {
+		var err error
+		ca, err = certs.NewCA(certs.Options{CommonName: "default_ca"})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	issue := func(validFor time.Duration) *certs.Certificate {
+		certificate, err := ca.Server(certs.Options{CommonName: "10.245.0.11", Hosts: []string{"10.245.0.11"}, Validity: certs.ValidFor(validFor)})
+		Expect(err).NotTo(HaveOccurred())
+		return certificate
+	}
+
+	Describe("PEMExpiry", func() {
+		It("reads the expiry of the first certificate to the second", func() {
+			director := issue(10 * 24 * time.Hour)
+
+			expiry, found, err := utils.PEMExpiry(append(director.CertPEM(), ca.CertPEM()...))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(expiry).To(Equal(director.Certificate.NotAfter.UTC().Truncate(time.Second)))
+			Expect(expiry.Location()).To(Equal(time.UTC))
+		})
+
+		It("skips blocks that are not certificates", func() {
+			director := issue(time.Hour)
+
+			expiry, found, err := utils.PEMExpiry(append(director.KeyPEM(), director.CertPEM()...))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(expiry).To(Equal(director.Certificate.NotAfter.UTC().Truncate(time.Second)))
+		})
+
+		It("reports no expiry without a certificate", func() {
+			_, found, err := utils.PEMExpiry([]byte(""))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeFalse())
+		})
+
+		It("fails on a malformed certificate", func() {
+			_, _, err := utils.PEMExpiry([]byte("-----BEGIN CERTIFICATE-----\nbm90IGEgY2VydGlmaWNhdGU=\n-----END CERTIFICATE-----\n"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	DescribeTable("DaysLeft",
+		func(left time.Duration, expected int) {
+			now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+			Expect(utils.DaysLeft(now.Add(left), now)).To(Equal(expected))
+		},
+		Entry("whole days", 10*24*time.Hour, 10),
+		Entry("rounds down", 10*24*time.Hour-time.Second, 9),
+		Entry("less than a day", time.Hour, 0),
+		Entry("expired", -time.Hour, -1),
+	)
+
+	Describe("DirectorCertificateExpiries", func() {
+		It("reads the director job's certificates by property", func() {
+			director := issue(10 * 24 * time.Hour)
+			directorYML, err := json.Marshal(map[string]any{
+				"blobstore": map[string]any{"options": map[string]any{"tls": map[string]any{"cert": map[string]any{"ca": string(ca.CertPEM())}}}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			expiries, err := utils.DirectorCertificateExpiries(map[string]string{
+				"/var/vcap/jobs/director/config/ssl/director.pem":      string(director.CertPEM()),
+				"/var/vcap/jobs/director/config/nats_server_ca.pem":    string(ca.CertPEM()),
+				"/var/vcap/jobs/director/config/config_server_ca.cert": "",
+				"/var/vcap/jobs/director/config/director.yml":          string(directorYML),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(expiries).To(Equal(map[string]time.Time{
+				"director.ssl.cert":     director.Certificate.NotAfter.UTC().Truncate(time.Second),
+				"nats.tls.ca":           ca.Certificate.NotAfter.UTC().Truncate(time.Second),
+				"blobstore.tls.cert.ca": ca.Certificate.NotAfter.UTC().Truncate(time.Second),
+			}))
+		})
+
+		It("fails on a malformed director.yml", func() {
+			_, err := utils.DirectorCertificateExpiries(map[string]string{"/var/vcap/jobs/director/config/director.yml": "{"})
+			Expect(err).To(MatchError(ContainSubstring("director.yml")))
+		})
+	})
+
+	Describe("CertificateExpiryMismatches", func() {
+		now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+		expiry := now.Add(10*24*time.Hour + time.Hour)
+
+		It("accepts matching expiries", func() {
+			Expect(utils.CertificateExpiryMismatches(
+				map[string]time.Time{"director.ssl.cert": expiry},
+				[]utils.CertificateExpiry{{Property: "director.ssl.cert", Expiry: expiry, DaysLeft: 10}},
+				now,
+			)).To(BeEmpty())
+		})
+
+		It("accepts days left from before a day boundary passed", func() {
+			Expect(utils.CertificateExpiryMismatches(
+				map[string]time.Time{"director.ssl.cert": expiry},
+				[]utils.CertificateExpiry{{Property: "director.ssl.cert", Expiry: expiry, DaysLeft: 10}},
+				now.Add(2*time.Hour),
+			)).To(BeEmpty())
+		})
+
+		It("describes every mismatch", func() {
+			Expect(utils.CertificateExpiryMismatches(
+				map[string]time.Time{"director.ssl.cert": expiry, "nats.tls.ca": expiry},
+				[]utils.CertificateExpiry{
+					{Property: "director.ssl.cert", Expiry: expiry.Add(time.Hour), DaysLeft: 30},
+					{Property: "director.db.tls.cert.ca", Expiry: expiry, DaysLeft: 10},
+				},
+				now,
+			)).To(Equal([]string{
+				"director.db.tls.cert.ca is reported to expire at 2026-10-29T13:00:00Z but has no certificate deployed",
+				"director.ssl.cert is reported to expire at 2026-10-29T14:00:00Z but expires at 2026-10-29T13:00:00Z",
+				"director.ssl.cert is reported to have 30 days left but has 10",
+				"nats.tls.ca expires at 2026-10-29T13:00:00Z but is not reported",
+			}))
+		})
+	})
+
+	It("parses the director's /certificate_expiry response", func() {
+		var expiries []utils.CertificateExpiry
+		Expect(json.Unmarshal([]byte(`[{"certificate_path":"director.ssl.cert","expiry":"2026-10-29T13:00:00Z","days_left":10}]`), &expiries)).To(Succeed())
+		Expect(expiries).To(Equal([]utils.CertificateExpiry{
+			{Property: "director.ssl.cert", Expiry: time.Date(2026, 10, 29, 13, 0, 0, 0, time.UTC), DaysLeft: 10},
+		}))
+	})
+})
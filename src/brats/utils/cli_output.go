@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// CLIOutput is the document printed by the bosh CLI when invoked with --json.
+type CLIOutput struct {
+	Tables []CLITable `json:"Tables"`
+	Blocks []string   `json:"Blocks"`
+	Lines  []string   `json:"Lines"`
+}
+
+type CLITable struct {
+	Content string              `json:"Content"`
+	Header  map[string]string   `json:"Header"`
+	Rows    []map[string]string `json:"Rows"`
+	Notes   []string            `json:"Notes"`
+}
+
+func ParseCLIOutput(contents []byte) (CLIOutput, error) {
+	var output CLIOutput
+	if err := json.Unmarshal(contents, &output); err != nil {
+		return CLIOutput{}, fmt.Errorf("parsing bosh CLI json output: %w", err)
+	}
+
+	return output, nil
+}
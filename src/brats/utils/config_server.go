@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DeploymentVariable is a variable of a deployment as the director lists
+// it, with the ID of the config server value the deployment uses.
+type DeploymentVariable struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func (c *DirectorClient) DeploymentVariables(deployment string) ([]DeploymentVariable, error) {
+	var variables []DeploymentVariable
+	err := c.Get("/deployments/"+url.PathEscape(deployment)+"/variables", nil, &variables)
+	return variables, err
+}
+
+// ConfigServerClient reads values from the data API of a config server, as
+// the director does.
+type ConfigServerClient struct {
+	url        string
+	token      string
+	httpClient *http.Client
+}
+
+// NewConfigServerClient authenticates with a client credentials token from
+// the config server's UAA, which is signed by the same CA.
+func NewConfigServerClient(config ConfigServerConfig) (*ConfigServerClient, error) {
+	caCert, err := os.ReadFile(config.CACertPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading the config server CA: %w", err)
+	}
+	caCertPool := x509.NewCertPool()
+	if ok := caCertPool.AppendCertsFromPEM(caCert); !ok {
+		return nil, fmt.Errorf("failed to load config server CA certificate")
+	}
+
+	c := &ConfigServerClient{
+		url: strings.TrimSuffix(config.URL, "/"),
+		httpClient: &http.Client{
+			Timeout: time.Minute,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: caCertPool},
+			},
+		},
+	}
+	c.token, err = c.clientCredentialsToken(strings.TrimSuffix(config.UAAURL, "/"), config.ClientID, config.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// clientCredentialsToken fetches a token from UAA's /oauth/token, which
+// takes a form rather than JSON.
+func (c *ConfigServerClient) clientCredentialsToken(uaaURL, clientID, clientSecret string) (string, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, err := http.NewRequest(http.MethodPost, uaaURL+"/oauth/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(clientID, clientSecret)
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := c.do(req, &token); err != nil {
+		return "", fmt.Errorf("fetching a config server token for %s: %w", clientID, err)
+	}
+	return token.AccessToken, nil
+}
+
+// Value reads the value with id, a string or an object of fields such as
+// a certificate's.
+func (c *ConfigServerClient) Value(id string) (any, error) {
+	req, err := http.NewRequest(http.MethodGet, c.url+"/v1/data/"+url.PathEscape(id), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "bearer "+c.token)
+
+	var credential struct {
+		Value any `json:"value"`
+	}
+	if err := c.do(req, &credential); err != nil {
+		return nil, err
+	}
+	return credential.Value, nil
+}
+
+func (c *ConfigServerClient) do(req *http.Request, out any) error {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	contents, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Path, resp.Status, contents)
+	}
+
+	if err := json.Unmarshal(contents, out); err != nil {
+		return fmt.Errorf("decoding response of %s %s: %w", req.Method, req.URL.Path, err)
+	}
+	return nil
+}
+
+// ConfigServerSecrets loads the values of a deployment's variables from the
+// config server and returns them as CredsSecrets does for a vars store.
+func ConfigServerSecrets(director *DirectorClient, configServer *ConfigServerClient, deployment string) ([]Secret, error) {
+	variables, err := director.DeploymentVariables(deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	source := fmt.Sprintf("the config server for the %s deployment", deployment)
+	var secrets []Secret
+	for _, variable := range variables {
+		value, err := configServer.Value(variable.ID)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", variable.Name, err)
+		}
+
+		switch value := value.(type) {
+		case string:
+			if len(value) >= minSecretLength {
+				secrets = append(secrets, Secret{Name: variable.Name, Source: source, Value: value})
+			}
+		case map[string]any:
+			fields := make([]string, 0, len(value))
+			for field := range value {
+				fields = append(fields, field)
+			}
+			sort.Strings(fields)
+
+			for _, field := range fields {
+				fieldValue, ok := value[field].(string)
+				if !ok || publicCredentialFields[field] || len(fieldValue) < minSecretLength {
+					continue
+				}
+				secrets = append(secrets, Secret{Name: variable.Name + "/" + field, Source: source, Value: fieldValue})
+			}
+		}
+	}
+	return secrets, nil
+}
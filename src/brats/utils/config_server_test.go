@@ -0,0 +1,113 @@
+package utils_test
+
+import (
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"brats/fakes/credhub"
+	"brats/utils"
+)
+
+var _ = Describe("ConfigServerSecrets", func() {
+	var (
+		configServer *credhub.Server
+		config       utils.ConfigServerConfig
+		variables    []utils.DeploymentVariable
+		director     *utils.DirectorClient
+	)
+
+	BeforeEach(func() {
+		var err error
+		configServer, err = credhub.Start(credhub.Config{
+			Address:      "127.0.0.1:0",
+			Hosts:        []string{"127.0.0.1"},
+			ClientID:     "director_to_credhub",
+			ClientSecret: "fake-client-secret",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(configServer.Close)
+
+		caCertPath := filepath.Join(GinkgoT().TempDir(), "config-server-ca.pem")
+		Expect(os.WriteFile(caCertPath, []byte(configServer.CACert()), 0o644)).To(Succeed())
+		config = utils.ConfigServerConfig{
+			URL:          configServer.URL() + "/api/",
+			UAAURL:       configServer.URL(),
+			CACertPath:   caCertPath,
+			ClientID:     "director_to_credhub",
+			ClientSecret: "fake-client-secret",
+		}
+
+		password := configServer.Set("/docker-inner/dummy/password", "password", "a-generated-password")
+		short := configServer.Set("/docker-inner/dummy/short", "value", "short")
+		tls := configServer.Set("/docker-inner/dummy/tls", "certificate", map[string]any{
+			"ca":          "a-public-ca-certificate",
+			"certificate": "a-public-certificate",
+			"private_key": "a-private-key-value",
+		})
+		variables = []utils.DeploymentVariable{
+			{ID: password.ID, Name: password.Name},
+			{ID: short.ID, Name: short.Name},
+			{ID: tls.ID, Name: tls.Name},
+		}
+
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/deployments/dummy/variables" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			fmt.Fprint(w, `[`) //nolint:errcheck
+			for i, variable := range variables {
+				if i > 0 {
+					fmt.Fprint(w, `,`) //nolint:errcheck
+				}
+				fmt.Fprintf(w, `{"id": %q, "name": %q}`, variable.ID, variable.Name) //nolint:errcheck
+			}
+			fmt.Fprint(w, `]`) //nolint:errcheck
+		}))
+		DeferCleanup(server.Close)
+
+		caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+		director, err = utils.NewDirectorClient(server.URL, caCert, nil)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("returns the deployed values of the variables except certificates", func() {
+		client, err := utils.NewConfigServerClient(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		secrets, err := utils.ConfigServerSecrets(director, client, "dummy")
+		Expect(err).NotTo(HaveOccurred())
+
+		source := "the config server for the dummy deployment"
+		Expect(secrets).To(ConsistOf(
+			utils.Secret{Name: "/docker-inner/dummy/password", Source: source, Value: "a-generated-password"},
+			utils.Secret{Name: "/docker-inner/dummy/tls/private_key", Source: source, Value: "a-private-key-value"},
+		))
+	})
+
+	It("reads the version the deployment uses rather than the current one", func() {
+		configServer.Set("/docker-inner/dummy/password", "password", "a-newer-password")
+
+		client, err := utils.NewConfigServerClient(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		secrets, err := utils.ConfigServerSecrets(director, client, "dummy")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(secrets).To(ContainElement(HaveField("Value", "a-generated-password")))
+		Expect(secrets).NotTo(ContainElement(HaveField("Value", "a-newer-password")))
+	})
+
+	It("fails without a token from the config server's UAA", func() {
+		config.ClientSecret = "wrong-secret"
+
+		_, err := utils.NewConfigServerClient(config)
+		Expect(err).To(MatchError(ContainSubstring("fetching a config server token for director_to_credhub")))
+	})
+})
@@ -0,0 +1,298 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/onsi/gomega" //nolint:staticcheck
+)
+
+const (
+	TaskStateQueued     = "queued"
+	TaskStateProcessing = "processing"
+	TaskStateCancelling = "cancelling"
+	TaskStateCancelled  = "cancelled"
+	TaskStateDone       = "done"
+	TaskStateError      = "error"
+	TaskStateTimeout    = "timeout"
+)
+
+// DirectorClient talks to the director API directly, for the endpoints the
+// bosh CLI does not expose or only exposes as human-readable tables.
+type DirectorClient struct {
+	url        string
+	httpClient *http.Client
+	authorize  func(*http.Request) error
+}
+
+// DirectorError is returned for any response outside the 2xx range.
+type DirectorError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Body       string
+}
+
+func (e *DirectorError) Error() string {
+	return fmt.Sprintf("director responded to %s %s with %d: %s", e.Method, e.Path, e.StatusCode, e.Body)
+}
+
+type Task struct {
+	ID          int    `json:"id"`
+	State       string `json:"state"`
+	Description string `json:"description"`
+	Timestamp   *int64 `json:"timestamp"`
+	StartedAt   *int64 `json:"started_at"`
+	Result      string `json:"result"`
+	User        string `json:"user"`
+	Deployment  string `json:"deployment"`
+	ContextID   string `json:"context_id"`
+}
+
+// Finished reports whether the task reached a state it will never leave.
+func (t Task) Finished() bool {
+	switch t.State {
+	case TaskStateDone, TaskStateError, TaskStateCancelled, TaskStateTimeout:
+		return true
+	}
+	return false
+}
+
+func (t Task) Started() (time.Time, bool) {
+	if t.StartedAt == nil {
+		return time.Time{}, false
+	}
+	return time.Unix(*t.StartedAt, 0), true
+}
+
+// Ended returns the time the director recorded for a finished task. The
+// director does not report a timestamp while a task is queued or processing.
+func (t Task) Ended() (time.Time, bool) {
+	if t.Timestamp == nil {
+		return time.Time{}, false
+	}
+	return time.Unix(*t.Timestamp, 0), true
+}
+
+type TasksFilter struct {
+	States     []string
+	Deployment string
+	ContextID  string
+	Limit      int
+
+	// Verbose 2 includes every task type; the director's default of 1 only
+	// lists deployment, release and stemcell changes.
+	Verbose int
+}
+
+func (f TasksFilter) query() url.Values {
+	query := url.Values{}
+	if len(f.States) > 0 {
+		query.Set("state", strings.Join(f.States, ","))
+	}
+	if f.Deployment != "" {
+		query.Set("deployment", f.Deployment)
+	}
+	if f.ContextID != "" {
+		query.Set("context_id", f.ContextID)
+	}
+	if f.Limit > 0 {
+		query.Set("limit", strconv.Itoa(f.Limit))
+	}
+	if f.Verbose > 0 {
+		query.Set("verbose", strconv.Itoa(f.Verbose))
+	}
+	return query
+}
+
+type Lock struct {
+	Type     string   `json:"type"`
+	Resource []string `json:"resource"`
+	Timeout  string   `json:"timeout"`
+	TaskID   string   `json:"task_id"`
+}
+
+// Name is the lock name without the "lock:" prefix, e.g.
+// "deployment:my-deployment".
+func (l Lock) Name() string {
+	return strings.Join(append([]string{l.Type}, l.Resource...), ":")
+}
+
+func NewDirectorClient(directorURL string, caCert []byte, authorize func(*http.Request) error) (*DirectorClient, error) {
+	caCertPool := x509.NewCertPool()
+	if ok := caCertPool.AppendCertsFromPEM(caCert); !ok {
+		return nil, fmt.Errorf("failed to load director CA certificate")
+	}
+
+	return &DirectorClient{
+		url: strings.TrimSuffix(directorURL, "/"),
+		httpClient: &http.Client{
+			Timeout: time.Minute,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: caCertPool},
+			},
+		},
+		authorize: authorize,
+	}, nil
+}
+
+func BasicAuth(user, password string) func(*http.Request) error {
+	return func(req *http.Request) error {
+		req.SetBasicAuth(user, password)
+		return nil
+	}
+}
+
+func BearerAuth(token string) func(*http.Request) error {
+	return func(req *http.Request) error {
+		req.Header.Set("Authorization", "bearer "+token)
+		return nil
+	}
+}
+
+// InnerDirectorClient returns a client for the inner director of the current
+// Ginkgo process, authenticated as the admin user from its creds.yml.
+func InnerDirectorClient() *DirectorClient {
+	client, err := innerBosh.Client()
+	Expect(err).NotTo(HaveOccurred())
+
+	return client
+}
+
+// InnerBoshCredential reads a value from the inner director's creds.yml.
+func InnerBoshCredential(path string) string {
+	value, err := innerBosh.Credential(path)
+	Expect(err).NotTo(HaveOccurred())
+
+	return value
+}
+
+func (c *DirectorClient) URL() string {
+	return c.url
+}
+
+// WithAuth returns a copy of the client that authenticates requests with
+// authorize instead.
+func (c *DirectorClient) WithAuth(authorize func(*http.Request) error) *DirectorClient {
+	clone := *c
+	clone.authorize = authorize
+	return &clone
+}
+
+func (c *DirectorClient) Get(path string, query url.Values, out any) error {
+	return c.Do(http.MethodGet, path, query, nil, out)
+}
+
+func (c *DirectorClient) Do(method, path string, query url.Values, body io.Reader, out any) error {
+	req, err := c.newRequest(method, path, query, body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	contents, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &DirectorError{Method: method, Path: path, StatusCode: resp.StatusCode, Body: string(contents)}
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(contents, out); err != nil {
+		return fmt.Errorf("decoding response of %s %s: %w", method, path, err)
+	}
+
+	return nil
+}
+
+// StartTask sends a request the director answers by queueing a task, and
+// returns the task ID from the redirect without following it, so the caller
+// does not need permission to read the task.
+func (c *DirectorClient) StartTask(method, path string, query url.Values, body io.Reader) (int, error) {
+	req, err := c.newRequest(method, path, query, body)
+	if err != nil {
+		return 0, err
+	}
+
+	httpClient := *c.httpClient
+	httpClient.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusFound {
+		contents, _ := io.ReadAll(resp.Body) //nolint:errcheck
+		return 0, &DirectorError{Method: method, Path: path, StatusCode: resp.StatusCode, Body: string(contents)}
+	}
+
+	location := resp.Header.Get("Location")
+	_, id, found := strings.Cut(location, "/tasks/")
+	if !found {
+		return 0, fmt.Errorf("director redirected %s %s to %q instead of a task", method, path, location)
+	}
+	return strconv.Atoi(id)
+}
+
+func (c *DirectorClient) newRequest(method, path string, query url.Values, body io.Reader) (*http.Request, error) {
+	endpoint := c.url + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if c.authorize != nil {
+		if err := c.authorize(req); err != nil {
+			return nil, err
+		}
+	}
+
+	return req, nil
+}
+
+func (c *DirectorClient) Tasks(filter TasksFilter) ([]Task, error) {
+	var tasks []Task
+	err := c.Get("/tasks", filter.query(), &tasks)
+	return tasks, err
+}
+
+func (c *DirectorClient) Task(id int) (Task, error) {
+	var task Task
+	err := c.Get(fmt.Sprintf("/tasks/%d", id), nil, &task)
+	return task, err
+}
+
+func (c *DirectorClient) Locks() ([]Lock, error) {
+	var locks []Lock
+	err := c.Get("/locks", nil, &locks)
+	return locks, err
+}
@@ -0,0 +1,141 @@
+package utils_test
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"brats/utils"
+)
+
+var _ = Describe("DirectorClient", func() {
+	var (
+		server   *httptest.Server
+		requests []*http.Request
+		client   *utils.DirectorClient
+	)
+
+	BeforeEach(func() {
+		requests = nil
+		server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r)
+
+			switch r.URL.Path {
+			case "/tasks":
+				w.Write([]byte(`[{"id": 7, "state": "done", "description": "create deployment", "timestamp": 1700000060, "started_at": 1700000000, "result": "/deployments/fake", "user": "admin", "deployment": "fake", "context_id": "fake-context"}]`)) //nolint:errcheck
+			case "/stemcells":
+				http.Redirect(w, r, "/tasks/9", http.StatusFound)
+			case "/director/certificate_expiry":
+				w.Write([]byte(`[{"certificate_path": "director.ssl.cert", "expiry": "2030-01-02T03:04:05Z", "days_left": 42}]`)) //nolint:errcheck
+			case "/locks":
+				w.Write([]byte(`[{"type": "deployment", "resource": ["fake"], "timeout": "1700000100.000000", "task_id": "8"}]`)) //nolint:errcheck
+			default:
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"code": 600000, "description": "Require one of the scopes: bosh.admin"}`)) //nolint:errcheck
+			}
+		}))
+		DeferCleanup(server.Close)
+
+		caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+		var err error
+		client, err = utils.NewDirectorClient(server.URL, caCert, utils.BasicAuth("fake-user", "fake-password"))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("reads the certificate expiries the director reports", func() {
+		expiries, err := client.CertificateExpiries()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(expiries).To(Equal([]utils.CertificateExpiry{{
+			Property: "director.ssl.cert",
+			Expiry:   time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC),
+			DaysLeft: 42,
+		}}))
+
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Method).To(Equal("GET"))
+		Expect(requests[0].URL.Path).To(Equal("/director/certificate_expiry"))
+	})
+
+	It("lists tasks with the given filter", func() {
+		tasks, err := client.Tasks(utils.TasksFilter{
+			States:     []string{"queued", "processing"},
+			Deployment: "fake",
+			ContextID:  "fake-context",
+			Limit:      5,
+			Verbose:    2,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tasks).To(HaveLen(1))
+		Expect(tasks[0].ID).To(Equal(7))
+		Expect(tasks[0].Finished()).To(BeTrue())
+
+		started, ok := tasks[0].Started()
+		Expect(ok).To(BeTrue())
+		ended, ok := tasks[0].Ended()
+		Expect(ok).To(BeTrue())
+		Expect(ended.Sub(started).Seconds()).To(Equal(60.0))
+
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].URL.Query()).To(Equal(url.Values{
+			"state":      {"queued,processing"},
+			"deployment": {"fake"},
+			"context_id": {"fake-context"},
+			"limit":      {"5"},
+			"verbose":    {"2"},
+		}))
+
+		user, password, ok := requests[0].BasicAuth()
+		Expect(ok).To(BeTrue())
+		Expect(user).To(Equal("fake-user"))
+		Expect(password).To(Equal("fake-password"))
+	})
+
+	It("authenticates with a bearer token instead", func() {
+		Expect(client.WithAuth(utils.BearerAuth("fake-token")).Get("/locks", nil, nil)).To(Succeed())
+
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Header.Get("Authorization")).To(Equal("bearer fake-token"))
+	})
+
+	It("returns the ID of a queued task without following the redirect", func() {
+		id, err := client.StartTask("POST", "/stemcells", nil, strings.NewReader(`{"location": "https://example.com/stemcell.tgz"}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(Equal(9))
+
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Header.Get("Content-Type")).To(Equal("application/json"))
+
+		_, err = client.StartTask("POST", "/deployments", nil, strings.NewReader("{}"))
+		Expect(err).To(BeAssignableToTypeOf(&utils.DirectorError{}))
+	})
+
+	It("lists locks", func() {
+		locks, err := client.Locks()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(locks).To(Equal([]utils.Lock{
+			{Type: "deployment", Resource: []string{"fake"}, Timeout: "1700000100.000000", TaskID: "8"},
+		}))
+	})
+
+	It("returns a DirectorError for unsuccessful responses", func() {
+		err := client.Get("/deployments", nil, nil)
+
+		var directorErr *utils.DirectorError
+		Expect(err).To(BeAssignableToTypeOf(directorErr))
+		directorErr = err.(*utils.DirectorError)
+		Expect(directorErr.StatusCode).To(Equal(http.StatusUnauthorized))
+		Expect(directorErr.Body).To(ContainSubstring("bosh.admin"))
+	})
+
+	It("rejects a CA certificate that is not PEM", func() {
+		_, err := utils.NewDirectorClient(server.URL, []byte("not a certificate"), nil)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,337 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:staticcheck
+	. "github.com/onsi/gomega"    //nolint:staticcheck
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/types"
+)
+
+// Logs of the jobs on the inner director VM.
+const (
+	// DirectorLogDir holds the logs of every process of the director job,
+	// stderr included.
+	DirectorLogDir   = "/var/vcap/sys/log/director"
+	DirectorLog      = "/var/vcap/sys/log/director/director.stdout.log"
+	WorkerLogs       = "/var/vcap/sys/log/director/*worker_*.stdout.log"
+	SchedulerLog     = "/var/vcap/sys/log/director/scheduler.stdout.log"
+	SyncDNSLog       = "/var/vcap/sys/log/director/sync_dns.stdout.log"
+	HealthMonitorLog = "/var/vcap/sys/log/health_monitor/health_monitor.log"
+)
+
+var (
+	// threadLogLine is the director's ThreadFormatter layout, which the
+	// director, workers and schedulers log with:
+	// "I, [2026-10-19T12:00:00.123456 #42] [0x2b0] INFO -- Director: message"
+	threadLogLine = regexp.MustCompile(`^([A-Z]), \[(\S+) ?#(\d+)\] \[([^\]]*)\]\s+([A-Z]+) -- ([^:]*): ?(.*)$`)
+	// rubyLogLine is Ruby's Logger layout, which the health monitor's
+	// plugins and stdlib loggers use:
+	// "I, [2026-10-19T12:00:00.123456 #42]  INFO -- progname: message"
+	rubyLogLine = regexp.MustCompile(`^([A-Z]), \[(\S+) ?#(\d+)\]\s+([A-Z]+) -- ([^:]*): ?(.*)$`)
+	// patternLogLine is the logging gem's default layout, which the health
+	// monitor logs with: "[2026-10-19T12:00:00] INFO  -- Bosh::Monitor : message"
+	patternLogLine = regexp.MustCompile(`^\[(\S+)\]\s+([A-Z]+)\s+-- (.*?) : ?(.*)$`)
+
+	logTime = regexp.MustCompile(`^(\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d)(?:\.(\d+))?(Z|[+-]\d\d:?\d\d)?$`)
+)
+
+// LogEntry is a parsed line of a director or health monitor log. Lines that
+// do not start an entry, like backtraces, are continuations of the message
+// before them.
+type LogEntry struct {
+	File      string
+	Time      time.Time
+	PID       int
+	Thread    string
+	Level     string
+	Component string
+	Message   string
+}
+
+func (e LogEntry) String() string {
+	return fmt.Sprintf("%s %s [%s] %s: %s", e.Time.Format(time.RFC3339Nano), e.Level, e.Component, e.File, e.Message)
+}
+
+// ParseLogLine parses a line that starts a log entry.
+func ParseLogLine(line string) (LogEntry, bool) {
+	var entry LogEntry
+	var timestamp, pid string
+
+	if match := threadLogLine.FindStringSubmatch(line); match != nil {
+		timestamp, pid = match[2], match[3]
+		entry.Thread, entry.Level, entry.Component, entry.Message = match[4], match[5], match[6], match[7]
+	} else if match := rubyLogLine.FindStringSubmatch(line); match != nil {
+		timestamp, pid = match[2], match[3]
+		entry.Level, entry.Component, entry.Message = match[4], match[5], match[6]
+	} else if match := patternLogLine.FindStringSubmatch(line); match != nil {
+		timestamp = match[1]
+		entry.Level, entry.Component, entry.Message = match[2], match[3], match[4]
+	} else {
+		return LogEntry{}, false
+	}
+
+	var err error
+	if entry.Time, err = parseLogTime(timestamp); err != nil {
+		return LogEntry{}, false
+	}
+	if pid != "" {
+		entry.PID, _ = strconv.Atoi(pid) //nolint:errcheck
+	}
+	entry.Component = strings.TrimSpace(entry.Component)
+	return entry, true
+}
+
+// parseLogTime parses the timestamps of all the layouts, in UTC unless they
+// have a zone. Fractions of a second beyond nanoseconds are dropped.
+func parseLogTime(timestamp string) (time.Time, error) {
+	match := logTime.FindStringSubmatch(timestamp)
+	if match == nil {
+		return time.Time{}, fmt.Errorf("unknown timestamp %q", timestamp)
+	}
+
+	t, err := time.Parse("2006-01-02T15:04:05", match[1])
+	if err != nil {
+		return time.Time{}, err
+	}
+	if fraction := match[2]; fraction != "" {
+		fraction = (fraction + "000000000")[:9]
+		nanoseconds, _ := strconv.Atoi(fraction) //nolint:errcheck
+		t = t.Add(time.Duration(nanoseconds))
+	}
+	if zone := strings.ReplaceAll(match[3], ":", ""); zone != "" && zone != "Z" {
+		offset, err := time.Parse("-0700", zone)
+		if err != nil {
+			return time.Time{}, err
+		}
+		_, seconds := offset.Zone()
+		t = t.Add(-time.Duration(seconds) * time.Second)
+	}
+	return t, nil
+}
+
+// logParser turns lines into entries as they arrive. The latest entry is
+// pending until the next one starts, since more of its message may follow.
+type logParser struct {
+	file    string
+	pending *LogEntry
+}
+
+func (p *logParser) line(line string) (LogEntry, bool) {
+	if header, found := strings.CutPrefix(line, "==> "); found && strings.HasSuffix(header, " <==") {
+		// tail announces which file the lines after this come from.
+		entry, complete := p.flush()
+		p.file = strings.TrimSuffix(header, " <==")
+		return entry, complete
+	}
+
+	if entry, found := ParseLogLine(line); found {
+		previous, complete := p.flush()
+		entry.File = p.file
+		p.pending = &entry
+		return previous, complete
+	}
+
+	if p.pending != nil && line != "" {
+		p.pending.Message += "\n" + line
+	}
+	return LogEntry{}, false
+}
+
+func (p *logParser) flush() (LogEntry, bool) {
+	if p.pending == nil {
+		return LogEntry{}, false
+	}
+	entry := *p.pending
+	p.pending = nil
+	return entry, true
+}
+
+// ParseLog parses the entries of a whole log.
+func ParseLog(contents string) []LogEntry {
+	parser := &logParser{}
+	entries := []LogEntry{}
+	for _, line := range strings.Split(contents, "\n") {
+		if entry, complete := parser.line(strings.TrimRight(line, "\r")); complete {
+			entries = append(entries, entry)
+		}
+	}
+	if entry, complete := parser.flush(); complete {
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// LogSource is anything log matchers can read entries from.
+type LogSource interface {
+	LogEntries() []LogEntry
+}
+
+// LogEntries lets a parsed log be matched directly.
+type LogEntries []LogEntry
+
+func (e LogEntries) LogEntries() []LogEntry {
+	return e
+}
+
+// LogCursor is a position in a LogTail.
+type LogCursor int
+
+// LogTail follows logs as they are written. Entries are parsed from what
+// has arrived whenever they are read, so `Eventually(tail)` sees new ones.
+type LogTail struct {
+	mutex   sync.Mutex
+	read    func() []byte
+	offset  int
+	partial string
+	parser  logParser
+	entries []LogEntry
+}
+
+// NewLogTail parses what read returns, which has to be everything written
+// so far, e.g. the contents of a gbytes.Buffer.
+func NewLogTail(read func() []byte) *LogTail {
+	return &LogTail{read: read}
+}
+
+// TailInnerDirectorLogs follows logs on the inner director VM from their
+// start, until the spec ends. Paths may be globs, which only root can
+// expand in the log directories.
+func TailInnerDirectorLogs(paths ...string) *LogTail {
+	output := gbytes.NewBuffer()
+	process, err := InnerDirectorSSHClient().Sudo().Start("exec tail -v -n +1 -F "+strings.Join(paths, " "), output, io.Discard)
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(process.Close)
+
+	return NewLogTail(output.Contents)
+}
+
+// LogEntries are the entries that have arrived. More lines of the message
+// of the latest one may still follow.
+func (t *LogTail) LogEntries() []LogEntry {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	contents := t.read()
+	if len(contents) > t.offset {
+		lines := strings.Split(t.partial+string(contents[t.offset:]), "\n")
+		t.offset = len(contents)
+		t.partial = lines[len(lines)-1]
+
+		for _, line := range lines[:len(lines)-1] {
+			line = strings.TrimRight(line, "\r")
+			if entry, complete := t.parser.line(line); complete {
+				t.entries = append(t.entries, entry)
+			}
+		}
+	}
+
+	entries := append([]LogEntry{}, t.entries...)
+	if t.parser.pending != nil {
+		entries = append(entries, *t.parser.pending)
+	}
+	return entries
+}
+
+// Cursor is the position after the entries that have arrived, so that
+// Since(cursor) only has entries logged after it.
+func (t *LogTail) Cursor() LogCursor {
+	return LogCursor(len(t.LogEntries()))
+}
+
+// Since is the entries after cursor.
+func (t *LogTail) Since(cursor LogCursor) LogSource {
+	return logSince{tail: t, cursor: cursor}
+}
+
+type logSince struct {
+	tail   *LogTail
+	cursor LogCursor
+}
+
+func (s logSince) LogEntries() []LogEntry {
+	entries := s.tail.LogEntries()
+	if int(s.cursor) >= len(entries) {
+		return []LogEntry{}
+	}
+	return entries[s.cursor:]
+}
+
+// Level matches entries logged at a level, e.g. "ERROR".
+func Level(level string) types.GomegaMatcher {
+	return HaveField("Level", strings.ToUpper(level))
+}
+
+// Component matches entries of a logger, e.g. "Scheduler" or
+// "DirectorWorker".
+func Component(component string) types.GomegaMatcher {
+	return HaveField("Component", component)
+}
+
+// Message matches the message of entries, either as a substring or with a
+// matcher.
+func Message(message any) types.GomegaMatcher {
+	if substring, ok := message.(string); ok {
+		return HaveField("Message", ContainSubstring(substring))
+	}
+	return HaveField("Message", message)
+}
+
+// ContainLogEntry succeeds once a log has an entry that satisfies all the
+// matchers.
+func ContainLogEntry(matchers ...types.GomegaMatcher) types.GomegaMatcher {
+	return &containLogEntryMatcher{entry: SatisfyAll(matchers...)}
+}
+
+type containLogEntryMatcher struct {
+	entry   types.GomegaMatcher
+	entries []LogEntry
+}
+
+func (m *containLogEntryMatcher) Match(actual any) (bool, error) {
+	source, ok := actual.(LogSource)
+	if !ok {
+		return false, fmt.Errorf("ContainLogEntry expects a LogSource, got %T", actual)
+	}
+
+	m.entries = source.LogEntries()
+	for _, entry := range m.entries {
+		if matches, err := m.entry.Match(entry); err != nil {
+			return false, err
+		} else if matches {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *containLogEntryMatcher) FailureMessage(any) string {
+	return fmt.Sprintf("Expected %d log entries%s\nto contain an entry that satisfies the matchers", len(m.entries), formatLogEntries(m.entries))
+}
+
+func (m *containLogEntryMatcher) NegatedFailureMessage(any) string {
+	return fmt.Sprintf("Expected %d log entries%s\nnot to contain an entry that satisfies the matchers", len(m.entries), formatLogEntries(m.entries))
+}
+
+// formatLogEntries shows the latest entries, which are what a spec waiting
+// for an entry usually wants to see.
+func formatLogEntries(entries []LogEntry) string {
+	const shown = 20
+
+	var b strings.Builder
+	if len(entries) > shown {
+		fmt.Fprintf(&b, "\n    ... %d earlier entries", len(entries)-shown)
+		entries = entries[len(entries)-shown:]
+	}
+	for _, entry := range entries {
+		fmt.Fprintf(&b, "\n    %s", entry)
+	}
+	return b.String()
+}
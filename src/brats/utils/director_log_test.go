@@ -0,0 +1,175 @@
+package utils_test
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"brats/utils"
+)
+
+var _ = Describe("director logs", func() {
+	DescribeTable("ParseLogLine",
+		func(line string, expected utils.LogEntry) {
+			entry, found := utils.ParseLogLine(line)
+			Expect(found).To(BeTrue())
+			Expect(entry).To(Equal(expected))
+		},
+		Entry("the director's thread layout",
+			"D, [2026-10-19T12:00:00.123456 #42] [0x2b0] DEBUG -- Scheduler: Scheduler cron - checking /",
+			utils.LogEntry{
+				Time: time.Date(2026, 10, 19, 12, 0, 0, 123456000, time.UTC), PID: 42, Thread: "0x2b0",
+				Level: "DEBUG", Component: "Scheduler", Message: "Scheduler cron - checking /",
+			},
+		),
+		Entry("a right-aligned level and a named thread",
+			"I, [2026-10-19T12:00:00.5 #7] [task:12]  INFO -- DirectorJobRunner: Task took 1s to process.",
+			utils.LogEntry{
+				Time: time.Date(2026, 10, 19, 12, 0, 0, 500000000, time.UTC), PID: 7, Thread: "task:12",
+				Level: "INFO", Component: "DirectorJobRunner", Message: "Task took 1s to process.",
+			},
+		),
+		Entry("Ruby's Logger layout without a program name",
+			"E, [2026-10-19T12:00:00.000001 #9] ERROR -- : connection refused",
+			utils.LogEntry{
+				Time: time.Date(2026, 10, 19, 12, 0, 0, 1000, time.UTC), PID: 9,
+				Level: "ERROR", Message: "connection refused",
+			},
+		),
+		Entry("the logging gem's default layout",
+			"[2026-10-19T12:00:00+02:00] WARN  -- Bosh::Monitor : Agent timed out: a1b2",
+			utils.LogEntry{
+				Time:  time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC),
+				Level: "WARN", Component: "Bosh::Monitor", Message: "Agent timed out: a1b2",
+			},
+		),
+		Entry("a message with colons",
+			"I, [2026-10-19T12:00:00.000000 #1] [0x1]  INFO -- Director: Sequel: SELECT 1",
+			utils.LogEntry{
+				Time: time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC), PID: 1, Thread: "0x1",
+				Level: "INFO", Component: "Director", Message: "Sequel: SELECT 1",
+			},
+		),
+	)
+
+	It("does not parse lines that do not start an entry", func() {
+		for _, line := range []string{
+			"",
+			"/var/vcap/packages/director/gem_home/lib/bosh/director.rb:12:in `run'",
+			"I, [yesterday #1] [0x1] INFO -- Director: message",
+		} {
+			_, found := utils.ParseLogLine(line)
+			Expect(found).To(BeFalse(), line)
+		}
+	})
+
+	It("appends lines that do not start an entry to the message before them", func() {
+		entries := utils.ParseLog(strings.Join([]string{
+			"stray line before any entry",
+			"D, [2026-10-19T12:00:00.000000 #1] [0x1] DEBUG -- Scheduler: Scheduler cron - checking /",
+			"Bosh::Director::Jobs::ScheduledOrphanedVMCleanup.has_work:false /",
+			"with params {}",
+			"I, [2026-10-19T12:00:01.000000 #1] [0x1]  INFO -- Scheduler: enqueueing 'ScheduledEventsCleanup'",
+			"",
+		}, "\n"))
+
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0].Message).To(Equal("Scheduler cron - checking /\nBosh::Director::Jobs::ScheduledOrphanedVMCleanup.has_work:false /\nwith params {}"))
+		Expect(entries[1].Message).To(Equal("enqueueing 'ScheduledEventsCleanup'"))
+	})
+
+	Describe("LogTail", func() {
+		var (
+			mutex   sync.Mutex
+			written []byte
+			tail    *utils.LogTail
+		)
+
+		write := func(lines ...string) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			written = append(written, strings.Join(lines, "")...)
+		}
+
+		BeforeEach(func() {
+			written = nil
+			tail = utils.NewLogTail(func() []byte {
+				mutex.Lock()
+				defer mutex.Unlock()
+				return append([]byte{}, written...)
+			})
+		})
+
+		It("parses lines as they arrive", func() {
+			write("==> /var/vcap/sys/log/director/scheduler.stdout.log <==\n",
+				"I, [2026-10-19T12:00:00.000000 #1] [0x1]  INFO -- Scheduler: starting sch")
+			Expect(tail.LogEntries()).To(BeEmpty())
+
+			write("eduler\n")
+			Expect(tail.LogEntries()).To(ConsistOf(SatisfyAll(
+				HaveField("File", "/var/vcap/sys/log/director/scheduler.stdout.log"),
+				HaveField("Message", "starting scheduler"),
+			)))
+
+			write("\n",
+				"==> /var/vcap/sys/log/director/worker_0.log <==\n",
+				"E, [2026-10-19T12:00:01.000000 #2] [0x2] ERROR -- DirectorWorker: failed\n",
+				"backtrace\n")
+			Expect(tail.LogEntries()).To(HaveLen(2))
+			Expect(tail.LogEntries()[1]).To(SatisfyAll(
+				HaveField("File", "/var/vcap/sys/log/director/worker_0.log"),
+				HaveField("Message", "failed\nbacktrace"),
+			))
+		})
+
+		It("only has entries after a cursor since it", func() {
+			write("I, [2026-10-19T12:00:00.000000 #1] [0x1] ERROR -- Scheduler: before\n")
+			cursor := tail.Cursor()
+			Expect(tail.Since(cursor).LogEntries()).To(BeEmpty())
+			Expect(tail.Since(cursor)).NotTo(utils.ContainLogEntry(utils.Level("ERROR")))
+
+			write("I, [2026-10-19T12:00:01.000000 #1] [0x1]  INFO -- Scheduler: after\n")
+			Expect(tail.Since(cursor).LogEntries()).To(ConsistOf(HaveField("Message", "after")))
+			Expect(tail).To(utils.ContainLogEntry(utils.Message("before")))
+		})
+
+		It("sees entries that arrive while waiting", func() {
+			go func() {
+				defer GinkgoRecover()
+				time.Sleep(50 * time.Millisecond)
+				write("E, [2026-10-19T12:00:00.000000 #1] [0x1] ERROR -- Scheduler: Scheduler start failed\n")
+			}()
+
+			Eventually(tail).Should(utils.ContainLogEntry(utils.Level("error"), utils.Component("Scheduler")))
+		})
+	})
+
+	Describe("ContainLogEntry", func() {
+		entries := utils.LogEntries{
+			{Level: "INFO", Component: "Director", Message: "INSERT INTO \"configs\" <redacted>"},
+			{Level: "ERROR", Component: "DirectorWorker", Message: "Task failed"},
+		}
+
+		It("matches an entry that satisfies every matcher", func() {
+			Expect(entries).To(utils.ContainLogEntry(utils.Level("ERROR"), utils.Component("DirectorWorker")))
+			Expect(entries).To(utils.ContainLogEntry(utils.Message(`INSERT INTO "configs" <redacted>`)))
+			Expect(entries).To(utils.ContainLogEntry(utils.Message(MatchRegexp(`^Task \w+$`))))
+			Expect(entries).NotTo(utils.ContainLogEntry(utils.Level("ERROR"), utils.Component("Director")))
+		})
+
+		It("shows the entries it looked at", func() {
+			matcher := utils.ContainLogEntry(utils.Level("FATAL"))
+			Expect(matcher.Match(entries)).To(BeFalse())
+			Expect(matcher.FailureMessage(entries)).To(ContainSubstring("Expected 2 log entries"))
+			Expect(matcher.FailureMessage(entries)).To(ContainSubstring("Task failed"))
+		})
+
+		It("fails on anything but a log", func() {
+			_, err := utils.ContainLogEntry().Match("a log")
+			Expect(err).To(MatchError(ContainSubstring("expects a LogSource")))
+		})
+	})
+})
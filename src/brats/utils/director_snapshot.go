@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// DirectorSnapshot is the director's API objects as they read back at one
+// point in time, decoded as generic JSON so that any field an upgrade
+// changes shows up in a diff.
+type DirectorSnapshot struct {
+	Deployments   any
+	Releases      any
+	Stemcells     any
+	Configs       any
+	OrphanedDisks any
+	// PerDeployment holds, by deployment name, what only the deployment's
+	// own endpoints return.
+	PerDeployment map[string]DeploymentSnapshot
+}
+
+type DeploymentSnapshot struct {
+	Manifest  any
+	VMs       any
+	Variables any
+}
+
+type snapshotRead struct {
+	path  string
+	query url.Values
+	out   *any
+}
+
+// SnapshotDirector reads every object the snapshot covers through client.
+func SnapshotDirector(client *DirectorClient) (DirectorSnapshot, error) {
+	snapshot := DirectorSnapshot{PerDeployment: map[string]DeploymentSnapshot{}}
+
+	var deployments []struct {
+		Name string `json:"name"`
+	}
+	if err := client.Get("/deployments", nil, &deployments); err != nil {
+		return DirectorSnapshot{}, err
+	}
+
+	reads := []snapshotRead{
+		{path: "/deployments", out: &snapshot.Deployments},
+		{path: "/releases", out: &snapshot.Releases},
+		{path: "/stemcells", out: &snapshot.Stemcells},
+		{path: "/configs", query: url.Values{"latest": {"true"}}, out: &snapshot.Configs},
+		{path: "/orphan_disks", out: &snapshot.OrphanedDisks},
+	}
+
+	perDeployment := map[string]*DeploymentSnapshot{}
+	for _, deployment := range deployments {
+		d := &DeploymentSnapshot{}
+		base := "/deployments/" + url.PathEscape(deployment.Name)
+		reads = append(reads,
+			snapshotRead{path: base, out: &d.Manifest},
+			snapshotRead{path: base + "/vms", out: &d.VMs},
+			snapshotRead{path: base + "/variables", out: &d.Variables},
+		)
+		perDeployment[deployment.Name] = d
+	}
+
+	for _, read := range reads {
+		if err := client.Get(read.path, read.query, read.out); err != nil {
+			return DirectorSnapshot{}, fmt.Errorf("snapshotting %s: %w", read.path, err)
+		}
+	}
+
+	for name, d := range perDeployment {
+		snapshot.PerDeployment[name] = *d
+	}
+
+	return snapshot, nil
+}
+
+// DiffSnapshots reports how after differs from before, or "" if every
+// object reads back identically. Fields of JSON objects only after has are
+// ignored, so a newer director may add fields to its responses.
+func DiffSnapshots(before, after DirectorSnapshot) string {
+	return cmp.Diff(before, after, cmp.FilterPath(addedField, cmp.Ignore()))
+}
+
+func addedField(path cmp.Path) bool {
+	index, ok := path.Last().(cmp.MapIndex)
+	if !ok {
+		return false
+	}
+
+	if path.Index(-2).Type() != reflect.TypeOf(map[string]any{}) {
+		return false
+	}
+
+	before, after := index.Values()
+	return !before.IsValid() && after.IsValid()
+}
@@ -0,0 +1,98 @@
+package utils_test
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"brats/utils"
+)
+
+var _ = Describe("DirectorSnapshot", func() {
+	var (
+		responses map[string]string
+		client    *utils.DirectorClient
+	)
+
+	BeforeEach(func() {
+		responses = map[string]string{
+			"/deployments":                `[{"name": "fake", "cloud_config": "latest"}]`,
+			"/releases":                   `[{"name": "slow", "release_versions": [{"version": "1"}]}]`,
+			"/stemcells":                  `[]`,
+			"/configs":                    `[{"id": "1", "type": "cloud", "name": "default"}]`,
+			"/orphan_disks":               `[{"disk_cid": "disk-1", "deployment_name": "gone"}]`,
+			"/deployments/fake":           `{"manifest": "name: fake"}`,
+			"/deployments/fake/vms":       `[{"agent_id": "agent-1", "cid": "vm-1", "vm_created_at": "2024-01-01T00:00:00Z"}]`,
+			"/deployments/fake/variables": `[{"id": "7", "name": "/director/fake/password"}]`,
+		}
+
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			response, found := responses[r.URL.Path]
+			if !found {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(response)) //nolint:errcheck
+		}))
+		DeferCleanup(server.Close)
+
+		var err error
+		client, err = utils.NewDirectorClient(server.URL, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), nil)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	snapshot := func() utils.DirectorSnapshot {
+		s, err := utils.SnapshotDirector(client)
+		Expect(err).NotTo(HaveOccurred())
+		return s
+	}
+
+	It("reads the director-wide objects and each deployment's own", func() {
+		s := snapshot()
+		Expect(s.OrphanedDisks).To(ConsistOf(HaveKeyWithValue("disk_cid", "disk-1")))
+		Expect(s.PerDeployment).To(HaveKey("fake"))
+		Expect(s.PerDeployment["fake"].Manifest).To(HaveKeyWithValue("manifest", "name: fake"))
+		Expect(s.PerDeployment["fake"].VMs).To(ConsistOf(HaveKeyWithValue("cid", "vm-1")))
+		Expect(s.PerDeployment["fake"].Variables).To(ConsistOf(HaveKeyWithValue("id", "7")))
+	})
+
+	It("diffs nothing when every object reads back identically", func() {
+		Expect(utils.DiffSnapshots(snapshot(), snapshot())).To(BeEmpty())
+	})
+
+	It("reports changed and removed values", func() {
+		before := snapshot()
+		responses["/deployments/fake/vms"] = `[{"agent_id": "agent-1", "cid": "vm-2"}]`
+		responses["/orphan_disks"] = `[]`
+
+		diff := utils.DiffSnapshots(before, snapshot())
+		Expect(diff).To(ContainSubstring("vm-2"))
+		Expect(diff).To(ContainSubstring("vm_created_at"))
+		Expect(diff).To(ContainSubstring("disk-1"))
+	})
+
+	It("ignores fields only the newer director returns", func() {
+		before := snapshot()
+		responses["/deployments"] = `[{"name": "fake", "cloud_config": "latest", "teams": []}]`
+		Expect(utils.DiffSnapshots(before, snapshot())).To(BeEmpty())
+	})
+
+	It("reports deployments that appear", func() {
+		before := snapshot()
+		responses["/deployments"] = `[{"name": "fake", "cloud_config": "latest"}, {"name": "new"}]`
+		responses["/deployments/new"] = `{"manifest": "name: new"}`
+		responses["/deployments/new/vms"] = `[]`
+		responses["/deployments/new/variables"] = `[]`
+
+		Expect(utils.DiffSnapshots(before, snapshot())).To(ContainSubstring(`"new"`))
+	})
+
+	It("fails when an endpoint cannot be read", func() {
+		delete(responses, "/orphan_disks")
+		_, err := utils.SnapshotDirector(client)
+		Expect(err).To(MatchError(ContainSubstring("/orphan_disks")))
+	})
+})
@@ -0,0 +1,268 @@
+package utils
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	. "github.com/onsi/gomega" //nolint:staticcheck
+	"github.com/onsi/gomega/gexec"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// RecordsJSONPath is where the agent writes the DNS records the director
+	// syncs to every instance.
+	RecordsJSONPath = "/var/vcap/instance/dns/records.json"
+
+	// boshDNSAddress is where bosh-dns listens on every instance.
+	boshDNSAddress = "169.254.0.2:53"
+
+	dnsQueryTimeout = 10 * time.Second
+)
+
+// Records is records.json as the director writes it.
+type Records struct {
+	Version uint64 `json:"version"`
+	// Records are instance-specific names with their IPs, e.g.
+	// "<id>.provider.default.dns-with-templates.bosh".
+	Records     []Record            `json:"records"`
+	RecordKeys  []string            `json:"record_keys"`
+	RecordInfos [][]json.RawMessage `json:"record_infos"`
+	Aliases     map[string][]string `json:"aliases"`
+}
+
+type Record struct {
+	IP   string
+	Name string
+}
+
+func (r *Record) UnmarshalJSON(contents []byte) error {
+	var pair []string
+	if err := json.Unmarshal(contents, &pair); err != nil {
+		return err
+	}
+	if len(pair) != 2 {
+		return fmt.Errorf("expected an IP and a name, got %s", contents)
+	}
+	r.IP, r.Name = pair[0], pair[1]
+	return nil
+}
+
+// RecordInfo is a row of record_infos: one instance on one network.
+type RecordInfo struct {
+	ID            string   `json:"id"`
+	NumID         string   `json:"num_id"`
+	InstanceGroup string   `json:"instance_group"`
+	GroupIDs      []string `json:"group_ids"`
+	AZ            string   `json:"az"`
+	AZID          string   `json:"az_id"`
+	Network       string   `json:"network"`
+	NetworkID     string   `json:"network_id"`
+	Deployment    string   `json:"deployment"`
+	IP            string   `json:"ip"`
+	Domain        string   `json:"domain"`
+	AgentID       string   `json:"agent_id"`
+	InstanceIndex int      `json:"instance_index"`
+}
+
+func ParseRecords(contents []byte) (*Records, error) {
+	var records Records
+	if err := json.Unmarshal(contents, &records); err != nil {
+		return nil, fmt.Errorf("parsing records.json: %w", err)
+	}
+	return &records, nil
+}
+
+// Infos decodes record_infos by record_keys.
+func (r *Records) Infos() ([]RecordInfo, error) {
+	infos := make([]RecordInfo, len(r.RecordInfos))
+	for i, row := range r.RecordInfos {
+		if len(row) != len(r.RecordKeys) {
+			return nil, fmt.Errorf("record info %d has %d values for %d keys", i, len(row), len(r.RecordKeys))
+		}
+
+		fields := make(map[string]json.RawMessage, len(row))
+		for j, key := range r.RecordKeys {
+			fields[key] = row[j]
+		}
+		contents, err := json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(contents, &infos[i]); err != nil {
+			return nil, fmt.Errorf("parsing record info %d: %w", i, err)
+		}
+	}
+	return infos, nil
+}
+
+// IPs are the sorted IPs of the instances matching filter, as bosh-dns
+// answers a query for them.
+func (r *Records) IPs(filter func(RecordInfo) bool) ([]string, error) {
+	infos, err := r.Infos()
+	if err != nil {
+		return nil, err
+	}
+
+	ips := []string{}
+	for _, info := range infos {
+		if filter(info) {
+			ips = append(ips, info.IP)
+		}
+	}
+	sort.Strings(ips)
+	return ips, nil
+}
+
+// Name is the instance-specific name of the instance on its network.
+func (i RecordInfo) Name() string {
+	return strings.Join([]string{i.ID, i.InstanceGroup, i.Network, i.Deployment, i.Domain}, ".")
+}
+
+// LongQuery is a query for the instance's instance group by name, e.g.
+// "q-s0.provider.default.dns-with-templates.bosh" for filters "s0".
+func (i RecordInfo) LongQuery(filters string) string {
+	return strings.Join([]string{"q-" + filters, i.InstanceGroup, i.Network, i.Deployment, i.Domain}, ".")
+}
+
+// ShortQuery is a query for the instance's instance group by its encoded
+// group ID, e.g. "q-s0.q-g1.bosh" for filters "s0".
+func (i RecordInfo) ShortQuery(filters string) (string, error) {
+	if len(i.GroupIDs) == 0 {
+		return "", fmt.Errorf("record info %s has no group IDs", i.ID)
+	}
+	return strings.Join([]string{"q-" + filters, "q-g" + i.GroupIDs[0], i.Domain}, "."), nil
+}
+
+// InstanceRecords reads records.json on every instance of a deployment,
+// keyed by instance.
+func InstanceRecords(deployment string) map[string]*Records {
+	records, err := readInstanceRecords(deployment)
+	Expect(err).NotTo(HaveOccurred())
+	return records
+}
+
+func readInstanceRecords(deployment string) (map[string]*Records, error) {
+	session := BoshQuiet("--json", "-d", deployment, "ssh", "--results", "-c", "sudo cat "+RecordsJSONPath)
+	Eventually(session, time.Minute).Should(gexec.Exit())
+	if session.ExitCode() != 0 {
+		return nil, fmt.Errorf("reading records.json of %s exited %d", deployment, session.ExitCode())
+	}
+
+	output, err := ParseCLIOutput(session.Out.Contents())
+	if err != nil {
+		return nil, err
+	}
+	if len(output.Tables) == 0 {
+		return nil, fmt.Errorf("reading records.json of %s printed no results", deployment)
+	}
+
+	records := map[string]*Records{}
+	for _, row := range output.Tables[0].Rows {
+		if records[row["instance"]], err = ParseRecords([]byte(row["stdout"])); err != nil {
+			return nil, fmt.Errorf("reading records.json on %s: %w", row["instance"], err)
+		}
+	}
+	return records, nil
+}
+
+// DNSResolver queries a bosh-dns server directly, over TCP, which is all
+// an ssh tunnel forwards.
+type DNSResolver struct {
+	address string
+}
+
+// NewDNSResolver sends every query to the DNS server at address, instead of
+// the ones in /etc/resolv.conf.
+func NewDNSResolver(address string) *DNSResolver {
+	return &DNSResolver{address: address}
+}
+
+// Lookup returns the sorted IPs of the A records a name resolves to.
+func (r *DNSResolver) Lookup(name string) ([]string, error) {
+	// A fully qualified name keeps the server from appending search
+	// domains.
+	question, err := dnsmessage.NewName(strings.TrimSuffix(name, ".") + ".")
+	if err != nil {
+		return nil, fmt.Errorf("looking up %s: %w", name, err)
+	}
+	id := uint16(rand.Uint32()) //nolint:gosec
+	query, err := (&dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: question, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}},
+	}).Pack()
+	if err != nil {
+		return nil, fmt.Errorf("looking up %s: %w", name, err)
+	}
+
+	response, err := r.exchange(query)
+	if err != nil {
+		return nil, fmt.Errorf("looking up %s: %w", name, err)
+	}
+	if response.ID != id {
+		return nil, fmt.Errorf("looking up %s: answer for query %d instead of %d", name, response.ID, id)
+	}
+	switch response.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, fmt.Errorf("looking up %s: no such host", name)
+	default:
+		return nil, fmt.Errorf("looking up %s: %s", name, response.RCode)
+	}
+
+	ips := []string{}
+	for _, answer := range response.Answers {
+		if a, ok := answer.Body.(*dnsmessage.AResource); ok {
+			ips = append(ips, net.IP(a.A[:]).String())
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("looking up %s: no such host", name)
+	}
+	sort.Strings(ips)
+	return ips, nil
+}
+
+// exchange sends a query and reads the answer, both framed with their
+// length as DNS over TCP is.
+func (r *DNSResolver) exchange(query []byte) (*dnsmessage.Message, error) {
+	conn, err := net.DialTimeout("tcp", r.address, dnsQueryTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close() //nolint:errcheck
+	if err := conn.SetDeadline(time.Now().Add(dnsQueryTimeout)); err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(query))), query...)); err != nil {
+		return nil, err
+	}
+	var length uint16
+	if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	contents := make([]byte, length)
+	if _, err := io.ReadFull(conn, contents); err != nil {
+		return nil, err
+	}
+
+	var response dnsmessage.Message
+	if err := response.Unpack(contents); err != nil {
+		return nil, fmt.Errorf("parsing the answer: %w", err)
+	}
+	return &response, nil
+}
+
+// StartDNSTunnel forwards a local port to bosh-dns on an instance of a
+// deployment of the inner director through `bosh ssh`, until the spec ends.
+func StartDNSTunnel(deployment, instance string) *DNSResolver {
+	return NewDNSResolver(startTunnel(Bosh, deployment, instance, boshDNSAddress))
+}
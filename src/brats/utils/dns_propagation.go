@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:staticcheck
+	. "github.com/onsi/gomega"    //nolint:staticcheck
+	"github.com/onsi/gomega/gmeasure"
+)
+
+const dnsPropagationPollInterval = 2 * time.Second
+
+// DNSConvergence tracks when each instance of a deployment first had each
+// records.json version, from a series of polls of all of them.
+type DNSConvergence struct {
+	start     time.Time
+	latest    map[string]uint64
+	firstSeen map[string]map[uint64]time.Time
+}
+
+// NewDNSConvergence measures from start, when the director pushed the
+// records.json version the change bumped.
+func NewDNSConvergence(start time.Time) *DNSConvergence {
+	return &DNSConvergence{
+		start:     start,
+		latest:    map[string]uint64{},
+		firstSeen: map[string]map[uint64]time.Time{},
+	}
+}
+
+// Observe records the versions the instances had at a poll. Instances that
+// were not polled keep their previous version.
+func (c *DNSConvergence) Observe(at time.Time, versions map[string]uint64) {
+	for instance, version := range versions {
+		c.latest[instance] = version
+		if c.firstSeen[instance] == nil {
+			c.firstSeen[instance] = map[uint64]time.Time{}
+		}
+		if _, seen := c.firstSeen[instance][version]; !seen {
+			c.firstSeen[instance][version] = at
+		}
+	}
+}
+
+// Converged is the version every instance has, once they all have the same
+// one and it is newer than baseline.
+func (c *DNSConvergence) Converged(baseline uint64) (uint64, bool) {
+	if len(c.latest) == 0 {
+		return 0, false
+	}
+
+	var converged uint64
+	for _, version := range c.latest {
+		if converged == 0 {
+			converged = version
+		}
+		if version != converged {
+			return 0, false
+		}
+	}
+	return converged, converged > baseline
+}
+
+// Durations is how long after the start each instance was first polled with
+// version, so each is late by up to a poll interval. An instance seen with
+// version before the start, e.g. because the start came from the director's
+// clock, counts as converging at the start.
+func (c *DNSConvergence) Durations(version uint64) map[string]time.Duration {
+	durations := map[string]time.Duration{}
+	for instance, seen := range c.firstSeen {
+		at, found := seen[version]
+		if !found {
+			continue
+		}
+		durations[instance] = max(at.Sub(c.start), 0)
+	}
+	return durations
+}
+
+// Versions are the latest versions observed, for failure messages.
+func (c *DNSConvergence) Versions() map[string]uint64 {
+	versions := make(map[string]uint64, len(c.latest))
+	for instance, version := range c.latest {
+		versions[instance] = version
+	}
+	return versions
+}
+
+// LatestDNSVersion is the newest records.json version on any instance of a
+// deployment.
+func LatestDNSVersion(deployment string) uint64 {
+	var latest uint64
+	for _, records := range InstanceRecords(deployment) {
+		latest = max(latest, records.Version)
+	}
+	return latest
+}
+
+// MeasureDNSConvergence polls records.json on every instance of a deployment
+// until all of them have the same version, newer than baseline, and records
+// how long each instance took after start in experiment under name. It
+// returns the version they converged on. A single `bosh ssh` reads all the
+// instances in parallel, so the durations are accurate to the time a poll
+// takes.
+func MeasureDNSConvergence(experiment *gmeasure.Experiment, name, deployment string, baseline uint64, start time.Time, timeout time.Duration) (uint64, map[string]time.Duration) {
+	convergence := NewDNSConvergence(start)
+	var version uint64
+	Eventually(func() error {
+		records, err := readInstanceRecords(deployment)
+		if err != nil {
+			return err
+		}
+
+		versions := make(map[string]uint64, len(records))
+		for instance, instanceRecords := range records {
+			versions[instance] = instanceRecords.Version
+		}
+		convergence.Observe(time.Now(), versions)
+
+		var converged bool
+		if version, converged = convergence.Converged(baseline); !converged {
+			return fmt.Errorf("records.json versions have not converged past %d: %v", baseline, convergence.Versions())
+		}
+		return nil
+	}, timeout, dnsPropagationPollInterval).Should(Succeed(), "%s: DNS records did not propagate", name)
+
+	durations := convergence.Durations(version)
+	instances := make([]string, 0, len(durations))
+	for instance := range durations {
+		instances = append(instances, instance)
+	}
+	sort.Strings(instances)
+	for _, instance := range instances {
+		experiment.RecordDuration(name, durations[instance], gmeasure.Annotation(instance))
+	}
+	GinkgoWriter.Printf("%s: records.json version %d converged on %d instances\n", name, version, len(durations))
+
+	return version, durations
+}
@@ -0,0 +1,77 @@
+package utils_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"brats/utils"
+)
+
+var _ = Describe("DNSConvergence", func() {
+	start := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	var convergence *utils.DNSConvergence
+
+	BeforeEach(func() {
+		convergence = utils.NewDNSConvergence(start)
+	})
+
+	It("has not converged before any poll", func() {
+		_, converged := convergence.Converged(0)
+		Expect(converged).To(BeFalse())
+	})
+
+	It("has not converged while instances have different versions", func() {
+		convergence.Observe(start.Add(time.Second), map[string]uint64{"provider/a": 8, "provider/b": 7})
+
+		_, converged := convergence.Converged(7)
+		Expect(converged).To(BeFalse())
+	})
+
+	It("has not converged on a version that is not newer than the baseline", func() {
+		convergence.Observe(start.Add(time.Second), map[string]uint64{"provider/a": 7, "provider/b": 7})
+
+		_, converged := convergence.Converged(7)
+		Expect(converged).To(BeFalse())
+	})
+
+	It("measures when each instance first had the converged version", func() {
+		convergence.Observe(start.Add(2*time.Second), map[string]uint64{"provider/a": 7, "provider/b": 8})
+		convergence.Observe(start.Add(4*time.Second), map[string]uint64{"provider/a": 8, "provider/b": 8})
+		convergence.Observe(start.Add(6*time.Second), map[string]uint64{"provider/a": 8, "provider/b": 8})
+
+		version, converged := convergence.Converged(7)
+		Expect(converged).To(BeTrue())
+		Expect(version).To(Equal(uint64(8)))
+		Expect(convergence.Durations(version)).To(Equal(map[string]time.Duration{
+			"provider/a": 4 * time.Second,
+			"provider/b": 2 * time.Second,
+		}))
+	})
+
+	It("keeps the versions of instances a poll missed", func() {
+		convergence.Observe(start.Add(2*time.Second), map[string]uint64{"provider/a": 7, "provider/b": 7})
+		convergence.Observe(start.Add(4*time.Second), map[string]uint64{"provider/b": 8})
+
+		_, converged := convergence.Converged(7)
+		Expect(converged).To(BeFalse())
+		Expect(convergence.Versions()).To(Equal(map[string]uint64{"provider/a": 7, "provider/b": 8}))
+	})
+
+	It("measures instances that appeared during the change", func() {
+		convergence.Observe(start.Add(2*time.Second), map[string]uint64{"provider/a": 8})
+		convergence.Observe(start.Add(4*time.Second), map[string]uint64{"provider/a": 8, "provider/c": 8})
+
+		version, converged := convergence.Converged(7)
+		Expect(converged).To(BeTrue())
+		Expect(convergence.Durations(version)).To(HaveKeyWithValue("provider/c", 4*time.Second))
+	})
+
+	It("does not measure negative durations", func() {
+		convergence.Observe(start.Add(-time.Second), map[string]uint64{"provider/a": 8})
+
+		Expect(convergence.Durations(8)).To(HaveKeyWithValue("provider/a", time.Duration(0)))
+	})
+})
@@ -0,0 +1,203 @@
+package utils_test
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"brats/utils"
+)
+
+const recordsJSON = `{
+	"records": [
+		["10.245.0.3", "0c1bd4f1-6f4e-4b5e-9b5a-1d2a3b4c5d6e.provider.default.dns-with-templates.bosh"],
+		["10.245.0.4", "7e8f9a0b-1c2d-4e3f-8a9b-0c1d2e3f4a5b.provider.default.dns-with-templates.bosh"],
+		["10.245.0.5", "a1b2c3d4-e5f6-4a7b-8c9d-0e1f2a3b4c5d.test-agent.default.dns-with-templates.bosh"]
+	],
+	"version": 7,
+	"record_keys": ["id", "num_id", "instance_group", "group_ids", "az", "az_id", "network", "network_id", "deployment", "ip", "domain", "agent_id", "instance_index"],
+	"record_infos": [
+		["0c1bd4f1-6f4e-4b5e-9b5a-1d2a3b4c5d6e", "2", "provider", ["2"], "z1", "1", "default", "1", "dns-with-templates", "10.245.0.3", "bosh", "agent-1", 0],
+		["7e8f9a0b-1c2d-4e3f-8a9b-0c1d2e3f4a5b", "3", "provider", ["2"], "z2", "2", "default", "1", "dns-with-templates", "10.245.0.4", "bosh", "agent-2", 1],
+		["a1b2c3d4-e5f6-4a7b-8c9d-0e1f2a3b4c5d", "1", "test-agent", ["1"], null, null, "default", "1", "dns-with-templates", "10.245.0.5", "bosh", "agent-3", 0]
+	],
+	"aliases": {"provider.internal": ["q-s0.provider.default.dns-with-templates.bosh"]}
+}`
+
+var _ = Describe("DNS", func() {
+	Describe("Records", func() {
+		var records *utils.Records
+
+		BeforeEach(func() {
+			var err error
+			records, err = utils.ParseRecords([]byte(recordsJSON))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("parses records.json", func() {
+			Expect(records.Version).To(Equal(uint64(7)))
+			Expect(records.Records).To(ContainElement(utils.Record{IP: "10.245.0.3", Name: "0c1bd4f1-6f4e-4b5e-9b5a-1d2a3b4c5d6e.provider.default.dns-with-templates.bosh"}))
+			Expect(records.Aliases).To(HaveKeyWithValue("provider.internal", []string{"q-s0.provider.default.dns-with-templates.bosh"}))
+		})
+
+		It("decodes record infos by their keys", func() {
+			infos, err := records.Infos()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(infos).To(HaveLen(3))
+			Expect(infos[1]).To(Equal(utils.RecordInfo{
+				ID:            "7e8f9a0b-1c2d-4e3f-8a9b-0c1d2e3f4a5b",
+				NumID:         "3",
+				InstanceGroup: "provider",
+				GroupIDs:      []string{"2"},
+				AZ:            "z2",
+				AZID:          "2",
+				Network:       "default",
+				NetworkID:     "1",
+				Deployment:    "dns-with-templates",
+				IP:            "10.245.0.4",
+				Domain:        "bosh",
+				AgentID:       "agent-2",
+				InstanceIndex: 1,
+			}))
+			Expect(infos[2].AZ).To(BeEmpty())
+		})
+
+		It("does not depend on the order of the record keys", func() {
+			records.RecordKeys[0], records.RecordKeys[9] = records.RecordKeys[9], records.RecordKeys[0]
+			for _, row := range records.RecordInfos {
+				row[0], row[9] = row[9], row[0]
+			}
+
+			infos, err := records.Infos()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(infos[0].ID).To(Equal("0c1bd4f1-6f4e-4b5e-9b5a-1d2a3b4c5d6e"))
+			Expect(infos[0].IP).To(Equal("10.245.0.3"))
+		})
+
+		It("fails on record infos that do not match the keys", func() {
+			records.RecordInfos[0] = records.RecordInfos[0][1:]
+			_, err := records.Infos()
+			Expect(err).To(MatchError(ContainSubstring("record info 0 has 12 values for 13 keys")))
+		})
+
+		It("selects the IPs of matching instances", func() {
+			Expect(records.IPs(func(info utils.RecordInfo) bool { return info.InstanceGroup == "provider" })).To(Equal([]string{"10.245.0.3", "10.245.0.4"}))
+			Expect(records.IPs(func(info utils.RecordInfo) bool { return false })).To(BeEmpty())
+		})
+
+		It("builds names and queries for an instance", func() {
+			infos, err := records.Infos()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(infos[0].Name()).To(Equal("0c1bd4f1-6f4e-4b5e-9b5a-1d2a3b4c5d6e.provider.default.dns-with-templates.bosh"))
+			Expect(infos[0].LongQuery("s0")).To(Equal("q-s0.provider.default.dns-with-templates.bosh"))
+			Expect(infos[0].ShortQuery("m2n1s0")).To(Equal("q-m2n1s0.q-g2.bosh"))
+		})
+
+		It("has no short query for an instance without group IDs", func() {
+			_, err := utils.RecordInfo{ID: "0c1bd4f1", Domain: "bosh"}.ShortQuery("s0")
+			Expect(err).To(MatchError("record info 0c1bd4f1 has no group IDs"))
+		})
+
+		It("fails on malformed records", func() {
+			_, err := utils.ParseRecords([]byte(`{"records": [["10.245.0.3"]]}`))
+			Expect(err).To(MatchError(ContainSubstring("expected an IP and a name")))
+		})
+	})
+
+	Describe("DNSResolver", func() {
+		var address string
+
+		BeforeEach(func() {
+			address = startDNSServer(map[string][]string{
+				"q-s0.q-g2.bosh.": {"10.245.0.4", "10.245.0.3"},
+			})
+		})
+
+		It("resolves names over TCP against the given server", func() {
+			resolver := utils.NewDNSResolver(address)
+			Expect(resolver.Lookup("q-s0.q-g2.bosh")).To(Equal([]string{"10.245.0.3", "10.245.0.4"}))
+			Expect(resolver.Lookup("q-s0.q-g2.bosh.")).To(Equal([]string{"10.245.0.3", "10.245.0.4"}))
+		})
+
+		It("fails for unknown names", func() {
+			_, err := utils.NewDNSResolver(address).Lookup("q-s0.q-g9.bosh")
+			Expect(err).To(MatchError(ContainSubstring("no such host")))
+		})
+	})
+})
+
+// startDNSServer answers A queries over TCP from answers, and with
+// NXDOMAIN for any other name.
+func startDNSServer(answers map[string][]string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(listener.Close)
+
+	go func() {
+		defer GinkgoRecover()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveDNS(conn, answers)
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func serveDNS(conn net.Conn, answers map[string][]string) {
+	defer conn.Close() //nolint:errcheck
+
+	for {
+		var length uint16
+		if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+			return
+		}
+		query := make([]byte, length)
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+
+		var request dnsmessage.Message
+		if err := request.Unpack(query); err != nil || len(request.Questions) != 1 {
+			return
+		}
+		question := request.Questions[0]
+
+		response := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: request.ID, Response: true, Authoritative: true},
+			Questions: request.Questions,
+		}
+		ips, found := answers[strings.ToLower(question.Name.String())]
+		if !found {
+			response.RCode = dnsmessage.RCodeNameError
+		}
+		if question.Type == dnsmessage.TypeA {
+			for _, ip := range ips {
+				response.Answers = append(response.Answers, dnsmessage.Resource{
+					Header: dnsmessage.ResourceHeader{Name: question.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 0},
+					Body:   &dnsmessage.AResource{A: [4]byte(net.ParseIP(ip).To4())},
+				})
+			}
+		}
+
+		packed, err := response.Pack()
+		if err != nil {
+			return
+		}
+		if err := binary.Write(conn, binary.BigEndian, uint16(len(packed))); err != nil {
+			return
+		}
+		if _, err := conn.Write(packed); err != nil {
+			return
+		}
+	}
+}
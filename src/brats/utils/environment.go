@@ -0,0 +1,313 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	. "github.com/onsi/gomega" //nolint:staticcheck
+	"go.yaml.in/yaml/v3"
+)
+
+// EnvironmentFileEnvVar points at a YAML or JSON file that describes the
+// environment brats runs in. Environment variables override its fields.
+const EnvironmentFileEnvVar = "BRATS_ENV_FILE"
+
+// EnvironmentField is the path of a field in the environment file, e.g.
+// "releases.dns".
+type EnvironmentField string
+
+// The fields that only some suites need; they pass them to Bootstrap.
+const (
+	CandidateStemcellPath   EnvironmentField = "stemcells.candidate"
+	BOSHReleasePath         EnvironmentField = "releases.bosh"
+	DNSReleasePath          EnvironmentField = "releases.dns"
+	BOSHDirectorTarballPath EnvironmentField = "releases.bosh_director_tarball"
+	CFDeploymentPath        EnvironmentField = "releases.cf_deployment"
+)
+
+// bootstrapEnvironment are the fields every suite needs.
+var bootstrapEnvironment = []EnvironmentField{
+	"outer_director.environment",
+	"paths.bosh_binary",
+	"paths.bosh_deployment",
+	"stemcells.os",
+	"releases.bosh_director",
+}
+
+// Environment is what brats runs against: the outer director, and the
+// paths of what it deploys there.
+type Environment struct {
+	OuterDirector OuterDirectorEnvironment         `yaml:"outer_director"`
+	Paths         PathsEnvironment                 `yaml:"paths"`
+	Stemcells     StemcellsEnvironment             `yaml:"stemcells"`
+	Releases      ReleasesEnvironment              `yaml:"releases"`
+	Timeouts      TimeoutsEnvironment              `yaml:"timeouts"`
+	ExternalDBs   map[string]ExternalDBEnvironment `yaml:"external_dbs"`
+}
+
+// OuterDirectorEnvironment is how the bosh CLI and the scripts that start
+// inner directors reach the outer director and its docker CPI.
+type OuterDirectorEnvironment struct {
+	Environment  string `yaml:"environment"`
+	Client       string `yaml:"client"`
+	ClientSecret string `yaml:"client_secret"`
+	CACert       string `yaml:"ca_cert"`
+	DockerHost   string `yaml:"docker_host"`
+	DockerCerts  string `yaml:"docker_certs"`
+}
+
+type PathsEnvironment struct {
+	BoshBinary     string `yaml:"bosh_binary"`
+	BoshDeployment string `yaml:"bosh_deployment"`
+	Artifacts      string `yaml:"artifacts"`
+}
+
+type StemcellsEnvironment struct {
+	OS string `yaml:"os"`
+	// DirectorOS is the OS of the stemcell inner directors run on.
+	DirectorOS string `yaml:"director_os"`
+	Candidate  string `yaml:"candidate"`
+}
+
+type ReleasesEnvironment struct {
+	// BoshDirector is the source of the director release under test.
+	BoshDirector        string `yaml:"bosh_director"`
+	BoshDirectorTarball string `yaml:"bosh_director_tarball"`
+	Bosh                string `yaml:"bosh"`
+	DNS                 string `yaml:"dns"`
+	CFDeployment        string `yaml:"cf_deployment"`
+}
+
+// TimeoutsEnvironment are durations like "45m".
+type TimeoutsEnvironment struct {
+	StartInnerBosh    string `yaml:"start_inner_bosh"`
+	DNSPropagationSLA string `yaml:"dns_propagation_sla"`
+}
+
+// ExternalDBEnvironment is a database server the director can use instead
+// of its own, keyed by IaaS and type, e.g. "gcp_mysql".
+type ExternalDBEnvironment struct {
+	Host              string `yaml:"host"`
+	User              string `yaml:"user"`
+	Password          string `yaml:"password"`
+	CA                string `yaml:"ca"`
+	ClientCertificate string `yaml:"client_certificate"`
+	ClientPrivateKey  string `yaml:"client_private_key"`
+}
+
+type fieldKind int
+
+const (
+	stringField fieldKind = iota
+	pathField
+	durationField
+)
+
+type environmentField struct {
+	name         EnvironmentField
+	envVar       string
+	value        *string
+	kind         fieldKind
+	defaultValue string
+}
+
+func (e *Environment) fields() []environmentField {
+	return []environmentField{
+		{name: "outer_director.environment", envVar: "BOSH_ENVIRONMENT", value: &e.OuterDirector.Environment},
+		{name: "outer_director.client", envVar: "BOSH_CLIENT", value: &e.OuterDirector.Client},
+		{name: "outer_director.client_secret", envVar: "BOSH_CLIENT_SECRET", value: &e.OuterDirector.ClientSecret},
+		{name: "outer_director.ca_cert", envVar: "BOSH_CA_CERT", value: &e.OuterDirector.CACert},
+		{name: "outer_director.docker_host", envVar: "DOCKER_HOST", value: &e.OuterDirector.DockerHost},
+		{name: "outer_director.docker_certs", envVar: "DOCKER_CERTS", value: &e.OuterDirector.DockerCerts},
+
+		{name: "paths.bosh_binary", envVar: "BOSH_BINARY_PATH", value: &e.Paths.BoshBinary, kind: pathField},
+		{name: "paths.bosh_deployment", envVar: "BOSH_DEPLOYMENT_PATH", value: &e.Paths.BoshDeployment, kind: pathField},
+		{name: "paths.artifacts", envVar: artifactsDirEnvVar, value: &e.Paths.Artifacts, defaultValue: defaultArtifactsDir},
+
+		{name: "stemcells.os", envVar: "STEMCELL_OS", value: &e.Stemcells.OS},
+		{name: "stemcells.director_os", envVar: "DIRECTOR_STEMCELL_OS", value: &e.Stemcells.DirectorOS},
+		{name: CandidateStemcellPath, envVar: "CANDIDATE_STEMCELL_TARBALL_PATH", value: &e.Stemcells.Candidate, kind: pathField},
+
+		{name: "releases.bosh_director", envVar: "BOSH_DIRECTOR_RELEASE_PATH", value: &e.Releases.BoshDirector, kind: pathField},
+		{name: BOSHDirectorTarballPath, envVar: "BOSH_DIRECTOR_TARBALL_PATH", value: &e.Releases.BoshDirectorTarball, kind: pathField},
+		{name: BOSHReleasePath, envVar: "BOSH_RELEASE", value: &e.Releases.Bosh, kind: pathField},
+		{name: DNSReleasePath, envVar: "DNS_RELEASE_PATH", value: &e.Releases.DNS, kind: pathField},
+		{name: CFDeploymentPath, envVar: "CF_DEPLOYMENT_RELEASE_PATH", value: &e.Releases.CFDeployment, kind: pathField},
+
+		{name: "timeouts.start_inner_bosh", envVar: "START_INNER_BOSH_TIMEOUT", value: &e.Timeouts.StartInnerBosh, kind: durationField, defaultValue: "45m"},
+		{name: "timeouts.dns_propagation_sla", envVar: "DNS_PROPAGATION_SLA", value: &e.Timeouts.DNSPropagationSLA, kind: durationField, defaultValue: "1m"},
+	}
+}
+
+// EnvironmentError lists everything wrong with an environment.
+type EnvironmentError struct {
+	Problems []string
+}
+
+func (e *EnvironmentError) Error() string {
+	return fmt.Sprintf("the brats environment is invalid, set %s or the environment variables:\n  - %s",
+		EnvironmentFileEnvVar, strings.Join(e.Problems, "\n  - "))
+}
+
+// LoadEnvironment reads the environment file BRATS_ENV_FILE points at, if
+// any, and overrides its fields with the environment variables that are
+// set. Fields that are set nowhere get their defaults.
+func LoadEnvironment() (*Environment, error) {
+	env := &Environment{}
+	if path := os.Getenv(EnvironmentFileEnvVar); path != "" {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := ParseEnvironment(contents, env); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+	}
+
+	for _, field := range env.fields() {
+		if value := os.Getenv(field.envVar); value != "" {
+			*field.value = value
+		}
+		if *field.value == "" {
+			*field.value = field.defaultValue
+		}
+	}
+	return env, nil
+}
+
+// ParseEnvironment parses an environment file into env. JSON is YAML too.
+// Fields it does not know are an error, so that typos do not go unnoticed.
+func ParseEnvironment(contents []byte, env *Environment) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	decoder.KnownFields(true)
+	err := decoder.Decode(env)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
+// Validate checks every field that is set, e.g. that paths exist and
+// durations parse, and that the required ones are set. It reports every
+// problem at once.
+func (e *Environment) Validate(required ...EnvironmentField) error {
+	isRequired := map[EnvironmentField]bool{}
+	for _, name := range required {
+		isRequired[name] = true
+	}
+
+	var problems []string
+	for _, field := range e.fields() {
+		value := *field.value
+		if value == "" {
+			if isRequired[field.name] {
+				problems = append(problems, fmt.Sprintf("%s (%s) is missing", field.name, field.envVar))
+			}
+			delete(isRequired, field.name)
+			continue
+		}
+		delete(isRequired, field.name)
+
+		switch field.kind {
+		case pathField:
+			if _, err := os.Stat(value); err != nil {
+				problems = append(problems, fmt.Sprintf("%s (%s) %q does not exist", field.name, field.envVar, value))
+			}
+		case durationField:
+			if duration, err := time.ParseDuration(value); err != nil || duration <= 0 {
+				problems = append(problems, fmt.Sprintf("%s (%s) %q is not a positive duration", field.name, field.envVar, value))
+			}
+		}
+	}
+	for name := range isRequired {
+		problems = append(problems, fmt.Sprintf("%s is not a field", name))
+	}
+
+	if len(problems) > 0 {
+		return &EnvironmentError{Problems: problems}
+	}
+	return nil
+}
+
+// ExportEnvironment loads and validates the environment, with the fields
+// every suite needs and those in required, and exports it.
+func ExportEnvironment(required ...EnvironmentField) (*Environment, error) {
+	env, err := LoadEnvironment()
+	if err != nil {
+		return nil, err
+	}
+	if err := env.Validate(append(bootstrapEnvironment, required...)...); err != nil {
+		return nil, err
+	}
+	return env, env.Export()
+}
+
+// Export sets the environment variables of the fields that are set, for
+// the bosh CLI and the scripts that start inner directors.
+func (e *Environment) Export() error {
+	for _, field := range e.fields() {
+		if *field.value == "" {
+			continue
+		}
+		if err := os.Setenv(field.envVar, *field.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Environment) StartInnerBoshTimeout() time.Duration {
+	return mustParseDuration(e.Timeouts.StartInnerBosh)
+}
+
+func (e *Environment) DNSPropagationSLA() time.Duration {
+	return mustParseDuration(e.Timeouts.DNSPropagationSLA)
+}
+
+func mustParseDuration(value string) time.Duration {
+	duration, err := time.ParseDuration(value)
+	Expect(err).NotTo(HaveOccurred())
+	return duration
+}
+
+// ExternalDB is the database server named e.g. "gcp_mysql", with the
+// fields the environment variables GCP_MYSQL_EXTERNAL_DB_HOST and so on
+// override. Host, user and password are required, and so are the client
+// certificate and key with mutual TLS.
+func (e *Environment) ExternalDB(name string, mutualTLS bool) (ExternalDBEnvironment, error) {
+	config := e.ExternalDBs[name]
+	prefix := strings.ToUpper(name) + "_EXTERNAL_DB_"
+	fields := []struct {
+		name     string
+		value    *string
+		required bool
+	}{
+		{"host", &config.Host, true},
+		{"user", &config.User, true},
+		{"password", &config.Password, true},
+		{"ca", &config.CA, false},
+		{"client_certificate", &config.ClientCertificate, mutualTLS},
+		{"client_private_key", &config.ClientPrivateKey, mutualTLS},
+	}
+
+	var problems []string
+	for _, field := range fields {
+		envVar := prefix + strings.ToUpper(field.name)
+		if value := os.Getenv(envVar); value != "" {
+			*field.value = value
+		}
+		if field.required && *field.value == "" {
+			problems = append(problems, fmt.Sprintf("external_dbs.%s.%s (%s) is missing", name, field.name, envVar))
+		}
+	}
+
+	if len(problems) > 0 {
+		return config, &EnvironmentError{Problems: problems}
+	}
+	return config, nil
+}
@@ -0,0 +1,182 @@
+package utils_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"brats/utils"
+)
+
+var _ = Describe("Environment", func() {
+	var dir string
+
+	// setenv clears the variables a field could be overridden with, so
+	// that the environment the tests run in does not leak into them.
+	setenv := func(values map[string]string) {
+		for _, name := range []string{
+			"BOSH_ENVIRONMENT", "BOSH_BINARY_PATH", "BOSH_DEPLOYMENT_PATH", "STEMCELL_OS",
+			"BOSH_DIRECTOR_RELEASE_PATH", "DNS_RELEASE_PATH", "START_INNER_BOSH_TIMEOUT",
+			"DNS_PROPAGATION_SLA", "BRATS_ARTIFACTS_DIR", "GCP_MYSQL_EXTERNAL_DB_HOST",
+			"GCP_MYSQL_EXTERNAL_DB_USER", "GCP_MYSQL_EXTERNAL_DB_PASSWORD",
+		} {
+			GinkgoT().Setenv(name, values[name])
+		}
+	}
+
+	writeFile := func(name, contents string) string {
+		path := filepath.Join(dir, name)
+		Expect(os.WriteFile(path, []byte(contents), 0644)).To(Succeed())
+		return path
+	}
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		setenv(nil)
+		GinkgoT().Setenv(utils.EnvironmentFileEnvVar, "")
+	})
+
+	Describe("LoadEnvironment", func() {
+		It("reads the environment file, overridden by environment variables", func() {
+			GinkgoT().Setenv(utils.EnvironmentFileEnvVar, writeFile("env.yml", `
+outer_director:
+  environment: 10.245.0.3
+paths:
+  bosh_binary: /usr/local/bin/bosh
+stemcells:
+  os: ubuntu-noble
+timeouts:
+  start_inner_bosh: 30m
+external_dbs:
+  gcp_mysql:
+    host: mysql.example.com
+`))
+			setenv(map[string]string{"STEMCELL_OS": "ubuntu-jammy"})
+
+			env, err := utils.LoadEnvironment()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(env.OuterDirector.Environment).To(Equal("10.245.0.3"))
+			Expect(env.Paths.BoshBinary).To(Equal("/usr/local/bin/bosh"))
+			Expect(env.Stemcells.OS).To(Equal("ubuntu-jammy"))
+			Expect(env.StartInnerBoshTimeout()).To(Equal(30 * time.Minute))
+			Expect(env.ExternalDBs).To(HaveKeyWithValue("gcp_mysql", HaveField("Host", "mysql.example.com")))
+		})
+
+		It("reads JSON", func() {
+			GinkgoT().Setenv(utils.EnvironmentFileEnvVar, writeFile("env.json", `{"releases": {"dns": "/releases/dns.tgz"}}`))
+
+			env, err := utils.LoadEnvironment()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(env.Releases.DNS).To(Equal("/releases/dns.tgz"))
+		})
+
+		It("defaults what is set nowhere", func() {
+			env, err := utils.LoadEnvironment()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(env.StartInnerBoshTimeout()).To(Equal(45 * time.Minute))
+			Expect(env.DNSPropagationSLA()).To(Equal(time.Minute))
+			Expect(env.Paths.Artifacts).To(Equal("/tmp/brats-artifacts"))
+		})
+
+		It("rejects fields it does not know", func() {
+			GinkgoT().Setenv(utils.EnvironmentFileEnvVar, writeFile("env.yml", "stemcells:\n  candiate: /stemcell.tgz\n"))
+
+			_, err := utils.LoadEnvironment()
+			Expect(err).To(MatchError(ContainSubstring("field candiate not found")))
+		})
+
+		It("fails on a file that does not exist", func() {
+			GinkgoT().Setenv(utils.EnvironmentFileEnvVar, filepath.Join(dir, "missing.yml"))
+
+			_, err := utils.LoadEnvironment()
+			Expect(err).To(MatchError(os.ErrNotExist))
+		})
+	})
+
+	Describe("Validate", func() {
+		It("reports every problem at once", func() {
+			setenv(map[string]string{
+				"BOSH_BINARY_PATH":         filepath.Join(dir, "no-bosh"),
+				"BOSH_DEPLOYMENT_PATH":     dir,
+				"START_INNER_BOSH_TIMEOUT": "forever",
+				"DNS_PROPAGATION_SLA":      "-1m",
+			})
+
+			env, err := utils.LoadEnvironment()
+			Expect(err).NotTo(HaveOccurred())
+
+			err = env.Validate("outer_director.environment", "paths.bosh_binary", "paths.bosh_deployment", utils.DNSReleasePath)
+			var envErr *utils.EnvironmentError
+			Expect(errors.As(err, &envErr)).To(BeTrue())
+			Expect(envErr.Problems).To(ConsistOf(
+				"outer_director.environment (BOSH_ENVIRONMENT) is missing",
+				ContainSubstring(`paths.bosh_binary (BOSH_BINARY_PATH) "`+filepath.Join(dir, "no-bosh")+`" does not exist`),
+				"releases.dns (DNS_RELEASE_PATH) is missing",
+				`timeouts.start_inner_bosh (START_INNER_BOSH_TIMEOUT) "forever" is not a positive duration`,
+				`timeouts.dns_propagation_sla (DNS_PROPAGATION_SLA) "-1m" is not a positive duration`,
+			))
+			Expect(err).To(MatchError(ContainSubstring("  - releases.dns (DNS_RELEASE_PATH) is missing")))
+		})
+
+		It("checks fields that are set even if they are not required", func() {
+			setenv(map[string]string{"DNS_RELEASE_PATH": filepath.Join(dir, "dns.tgz")})
+
+			env, err := utils.LoadEnvironment()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(env.Validate()).To(MatchError(ContainSubstring("releases.dns (DNS_RELEASE_PATH)")))
+
+			writeFile("dns.tgz", "")
+			Expect(env.Validate()).To(Succeed())
+		})
+
+		It("rejects fields that do not exist", func() {
+			env, err := utils.LoadEnvironment()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(env.Validate("releases.nope")).To(MatchError(ContainSubstring("releases.nope is not a field")))
+		})
+	})
+
+	Describe("ExternalDB", func() {
+		It("overrides the file with the database's environment variables", func() {
+			GinkgoT().Setenv(utils.EnvironmentFileEnvVar, writeFile("env.yml", `
+external_dbs:
+  gcp_mysql:
+    host: mysql.example.com
+    user: from-file
+    password: secret
+`))
+			setenv(map[string]string{"GCP_MYSQL_EXTERNAL_DB_USER": "from-env"})
+
+			env, err := utils.LoadEnvironment()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(env.ExternalDB("gcp_mysql", false)).To(Equal(utils.ExternalDBEnvironment{
+				Host:     "mysql.example.com",
+				User:     "from-env",
+				Password: "secret",
+			}))
+		})
+
+		It("reports everything that is missing", func() {
+			setenv(map[string]string{"GCP_MYSQL_EXTERNAL_DB_HOST": "mysql.example.com"})
+			GinkgoT().Setenv("GCP_MYSQL_EXTERNAL_DB_CLIENT_CERTIFICATE", "")
+			GinkgoT().Setenv("GCP_MYSQL_EXTERNAL_DB_CLIENT_PRIVATE_KEY", "")
+
+			env, err := utils.LoadEnvironment()
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = env.ExternalDB("gcp_mysql", true)
+			var envErr *utils.EnvironmentError
+			Expect(errors.As(err, &envErr)).To(BeTrue())
+			Expect(envErr.Problems).To(Equal([]string{
+				"external_dbs.gcp_mysql.user (GCP_MYSQL_EXTERNAL_DB_USER) is missing",
+				"external_dbs.gcp_mysql.password (GCP_MYSQL_EXTERNAL_DB_PASSWORD) is missing",
+				"external_dbs.gcp_mysql.client_certificate (GCP_MYSQL_EXTERNAL_DB_CLIENT_CERTIFICATE) is missing",
+				"external_dbs.gcp_mysql.client_private_key (GCP_MYSQL_EXTERNAL_DB_CLIENT_PRIVATE_KEY) is missing",
+			}))
+		})
+	})
+})
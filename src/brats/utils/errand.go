@@ -0,0 +1,209 @@
+package utils
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:staticcheck
+	. "github.com/onsi/gomega"    //nolint:staticcheck
+	"github.com/onsi/gomega/gexec"
+)
+
+const defaultErrandTimeout = 10 * time.Minute
+
+var downloadedResourcePattern = regexp.MustCompile(`Downloading resource '[^']+' to '([^']+)'`)
+
+type ErrandOptions struct {
+	// Instances limits the errand to the given instance group or
+	// instance group/ID slugs (--instance).
+	Instances []string
+
+	KeepAlive   bool
+	WhenChanged bool
+
+	// DownloadLogs fetches the errand logs into LogsDir, or into a
+	// temporary directory when LogsDir is empty.
+	DownloadLogs bool
+	LogsDir      string
+
+	Timeout time.Duration
+}
+
+// ErrandRun is the outcome of a single `bosh run-errand` invocation. A
+// failing errand makes the CLI exit non-zero while still reporting results.
+type ErrandRun struct {
+	ExitCode int
+	Results  []ErrandResult
+	Lines    []string
+}
+
+type ErrandResult struct {
+	Instance    string
+	ExitCode    int
+	Stdout      string
+	Stderr      string
+	LogsTarball string
+}
+
+func (r ErrandResult) InstanceGroup() string {
+	group, _, _ := strings.Cut(r.Instance, "/")
+	return group
+}
+
+func (r ErrandResult) InstanceID() string {
+	_, id, _ := strings.Cut(r.Instance, "/")
+	return id
+}
+
+// Ran reports whether the errand was executed on any instance. Errands run
+// with --when-changed are skipped when nothing changed since the last run.
+func (r *ErrandRun) Ran() bool {
+	return len(r.Results) > 0
+}
+
+func (r *ErrandRun) ResultFor(instance string) (ErrandResult, bool) {
+	for _, result := range r.Results {
+		if result.Instance == instance || result.InstanceGroup() == instance {
+			return result, true
+		}
+	}
+
+	return ErrandResult{}, false
+}
+
+func (o ErrandOptions) Args(deployment, name string) []string {
+	args := []string{"-n", "-d", deployment, "run-errand", name, "--json"}
+
+	for _, instance := range o.Instances {
+		args = append(args, "--instance", instance)
+	}
+	if o.KeepAlive {
+		args = append(args, "--keep-alive")
+	}
+	if o.WhenChanged {
+		args = append(args, "--when-changed")
+	}
+	if o.DownloadLogs {
+		args = append(args, "--download-logs")
+		if o.LogsDir != "" {
+			args = append(args, "--logs-dir", o.LogsDir)
+		}
+	}
+
+	return args
+}
+
+func RunErrand(deployment, name string, opts ErrandOptions) *ErrandRun {
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = defaultErrandTimeout
+	}
+
+	if opts.DownloadLogs && opts.LogsDir == "" {
+		opts.LogsDir = GinkgoT().TempDir()
+	}
+
+	session := Bosh(opts.Args(deployment, name)...)
+	Eventually(session, timeout).Should(gexec.Exit())
+
+	run, err := ParseErrandRun(session.Out.Contents())
+	Expect(err).NotTo(HaveOccurred())
+	run.ExitCode = session.ExitCode()
+
+	return run
+}
+
+func ParseErrandRun(contents []byte) (*ErrandRun, error) {
+	output, err := ParseCLIOutput(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &ErrandRun{Lines: output.Lines}
+
+	for _, table := range output.Tables {
+		for _, row := range table.Rows {
+			exitCode, err := strconv.Atoi(row["exit_code"])
+			if err != nil {
+				return nil, fmt.Errorf("parsing exit code of errand on '%s': %w", row["instance"], err)
+			}
+
+			run.Results = append(run.Results, ErrandResult{
+				Instance: row["instance"],
+				ExitCode: exitCode,
+				Stdout:   row["stdout"],
+				Stderr:   row["stderr"],
+			})
+		}
+	}
+
+	var tarballs []string
+	for _, line := range output.Lines {
+		if match := downloadedResourcePattern.FindStringSubmatch(line); match != nil {
+			tarballs = append(tarballs, match[1])
+		}
+	}
+
+	for i := range run.Results {
+		for _, tarball := range tarballs {
+			id := run.Results[i].InstanceID()
+			if id != "" && strings.Contains(filepath.Base(tarball), id) {
+				run.Results[i].LogsTarball = tarball
+			}
+		}
+	}
+	if len(run.Results) == 1 && len(tarballs) == 1 && run.Results[0].LogsTarball == "" {
+		run.Results[0].LogsTarball = tarballs[0]
+	}
+
+	return run, nil
+}
+
+// ReadLogsTarball returns the regular files in a downloaded logs tarball,
+// keyed by their path inside the archive without the leading "./".
+func ReadLogsTarball(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint:errcheck
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading gzip stream of '%s': %w", path, err)
+	}
+	defer gz.Close() //nolint:errcheck
+
+	files := map[string]string{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading tar entries of '%s': %w", path, err)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		contents, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[strings.TrimPrefix(header.Name, "./")] = string(contents)
+	}
+
+	return files, nil
+}
@@ -0,0 +1,131 @@
+package utils_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"brats/utils"
+)
+
+var _ = Describe("Errands", func() {
+	Context("ErrandOptions", func() {
+		It("generates the minimal run-errand args", func() {
+			Expect(utils.ErrandOptions{}.Args("fake-deployment", "fake-errand")).To(Equal([]string{
+				"-n", "-d", "fake-deployment", "run-errand", "fake-errand", "--json",
+			}))
+		})
+
+		It("generates args for every option", func() {
+			opts := utils.ErrandOptions{
+				Instances:    []string{"group-a", "group-b/fake-id"},
+				KeepAlive:    true,
+				WhenChanged:  true,
+				DownloadLogs: true,
+				LogsDir:      "/fake/logs-dir",
+			}
+
+			Expect(opts.Args("fake-deployment", "fake-errand")).To(Equal([]string{
+				"-n", "-d", "fake-deployment", "run-errand", "fake-errand", "--json",
+				"--instance", "group-a",
+				"--instance", "group-b/fake-id",
+				"--keep-alive",
+				"--when-changed",
+				"--download-logs",
+				"--logs-dir", "/fake/logs-dir",
+			}))
+		})
+	})
+
+	Context("ParseErrandRun", func() {
+		It("parses the result of every instance", func() {
+			output := `{
+				"Tables": [{
+					"Content": "errand(s)",
+					"Header": {"instance": "Instance", "exit_code": "Exit Code", "stdout": "Stdout", "stderr": "Stderr"},
+					"Rows": [
+						{"instance": "group-a/id-1", "exit_code": "0", "stdout": "out-1\n", "stderr": ""},
+						{"instance": "group-a/id-2", "exit_code": "3", "stdout": "", "stderr": "err-2\n"}
+					],
+					"Notes": null
+				}],
+				"Blocks": null,
+				"Lines": [
+					"Using deployment 'fake-deployment'",
+					"Task 12",
+					"Downloading resource 'blob-1' to '/logs/fake-errand.group-a.id-1-20240101-000000-000000000.tgz'...",
+					"Downloading resource 'blob-2' to '/logs/fake-errand.group-a.id-2-20240101-000000-000000000.tgz'...",
+					"Succeeded"
+				]
+			}`
+
+			run, err := utils.ParseErrandRun([]byte(output))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(run.Ran()).To(BeTrue())
+			Expect(run.Results).To(Equal([]utils.ErrandResult{
+				{
+					Instance:    "group-a/id-1",
+					ExitCode:    0,
+					Stdout:      "out-1\n",
+					LogsTarball: "/logs/fake-errand.group-a.id-1-20240101-000000-000000000.tgz",
+				},
+				{
+					Instance:    "group-a/id-2",
+					ExitCode:    3,
+					Stderr:      "err-2\n",
+					LogsTarball: "/logs/fake-errand.group-a.id-2-20240101-000000-000000000.tgz",
+				},
+			}))
+
+			result, found := run.ResultFor("group-a/id-2")
+			Expect(found).To(BeTrue())
+			Expect(result.InstanceGroup()).To(Equal("group-a"))
+			Expect(result.InstanceID()).To(Equal("id-2"))
+		})
+
+		It("reports a skipped errand as not run", func() {
+			run, err := utils.ParseErrandRun([]byte(`{"Tables": [{"Content": "errand(s)", "Rows": []}], "Lines": ["Succeeded"]}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(run.Ran()).To(BeFalse())
+		})
+
+		It("fails on a non-numeric exit code", func() {
+			_, err := utils.ParseErrandRun([]byte(`{"Tables": [{"Rows": [{"instance": "group-a/id-1", "exit_code": "-"}]}]}`))
+			Expect(err).To(MatchError(ContainSubstring("group-a/id-1")))
+		})
+
+		It("fails on output that is not json", func() {
+			_, err := utils.ParseErrandRun([]byte("Task 12 done"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("ReadLogsTarball", func() {
+		It("returns the regular files in the tarball", func() {
+			tarballPath := filepath.Join(GinkgoT().TempDir(), "logs.tgz")
+
+			f, err := os.Create(tarballPath)
+			Expect(err).NotTo(HaveOccurred())
+			gz := gzip.NewWriter(f)
+			tw := tar.NewWriter(gz)
+
+			Expect(tw.WriteHeader(&tar.Header{Name: "./smoke-errand/", Typeflag: tar.TypeDir, Mode: 0755})).To(Succeed())
+			contents := "log: fake\n"
+			Expect(tw.WriteHeader(&tar.Header{Name: "./smoke-errand/errand.log", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(contents))})).To(Succeed())
+			_, err = tw.Write([]byte(contents))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(tw.Close()).To(Succeed())
+			Expect(gz.Close()).To(Succeed())
+			Expect(f.Close()).To(Succeed())
+
+			files, err := utils.ReadLogsTarball(tarballPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(Equal(map[string]string{"smoke-errand/errand.log": "log: fake\n"}))
+		})
+	})
+})
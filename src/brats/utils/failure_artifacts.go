@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:staticcheck
+	. "github.com/onsi/gomega"    //nolint:staticcheck
+	"github.com/onsi/gomega/gexec"
+)
+
+const (
+	artifactsDirEnvVar  = "BRATS_ARTIFACTS_DIR"
+	defaultArtifactsDir = "/tmp/brats-artifacts"
+
+	// FailureArtifactsReportEntry names the report entry that points at the
+	// artifacts of a failed spec.
+	FailureArtifactsReportEntry = "failure artifacts"
+
+	maxArtifactsDirNameLength = 80
+	failureArtifactsTimeout   = 5 * time.Minute
+)
+
+var nonWordRun = regexp.MustCompile(`[^a-z0-9]+`)
+
+// FailureArtifactsDirName names the directory of a spec's artifacts after
+// its text, process and start, so that retries and parallel processes do
+// not collide.
+func FailureArtifactsDirName(report SpecReport) string {
+	name := strings.Trim(nonWordRun.ReplaceAllString(strings.ToLower(report.FullText()), "-"), "-")
+	if len(name) > maxArtifactsDirNameLength {
+		name = strings.TrimRight(name[:maxArtifactsDirNameLength], "-")
+	}
+	return fmt.Sprintf("%s-%d-%s", name, report.ParallelProcess, report.StartTime.UTC().Format("20060102T150405Z"))
+}
+
+// CollectFailureArtifacts keeps what is needed to debug a failed spec in a
+// directory of its own under the environment's artifacts path: the inner
+// director's logs, the debug logs of TasksForCurrentSpec, its
+// bosh-director.yml and its processes. The directory is added to the
+// spec's report. Call it from ReportAfterEach; what cannot be collected is
+// listed in collection-errors.txt rather than failing the spec again.
+func CollectFailureArtifacts(report SpecReport) {
+	if !report.Failed() {
+		return
+	}
+
+	dir := filepath.Join(Env().Paths.Artifacts, FailureArtifactsDirName(report))
+	var problems []string
+	collect := func(name string, collector func()) {
+		if err := InterceptGomegaFailure(collector); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", name, err))
+		}
+	}
+	write := func(name string, contents []byte) {
+		path := filepath.Join(dir, name)
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(os.WriteFile(path, contents, 0644)).To(Succeed())
+	}
+
+	collect("failure", func() {
+		write("failure.txt", []byte(fmt.Sprintf("%s\n\n%s\n%s\n", report.FullText(), report.Failure.Location, report.FailureMessage())))
+	})
+
+	if !InnerBoshExists() {
+		problems = append(problems, "the inner director does not exist")
+	} else {
+		collect("logs", func() {
+			write("logs.tgz", []byte(innerDirectorTarball(InnerDirectorLogDirs...)))
+		})
+		collect("tasks", func() {
+			tasks, err := tasksForSpec(SpecContextID())
+			for _, task := range tasks {
+				write(filepath.Join("tasks", fmt.Sprintf("%s-%d.log", task.Director, task.ID)), []byte(task.DebugLog()))
+			}
+			Expect(err).NotTo(HaveOccurred())
+		})
+		collect("bosh-director.yml", func() {
+			manifest, err := os.ReadFile(filepath.Join(innerBoshPath, "bosh-director.yml"))
+			Expect(err).NotTo(HaveOccurred())
+			write("bosh-director.yml", manifest)
+		})
+		collect("instances", func() {
+			session := OuterBoshQuiet("-d", InnerBoshDirectorName(), "instances", "--ps", "--details")
+			Eventually(session, failureArtifactsTimeout).Should(gexec.Exit())
+			write("instances.txt", append(session.Out.Contents(), session.Err.Contents()...))
+		})
+	}
+
+	if len(problems) > 0 {
+		collect("errors", func() {
+			write("collection-errors.txt", []byte(strings.Join(problems, "\n")+"\n"))
+		})
+	}
+	AddReportEntry(FailureArtifactsReportEntry, dir)
+}
@@ -0,0 +1,37 @@
+package utils_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"brats/utils"
+)
+
+var _ = Describe("failure artifacts", func() {
+	Describe("FailureArtifactsDirName", func() {
+		start := time.Date(2026, 10, 19, 12, 30, 45, 0, time.FixedZone("CEST", 2*60*60))
+
+		It("names the directory after the spec, its process and its start", func() {
+			report := SpecReport{
+				ContainerHierarchyTexts: []string{"director console", "with a deployment"},
+				LeafNodeText:            "queries the director's models",
+				ParallelProcess:         3,
+				StartTime:               start,
+			}
+			Expect(utils.FailureArtifactsDirName(report)).To(Equal("director-console-with-a-deployment-queries-the-director-s-models-3-20261019T103045Z"))
+		})
+
+		It("shortens long spec texts", func() {
+			report := SpecReport{
+				ContainerHierarchyTexts: []string{"a container with a rather long description of its context"},
+				LeafNodeText:            "and a spec whose text goes on, and on, and on",
+				ParallelProcess:         1,
+				StartTime:               start,
+			}
+			name := utils.FailureArtifactsDirName(report)
+			Expect(name).To(Equal("a-container-with-a-rather-long-description-of-its-context-and-a-spec-whose-text-1-20261019T103045Z"))
+		})
+	})
+})
@@ -0,0 +1,180 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"brats/sshclient"
+)
+
+// InnerBoshRoot is where start-inner-bosh-parallel.sh keeps the files of
+// each inner director, in a directory named after its number.
+const InnerBoshRoot = "/tmp/inner-bosh/director"
+
+const fingerprintLength = 12
+
+// InnerDirectorLogDirs are the log directories of the inner director's jobs.
+var InnerDirectorLogDirs = []string{
+	"/var/vcap/sys/log/director",
+	"/var/vcap/sys/log/health_monitor",
+	"/var/vcap/sys/log/nats",
+	"/var/vcap/sys/log/blobstore",
+}
+
+// InnerBosh is an inner director the scripts in ci/dockerfiles/docker-cpi
+// deploy. Ginkgo process N uses number N. Unlike the other helpers, its
+// methods return errors rather than fail the spec, so that tools can use
+// them outside the suites.
+type InnerBosh struct {
+	Number int
+	Dir    string
+	// BoshBinary is the bosh CLI that reads creds.yml, the environment's
+	// paths.bosh_binary. Credential and Client need it.
+	BoshBinary string
+}
+
+func NewInnerBosh(number int) InnerBosh {
+	return InnerBosh{Number: number, Dir: filepath.Join(InnerBoshRoot, strconv.Itoa(number))}
+}
+
+// ListInnerBoshes lists the inner directors with a directory under root,
+// by number.
+func ListInnerBoshes(root string) ([]InnerBosh, error) {
+	entries, err := os.ReadDir(root)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var directors []InnerBosh
+	for _, entry := range entries {
+		number, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		directors = append(directors, InnerBosh{Number: number, Dir: filepath.Join(root, entry.Name())})
+	}
+	sort.Slice(directors, func(i, j int) bool { return directors[i].Number < directors[j].Number })
+	return directors, nil
+}
+
+func (b InnerBosh) DeploymentName() string { return fmt.Sprintf("bosh-%d", b.Number) }
+func (b InnerBosh) IP() string             { return fmt.Sprintf("10.245.0.%d", 10+b.Number) }
+func (b InnerBosh) URL() string            { return fmt.Sprintf("https://%s:25555", b.IP()) }
+
+// BoshPath is the bosh CLI wrapper that targets the director as admin.
+func (b InnerBosh) BoshPath() string     { return filepath.Join(b.Dir, "bosh") }
+func (b InnerBosh) ManifestPath() string { return filepath.Join(b.Dir, "bosh-director.yml") }
+func (b InnerBosh) CredsPath() string    { return filepath.Join(b.Dir, "creds.yml") }
+func (b InnerBosh) CACertPath() string   { return filepath.Join(b.Dir, "ca.crt") }
+func (b InnerBosh) JumpboxPrivateKeyPath() string {
+	return filepath.Join(b.Dir, "jumpbox_private_key.pem")
+}
+
+// Deployed tells whether the director was deployed: the script writes the
+// bosh CLI wrapper once it was.
+func (b InnerBosh) Deployed() (bool, error) {
+	_, err := os.Stat(b.BoshPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Fingerprint identifies the manifest the director was deployed with, so
+// that directors started with different ops files can be told apart.
+func (b InnerBosh) Fingerprint() (string, error) {
+	manifest, err := os.ReadFile(b.ManifestPath())
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(manifest)
+	return hex.EncodeToString(sum[:])[:fingerprintLength], nil
+}
+
+// Credential reads a value from the director's creds.yml, e.g.
+// "/admin_password".
+func (b InnerBosh) Credential(path string) (string, error) {
+	if b.BoshBinary == "" {
+		return "", fmt.Errorf("reading %s from %s: no bosh CLI given", path, b.CredsPath())
+	}
+	value, err := exec.Command(b.BoshBinary, "int", b.CredsPath(), "--path", path).Output()
+	if err != nil {
+		return "", fmt.Errorf("reading %s from %s: %w", path, b.CredsPath(), err)
+	}
+	return strings.TrimSpace(string(value)), nil
+}
+
+// Client is authenticated as the admin user.
+func (b InnerBosh) Client() (*DirectorClient, error) {
+	caCert, err := os.ReadFile(b.CACertPath())
+	if err != nil {
+		return nil, err
+	}
+	password, err := b.Credential("/admin_password")
+	if err != nil {
+		return nil, err
+	}
+	return NewDirectorClient(b.URL(), caCert, BasicAuth("admin", password))
+}
+
+// SSHClient connects to the director VM as the jumpbox user.
+func (b InnerBosh) SSHClient() (*sshclient.Client, error) {
+	privateKey, err := os.ReadFile(b.JumpboxPrivateKeyPath())
+	if err != nil {
+		return nil, err
+	}
+	return sshclient.Dial(sshclient.Config{
+		Address:    b.IP(),
+		User:       jumpboxUser,
+		PrivateKey: privateKey,
+	})
+}
+
+// StartCommand deploys the director with start-inner-bosh-parallel.sh of
+// the repository at repoRoot; args go to `bosh int`, e.g. "-o", "ops.yml".
+func (b InnerBosh) StartCommand(repoRoot string, args ...string) *exec.Cmd {
+	return innerBoshScript(repoRoot, "start-inner-bosh-parallel.sh", append([]string{strconv.Itoa(b.Number)}, args...)...)
+}
+
+// UploadReleasesCommand uploads the director release at releasePath and
+// those it is deployed with to the outer director.
+func (b InnerBosh) UploadReleasesCommand(repoRoot, releasePath string) *exec.Cmd {
+	cmd := innerBoshScript(repoRoot, "create-and-upload-release.sh", strconv.Itoa(b.Number))
+	cmd.Env = append(cmd.Env, fmt.Sprintf("bosh_release_path=%s", releasePath))
+	return cmd
+}
+
+// StopCommand deletes the director's deployments and then the director.
+func (b InnerBosh) StopCommand(repoRoot string) *exec.Cmd {
+	return innerBoshScript(repoRoot, "destroy-inner-bosh.sh", strconv.Itoa(b.Number))
+}
+
+func innerBoshScript(repoRoot, name string, args ...string) *exec.Cmd {
+	cmd := exec.Command(filepath.Join(repoRoot, "ci", "dockerfiles", "docker-cpi", name), args...)
+	cmd.Env = os.Environ()
+	return cmd
+}
+
+// InnerDirectorTarballCommand archives paths on the inner director VM to
+// its standard output; those that do not exist are left out. Run it as
+// root.
+func InnerDirectorTarballCommand(paths ...string) string {
+	relative := make([]string, len(paths))
+	for i, path := range paths {
+		relative[i] = strings.TrimPrefix(path, "/")
+	}
+
+	// tar exits 1 when a file is written to while it is read, e.g. a log.
+	return fmt.Sprintf("cd / && { tar czf - --ignore-failed-read %s || [ $? -eq 1 ]; }", strings.Join(relative, " "))
+}
@@ -0,0 +1,75 @@
+package utils_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"brats/utils"
+)
+
+var _ = Describe("InnerBosh", func() {
+	It("is where the scripts put the director of the Ginkgo process", func() {
+		director := utils.NewInnerBosh(3)
+		Expect(director.Dir).To(Equal("/tmp/inner-bosh/director/3"))
+		Expect(director.BoshPath()).To(Equal("/tmp/inner-bosh/director/3/bosh"))
+		Expect(director.DeploymentName()).To(Equal("bosh-3"))
+		Expect(director.IP()).To(Equal("10.245.0.13"))
+		Expect(director.URL()).To(Equal("https://10.245.0.13:25555"))
+	})
+
+	Describe("ListInnerBoshes", func() {
+		It("lists the numbered directories in order", func() {
+			root := GinkgoT().TempDir()
+			for _, name := range []string{"10", "2", "logs"} {
+				Expect(os.Mkdir(filepath.Join(root, name), 0755)).To(Succeed())
+			}
+			Expect(os.WriteFile(filepath.Join(root, "3"), nil, 0644)).To(Succeed())
+
+			directors, err := utils.ListInnerBoshes(root)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(directors).To(Equal([]utils.InnerBosh{
+				{Number: 2, Dir: filepath.Join(root, "2")},
+				{Number: 10, Dir: filepath.Join(root, "10")},
+			}))
+		})
+
+		It("lists nothing before any director was started", func() {
+			directors, err := utils.ListInnerBoshes(filepath.Join(GinkgoT().TempDir(), "director"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(directors).To(BeEmpty())
+		})
+	})
+
+	Describe("Credential", func() {
+		It("reads creds.yml with the configured bosh CLI", func() {
+			dir := GinkgoT().TempDir()
+			boshBinary := filepath.Join(dir, "fake-bosh")
+			Expect(os.WriteFile(boshBinary, []byte("#!/bin/sh\necho \"$@\"\n"), 0755)).To(Succeed())
+
+			director := utils.InnerBosh{Number: 1, Dir: dir, BoshBinary: boshBinary}
+			Expect(director.Credential("/admin_password")).To(Equal("int " + director.CredsPath() + " --path /admin_password"))
+		})
+
+		It("fails without a bosh CLI", func() {
+			director := utils.InnerBosh{Number: 1, Dir: GinkgoT().TempDir()}
+			_, err := director.Credential("/admin_password")
+			Expect(err).To(MatchError(ContainSubstring("no bosh CLI given")))
+		})
+	})
+
+	It("fingerprints the manifest and tells whether it was deployed", func() {
+		director := utils.InnerBosh{Number: 1, Dir: GinkgoT().TempDir()}
+		Expect(director.Deployed()).To(BeFalse())
+		_, err := director.Fingerprint()
+		Expect(err).To(MatchError(os.ErrNotExist))
+
+		Expect(os.WriteFile(director.ManifestPath(), []byte("name: bosh-1\n"), 0644)).To(Succeed())
+		Expect(director.Fingerprint()).To(MatchRegexp(`^[0-9a-f]{12}$`))
+
+		Expect(os.WriteFile(director.BoshPath(), nil, 0755)).To(Succeed())
+		Expect(director.Deployed()).To(BeTrue())
+	})
+})
@@ -0,0 +1,354 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/onsi/gomega" //nolint:staticcheck
+	"github.com/onsi/gomega/gexec"
+
+	"brats/nats"
+)
+
+const (
+	// NATSAuthConfigPath is where bosh-nats-sync writes the users nats.cfg
+	// includes.
+	NATSAuthConfigPath = "/var/vcap/data/nats/auth.json"
+
+	natsPort          = 4222
+	natsMonitoringURL = "http://127.0.0.1:8222"
+
+	agentSettingsPath       = "/var/vcap/bosh/settings.json"
+	agentUpdateSettingsPath = "/var/vcap/bosh/update_settings.json"
+)
+
+// VM is an entry of the director's /deployments/:deployment/vms, which
+// bosh-nats-sync authorizes agents from.
+type VM struct {
+	AgentID                  string `json:"agent_id"`
+	CID                      string `json:"cid"`
+	Job                      string `json:"job"`
+	Index                    int    `json:"index"`
+	ID                       string `json:"id"`
+	PermanentNATSCredentials bool   `json:"permanent_nats_credentials"`
+}
+
+func (c *DirectorClient) VMs(deployment string) ([]VM, error) {
+	var vms []VM
+	err := c.Get("/deployments/"+url.PathEscape(deployment)+"/vms", nil, &vms)
+	return vms, err
+}
+
+// AllVMs lists the VMs of every deployment, as bosh-nats-sync does.
+func (c *DirectorClient) AllVMs() ([]VM, error) {
+	var deployments []struct {
+		Name string `json:"name"`
+	}
+	if err := c.Get("/deployments", nil, &deployments); err != nil {
+		return nil, err
+	}
+
+	vms := []VM{}
+	for _, deployment := range deployments {
+		deploymentVMs, err := c.VMs(deployment.Name)
+		if err != nil {
+			return nil, err
+		}
+		vms = append(vms, deploymentVMs...)
+	}
+	return vms, nil
+}
+
+// AgentNATSUser is the subject NATS maps an agent certificate with common
+// name "<cn>.agent.bosh-internal" to.
+func AgentNATSUser(cn string) string {
+	return fmt.Sprintf("C=USA, O=Cloud Foundry, CN=%s.agent.bosh-internal", cn)
+}
+
+func isAgentNATSUser(user string) bool {
+	return strings.HasSuffix(user, ".agent.bosh-internal")
+}
+
+// ExpectedAgentNATSUsers are the sorted agent users bosh-nats-sync
+// authorizes for vms: the permanent identity of every agent, and the
+// bootstrap identity of agents that have not been given permanent
+// credentials yet.
+func ExpectedAgentNATSUsers(vms []VM) []string {
+	users := []string{}
+	for _, vm := range vms {
+		if !vm.PermanentNATSCredentials {
+			users = append(users, AgentNATSUser(vm.AgentID+".bootstrap"))
+		}
+		users = append(users, AgentNATSUser(vm.AgentID))
+	}
+	sort.Strings(users)
+	return users
+}
+
+// NATSAuthConfig is auth.json as bosh-nats-sync writes it.
+type NATSAuthConfig struct {
+	Authorization struct {
+		Users []NATSUser `json:"users"`
+	} `json:"authorization"`
+}
+
+type NATSUser struct {
+	User        string `json:"user"`
+	Permissions struct {
+		Publish   []string `json:"publish"`
+		Subscribe []string `json:"subscribe"`
+	} `json:"permissions"`
+}
+
+func ParseNATSAuthConfig(contents []byte) (*NATSAuthConfig, error) {
+	var config NATSAuthConfig
+	if err := json.Unmarshal(contents, &config); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", NATSAuthConfigPath, err)
+	}
+	return &config, nil
+}
+
+// AgentUsers are the sorted agent users the config authorizes, leaving out
+// the director and the health monitor.
+func (c *NATSAuthConfig) AgentUsers() []string {
+	users := []string{}
+	for _, user := range c.Authorization.Users {
+		if isAgentNATSUser(user.User) {
+			users = append(users, user.User)
+		}
+	}
+	sort.Strings(users)
+	return users
+}
+
+// User is the entry for a user, if the config authorizes it.
+func (c *NATSAuthConfig) User(user string) (NATSUser, bool) {
+	for _, u := range c.Authorization.Users {
+		if u.User == user {
+			return u, true
+		}
+	}
+	return NATSUser{}, false
+}
+
+// NATSConnections is the NATS server's /connz.
+type NATSConnections struct {
+	NumConnections int              `json:"num_connections"`
+	Connections    []NATSConnection `json:"connections"`
+}
+
+type NATSConnection struct {
+	CID            uint64 `json:"cid"`
+	IP             string `json:"ip"`
+	AuthorizedUser string `json:"authorized_user"`
+}
+
+func ParseNATSConnections(contents []byte) (*NATSConnections, error) {
+	var connections NATSConnections
+	if err := json.Unmarshal(contents, &connections); err != nil {
+		return nil, fmt.Errorf("parsing /connz: %w", err)
+	}
+	return &connections, nil
+}
+
+// AgentUsers are the sorted, distinct agent users that are connected.
+func (c *NATSConnections) AgentUsers() []string {
+	seen := map[string]bool{}
+	users := []string{}
+	for _, connection := range c.Connections {
+		if isAgentNATSUser(connection.AuthorizedUser) && !seen[connection.AuthorizedUser] {
+			seen[connection.AuthorizedUser] = true
+			users = append(users, connection.AuthorizedUser)
+		}
+	}
+	sort.Strings(users)
+	return users
+}
+
+// NATSAuthorizationMismatches describes how the agents NATS authorizes and
+// has connected differ from the VMs the director has: every VM's agent has
+// to be authorized and connected, and no other agent may be.
+func NATSAuthorizationMismatches(vms []VM, config *NATSAuthConfig, connections *NATSConnections) []string {
+	expected := map[string]bool{}
+	for _, user := range ExpectedAgentNATSUsers(vms) {
+		expected[user] = true
+	}
+
+	var mismatches []string
+	authorized := map[string]bool{}
+	for _, user := range config.AgentUsers() {
+		authorized[user] = true
+		if !expected[user] {
+			mismatches = append(mismatches, fmt.Sprintf("%s is authorized but has no VM", user))
+		}
+	}
+	for user := range expected {
+		if !authorized[user] {
+			mismatches = append(mismatches, fmt.Sprintf("%s has a VM but is not authorized", user))
+		}
+	}
+
+	connected := map[string]bool{}
+	for _, user := range connections.AgentUsers() {
+		connected[user] = true
+		if !expected[user] {
+			mismatches = append(mismatches, fmt.Sprintf("%s is connected but has no VM", user))
+		}
+	}
+	for _, vm := range vms {
+		if !connected[AgentNATSUser(vm.AgentID)] && !connected[AgentNATSUser(vm.AgentID+".bootstrap")] {
+			mismatches = append(mismatches, fmt.Sprintf("the agent of %s/%s is not connected", vm.Job, vm.ID))
+		}
+	}
+
+	sort.Strings(mismatches)
+	return mismatches
+}
+
+// InnerNATSAuthConfig reads auth.json on the inner director VM.
+func InnerNATSAuthConfig() *NATSAuthConfig {
+	contents, err := InnerDirectorSSHClient().Sudo().Get(NATSAuthConfigPath)
+	Expect(err).NotTo(HaveOccurred())
+
+	config, err := ParseNATSAuthConfig(contents)
+	Expect(err).NotTo(HaveOccurred())
+	return config
+}
+
+// InnerNATSConnections reads /connz of the NATS server on the inner
+// director VM, which needs nats.enable_metrics_endpoint.
+func InnerNATSConnections() *NATSConnections {
+	response, err := InnerDirectorHTTPClient().Get(natsMonitoringURL + "/connz?auth=true&limit=1024")
+	Expect(err).NotTo(HaveOccurred())
+	defer response.Body.Close() //nolint:errcheck
+	Expect(response.StatusCode).To(Equal(http.StatusOK))
+
+	body, err := io.ReadAll(response.Body)
+	Expect(err).NotTo(HaveOccurred())
+	connections, err := ParseNATSConnections(body)
+	Expect(err).NotTo(HaveOccurred())
+	return connections
+}
+
+// NATSCredentials are the certificate an agent connects to NATS with, and
+// the CA it verifies the server with.
+type NATSCredentials struct {
+	CA          string `json:"ca"`
+	Certificate string `json:"certificate"`
+	PrivateKey  string `json:"private_key"`
+}
+
+// ParseAgentNATSCredentials picks the credentials an agent uses from its
+// settings: the permanent ones the director sent with update_settings,
+// falling back to the bootstrap ones it was created with.
+func ParseAgentNATSCredentials(settings, updateSettings []byte) (NATSCredentials, error) {
+	var update struct {
+		Mbus struct {
+			Cert NATSCredentials `json:"cert"`
+		} `json:"mbus"`
+	}
+	if len(strings.TrimSpace(string(updateSettings))) > 0 {
+		if err := json.Unmarshal(updateSettings, &update); err != nil {
+			return NATSCredentials{}, fmt.Errorf("parsing %s: %w", agentUpdateSettingsPath, err)
+		}
+		if update.Mbus.Cert.Certificate != "" {
+			return update.Mbus.Cert, nil
+		}
+	}
+
+	var bootstrap struct {
+		Env struct {
+			Bosh struct {
+				Mbus struct {
+					Cert NATSCredentials `json:"cert"`
+				} `json:"mbus"`
+			} `json:"bosh"`
+		} `json:"env"`
+	}
+	if err := json.Unmarshal(settings, &bootstrap); err != nil {
+		return NATSCredentials{}, fmt.Errorf("parsing %s: %w", agentSettingsPath, err)
+	}
+	if bootstrap.Env.Bosh.Mbus.Cert.Certificate == "" {
+		return NATSCredentials{}, fmt.Errorf("%s has no NATS certificate", agentSettingsPath)
+	}
+	return bootstrap.Env.Bosh.Mbus.Cert, nil
+}
+
+// AgentNATSCredentials reads the NATS credentials of the agent on an
+// instance of a deployment of the inner director.
+func AgentNATSCredentials(deployment, instance string) NATSCredentials {
+	read := func(path string) []byte {
+		session := BoshQuiet("--json", "-d", deployment, "ssh", instance, "--results",
+			"-c", fmt.Sprintf("sudo sh -c 'cat %s 2>/dev/null || true'", path),
+		)
+		Eventually(session, time.Minute).Should(gexec.Exit(0))
+		return []byte(sshResultStdout(session))
+	}
+
+	credentials, err := ParseAgentNATSCredentials(read(agentSettingsPath), read(agentUpdateSettingsPath))
+	Expect(err).NotTo(HaveOccurred())
+	return credentials
+}
+
+func sshResultStdout(session *gexec.Session) string {
+	output, err := ParseCLIOutput(session.Out.Contents())
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output.Tables).NotTo(BeEmpty())
+	Expect(output.Tables[0].Rows).To(HaveLen(1))
+	return output.Tables[0].Rows[0]["stdout"]
+}
+
+// InnerNATSAddress is where agents reach the inner director's NATS server.
+func InnerNATSAddress() string {
+	return net.JoinHostPort(InnerDirectorIP(), strconv.Itoa(natsPort))
+}
+
+// TLSConfig authenticates with the credentials to the NATS server at
+// serverName.
+func (c NATSCredentials) TLSConfig(serverName string) (*tls.Config, error) {
+	config := &tls.Config{ServerName: serverName, MinVersion: tls.VersionTLS12}
+
+	if c.Certificate != "" {
+		certificate, err := tls.X509KeyPair([]byte(c.Certificate), []byte(c.PrivateKey))
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	config.RootCAs = x509.NewCertPool()
+	if !config.RootCAs.AppendCertsFromPEM([]byte(c.CA)) {
+		return nil, fmt.Errorf("the NATS CA is not PEM")
+	}
+	return config, nil
+}
+
+// ConnectInnerNATS connects to the inner director's NATS server as the
+// holder of credentials would. Without a certificate, it connects with none.
+func ConnectInnerNATS(credentials NATSCredentials) (*nats.Conn, error) {
+	config, err := credentials.TLSConfig(InnerDirectorIP())
+	if err != nil {
+		return nil, err
+	}
+	return nats.Connect(InnerNATSAddress(), nats.Options{TLSConfig: config, Name: "brats"})
+}
+
+// NATSConnect connects to the inner director's NATS server as the holder of
+// credentials would, and returns the error the server rejected it with.
+func NATSConnect(credentials NATSCredentials) error {
+	conn, err := ConnectInnerNATS(credentials)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,122 @@
+package utils_test
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"brats/utils"
+)
+
+const natsAuthJSON = `{"authorization":{"users":[
+	{"user":"C=USA, O=Cloud Foundry, CN=default.director.bosh-internal","permissions":{"publish":["agent.*","hm.director.alert"],"subscribe":["director.>"]}},
+	{"user":"C=USA, O=Cloud Foundry, CN=default.hm.bosh-internal","permissions":{"publish":[],"subscribe":["hm.agent.heartbeat.*","hm.agent.alert.*","hm.agent.shutdown.*","hm.director.alert"]}},
+	{"user":"C=USA, O=Cloud Foundry, CN=agent-2.bootstrap.agent.bosh-internal","permissions":{"publish":["hm.agent.heartbeat.agent-2","hm.agent.alert.agent-2","hm.agent.shutdown.agent-2","director.*.agent-2.*"],"subscribe":["agent.agent-2"]}},
+	{"user":"C=USA, O=Cloud Foundry, CN=agent-2.agent.bosh-internal","permissions":{"publish":["hm.agent.heartbeat.agent-2","hm.agent.alert.agent-2","hm.agent.shutdown.agent-2","director.*.agent-2.*"],"subscribe":["agent.agent-2"]}},
+	{"user":"C=USA, O=Cloud Foundry, CN=agent-1.agent.bosh-internal","permissions":{"publish":["hm.agent.heartbeat.agent-1","hm.agent.alert.agent-1","hm.agent.shutdown.agent-1","director.*.agent-1.*"],"subscribe":["agent.agent-1"]}}
+]}}`
+
+const natsConnzJSON = `{"num_connections":4,"connections":[
+	{"cid":1,"ip":"127.0.0.1","authorized_user":"C=USA, O=Cloud Foundry, CN=default.director.bosh-internal"},
+	{"cid":2,"ip":"127.0.0.1","authorized_user":"C=USA, O=Cloud Foundry, CN=default.hm.bosh-internal"},
+	{"cid":5,"ip":"10.245.0.3","authorized_user":"C=USA, O=Cloud Foundry, CN=agent-1.agent.bosh-internal"},
+	{"cid":7,"ip":"10.245.0.4","authorized_user":"C=USA, O=Cloud Foundry, CN=agent-2.bootstrap.agent.bosh-internal"}
+]}`
+
+var _ = Describe("NATS authorization", func() {
+	vms := []utils.VM{
+		{AgentID: "agent-1", Job: "sleeper", ID: "id-1", PermanentNATSCredentials: true},
+		{AgentID: "agent-2", Job: "sleeper", ID: "id-2"},
+	}
+
+	var (
+		config      *utils.NATSAuthConfig
+		connections *utils.NATSConnections
+	)
+
+	BeforeEach(func() {
+		var err error
+		config, err = utils.ParseNATSAuthConfig([]byte(natsAuthJSON))
+		Expect(err).NotTo(HaveOccurred())
+		connections, err = utils.ParseNATSConnections([]byte(natsConnzJSON))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("expects the bootstrap identity only of agents without permanent credentials", func() {
+		Expect(utils.ExpectedAgentNATSUsers(vms)).To(Equal([]string{
+			"C=USA, O=Cloud Foundry, CN=agent-1.agent.bosh-internal",
+			"C=USA, O=Cloud Foundry, CN=agent-2.agent.bosh-internal",
+			"C=USA, O=Cloud Foundry, CN=agent-2.bootstrap.agent.bosh-internal",
+		}))
+		Expect(utils.ExpectedAgentNATSUsers(nil)).To(BeEmpty())
+	})
+
+	It("reads the authorized agents without the director and health monitor", func() {
+		Expect(config.AgentUsers()).To(Equal(utils.ExpectedAgentNATSUsers(vms)))
+
+		user, found := config.User(utils.AgentNATSUser("agent-1"))
+		Expect(found).To(BeTrue())
+		Expect(user.Permissions.Subscribe).To(Equal([]string{"agent.agent-1"}))
+		_, found = config.User(utils.AgentNATSUser("agent-3"))
+		Expect(found).To(BeFalse())
+	})
+
+	It("reads the connected agents", func() {
+		Expect(connections.AgentUsers()).To(Equal([]string{
+			"C=USA, O=Cloud Foundry, CN=agent-1.agent.bosh-internal",
+			"C=USA, O=Cloud Foundry, CN=agent-2.bootstrap.agent.bosh-internal",
+		}))
+	})
+
+	It("accepts agents that are authorized and connected as the director's VMs", func() {
+		Expect(utils.NATSAuthorizationMismatches(vms, config, connections)).To(BeEmpty())
+	})
+
+	It("describes every mismatch", func() {
+		connections.Connections = append(connections.Connections, utils.NATSConnection{AuthorizedUser: utils.AgentNATSUser("agent-9")})
+
+		Expect(utils.NATSAuthorizationMismatches(
+			[]utils.VM{vms[0], {AgentID: "agent-3", Job: "sleeper", ID: "id-3", PermanentNATSCredentials: true}},
+			config,
+			connections,
+		)).To(Equal([]string{
+			"C=USA, O=Cloud Foundry, CN=agent-2.agent.bosh-internal is authorized but has no VM",
+			"C=USA, O=Cloud Foundry, CN=agent-2.bootstrap.agent.bosh-internal is authorized but has no VM",
+			"C=USA, O=Cloud Foundry, CN=agent-2.bootstrap.agent.bosh-internal is connected but has no VM",
+			"C=USA, O=Cloud Foundry, CN=agent-3.agent.bosh-internal has a VM but is not authorized",
+			"C=USA, O=Cloud Foundry, CN=agent-9.agent.bosh-internal is connected but has no VM",
+			"the agent of sleeper/id-3 is not connected",
+		}))
+	})
+
+	Describe("ParseAgentNATSCredentials", func() {
+		settings := func(certificate string) []byte {
+			contents, err := json.Marshal(map[string]any{"env": map[string]any{"bosh": map[string]any{"mbus": map[string]any{"cert": map[string]string{
+				"ca": "nats-ca", "certificate": certificate, "private_key": certificate + "-key",
+			}}}}})
+			Expect(err).NotTo(HaveOccurred())
+			return contents
+		}
+
+		It("prefers the permanent credentials from update_settings", func() {
+			credentials, err := utils.ParseAgentNATSCredentials(settings("bootstrap"),
+				[]byte(`{"mbus":{"cert":{"ca":"nats-ca","certificate":"permanent","private_key":"permanent-key"}}}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(credentials).To(Equal(utils.NATSCredentials{CA: "nats-ca", Certificate: "permanent", PrivateKey: "permanent-key"}))
+		})
+
+		It("falls back to the bootstrap credentials", func() {
+			for _, update := range []string{"", `{"mbus":{"cert":{}}}`} {
+				credentials, err := utils.ParseAgentNATSCredentials(settings("bootstrap"), []byte(update))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(credentials.Certificate).To(Equal("bootstrap"))
+			}
+		})
+
+		It("fails without a certificate", func() {
+			_, err := utils.ParseAgentNATSCredentials([]byte(`{}`), nil)
+			Expect(err).To(MatchError(ContainSubstring("has no NATS certificate")))
+		})
+	})
+})
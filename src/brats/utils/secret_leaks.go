@@ -0,0 +1,314 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:staticcheck
+	"github.com/onsi/ginkgo/v2/types"
+	. "github.com/onsi/gomega" //nolint:staticcheck
+	"github.com/onsi/gomega/gexec"
+	"go.yaml.in/yaml/v3"
+)
+
+// minSecretLength keeps short values such as "admin" or "true", which show
+// up in logs for unrelated reasons, out of the scan.
+const minSecretLength = 8
+
+// publicCredentialFields are the parts of generated credentials that are
+// meant to be shared.
+var publicCredentialFields = map[string]bool{
+	"ca":                     true,
+	"certificate":            true,
+	"public_key":             true,
+	"public_key_fingerprint": true,
+}
+
+var secretPropertyPattern = regexp.MustCompile(`(?i)password|secret|private_key|token`)
+
+// Secret is a value that must never show up in a log.
+type Secret struct {
+	// Name is the path of the value in its source, e.g. "/admin_password".
+	Name string
+	// Source is where the value came from, e.g. "creds.yml".
+	Source string
+	Value  string
+}
+
+// SecretLeak is a secret found in a log. It deliberately does not include
+// the value, so reports can be printed.
+type SecretLeak struct {
+	Secret   Secret
+	Encoding string
+	Location string
+	Line     int
+}
+
+func (l SecretLeak) String() string {
+	return fmt.Sprintf("%s from %s leaked %s in %s line %d", l.Secret.Name, l.Secret.Source, l.Encoding, l.Location, l.Line)
+}
+
+// CredsSecrets returns every value in a vars store such as the inner
+// director's creds.yml, except for certificates and public keys.
+func CredsSecrets(source string, contents []byte) ([]Secret, error) {
+	var secrets []Secret
+	err := walkYAML(contents, func(path []string, value string) {
+		if !publicCredentialFields[path[len(path)-1]] {
+			secrets = append(secrets, Secret{Name: "/" + strings.Join(path, "/"), Source: source, Value: value})
+		}
+	})
+	return secrets, err
+}
+
+// ManifestSecrets returns the literal values of properties named like
+// passwords, secrets, private keys and tokens in a manifest or config.
+// Variables the director resolves from a config server are not in the
+// manifest, see SecretLeakScanner.UseConfigServer.
+func ManifestSecrets(source string, contents []byte) ([]Secret, error) {
+	var secrets []Secret
+	err := walkYAML(contents, func(path []string, value string) {
+		if !secretPropertyPattern.MatchString(path[len(path)-1]) {
+			return
+		}
+		if strings.HasPrefix(value, "((") && strings.HasSuffix(value, "))") {
+			return
+		}
+		secrets = append(secrets, Secret{Name: "/" + strings.Join(path, "/"), Source: source, Value: value})
+	})
+	return secrets, err
+}
+
+// walkYAML calls visit for every string of at least minSecretLength
+// characters, with the keys and indexes leading to it.
+func walkYAML(contents []byte, visit func(path []string, value string)) error {
+	var document any
+	if err := yaml.Unmarshal(contents, &document); err != nil {
+		return err
+	}
+
+	var walk func(path []string, node any)
+	walk = func(path []string, node any) {
+		switch node := node.(type) {
+		case map[string]any:
+			for key, value := range node {
+				walk(append(path[:len(path):len(path)], key), value)
+			}
+		case []any:
+			for i, value := range node {
+				walk(append(path[:len(path):len(path)], strconv.Itoa(i)), value)
+			}
+		case string:
+			if len(path) > 0 && len(node) >= minSecretLength {
+				visit(path, node)
+			}
+		}
+	}
+	walk(nil, document)
+	return nil
+}
+
+// secretForms are the ways a secret can appear in a log. Base64 is matched
+// at each of the three alignments the secret can have inside a longer
+// encoded value, e.g. an agent settings blob. Multi-line values such as
+// private keys mostly appear JSON encoded.
+func secretForms(value string) map[string]string {
+	forms := map[string]string{value: "raw"}
+	if strings.Contains(value, "\n") {
+		escaped, _ := json.Marshal(value) //nolint:errcheck
+		forms[strings.Trim(string(escaped), `"`)] = "JSON encoded"
+	}
+
+	for offset := 0; offset < 3; offset++ {
+		encoded := base64.StdEncoding.EncodeToString(append(make([]byte, offset), value...))
+		// Characters that mix in bits of the bytes before or after the
+		// secret depend on what surrounds it.
+		start := (offset*8 + 5) / 6
+		end := (offset + len(value)) * 8 / 6
+		if end-start < minSecretLength {
+			continue
+		}
+		form := encoded[start:end]
+		forms[form] = "base64 encoded"
+		forms[strings.NewReplacer("+", "-", "/", "_").Replace(form)] = "base64 encoded"
+	}
+	return forms
+}
+
+// FindSecretLeaks reports the first line of contents each secret appears on
+// in any of its forms.
+func FindSecretLeaks(secrets []Secret, location, contents string) []SecretLeak {
+	var leaks []SecretLeak
+	for _, secret := range secrets {
+		for form, encoding := range secretForms(secret.Value) {
+			index := strings.Index(contents, form)
+			if index < 0 {
+				continue
+			}
+			leaks = append(leaks, SecretLeak{
+				Secret:   secret,
+				Encoding: encoding,
+				Location: location,
+				Line:     strings.Count(contents[:index], "\n") + 1,
+			})
+		}
+	}
+
+	sort.Slice(leaks, func(i, j int) bool {
+		if leaks[i].Line != leaks[j].Line {
+			return leaks[i].Line < leaks[j].Line
+		}
+		return leaks[i].String() < leaks[j].String()
+	})
+	return leaks
+}
+
+// FormatSecretLeaks lists one leak per line.
+func FormatSecretLeaks(leaks []SecretLeak) string {
+	var report strings.Builder
+	for _, leak := range leaks {
+		fmt.Fprintln(&report, leak)
+	}
+	return report.String()
+}
+
+// SecretLeakScanner checks the inner director's logs for the secrets it
+// knows about, see DetectSecretLeaks.
+type SecretLeakScanner struct {
+	secrets      []Secret
+	configServer *ConfigServerConfig
+	lastTaskID   int
+}
+
+// DetectSecretLeaks fails every spec in the enclosing container after which
+// a secret from the inner director's creds.yml, a deployed manifest, the
+// config server of SecretLeakScanner.UseConfigServer or
+// SecretLeakScanner.Add is in the director, worker, health monitor, nats or
+// blobstore logs, a task debug log or `bosh task --debug` output.
+func DetectSecretLeaks() *SecretLeakScanner {
+	scanner := &SecretLeakScanner{}
+
+	// The enclosing container's BeforeEach may (re)start the director.
+	JustBeforeEach(func() {
+		scanner.lastTaskID = latestTaskID()
+	})
+
+	AfterEach(func() {
+		defer func() { scanner.secrets = nil }()
+		if report := CurrentSpecReport(); report.Failed() || report.State == types.SpecStateSkipped {
+			return
+		}
+		if leaks := scanner.Scan(); len(leaks) > 0 {
+			Fail("secrets leaked into the inner director's logs:\n" + FormatSecretLeaks(leaks))
+		}
+	})
+
+	return scanner
+}
+
+// Add makes the scanner look for more secrets in the current spec, e.g.
+// values from a config server or a config the spec uploads.
+func (s *SecretLeakScanner) Add(secrets ...Secret) {
+	s.secrets = append(s.secrets, secrets...)
+}
+
+// UseConfigServer makes the scanner look for the values of the deployed
+// manifests' variables too, from the config server the inner director was
+// deployed with, for the specs that follow.
+func (s *SecretLeakScanner) UseConfigServer(config ConfigServerConfig) {
+	s.configServer = &config
+}
+
+// Scan looks for secrets in the logs as they are now.
+func (s *SecretLeakScanner) Scan() []SecretLeak {
+	By("scanning the inner director's logs for secrets")
+	secrets := append(innerDirectorSecrets(s.configServer), s.secrets...)
+
+	var leaks []SecretLeak
+	logs := FetchInnerDirectorFiles(
+		"/var/vcap/sys/log/director",
+		"/var/vcap/sys/log/health_monitor",
+		"/var/vcap/sys/log/nats",
+		"/var/vcap/sys/log/blobstore",
+		"/var/vcap/store/director/tasks/*/debug",
+	)
+	locations := make([]string, 0, len(logs))
+	for location := range logs {
+		locations = append(locations, location)
+	}
+	sort.Strings(locations)
+	for _, location := range locations {
+		leaks = append(leaks, FindSecretLeaks(secrets, location, logs[location])...)
+	}
+
+	for _, id := range s.tasksSince() {
+		session := BoshQuiet("task", strconv.Itoa(id), "--debug")
+		Eventually(session, 2*time.Minute).Should(gexec.Exit())
+		leaks = append(leaks, FindSecretLeaks(secrets, fmt.Sprintf("bosh task %d --debug", id), string(session.Out.Contents()))...)
+	}
+
+	return leaks
+}
+
+func innerDirectorSecrets(configServerConfig *ConfigServerConfig) []Secret {
+	contents, err := os.ReadFile(filepath.Join(innerBoshPath, "creds.yml"))
+	Expect(err).NotTo(HaveOccurred())
+	secrets, err := CredsSecrets("creds.yml", contents)
+	Expect(err).NotTo(HaveOccurred())
+
+	var configServer *ConfigServerClient
+	if configServerConfig != nil {
+		configServer, err = NewConfigServerClient(*configServerConfig)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	session := BoshQuiet("deployments", "--column=name")
+	Eventually(session, time.Minute).Should(gexec.Exit(0))
+	for _, deployment := range strings.Fields(string(session.Out.Contents())) {
+		session := BoshQuiet("-d", deployment, "manifest")
+		Eventually(session, time.Minute).Should(gexec.Exit(0))
+
+		manifestSecrets, err := ManifestSecrets(fmt.Sprintf("the %s manifest", deployment), session.Out.Contents())
+		Expect(err).NotTo(HaveOccurred())
+		secrets = append(secrets, manifestSecrets...)
+
+		if configServer != nil {
+			variableSecrets, err := ConfigServerSecrets(InnerDirectorClient(), configServer, deployment)
+			Expect(err).NotTo(HaveOccurred())
+			secrets = append(secrets, variableSecrets...)
+		}
+	}
+
+	return secrets
+}
+
+func latestTaskID() int {
+	tasks, err := InnerDirectorClient().Tasks(TasksFilter{Limit: 1, Verbose: 2})
+	Expect(err).NotTo(HaveOccurred())
+	if len(tasks) == 0 {
+		return 0
+	}
+	return tasks[0].ID
+}
+
+// tasksSince lists the tasks started since the spec started, oldest first.
+func (s *SecretLeakScanner) tasksSince() []int {
+	tasks, err := InnerDirectorClient().Tasks(TasksFilter{Limit: 1000, Verbose: 2})
+	Expect(err).NotTo(HaveOccurred())
+
+	var ids []int
+	for _, task := range tasks {
+		if task.ID > s.lastTaskID {
+			ids = append(ids, task.ID)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:staticcheck
+	. "github.com/onsi/gomega"    //nolint:staticcheck
+	"github.com/onsi/gomega/gexec"
+)
+
+const (
+	boshContextIDEnvVar = "BOSH_CONTEXT_ID"
+
+	// SpecTasksReportEntry names the report entry that lists the tasks a
+	// spec started.
+	SpecTasksReportEntry = "director tasks"
+
+	// InnerDirector and OuterDirector tell which director ran a SpecTask.
+	InnerDirector = "inner"
+	OuterDirector = "outer"
+)
+
+// SpecTask is a director task a spec started.
+type SpecTask struct {
+	Director string `json:"director"`
+	ID       int    `json:"id"`
+}
+
+func (t SpecTask) String() string {
+	return fmt.Sprintf("%s/%d", t.Director, t.ID)
+}
+
+// Task reads the task's state from the inner director; the outer
+// director's tasks only have debug logs.
+func (t SpecTask) Task() Task {
+	Expect(t.Director).To(Equal(InnerDirector), "only the inner director's tasks can be read")
+	task, err := InnerDirectorClient().Task(t.ID)
+	Expect(err).NotTo(HaveOccurred())
+	return task
+}
+
+// DebugLog is the output of `bosh task --debug`.
+func (t SpecTask) DebugLog() string {
+	var session *gexec.Session
+	if t.Director == InnerDirector {
+		session = BoshQuiet("task", strconv.Itoa(t.ID), "--debug")
+	} else {
+		session = OuterBoshQuiet("task", strconv.Itoa(t.ID), "--debug")
+	}
+	Eventually(session, 5*time.Minute).Should(gexec.Exit())
+	return string(session.Out.Contents())
+}
+
+// specSession is a bosh CLI invocation of a spec.
+type specSession struct {
+	director string
+	session  *gexec.Session
+}
+
+var (
+	specSessionsMutex sync.Mutex
+	// specSessions are the bosh CLI invocations of each spec, by its context
+	// ID, until ForgetTasksForCurrentSpec.
+	specSessions = map[string][]specSession{}
+)
+
+// SpecContextID is the context ID the bosh CLI sends for the current spec,
+// which the director records with the tasks it starts.
+func SpecContextID() string {
+	return fmt.Sprintf("brats-%d-%d", GinkgoParallelProcess(), CurrentSpecReport().StartTime.UnixNano())
+}
+
+// startBosh runs the bosh CLI against director with the current spec's
+// context ID, and keeps the session to list the tasks it reported.
+func startBosh(director string, stdout, stderr io.Writer, binaryPath string, args ...string) *gexec.Session {
+	contextID := SpecContextID()
+	cmd := exec.Command(binaryPath, args...)
+	cmd.Env = append(os.Environ(), boshContextIDEnvVar+"="+contextID)
+
+	session, err := gexec.Start(cmd, stdout, stderr)
+	Expect(err).ToNot(HaveOccurred())
+
+	specSessionsMutex.Lock()
+	defer specSessionsMutex.Unlock()
+	specSessions[contextID] = append(specSessions[contextID], specSession{director: director, session: session})
+	return session
+}
+
+// TaskIDsFromOutput returns every director task a bosh CLI invocation
+// reported, in its human-readable or its --json output.
+func TaskIDsFromOutput(contents []byte) []int {
+	var jsonOutput struct {
+		Lines []string
+	}
+	if json.Unmarshal(contents, &jsonOutput) == nil {
+		contents = []byte(strings.Join(jsonOutput.Lines, "\n"))
+	}
+
+	var ids []int
+	seen := map[int]bool{}
+	for _, match := range taskIDPattern.FindAllSubmatch(contents, -1) {
+		id, err := strconv.Atoi(string(match[1]))
+		if err != nil || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// TasksForCurrentSpec lists the tasks the current spec started: those its
+// bosh CLI invocations reported, and those the inner director recorded
+// with its context ID, e.g. of an invocation that is still running.
+func TasksForCurrentSpec() []SpecTask {
+	tasks, err := tasksForSpec(SpecContextID())
+	Expect(err).NotTo(HaveOccurred())
+	return tasks
+}
+
+// tasksForSpec also returns the tasks it found when the inner director
+// cannot be asked. It reads the output of the spec's invocations as it is
+// now, so it sees the tasks of those that exited and of those still running
+// alike.
+func tasksForSpec(contextID string) ([]SpecTask, error) {
+	specSessionsMutex.Lock()
+	sessions := append([]specSession{}, specSessions[contextID]...)
+	specSessionsMutex.Unlock()
+
+	var tasks []SpecTask
+	for _, s := range sessions {
+		for _, id := range TaskIDsFromOutput(s.session.Out.Contents()) {
+			tasks = append(tasks, SpecTask{Director: s.director, ID: id})
+		}
+	}
+
+	var err error
+	if InnerBoshExists() {
+		err = InterceptGomegaFailure(func() {
+			recorded, err := InnerDirectorClient().Tasks(TasksFilter{ContextID: contextID, Verbose: 2, Limit: 1000})
+			Expect(err).NotTo(HaveOccurred())
+			for _, task := range recorded {
+				tasks = append(tasks, SpecTask{Director: InnerDirector, ID: task.ID})
+			}
+		})
+	}
+	return uniqueSpecTasks(tasks), err
+}
+
+func uniqueSpecTasks(tasks []SpecTask) []SpecTask {
+	seen := map[SpecTask]bool{}
+	unique := []SpecTask{}
+	for _, task := range tasks {
+		if !seen[task] {
+			seen[task] = true
+			unique = append(unique, task)
+		}
+	}
+	sort.Slice(unique, func(i, j int) bool {
+		if unique[i].Director != unique[j].Director {
+			return unique[i].Director < unique[j].Director
+		}
+		return unique[i].ID < unique[j].ID
+	})
+	return unique
+}
+
+// ReportTasksForCurrentSpec adds the tasks the current spec started to its
+// report. Call it from ReportAfterEach, before ForgetTasksForCurrentSpec.
+func ReportTasksForCurrentSpec() {
+	tasks, err := tasksForSpec(SpecContextID())
+	if err != nil {
+		fmt.Fprintf(GinkgoWriter, "listing the inner director's tasks of %s: %s\n", SpecContextID(), err)
+	}
+	if len(tasks) > 0 {
+		AddReportEntry(SpecTasksReportEntry, tasks, ReportEntryVisibilityFailureOrVerbose)
+	}
+}
+
+// ForgetTasksForCurrentSpec drops the bosh CLI invocations of the current
+// spec and their output. Call it last in ReportAfterEach.
+func ForgetTasksForCurrentSpec() {
+	specSessionsMutex.Lock()
+	defer specSessionsMutex.Unlock()
+	delete(specSessions, SpecContextID())
+}
@@ -0,0 +1,38 @@
+package utils_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"brats/utils"
+)
+
+var _ = Describe("spec tasks", func() {
+	DescribeTable("TaskIDsFromOutput",
+		func(output string, expected []int) {
+			Expect(utils.TaskIDsFromOutput([]byte(output))).To(Equal(expected))
+		},
+		Entry("human-readable output",
+			"Using environment '10.245.0.11' as client 'admin'\n\nTask 12\n\nTask 12 | 10:00:00 | Preparing deployment\n\nTask 12 done\n\nTask 14\n",
+			[]int{12, 14},
+		),
+		Entry("--json output",
+			`{"Tables": [], "Blocks": ["Task 7 | 10:00:00 | Updating instance"], "Lines": ["Using environment '10.245.0.11' as client 'admin'", "Task 7", "Task 7 done", "Succeeded"]}`,
+			[]int{7},
+		),
+		Entry("output of a command on an instance",
+			"bosh/0a1b: stdout | Task 3\n",
+			nil,
+		),
+		Entry("no tasks", "Succeeded\n", nil),
+	)
+
+	It("tells which director ran a task", func() {
+		Expect(utils.SpecTask{Director: utils.InnerDirector, ID: 12}.String()).To(Equal("inner/12"))
+	})
+
+	It("has a context ID for the current spec", func() {
+		Expect(utils.SpecContextID()).To(MatchRegexp(`^brats-\d+-\d+$`))
+		Expect(utils.SpecContextID()).To(Equal(utils.SpecContextID()))
+	})
+})
@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"crypto/tls"
+	"net/http"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:staticcheck
+	. "github.com/onsi/gomega"    //nolint:staticcheck
+
+	"brats/sshclient"
+)
+
+// innerDirectorSSHAliveTimeout is how long a reused connection has to
+// answer before it is replaced, e.g. after the director was recreated.
+const innerDirectorSSHAliveTimeout = 10 * time.Second
+
+var (
+	innerDirectorSSHMutex  sync.Mutex
+	innerDirectorSSHClient *sshclient.Client
+)
+
+// InnerDirectorSSHClient connects to the inner director VM as the jumpbox
+// user. The connection is shared by the specs of this process and replaced
+// once it stops answering; use Sudo for what needs root.
+func InnerDirectorSSHClient() *sshclient.Client {
+	innerDirectorSSHMutex.Lock()
+	defer innerDirectorSSHMutex.Unlock()
+
+	if innerDirectorSSHClient != nil {
+		if innerDirectorSSHClient.Alive(innerDirectorSSHAliveTimeout) {
+			return innerDirectorSSHClient
+		}
+		innerDirectorSSHClient.Close() //nolint:errcheck
+		innerDirectorSSHClient = nil
+	}
+
+	var err error
+	innerDirectorSSHClient, err = innerBosh.SSHClient()
+	Expect(err).NotTo(HaveOccurred())
+	return innerDirectorSSHClient
+}
+
+// closeInnerDirectorSSHClient drops the connection to a director that is
+// going away.
+func closeInnerDirectorSSHClient() {
+	innerDirectorSSHMutex.Lock()
+	defer innerDirectorSSHMutex.Unlock()
+
+	if innerDirectorSSHClient != nil {
+		innerDirectorSSHClient.Close() //nolint:errcheck
+		innerDirectorSSHClient = nil
+	}
+}
+
+// InnerDirectorRun runs a command on the inner director VM as root and
+// returns its output, failing the spec unless it succeeds.
+func InnerDirectorRun(command string) string {
+	result, err := InnerDirectorSSHClient().Sudo().Run(command)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(result.ExitStatus).To(BeZero(), "%q failed:\n%s", command, result.Stderr)
+	return string(result.Stdout)
+}
+
+// InnerDirectorForward forwards a local port to an address as seen from the
+// inner director VM, e.g. "127.0.0.1:25555", until the spec ends, and
+// returns the local address.
+func InnerDirectorForward(remoteAddress string) string {
+	forward, err := InnerDirectorSSHClient().Forward(remoteAddress)
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(forward.Close)
+	return forward.Address()
+}
+
+// InnerDirectorHTTPClient makes requests from the inner director VM, so
+// that e.g. http://127.0.0.1:8222 is its NATS monitoring endpoint. It does
+// not verify certificates, which are not issued for the loopback address.
+func InnerDirectorHTTPClient() *http.Client {
+	return &http.Client{
+		Timeout: time.Minute,
+		Transport: &http.Transport{
+			DialContext:     InnerDirectorSSHClient().DialContext,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, //nolint:gosec
+		},
+	}
+}
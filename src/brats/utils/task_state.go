@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	. "github.com/onsi/gomega" //nolint:staticcheck
+	"github.com/onsi/gomega/gexec"
+)
+
+// TaskStateReached reports whether a task is in one of the wanted states. The
+// queued, processing and cancelling states are transitional, so a task in any
+// of them may still get there; a finished task never will, which is reported
+// as an error.
+func TaskStateReached(task Task, wanted ...string) (bool, error) {
+	if slices.Contains(wanted, task.State) {
+		return true, nil
+	}
+
+	if task.Finished() {
+		return false, fmt.Errorf("task %d finished in state '%s' instead of one of %v: %s", task.ID, task.State, wanted, task.Result)
+	}
+
+	return false, nil
+}
+
+// WaitForTaskState polls the director until the task reaches one of the
+// wanted states and returns it, failing early once the task finished in any
+// other state.
+func WaitForTaskState(client *DirectorClient, id int, timeout time.Duration, wanted ...string) Task {
+	var task Task
+
+	Eventually(func() error {
+		var err error
+		task, err = client.Task(id)
+		if err != nil {
+			return err
+		}
+
+		reached, err := TaskStateReached(task, wanted...)
+		if err != nil {
+			return StopTrying(err.Error())
+		}
+		if !reached {
+			return fmt.Errorf("task %d is still '%s', waiting for one of %v", id, task.State, wanted)
+		}
+
+		return nil
+	}, timeout, 2*time.Second).Should(Succeed())
+
+	return task
+}
+
+// WaitForTaskLocks waits until the task holds at least one lock and returns
+// the locks it holds.
+func WaitForTaskLocks(client *DirectorClient, id int, timeout time.Duration) []Lock {
+	var held []Lock
+
+	Eventually(func() []Lock {
+		held = locksHeldBy(client, id)
+		return held
+	}, timeout, time.Second).ShouldNot(BeEmpty(), "task %d never acquired a lock", id)
+
+	return held
+}
+
+// WaitForTaskLocksReleased waits until the task holds no lock anymore. Locks
+// of a task whose process died are only dropped once they expire.
+func WaitForTaskLocksReleased(client *DirectorClient, id int, timeout time.Duration) {
+	Eventually(func() []Lock {
+		return locksHeldBy(client, id)
+	}, timeout, time.Second).Should(BeEmpty(), "task %d still holds locks", id)
+}
+
+// WaitForTaskID waits until a running bosh CLI invocation reports the
+// director task it started.
+func WaitForTaskID(session *gexec.Session, timeout time.Duration) int {
+	var id int
+
+	Eventually(func() bool {
+		var found bool
+		id, found = TaskIDFromOutput(session.Out.Contents())
+		return found
+	}, timeout, time.Second).Should(BeTrue(), "no task reported by %v", session.Command.Args)
+
+	return id
+}
+
+func locksHeldBy(client *DirectorClient, id int) []Lock {
+	locks, err := client.Locks()
+	Expect(err).NotTo(HaveOccurred())
+
+	var held []Lock
+	for _, lock := range locks {
+		if lock.TaskID == strconv.Itoa(id) {
+			held = append(held, lock)
+		}
+	}
+	return held
+}
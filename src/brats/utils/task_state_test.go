@@ -0,0 +1,45 @@
+package utils_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"brats/utils"
+)
+
+var _ = Describe("TaskStateReached", func() {
+	DescribeTable("tasks in a wanted state",
+		func(state string, wanted ...string) {
+			reached, err := utils.TaskStateReached(utils.Task{ID: 1, State: state}, wanted...)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reached).To(BeTrue())
+		},
+		Entry("processing", "processing", "processing"),
+		Entry("cancelling while waiting for cancellation", "cancelling", "cancelling", "cancelled"),
+		Entry("cancelled", "cancelled", "cancelled"),
+		Entry("timed out", "timeout", "timeout", "error"),
+	)
+
+	DescribeTable("tasks that may still reach a wanted state",
+		func(state string, wanted ...string) {
+			reached, err := utils.TaskStateReached(utils.Task{ID: 1, State: state}, wanted...)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reached).To(BeFalse())
+		},
+		Entry("queued", "queued", "processing"),
+		Entry("processing", "processing", "done"),
+		Entry("cancelling", "cancelling", "cancelled"),
+	)
+
+	DescribeTable("tasks that finished in another state",
+		func(state string, wanted ...string) {
+			reached, err := utils.TaskStateReached(utils.Task{ID: 1, State: state, Result: "fake-result"}, wanted...)
+			Expect(err).To(MatchError(And(ContainSubstring(state), ContainSubstring("fake-result"))))
+			Expect(reached).To(BeFalse())
+		},
+		Entry("done", "done", "cancelled"),
+		Entry("error", "error", "done"),
+		Entry("timeout", "timeout", "error"),
+		Entry("cancelled", "cancelled", "processing"),
+	)
+})
@@ -0,0 +1,268 @@
+package utils
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	. "github.com/onsi/gomega" //nolint:staticcheck
+	"github.com/onsi/gomega/gexec"
+)
+
+var taskIDPattern = regexp.MustCompile(`(?m)^Task (\d+)`)
+
+// TimelineSample is a snapshot of /tasks and /locks taken at a point in time.
+type TimelineSample struct {
+	At    time.Time
+	Tasks []Task
+	Locks []Lock
+}
+
+// TaskTimeline is the sequence of samples collected by a TaskRecorder.
+type TaskTimeline struct {
+	Samples []TimelineSample
+}
+
+// LockHold is a span of consecutive samples in which a task held a lock.
+type LockHold struct {
+	Name   string
+	TaskID string
+	From   time.Time
+	To     time.Time
+}
+
+func (h LockHold) Overlaps(other LockHold) bool {
+	return !h.To.Before(other.From) && !other.To.Before(h.From)
+}
+
+// TaskRecorder polls the director in the background until stopped.
+type TaskRecorder struct {
+	client   *DirectorClient
+	filter   TasksFilter
+	interval time.Duration
+
+	mu       sync.Mutex
+	timeline TaskTimeline
+	errs     []error
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func RecordTaskTimeline(client *DirectorClient, filter TasksFilter, interval time.Duration) *TaskRecorder {
+	r := &TaskRecorder{
+		client:   client,
+		filter:   filter,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go r.run()
+
+	return r
+}
+
+func (r *TaskRecorder) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.sample()
+
+		select {
+		case <-r.stop:
+			r.sample()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *TaskRecorder) sample() {
+	at := time.Now()
+	tasks, err := r.client.Tasks(r.filter)
+	if err == nil {
+		var locks []Lock
+		locks, err = r.client.Locks()
+		if err == nil {
+			r.mu.Lock()
+			r.timeline.Samples = append(r.timeline.Samples, TimelineSample{At: at, Tasks: tasks, Locks: locks})
+			r.mu.Unlock()
+			return
+		}
+	}
+
+	r.mu.Lock()
+	r.errs = append(r.errs, err)
+	r.mu.Unlock()
+}
+
+// Stop ends the recording and returns everything sampled so far. A handful of
+// failed polls is tolerated since the director can be briefly unavailable
+// while under load, but a recorder that never got a sample fails the spec.
+func (r *TaskRecorder) Stop() *TaskTimeline {
+	close(r.stop)
+	<-r.done
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	Expect(r.timeline.Samples).NotTo(BeEmpty(), "no samples recorded, errors: %v", r.errs)
+
+	return &r.timeline
+}
+
+// LockHolds returns every span in which the named lock was held, in order.
+func (t *TaskTimeline) LockHolds(name string) []LockHold {
+	var holds []LockHold
+	var current *LockHold
+
+	for _, sample := range t.Samples {
+		holder := ""
+		for _, lock := range sample.Locks {
+			if lock.Name() == name {
+				holder = lock.TaskID
+			}
+		}
+
+		if current != nil && current.TaskID == holder {
+			current.To = sample.At
+			continue
+		}
+
+		if current != nil {
+			holds = append(holds, *current)
+			current = nil
+		}
+
+		if holder != "" {
+			current = &LockHold{Name: name, TaskID: holder, From: sample.At, To: sample.At}
+		}
+	}
+
+	if current != nil {
+		holds = append(holds, *current)
+	}
+
+	return holds
+}
+
+// MaxConcurrentLocks is the largest number of locks of the given type held at
+// the same time in any sample.
+func (t *TaskTimeline) MaxConcurrentLocks(lockType string) int {
+	maximum := 0
+	for _, sample := range t.Samples {
+		count := 0
+		for _, lock := range sample.Locks {
+			if lock.Type == lockType {
+				count++
+			}
+		}
+		if count > maximum {
+			maximum = count
+		}
+	}
+	return maximum
+}
+
+// MaxConcurrentTasks is the largest number of tasks in the given state at the
+// same time in any sample.
+func (t *TaskTimeline) MaxConcurrentTasks(state string) int {
+	maximum := 0
+	for _, sample := range t.Samples {
+		count := 0
+		for _, task := range sample.Tasks {
+			if task.State == state {
+				count++
+			}
+		}
+		if count > maximum {
+			maximum = count
+		}
+	}
+	return maximum
+}
+
+// TaskStates lists the distinct states a task went through, in the order
+// they were observed.
+func (t *TaskTimeline) TaskStates(id int) []string {
+	var states []string
+	for _, sample := range t.Samples {
+		for _, task := range sample.Tasks {
+			if task.ID == id && (len(states) == 0 || states[len(states)-1] != task.State) {
+				states = append(states, task.State)
+			}
+		}
+	}
+	return states
+}
+
+// TaskIDs lists every task seen in any sample, in ascending order.
+func (t *TaskTimeline) TaskIDs() []int {
+	seen := map[int]bool{}
+	for _, sample := range t.Samples {
+		for _, task := range sample.Tasks {
+			seen[task.ID] = true
+		}
+	}
+
+	ids := make([]int, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	return ids
+}
+
+// LocksHeldBy returns the locks a task holds in the last sample.
+func (t *TaskTimeline) LocksHeldBy(taskID int) []Lock {
+	if len(t.Samples) == 0 {
+		return nil
+	}
+
+	var locks []Lock
+	for _, lock := range t.Samples[len(t.Samples)-1].Locks {
+		if lock.TaskID == strconv.Itoa(taskID) {
+			locks = append(locks, lock)
+		}
+	}
+	return locks
+}
+
+// StartConcurrently launches every bosh command against the inner director
+// without waiting for any of them.
+func StartConcurrently(commands ...[]string) []*gexec.Session {
+	sessions := make([]*gexec.Session, len(commands))
+	for i, args := range commands {
+		sessions[i] = Bosh(args...)
+	}
+	return sessions
+}
+
+func WaitForAll(sessions []*gexec.Session, timeout time.Duration) {
+	for _, session := range sessions {
+		Eventually(session, timeout).Should(gexec.Exit())
+	}
+}
+
+// TaskIDFromOutput returns the first director task a bosh CLI invocation
+// reported in its human-readable output.
+func TaskIDFromOutput(contents []byte) (int, bool) {
+	match := taskIDPattern.FindSubmatch(contents)
+	if match == nil {
+		return 0, false
+	}
+
+	id, err := strconv.Atoi(string(match[1]))
+	if err != nil {
+		return 0, false
+	}
+
+	return id, true
+}
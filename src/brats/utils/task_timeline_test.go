@@ -0,0 +1,106 @@
+package utils_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"brats/utils"
+)
+
+var _ = Describe("TaskTimeline", func() {
+	var (
+		start    time.Time
+		timeline *utils.TaskTimeline
+	)
+
+	deploymentLock := func(deployment, taskID string) utils.Lock {
+		return utils.Lock{Type: "deployment", Resource: []string{deployment}, TaskID: taskID}
+	}
+
+	BeforeEach(func() {
+		start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		timeline = &utils.TaskTimeline{Samples: []utils.TimelineSample{
+			{
+				At:    start,
+				Tasks: []utils.Task{{ID: 1, State: "processing"}, {ID: 2, State: "queued"}, {ID: 3, State: "queued"}},
+				Locks: []utils.Lock{deploymentLock("a", "1")},
+			},
+			{
+				At:    start.Add(time.Second),
+				Tasks: []utils.Task{{ID: 1, State: "processing"}, {ID: 2, State: "processing"}, {ID: 3, State: "queued"}},
+				Locks: []utils.Lock{deploymentLock("a", "1"), deploymentLock("b", "2")},
+			},
+			{
+				At:    start.Add(2 * time.Second),
+				Tasks: []utils.Task{{ID: 1, State: "done"}, {ID: 2, State: "processing"}, {ID: 3, State: "processing"}},
+				Locks: []utils.Lock{deploymentLock("b", "2"), deploymentLock("a", "3")},
+			},
+			{
+				At:    start.Add(3 * time.Second),
+				Tasks: []utils.Task{{ID: 1, State: "done"}, {ID: 2, State: "done"}, {ID: 3, State: "cancelling"}},
+				Locks: []utils.Lock{deploymentLock("a", "3")},
+			},
+			{
+				At:    start.Add(4 * time.Second),
+				Tasks: []utils.Task{{ID: 1, State: "done"}, {ID: 2, State: "done"}, {ID: 3, State: "cancelled"}},
+			},
+		}}
+	})
+
+	It("names locks after their type and resource", func() {
+		Expect(utils.Lock{Type: "stemcells", Resource: []string{"fake-os", "1.0"}}.Name()).To(Equal("stemcells:fake-os:1.0"))
+	})
+
+	It("groups consecutive samples into lock holds per task", func() {
+		Expect(timeline.LockHolds("deployment:a")).To(Equal([]utils.LockHold{
+			{Name: "deployment:a", TaskID: "1", From: start, To: start.Add(time.Second)},
+			{Name: "deployment:a", TaskID: "3", From: start.Add(2 * time.Second), To: start.Add(3 * time.Second)},
+		}))
+		Expect(timeline.LockHolds("deployment:missing")).To(BeEmpty())
+	})
+
+	It("detects overlapping lock holds", func() {
+		holdsA := timeline.LockHolds("deployment:a")
+		holdsB := timeline.LockHolds("deployment:b")
+
+		Expect(holdsA[0].Overlaps(holdsA[1])).To(BeFalse())
+		Expect(holdsA[0].Overlaps(holdsB[0])).To(BeTrue())
+		Expect(holdsB[0].Overlaps(holdsA[1])).To(BeTrue())
+	})
+
+	It("counts concurrently held locks and tasks", func() {
+		Expect(timeline.MaxConcurrentLocks("deployment")).To(Equal(2))
+		Expect(timeline.MaxConcurrentLocks("release")).To(Equal(0))
+		Expect(timeline.MaxConcurrentTasks("processing")).To(Equal(2))
+		Expect(timeline.MaxConcurrentTasks("queued")).To(Equal(2))
+	})
+
+	It("lists the states a task went through", func() {
+		Expect(timeline.TaskStates(3)).To(Equal([]string{"queued", "processing", "cancelling", "cancelled"}))
+		Expect(timeline.TaskIDs()).To(Equal([]int{1, 2, 3}))
+	})
+
+	It("lists the locks a task still holds at the end", func() {
+		Expect(timeline.LocksHeldBy(3)).To(BeEmpty())
+
+		timeline.Samples = timeline.Samples[:4]
+		Expect(timeline.LocksHeldBy(3)).To(Equal([]utils.Lock{deploymentLock("a", "3")}))
+	})
+
+	Context("TaskIDFromOutput", func() {
+		It("finds the task reported by the CLI", func() {
+			output := "Using environment '10.245.0.11' as client 'admin'\n\nTask 42\n\nTask 42 | 10:00:00 | Preparing deployment\n"
+
+			id, found := utils.TaskIDFromOutput([]byte(output))
+			Expect(found).To(BeTrue())
+			Expect(id).To(Equal(42))
+		})
+
+		It("reports output without a task", func() {
+			_, found := utils.TaskIDFromOutput([]byte("Succeeded\n"))
+			Expect(found).To(BeFalse())
+		})
+	})
+})
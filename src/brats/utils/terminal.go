@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"os/exec"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:staticcheck
+	. "github.com/onsi/gomega"    //nolint:staticcheck
+
+	"brats/terminal"
+)
+
+const (
+	// InnerDirectorShellPrompt is the prompt of the vcap user's shell on the
+	// inner director VM.
+	InnerDirectorShellPrompt = `bosh/[0-9a-f\-]{36}:~\$ $`
+	// InnerDirectorRootPrompt is the prompt of root's shell.
+	InnerDirectorRootPrompt = `bosh/[0-9a-f\-]{36}:~# $`
+)
+
+// InnerDirectorTerminal opens an interactive shell on the inner director VM
+// through `bosh ssh`, with InnerDirectorShellPrompt as its prompt. The
+// terminal is closed when the spec ends, and its transcript is added to the
+// report of a failed spec.
+func InnerDirectorTerminal() *terminal.Terminal {
+	term, err := terminal.Start(exec.Command(outerBoshBinaryPath, "-d", InnerBoshDirectorName(), "ssh", "bosh"), GinkgoWriter)
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(func() {
+		if CurrentSpecReport().Failed() {
+			AddReportEntry("terminal transcript", term.Transcript())
+		}
+		term.Close() //nolint:errcheck
+	})
+
+	Expect(term.SetPrompt(InnerDirectorShellPrompt)).To(Succeed())
+	return term
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:staticcheck
+	. "github.com/onsi/gomega"    //nolint:staticcheck
+	"github.com/onsi/gomega/gexec"
+)
+
+// StartOuterTunnel forwards a local port to remote, an address as seen from
+// an instance of a deployment of the outer director, through `bosh ssh`,
+// until the spec ends. It returns the local address.
+func StartOuterTunnel(deployment, instance, remote string) string {
+	return startTunnel(OuterBosh, deployment, instance, remote)
+}
+
+func startTunnel(bosh func(args ...string) *gexec.Session, deployment, instance, remote string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	port := listener.Addr().(*net.TCPAddr).Port
+	Expect(listener.Close()).To(Succeed())
+
+	local := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	session := bosh("-d", deployment, "ssh", instance,
+		"--opts", "-L", "--opts", local+":"+remote,
+		"-c", "sleep 3600",
+	)
+	DeferCleanup(func() {
+		session.Kill()
+		Eventually(session, time.Minute).Should(gexec.Exit())
+	})
+
+	Eventually(func() error {
+		conn, err := net.Dial("tcp", local)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}, 2*time.Minute, time.Second).Should(Succeed(), "ssh tunnel to %s on %s", remote, instance)
+
+	return local
+}
@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:staticcheck
+	. "github.com/onsi/gomega"    //nolint:staticcheck
+	"github.com/onsi/gomega/gexec"
+
+	"brats/db"
+)
+
+// UpgradeScenario deploys the inner director from the last final release,
+// lets Workloads create objects on it, and upgrades it to the candidate
+// release the suite uploaded.
+type UpgradeScenario struct {
+	// Options are passed to StartInnerBosh for both the previous and the
+	// candidate director, e.g. to point both at the same config server.
+	Options []string
+	// Workloads creates the objects the upgrade must preserve.
+	Workloads func()
+}
+
+type UpgradeResult struct {
+	PreviousVersion  string
+	CandidateVersion string
+	Before           DirectorSnapshot
+	After            DirectorSnapshot
+}
+
+func (s UpgradeScenario) Run() UpgradeResult {
+	// A director that already ran the candidate's migrations cannot be
+	// downgraded, so the previous release starts from an empty database.
+	if InnerBoshExists() {
+		By("deleting the existing inner director")
+		StopInnerBosh()
+	}
+
+	By("deploying the inner director from the last final release")
+	StartInnerBosh(append(append([]string{}, s.Options...), InnerBoshWithPreviousReleaseOptions()...)...)
+
+	var result UpgradeResult
+	result.PreviousVersion = innerDirectorVersion()
+
+	By("creating workloads on the previous director")
+	s.Workloads()
+
+	var err error
+	result.Before, err = SnapshotDirector(InnerDirectorClient())
+	Expect(err).NotTo(HaveOccurred())
+
+	By("upgrading the inner director to the candidate release")
+	StartInnerBosh(s.Options...)
+
+	result.CandidateVersion = innerDirectorVersion()
+	result.After, err = SnapshotDirector(InnerDirectorClient())
+	Expect(err).NotTo(HaveOccurred())
+
+	return result
+}
+
+// InnerBoshWithPreviousReleaseOptions deploys the director release
+// bosh-deployment pins, i.e. the last final release, instead of the
+// candidate.
+func InnerBoshWithPreviousReleaseOptions() []string {
+	release := func(field string) string {
+		session := ExecCommandQuiet(outerBoshBinaryPath, "int",
+			BoshDeploymentAssetPath("bosh.yml"),
+			"-o", BoshDeploymentAssetPath("misc/source-releases/bosh.yml"),
+			"--path", "/releases/name=bosh/"+field,
+		)
+		Eventually(session, time.Minute).Should(gexec.Exit(0))
+		return strings.TrimSpace(string(session.Out.Contents()))
+	}
+
+	return []string{
+		"-o", AssetPath("ops-previous-bosh-release.yml"),
+		"-v", fmt.Sprintf("previous_bosh_version=%s", release("version")),
+		"-v", fmt.Sprintf("previous_bosh_url=%s", release("url")),
+		"-v", fmt.Sprintf("previous_bosh_sha1=%s", release("sha1")),
+	}
+}
+
+// DirectorMigration is a row of the director's schema_migrations table,
+// which Sequel keeps by migration file name.
+type DirectorMigration struct {
+	Filename string
+}
+
+// ExpectedDirectorMigrations are the migrations of the director in this
+// tree.
+func ExpectedDirectorMigrations() []DirectorMigration {
+	paths, err := filepath.Glob(filepath.Join(repoRoot(), "src", "bosh-director", "db", "migrations", "*.rb"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(paths).NotTo(BeEmpty())
+
+	migrations := make([]DirectorMigration, len(paths))
+	for i, path := range paths {
+		migrations[i] = DirectorMigration{Filename: filepath.Base(path)}
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Filename < migrations[j].Filename })
+	return migrations
+}
+
+// AppliedDirectorMigrations reads the migrations the inner director's
+// database has recorded as applied, through a tunnel to the postgres that
+// only listens on the director VM's loopback interface.
+func AppliedDirectorMigrations() []DirectorMigration {
+	host, port, err := net.SplitHostPort(InnerDirectorForward("127.0.0.1:5432"))
+	Expect(err).NotTo(HaveOccurred())
+	portNumber, err := strconv.Atoi(port)
+	Expect(err).NotTo(HaveOccurred())
+
+	conn, err := db.Config{
+		Type:      db.Postgres,
+		Host:      host,
+		Port:      portNumber,
+		User:      "postgres",
+		Password:  InnerBoshCredential("/postgres_password"),
+		Plaintext: true,
+	}.Open("bosh")
+	Expect(err).NotTo(HaveOccurred())
+	defer conn.Close() //nolint:errcheck
+
+	rows, err := conn.Query("SELECT filename FROM schema_migrations ORDER BY filename")
+	Expect(err).NotTo(HaveOccurred())
+	defer rows.Close() //nolint:errcheck
+
+	var migrations []DirectorMigration
+	for rows.Next() {
+		var migration DirectorMigration
+		Expect(rows.Scan(&migration.Filename)).To(Succeed())
+		migrations = append(migrations, migration)
+	}
+	Expect(rows.Err()).NotTo(HaveOccurred())
+	return migrations
+}
+
+func innerDirectorVersion() string {
+	var info struct {
+		Version string `json:"version"`
+	}
+	Expect(InnerDirectorClient().Get("/info", nil, &info)).To(Succeed())
+	return info.Version
+}
@@ -5,11 +5,11 @@ import (
 	"crypto/x509"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 
@@ -17,16 +17,14 @@ import (
 	. "github.com/onsi/gomega"    //nolint:staticcheck
 	"github.com/onsi/gomega/gbytes"
 	"github.com/onsi/gomega/gexec"
+
+	"brats/db"
+	"brats/fakes/externaldb"
 )
 
 const (
-	mysqlDBType    = "mysql"
-	postgresDBType = "postgres"
-
-	mysqlDbCmd    = "mysql"
-	postgresDBCmd = "psql"
-
 	skipCleanupEnvVar = "BRATS_SKIP_CLEANUP"
+	jumpboxUser       = "jumpbox"
 )
 
 func repoRoot() string {
@@ -34,7 +32,9 @@ func repoRoot() string {
 }
 
 type ExternalDBConfig struct {
-	Host     string
+	Host string
+	// Port overrides the port in ConnectionVarFile, if set.
+	Port     int
 	Type     string
 	User     string
 	Password string
@@ -48,6 +48,25 @@ type ExternalDBConfig struct {
 	ConnectionOptionsFile string
 }
 
+type ConfigServerConfig struct {
+	URL          string
+	UAAURL       string
+	CACertPath   string
+	ClientID     string
+	ClientSecret string
+}
+
+// UAAConfig points the inner director at a UAA, e.g. the fake in
+// brats/fakes/uaa. The health monitor and nats-sync authenticate as the "hm"
+// and "nats" clients.
+type UAAConfig struct {
+	URL                 string
+	CACertPath          string
+	VerificationKeyPath string
+	HMClientSecret      string
+	NATSClientSecret    string
+}
+
 var (
 	outerBoshBinaryPath,
 	boshBinaryPath,
@@ -58,61 +77,81 @@ var (
 	boshDirectorReleasePath,
 	stemcellOS string
 	startInnerBoshTimeout time.Duration
+
+	innerBosh InnerBosh
+
+	environment *Environment
 )
 
-func Bootstrap() {
-	outerBoshBinaryPath = AssertEnvExists("BOSH_BINARY_PATH")
+// Bootstrap loads and validates the environment, with the fields every
+// suite needs and those in required, and fails with every problem it
+// finds.
+func Bootstrap(required ...EnvironmentField) {
+	env, err := ExportEnvironment(required...)
+	Expect(err).NotTo(HaveOccurred())
+	environment = env
 
-	innerDirectorUser = "jumpbox"
-	innerBoshPath = fmt.Sprintf("/tmp/inner-bosh/director/%d", GinkgoParallelProcess())
-	boshBinaryPath = filepath.Join(innerBoshPath, "bosh")
-	innerBoshJumpboxPrivateKeyPath = filepath.Join(innerBoshPath, "jumpbox_private_key.pem")
-	innerDirectorIP = fmt.Sprintf("10.245.0.%d", 10+GinkgoParallelProcess())
-	boshDirectorReleasePath = AssertEnvExists("BOSH_DIRECTOR_RELEASE_PATH")
-	stemcellOS = AssertEnvExists("STEMCELL_OS")
+	outerBoshBinaryPath = env.Paths.BoshBinary
 
-	AssertEnvExists("BOSH_ENVIRONMENT")
-	AssertEnvExists("BOSH_DEPLOYMENT_PATH")
+	innerBosh = NewInnerBosh(GinkgoParallelProcess())
+	innerBosh.BoshBinary = env.Paths.BoshBinary
+	innerDirectorUser = jumpboxUser
+	innerBoshPath = innerBosh.Dir
+	boshBinaryPath = innerBosh.BoshPath()
+	innerBoshJumpboxPrivateKeyPath = innerBosh.JumpboxPrivateKeyPath()
+	innerDirectorIP = innerBosh.IP()
+	boshDirectorReleasePath = env.Releases.BoshDirector
+	stemcellOS = env.Stemcells.OS
 
-	startInnerBoshTimeoutString := LoadEnvOrDefault("START_INNER_BOSH_TIMEOUT", "45m")
-	var err error
-	startInnerBoshTimeout, err = time.ParseDuration(startInnerBoshTimeoutString)
+	startInnerBoshTimeout = env.StartInnerBoshTimeout()
+}
+
+// Env is the environment Bootstrap loaded, or, before it ran, the one the
+// environment file and variables describe.
+func Env() *Environment {
+	if environment != nil {
+		return environment
+	}
+	env, err := LoadEnvironment()
 	Expect(err).NotTo(HaveOccurred())
+	return env
 }
 
 func LoadExternalDBConfig(iaasAndDbName string, mutualTLSEnabled bool, tmpCertDir string) *ExternalDBConfig {
 	var databaseType string
-	if strings.HasSuffix(iaasAndDbName, mysqlDBType) {
-		databaseType = mysqlDBType
+	if strings.HasSuffix(iaasAndDbName, db.MySQL) {
+		databaseType = db.MySQL
 	} else {
-		databaseType = postgresDBType
+		databaseType = db.Postgres
 	}
 
+	externalDB, err := Env().ExternalDB(iaasAndDbName, mutualTLSEnabled)
+	Expect(err).NotTo(HaveOccurred())
+
 	config := ExternalDBConfig{
 		Type:                  databaseType,
-		Host:                  AssertEnvExists(fmt.Sprintf("%s_EXTERNAL_DB_HOST", strings.ToUpper(iaasAndDbName))),
-		User:                  AssertEnvExists(fmt.Sprintf("%s_EXTERNAL_DB_USER", strings.ToUpper(iaasAndDbName))),
-		Password:              AssertEnvExists(fmt.Sprintf("%s_EXTERNAL_DB_PASSWORD", strings.ToUpper(iaasAndDbName))),
+		Host:                  externalDB.Host,
+		User:                  externalDB.User,
+		Password:              externalDB.Password,
 		DBName:                fmt.Sprintf("db_%s_%d", databaseType, GinkgoParallelProcess()),
 		ConnectionVarFile:     fmt.Sprintf("external_db/%s.yml", iaasAndDbName),
 		ConnectionOptionsFile: fmt.Sprintf("external_db/%s_connection_options.yml", iaasAndDbName),
 	}
 
-	caContents := []byte(os.Getenv(fmt.Sprintf("%s_EXTERNAL_DB_CA", strings.ToUpper(iaasAndDbName))))
+	caContents := []byte(externalDB.CA)
 	if len(caContents) == 0 {
-		var err error
 		caContents, err = exec.Command(outerBoshBinaryPath, "int", AssetPath(config.ConnectionVarFile), "--path", "/db_ca").Output()
 		Expect(err).ToNot(HaveOccurred())
 	}
 	caCertFilepath := filepath.Join(tmpCertDir, "db_ca")
-	err := os.WriteFile(caCertFilepath, caContents, 0644)
+	err = os.WriteFile(caCertFilepath, caContents, 0644)
 	Expect(err).ToNot(HaveOccurred())
 
 	config.CACertPath = caCertFilepath
 
 	if mutualTLSEnabled {
-		clientCertContents := AssertEnvExists(fmt.Sprintf("%s_EXTERNAL_DB_CLIENT_CERTIFICATE", strings.ToUpper(iaasAndDbName)))
-		clientKeyContents := AssertEnvExists(fmt.Sprintf("%s_EXTERNAL_DB_CLIENT_PRIVATE_KEY", strings.ToUpper(iaasAndDbName)))
+		clientCertContents := externalDB.ClientCertificate
+		clientKeyContents := externalDB.ClientPrivateKey
 
 		clientCertFilePath := filepath.Join(tmpCertDir, "client_cert")
 		err = os.WriteFile(clientCertFilePath, []byte(clientCertContents), 0644)
@@ -129,6 +168,51 @@ func LoadExternalDBConfig(iaasAndDbName string, mutualTLSEnabled bool, tmpCertDi
 	return &config
 }
 
+// StartLocalExternalDB starts a local postgres or mysql on the address the
+// inner director reaches this host at, stopped when the spec ends. The
+// returned config deploys the director against it with
+// InnerBoshWithExternalDBOptions. The spec fails if the database server is
+// not installed, see POSTGRES_BIN_DIR and MYSQL_BIN_DIR.
+func StartLocalExternalDB(databaseType string, mutualTLSEnabled bool) (*externaldb.Server, *ExternalDBConfig) {
+	binDirEnv, binary := "POSTGRES_BIN_DIR", "initdb"
+	if databaseType == db.MySQL {
+		binDirEnv, binary = "MYSQL_BIN_DIR", "mysqld"
+	}
+	binDir := os.Getenv(binDirEnv)
+	if binDir == "" {
+		if _, err := exec.LookPath(binary); err != nil {
+			Fail(fmt.Sprintf("%s is not installed; install it or set %s to run the local external database specs", binary, binDirEnv))
+		}
+	}
+
+	server, err := externaldb.Start(externaldb.Config{
+		Type:      databaseType,
+		Host:      LocalIPForInnerDirector(),
+		BinDir:    binDir,
+		MutualTLS: mutualTLSEnabled,
+	})
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(server.Close)
+
+	config := &ExternalDBConfig{
+		Type:                  databaseType,
+		Host:                  server.Host(),
+		Port:                  server.Port(),
+		User:                  externaldb.User,
+		Password:              server.Password(),
+		DBName:                fmt.Sprintf("db_%s_%d", databaseType, GinkgoParallelProcess()),
+		CACertPath:            server.CACertPath(),
+		ConnectionVarFile:     fmt.Sprintf("external_db/local_%s.yml", databaseType),
+		ConnectionOptionsFile: fmt.Sprintf("external_db/local_%s_connection_options.yml", databaseType),
+	}
+	if mutualTLSEnabled {
+		config.ClientCertPath = server.ClientCertPath()
+		config.ClientKeyPath = server.ClientKeyPath()
+	}
+
+	return server, config
+}
+
 func MetricsServerHTTPClient() *http.Client {
 	cmd := exec.Command("bosh", "int", filepath.Join(innerBoshPath, "creds.yml"), "--path", "/metrics_server_client_tls/ca")
 	caCertificateData, err := cmd.Output()
@@ -165,124 +249,49 @@ func MetricsServerHTTPClient() *http.Client {
 	return &http.Client{Transport: httpTransport}
 }
 
-func DeleteDB(dbConfig *ExternalDBConfig) {
-	if dbConfig == nil {
-		return
+// DBConfig reaches the database over TLS the way the director will: with
+// mutual TLS, the director skips the host check as well.
+func (c *ExternalDBConfig) DBConfig() db.Config {
+	config := db.Config{
+		Type:           c.Type,
+		Host:           c.Host,
+		Port:           c.Port,
+		User:           c.User,
+		Password:       c.Password,
+		CACertPath:     c.CACertPath,
+		ClientCertPath: c.ClientCertPath,
+		ClientKeyPath:  c.ClientKeyPath,
+		Verification:   db.VerifyFull,
 	}
-
-	if dbConfig.Type == mysqlDBType { //nolint:staticcheck
-		deleteMySQL(dbConfig)
-	} else if dbConfig.Type == postgresDBType {
-		deletePostgres(dbConfig)
+	if c.ClientCertPath != "" || c.ClientKeyPath != "" {
+		config.Verification = db.VerifyCA
 	}
+	return config
 }
 
-func deleteMySQL(dbConfig *ExternalDBConfig) {
-	dropArgs := GenerateMySQLCommand(
-		fmt.Sprintf("drop database if exists %s;", dbConfig.DBName),
-		dbConfig,
-	)
-
-	session := ExecCommand(mysqlDbCmd, dropArgs...)
-	Eventually(session, 2*time.Minute).Should(gexec.Exit(0))
-}
-
-func deletePostgres(dbConfig *ExternalDBConfig) {
-	dropArgs := GeneratePSQLCommand(fmt.Sprintf("drop database if exists %s;", dbConfig.DBName), dbConfig)
-
-	session := ExecCommand(postgresDBCmd, dropArgs...)
-	Eventually(session, 2*time.Minute).Should(gexec.Exit(0))
-}
-
-func CreateDB(dbConfig *ExternalDBConfig) {
+func DeleteDB(dbConfig *ExternalDBConfig) {
 	if dbConfig == nil {
 		return
 	}
 
-	if dbConfig.Type == mysqlDBType { //nolint:staticcheck
-		createMySQL(dbConfig)
-	} else if dbConfig.Type == postgresDBType {
-		createPostgres(dbConfig)
-	}
-}
-
-func createMySQL(dbConfig *ExternalDBConfig) {
-	args := GenerateMySQLCommand(
-		fmt.Sprintf("drop database if exists %s; create database %s;", dbConfig.DBName, dbConfig.DBName),
-		dbConfig,
-	)
-
-	session := ExecCommand(mysqlDbCmd, args...)
-	Eventually(session, 2*time.Minute).Should(gexec.Exit(0))
-}
-
-func createPostgres(dbConfig *ExternalDBConfig) {
-	dropArgs := GeneratePSQLCommand(fmt.Sprintf("drop database if exists %s;", dbConfig.DBName), dbConfig)
-
-	session := ExecCommand(postgresDBCmd, dropArgs...)
-	Eventually(session, 2*time.Minute).Should(gexec.Exit(0))
-
-	createArgs := GeneratePSQLCommand(fmt.Sprintf("create database %s;", dbConfig.DBName), dbConfig)
-
-	session = ExecCommand(postgresDBCmd, createArgs...)
-	Eventually(session, 2*time.Minute).Should(gexec.Exit(0))
-}
-
-func GenerateMySQLCommand(sqlToExecute string, dbConfig *ExternalDBConfig) []string {
-	args := []string{
-		"-h",
-		dbConfig.Host,
-		fmt.Sprintf("--user=%s", dbConfig.User),
-		fmt.Sprintf("--password=%s", dbConfig.Password),
-		"-e", sqlToExecute,
-		fmt.Sprintf("--ssl-ca=%s", dbConfig.CACertPath),
-	}
-
-	if dbConfig.ClientCertPath != "" || dbConfig.ClientKeyPath != "" {
-		args = append(args,
-			fmt.Sprintf("--ssl-cert=%s", dbConfig.ClientCertPath),
-			fmt.Sprintf("--ssl-key=%s", dbConfig.ClientKeyPath),
-			"--ssl-mode=VERIFY_CA",
-		)
-	} else {
-		args = append(args, "--ssl-mode=VERIFY_IDENTITY")
-	}
+	client, err := db.Connect(dbConfig.DBConfig())
+	Expect(err).NotTo(HaveOccurred())
+	defer client.Close() //nolint:errcheck
 
-	return args
+	Expect(client.DropDatabase(dbConfig.DBName)).To(Succeed())
 }
 
-func GeneratePSQLCommand(sqlToExecute string, dbConfig *ExternalDBConfig) []string {
-	connectionStr := fmt.Sprintf("dbname=postgres host=%s user=%s password=%s sslrootcert=%s ",
-		dbConfig.Host,
-		dbConfig.User,
-		dbConfig.Password,
-		dbConfig.CACertPath,
-	)
-
-	if dbConfig.ClientCertPath != "" || dbConfig.ClientKeyPath != "" {
-		connectionStr += fmt.Sprintf("sslcert=%s sslkey=%s sslmode=verify-ca ",
-			dbConfig.ClientCertPath,
-			dbConfig.ClientKeyPath,
-		)
-	} else {
-		connectionStr += "sslmode=verify-full "
-	}
-
-	args := []string{
-		connectionStr,
-		"-c",
-		sqlToExecute,
+func CreateDB(dbConfig *ExternalDBConfig) {
+	if dbConfig == nil {
+		return
 	}
 
-	return args
-}
+	client, err := db.Connect(dbConfig.DBConfig())
+	Expect(err).NotTo(HaveOccurred())
+	defer client.Close() //nolint:errcheck
 
-func AssertEnvExists(envName string) string {
-	val, found := os.LookupEnv(envName)
-	if !found {
-		Fail(fmt.Sprintf("Expected %s", envName))
-	}
-	return val
+	Expect(client.DropDatabase(dbConfig.DBName)).To(Succeed())
+	Expect(client.CreateDatabase(dbConfig.DBName)).To(Succeed())
 }
 
 func LoadEnvOrDefault(envName string, envDefault string) string {
@@ -330,16 +339,7 @@ func StartInnerBosh(args ...string) {
 }
 
 func StartInnerBoshWithExpectation(expectedFailure bool, expectedErrorToMatch string, args ...string) {
-	effectiveArgs := []string{strconv.Itoa(GinkgoParallelProcess())}
-	effectiveArgs = append(effectiveArgs, args...)
-
-	cmd := exec.Command(
-		filepath.Join(repoRoot(), "ci", "dockerfiles", "docker-cpi", "start-inner-bosh-parallel.sh"),
-		effectiveArgs...,
-	)
-	cmd.Env = os.Environ()
-
-	session, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+	session, err := gexec.Start(innerBosh.StartCommand(repoRoot(), args...), GinkgoWriter, GinkgoWriter)
 	Expect(err).ToNot(HaveOccurred())
 
 	if expectedFailure {
@@ -351,14 +351,7 @@ func StartInnerBoshWithExpectation(expectedFailure bool, expectedErrorToMatch st
 }
 
 func CreateAndUploadBOSHRelease() {
-	cmd := exec.Command(
-		filepath.Join(repoRoot(), "ci", "dockerfiles", "docker-cpi", "create-and-upload-release.sh"),
-		strconv.Itoa(GinkgoParallelProcess()),
-	)
-	cmd.Env = os.Environ()
-	cmd.Env = append(cmd.Env, fmt.Sprintf("bosh_release_path=%s", boshDirectorReleasePath))
-
-	session, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+	session, err := gexec.Start(innerBosh.UploadReleasesCommand(repoRoot(), boshDirectorReleasePath), GinkgoWriter, GinkgoWriter)
 	Expect(err).ToNot(HaveOccurred())
 	Eventually(session, 10*time.Minute).Should(gexec.Exit(0))
 }
@@ -369,14 +362,9 @@ func CreateRelease(path string) {
 }
 
 func StopInnerBosh() {
-	session, err := gexec.Start(
-		exec.Command(
-			filepath.Join(repoRoot(), "ci", "dockerfiles", "docker-cpi", "destroy-inner-bosh.sh"),
-			strconv.Itoa(GinkgoParallelProcess()),
-		),
-		GinkgoWriter,
-		GinkgoWriter,
-	)
+	closeInnerDirectorSSHClient()
+
+	session, err := gexec.Start(innerBosh.StopCommand(repoRoot()), GinkgoWriter, GinkgoWriter)
 	Expect(err).ToNot(HaveOccurred())
 	Eventually(session, 15*time.Minute).Should(gexec.Exit(0))
 }
@@ -384,33 +372,54 @@ func StopInnerBosh() {
 func InnerBoshExists() bool {
 	// If the inner BOSH has not been started, then the BOSH helper script will
 	// not exist.
-	_, err := os.Stat(BoshBinaryPath())
-	if os.IsNotExist(err) {
-		return false
-	}
+	deployed, err := innerBosh.Deployed()
 	Expect(err).NotTo(HaveOccurred())
-	return true
+	return deployed
 }
 
 func BoshDeploymentAssetPath(assetPath string) string {
-	return filepath.Join(os.Getenv("BOSH_DEPLOYMENT_PATH"), assetPath)
+	return filepath.Join(Env().Paths.BoshDeployment, assetPath)
 }
 
 func OuterBosh(args ...string) *gexec.Session {
-	return ExecCommand(outerBoshBinaryPath, args...)
+	return startBosh(OuterDirector, GinkgoWriter, GinkgoWriter, outerBoshBinaryPath, args...)
 }
 
 func OuterBoshQuiet(args ...string) *gexec.Session {
-	return ExecCommandQuiet(outerBoshBinaryPath, args...)
+	return startBosh(OuterDirector, io.Discard, io.Discard, outerBoshBinaryPath, args...)
+}
+
+// innerDirectorTarball archives paths on the inner director VM; those that
+// do not exist are left out.
+func innerDirectorTarball(paths ...string) string {
+	return InnerDirectorRun(InnerDirectorTarballCommand(paths...))
+}
+
+// FetchInnerDirectorFiles copies files from the inner director VM, keyed by
+// their path there. Paths may be directories or shell globs; those that do
+// not exist are left out.
+func FetchInnerDirectorFiles(paths ...string) map[string]string {
+	tarball := innerDirectorTarball(paths...)
+
+	path := filepath.Join(GinkgoT().TempDir(), "files.tgz")
+	Expect(os.WriteFile(path, []byte(tarball), 0600)).To(Succeed())
+	entries, err := ReadLogsTarball(path)
+	Expect(err).NotTo(HaveOccurred())
+
+	files := make(map[string]string, len(entries))
+	for name, contents := range entries {
+		files["/"+name] = contents
+	}
+	return files
 }
 
 func Bosh(args ...string) *gexec.Session {
 	By(fmt.Sprintf("Bosh '%s %s'", boshBinaryPath, strings.Join(args, " ")))
-	return ExecCommand(boshBinaryPath, args...)
+	return startBosh(InnerDirector, GinkgoWriter, GinkgoWriter, boshBinaryPath, args...)
 }
 
 func BoshQuiet(args ...string) *gexec.Session {
-	return ExecCommandQuiet(boshBinaryPath, args...)
+	return startBosh(InnerDirector, io.Discard, io.Discard, boshBinaryPath, args...)
 }
 
 func UploadStemcell(stemcellURL string) {
@@ -429,34 +438,75 @@ func UploadReleaseDir(releaseDir string) {
 }
 
 func InnerBoshDirectorName() string {
-	return fmt.Sprintf("bosh-%d", GinkgoParallelProcess())
+	return NewInnerBosh(GinkgoParallelProcess()).DeploymentName()
 }
 
+// InnerBoshWithExternalDBOptions deploys the inner director against the
+// database of dbConfig. The certificates are passed with --var-file: the
+// config only holds their paths, and the director needs their contents.
 func InnerBoshWithExternalDBOptions(dbConfig *ExternalDBConfig) []string {
 	options := []string{
 		"-o", BoshDeploymentAssetPath("misc/external-db.yml"),
 		"-o", BoshDeploymentAssetPath("experimental/db-enable-tls.yml"),
 		"-o", AssetPath(dbConfig.ConnectionOptionsFile),
 		"--vars-file", AssetPath(dbConfig.ConnectionVarFile),
-		fmt.Sprintf("--var=db_ca=%s", dbConfig.CACertPath),
+		fmt.Sprintf("--var-file=db_ca=%s", dbConfig.CACertPath),
 		"-v", fmt.Sprintf("external_db_host=%s", dbConfig.Host),
 		"-v", fmt.Sprintf("external_db_user=%s", dbConfig.User),
 		"-v", fmt.Sprintf("external_db_password=%s", dbConfig.Password),
 		"-v", fmt.Sprintf("external_db_name=%s", dbConfig.DBName),
 	}
 
+	if dbConfig.Port != 0 {
+		options = append(options, "-v", fmt.Sprintf("external_db_port=%d", dbConfig.Port))
+	}
+
 	if dbConfig.ClientCertPath != "" || dbConfig.ClientKeyPath != "" {
 		options = append(options,
 			fmt.Sprintf("-o %s", BoshDeploymentAssetPath("experimental/db-enable-mutual-tls.yml")),
 			fmt.Sprintf("-o %s", AssetPath("tls-skip-host-verify.yml")),
-			fmt.Sprintf("--var=db_client_certificate=%s", dbConfig.ClientCertPath),
-			fmt.Sprintf("--var=db_client_private_key=%s", dbConfig.ClientKeyPath),
+			fmt.Sprintf("--var-file=db_client_certificate=%s", dbConfig.ClientCertPath),
+			fmt.Sprintf("--var-file=db_client_private_key=%s", dbConfig.ClientKeyPath),
 		)
 	}
 
 	return options
 }
 
+func InnerBoshWithConfigServerOptions(config ConfigServerConfig) []string {
+	return []string{
+		"-o", AssetPath("ops-config-server.yml"),
+		"-v", fmt.Sprintf("config_server_url=%s", config.URL),
+		"-v", fmt.Sprintf("config_server_uaa_url=%s", config.UAAURL),
+		"-v", fmt.Sprintf("config_server_client_id=%s", config.ClientID),
+		"-v", fmt.Sprintf("config_server_client_secret=%s", config.ClientSecret),
+		fmt.Sprintf("--var-file=config_server_ca=%s", config.CACertPath),
+	}
+}
+
+func InnerBoshWithUAAOptions(config UAAConfig) []string {
+	return append(uaaVars(config),
+		"-o", AssetPath("ops-uaa-user-management.yml"),
+		"-v", fmt.Sprintf("uaa_hm_client_secret=%s", config.HMClientSecret),
+		"-v", fmt.Sprintf("uaa_nats_client_secret=%s", config.NATSClientSecret),
+	)
+}
+
+// InnerBoshWithConfigServerUAAOptions makes the director fetch config server
+// tokens from the given UAA instead of the config server itself. It goes
+// after InnerBoshWithConfigServerOptions.
+func InnerBoshWithConfigServerUAAOptions(config UAAConfig) []string {
+	return append(uaaVars(config), "-o", AssetPath("ops-config-server-uaa.yml"))
+}
+
+func uaaVars(config UAAConfig) []string {
+	return []string{
+		"-v", fmt.Sprintf("uaa_url=%s", config.URL),
+		fmt.Sprintf("--var-file=uaa_ca=%s", config.CACertPath),
+		fmt.Sprintf("--var-file=uaa_jwt_verification_key=%s", config.VerificationKeyPath),
+	}
+}
+
 func SuiteCleanup() {
 	if SkipCleanup() {
 		return
@@ -490,6 +540,16 @@ func CleanupInnerBoshDeployments() {
 	}
 }
 
+// LocalIPForInnerDirector is the address of this machine on its route to the
+// inner director, for servers the inner director has to call back into.
+func LocalIPForInnerDirector() string {
+	conn, err := net.Dial("udp", net.JoinHostPort(innerDirectorIP, "25555"))
+	Expect(err).NotTo(HaveOccurred())
+	defer conn.Close() //nolint:errcheck
+
+	return conn.LocalAddr().(*net.UDPAddr).IP.String()
+}
+
 func StemcellOS() string                     { return stemcellOS }
 func BoshBinaryPath() string                 { return boshBinaryPath }
 func OuterBoshBinaryPath() string            { return outerBoshBinaryPath }
@@ -8,6 +8,7 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"brats/db"
 	"brats/utils"
 )
 
@@ -127,194 +128,60 @@ var _ = Describe("Utils", func() {
 		})
 	})
 
-	Context("GenerateMySQLCommand", func() {
+	Context("DBConfig", func() {
 		var externalDBConfig *utils.ExternalDBConfig
-		var dbType = "mysql"
-		var sqlToExecute string
 
 		BeforeEach(func() {
-			sqlToExecute = "FAKE SQL TO EXECUTE;"
+			externalDBConfig = &utils.ExternalDBConfig{
+				Type:       "postgres",
+				Host:       dbHost,
+				User:       dbUser,
+				Password:   dbPass,
+				DBName:     dbName,
+				CACertPath: "fake/ca_cert/path",
+			}
 		})
 
 		Context("ClientCertPath and ClientKeyPath are empty", func() {
-			BeforeEach(func() {
-				externalDBConfig = &utils.ExternalDBConfig{
-					Type:       dbType,
-					Host:       dbHost,
-					User:       dbUser,
-					Password:   dbPass,
-					DBName:     dbName,
-					CACertPath: "fake/ca_cert/path",
-				}
-			})
-
-			It("generates the expected args", func() {
-				expectedAgs := []string{
-					"-h",
-					dbHost,
-					fmt.Sprintf("--user=%s", dbUser),
-					fmt.Sprintf("--password=%s", dbPass),
-					"-e",
-					sqlToExecute,
-					"--ssl-ca=fake/ca_cert/path",
-					"--ssl-mode=VERIFY_IDENTITY",
-				}
-
-				Expect(utils.GenerateMySQLCommand(sqlToExecute, externalDBConfig)).To(Equal(expectedAgs))
+			It("verifies the server certificate names the host", func() {
+				Expect(externalDBConfig.DBConfig()).To(Equal(db.Config{
+					Type:         "postgres",
+					Host:         dbHost,
+					User:         dbUser,
+					Password:     dbPass,
+					CACertPath:   "fake/ca_cert/path",
+					Verification: db.VerifyFull,
+				}))
 			})
 		})
 
-		Context("ClientCertPath is empty", func() {
+		Context("ClientCertPath and ClientKeyPath are set", func() {
 			BeforeEach(func() {
-				externalDBConfig = &utils.ExternalDBConfig{
-					Type:          dbType,
-					Host:          dbHost,
-					User:          dbUser,
-					Password:      dbPass,
-					DBName:        dbName,
-					CACertPath:    "fake/ca_cert/path",
-					ClientKeyPath: "fake/client_key/path",
-				}
+				externalDBConfig.ClientCertPath = "fake/client_cert/path"
+				externalDBConfig.ClientKeyPath = "fake/client_key/path"
 			})
 
-			It("generates the expected args", func() {
-				expectedAgs := []string{
-					"-h",
-					dbHost,
-					fmt.Sprintf("--user=%s", dbUser),
-					fmt.Sprintf("--password=%s", dbPass),
-					"-e",
-					sqlToExecute,
-					"--ssl-ca=fake/ca_cert/path",
-					"--ssl-cert=",
-					"--ssl-key=fake/client_key/path",
-					"--ssl-mode=VERIFY_CA",
-				}
-
-				Expect(utils.GenerateMySQLCommand(sqlToExecute, externalDBConfig)).To(Equal(expectedAgs))
-			})
-		})
-
-		Context("ClientKeyPath is empty", func() {
-			BeforeEach(func() {
-				externalDBConfig = &utils.ExternalDBConfig{
-					Type:           dbType,
+			It("presents the client certificate and only verifies the server's chain", func() {
+				Expect(externalDBConfig.DBConfig()).To(Equal(db.Config{
+					Type:           "postgres",
 					Host:           dbHost,
 					User:           dbUser,
 					Password:       dbPass,
-					DBName:         dbName,
 					CACertPath:     "fake/ca_cert/path",
 					ClientCertPath: "fake/client_cert/path",
-				}
-			})
-
-			It("generates the expected args", func() {
-				expectedAgs := []string{
-					"-h",
-					dbHost,
-					fmt.Sprintf("--user=%s", dbUser),
-					fmt.Sprintf("--password=%s", dbPass),
-					"-e",
-					sqlToExecute,
-					"--ssl-ca=fake/ca_cert/path",
-					"--ssl-cert=fake/client_cert/path",
-					"--ssl-key=",
-					"--ssl-mode=VERIFY_CA",
-				}
-
-				Expect(utils.GenerateMySQLCommand(sqlToExecute, externalDBConfig)).To(Equal(expectedAgs))
+					ClientKeyPath:  "fake/client_key/path",
+					Verification:   db.VerifyCA,
+				}))
 			})
 		})
-	})
-
-	Context("GeneratePSQLCommand", func() {
-		var externalDBConfig *utils.ExternalDBConfig
-		var dbType = "postgres"
-
-		var sqlToExecute string
-
-		BeforeEach(func() {
-			dbName = "fake-db-name"
-			sqlToExecute = "FAKE SQL TO EXECUTE;"
-		})
 
-		Context("ClientCertPath and ClientKeyPath are empty", func() {
+		Context("only ClientKeyPath is set", func() {
 			BeforeEach(func() {
-				externalDBConfig = &utils.ExternalDBConfig{
-					Type:       dbType,
-					Host:       dbHost,
-					User:       dbUser,
-					Password:   dbPass,
-					DBName:     dbName,
-					CACertPath: "fake/ca_cert/path",
-				}
+				externalDBConfig.ClientKeyPath = "fake/client_key/path"
 			})
 
-			It("generates the expected args", func() {
-				expectedAgs := []string{
-					fmt.Sprintf(
-						"dbname=%s host=%s user=%s password=%s sslrootcert=%s sslmode=verify-full ",
-						dbType, dbHost, dbUser, dbPass, "fake/ca_cert/path",
-					),
-					"-c",
-					sqlToExecute,
-				}
-
-				Expect(utils.GeneratePSQLCommand(sqlToExecute, externalDBConfig)).To(Equal(expectedAgs))
-			})
-		})
-
-		Context("ClientCertPath is empty", func() {
-			BeforeEach(func() {
-				externalDBConfig = &utils.ExternalDBConfig{
-					Type:          dbType,
-					Host:          dbHost,
-					User:          dbUser,
-					Password:      dbPass,
-					DBName:        dbName,
-					CACertPath:    "fake/ca_cert/path",
-					ClientKeyPath: "fake/client_key/path",
-				}
-			})
-
-			It("generates the expected args", func() {
-				expectedAgs := []string{
-					fmt.Sprintf(
-						"dbname=%s host=%s user=%s password=%s sslrootcert=%s sslcert= sslkey=%s sslmode=verify-ca ",
-						dbType, dbHost, dbUser, dbPass, "fake/ca_cert/path", "fake/client_key/path",
-					),
-					"-c",
-					sqlToExecute,
-				}
-
-				Expect(utils.GeneratePSQLCommand(sqlToExecute, externalDBConfig)).To(Equal(expectedAgs))
-			})
-		})
-
-		Context("ClientKeyPath is empty", func() {
-			BeforeEach(func() {
-				externalDBConfig = &utils.ExternalDBConfig{
-					Type:           dbType,
-					Host:           dbHost,
-					User:           dbUser,
-					Password:       dbPass,
-					DBName:         dbName,
-					CACertPath:     "fake/ca_cert/path",
-					ClientCertPath: "fake/client_cert/path",
-				}
-			})
-
-			It("generates the expected args", func() {
-				expectedAgs := []string{
-					fmt.Sprintf(
-						"dbname=%s host=%s user=%s password=%s sslrootcert=%s sslcert=%s sslkey= sslmode=verify-ca ",
-						dbType, dbHost, dbUser, dbPass, "fake/ca_cert/path", "fake/client_cert/path",
-					),
-					"-c",
-					sqlToExecute,
-				}
-
-				Expect(utils.GeneratePSQLCommand(sqlToExecute, externalDBConfig)).To(Equal(expectedAgs))
+			It("still only verifies the server's chain", func() {
+				Expect(externalDBConfig.DBConfig().Verification).To(Equal(db.VerifyCA))
 			})
 		})
 	})
@@ -346,18 +213,42 @@ var _ = Describe("Utils", func() {
 				"-o", utils.BoshDeploymentAssetPath("experimental/db-enable-tls.yml"),
 				"-o", utils.AssetPath(connectionOptionsFile),
 				"--vars-file", utils.AssetPath(connectionVarsFile),
-				fmt.Sprintf("--var=db_ca=%s", filepath.Join(certTmpDir, "db_ca")),
+				fmt.Sprintf("--var-file=db_ca=%s", filepath.Join(certTmpDir, "db_ca")),
 				"-v", fmt.Sprintf("external_db_host=%s", dbHost),
 				"-v", fmt.Sprintf("external_db_user=%s", dbUser),
 				"-v", fmt.Sprintf("external_db_password=%s", dbPass),
 				"-v", fmt.Sprintf("external_db_name=%s", dbName),
 				fmt.Sprintf("-o %s", utils.BoshDeploymentAssetPath("experimental/db-enable-mutual-tls.yml")),
 				fmt.Sprintf("-o %s", utils.AssetPath("tls-skip-host-verify.yml")),
-				fmt.Sprintf("--var=db_client_certificate=%s", filepath.Join(certTmpDir, "client_cert")),
-				fmt.Sprintf("--var=db_client_private_key=%s", filepath.Join(certTmpDir, "client_key")),
+				fmt.Sprintf("--var-file=db_client_certificate=%s", filepath.Join(certTmpDir, "client_cert")),
+				fmt.Sprintf("--var-file=db_client_private_key=%s", filepath.Join(certTmpDir, "client_key")),
 			}
 
 			Expect(utils.InnerBoshWithExternalDBOptions(externalDBConfig)).To(Equal(expectedAgs))
 		})
+
+		It("passes the certificates' contents rather than their paths", func() {
+			options := utils.InnerBoshWithExternalDBOptions(externalDBConfig)
+			Expect(options).To(ContainElements(
+				HavePrefix("--var-file=db_ca="),
+				HavePrefix("--var-file=db_client_certificate="),
+				HavePrefix("--var-file=db_client_private_key="),
+			))
+			Expect(options).NotTo(ContainElement(HavePrefix("--var=")))
+		})
+
+		Context("when the port is set", func() {
+			BeforeEach(func() {
+				externalDBConfig.Port = 15432
+				externalDBConfig.ClientCertPath = ""
+				externalDBConfig.ClientKeyPath = ""
+			})
+
+			It("overrides the port of the connection vars file", func() {
+				options := utils.InnerBoshWithExternalDBOptions(externalDBConfig)
+				Expect(options).To(HaveLen(19))
+				Expect(options[17:]).To(Equal([]string{"-v", "external_db_port=15432"}))
+			})
+		})
 	})
 })